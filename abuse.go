@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ventanas de las heurísticas de abuso
+const (
+	abuseRepeatWindow  = 10 * time.Minute // Mismo enlace una y otra vez
+	abuseInvalidWindow = 10 * time.Minute // Mensajes sin enlace válido
+	abuseStrikeWindow  = 24 * time.Hour   // Reincidencias que alargan el bloqueo
+)
+
+// allowLink aplica las heurísticas de abuso a un enlace recibido: demasiados
+// enlaces por minuto o el mismo enlace repetido muchas veces bloquean al
+// usuario un rato. Devuelve false si el enlace no se debe procesar.
+func (b *DownloadBot) allowLink(message *tgbotapi.Message, rawURL string) bool {
+	if message.From == nil || b.cfg().isAdmin(message.From.ID) {
+		return true
+	}
+	userID := message.From.ID
+	if b.softBanned(message) {
+		return false
+	}
+	if limit := b.cfg().AbuseLinksPerMinute; limit > 0 && b.state.Incr(fmt.Sprintf("abuse:links:%d", userID), time.Minute) > limit {
+		b.softBan(message, fmt.Sprintf("más de %d enlaces por minuto", limit))
+		return false
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	urlID := hex.EncodeToString(sum[:8])
+	if limit := b.cfg().AbuseRepeatLimit; limit > 0 && b.state.Incr(fmt.Sprintf("abuse:same:%d:%s", userID, urlID), abuseRepeatWindow) > limit {
+		b.softBan(message, fmt.Sprintf("el mismo enlace más de %d veces", limit))
+		return false
+	}
+	return true
+}
+
+// noteInvalidLink cuenta los mensajes sin enlace válido: una avalancha de
+// ellos también bloquea. Devuelve false si el usuario está bloqueado y no
+// se le debe responder.
+func (b *DownloadBot) noteInvalidLink(message *tgbotapi.Message) bool {
+	if message.From == nil || b.cfg().isAdmin(message.From.ID) {
+		return true
+	}
+	if b.softBanned(message) {
+		return false
+	}
+	if limit := b.cfg().AbuseInvalidLimit; limit > 0 && b.state.Incr(fmt.Sprintf("abuse:invalid:%d", message.From.ID), abuseInvalidWindow) > limit {
+		b.softBan(message, fmt.Sprintf("más de %d mensajes sin enlace válido", limit))
+		return false
+	}
+	return true
+}
+
+// softBanned indica si el usuario está bloqueado temporalmente. Se le avisó
+// al bloquearlo: mientras dure, sus mensajes se ignoran en silencio.
+func (b *DownloadBot) softBanned(message *tgbotapi.Message) bool {
+	return b.state.Count(fmt.Sprintf("abuse:ban:%d", message.From.ID)) > 0
+}
+
+// softBan bloquea al usuario durante ABUSE_BAN_DURATION, multiplicado por
+// las veces que ha reincidido en el día, y avisa a los administradores.
+func (b *DownloadBot) softBan(message *tgbotapi.Message, reason string) {
+	userID := message.From.ID
+	strikes := b.state.Incr(fmt.Sprintf("abuse:strikes:%d", userID), abuseStrikeWindow)
+	duration := b.cfg().AbuseBanDuration * time.Duration(strikes)
+	b.state.Incr(fmt.Sprintf("abuse:ban:%d", userID), duration)
+
+	log.Printf("🚨 Usuario %d bloqueado %s por abuso: %s", userID, duration, reason)
+	b.sendReply(message.Chat.ID, message.MessageID, fmt.Sprintf("🚨 *Demasiadas peticiones.*\n\nNo podrás usar el bot durante %d min. Si crees que es un error, usa /report cuando acabe.",
+		int(duration.Minutes())))
+	name := message.From.FirstName
+	if message.From.UserName != "" {
+		name += " @" + message.From.UserName
+	}
+	b.notifyAdmin(fmt.Sprintf("🚨 Bloqueo temporal por abuso\n\n👤 %s (`%d`)\n🔎 Motivo: %s\n⏱ Duración: %d min (reincidencia %d)",
+		escapeMarkdown(name), userID, escapeMarkdown(reason), int(duration.Minutes()), strikes))
+}
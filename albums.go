@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Pistas que se listan como botones en el menú de un álbum
+const maxAlbumButtons = 20
+
+// Enlaces de fuentes con varias pistas: sets de SoundCloud y álbumes de Bandcamp
+var albumURLPattern = regexp.MustCompile(`^https?://(?:(?:www|m)\.)?(?:soundcloud\.com/[^/]+/sets/[^/?#]+|[\w-]+\.bandcamp\.com/album/[^/?#]+)`)
+
+// albumInfo es la lista de pistas de un set o álbum (yt-dlp --flat-playlist).
+type albumInfo struct {
+	Title     string `json:"title"`
+	Uploader  string `json:"uploader"`
+	Thumbnail string `json:"thumbnail"`
+	URL       string `json:"webpage_url"`
+	Entries   []struct {
+		ID       string  `json:"id"`
+		Title    string  `json:"title"`
+		URL      string  `json:"url"`
+		Duration float64 `json:"duration"`
+		Uploader string  `json:"uploader"`
+	} `json:"entries"`
+}
+
+func isAlbumURL(rawURL string) bool {
+	return albumURLPattern.MatchString(rawURL)
+}
+
+func (b *DownloadBot) fetchAlbum(rawURL string) (*albumInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().ProbeTimeout)
+	defer cancel()
+
+	output, err := b.ytdlpCommand(ctx, rawURL, "-J", "--flat-playlist", rawURL).Output()
+	if err != nil {
+		log.Printf("Error yt-dlp (álbum): %v", err)
+		if timedOut(ctx) {
+			return nil, errors.New("⏱️ El sitio tardó demasiado en responder. Inténtalo de nuevo en unos minutos.")
+		}
+		return nil, errors.New("❌ No se pudo leer la lista de pistas. Verifica que sea pública.")
+	}
+	var album albumInfo
+	if err := json.Unmarshal(output, &album); err != nil || len(album.Entries) == 0 {
+		return nil, errors.New("❌ El álbum no tiene pistas disponibles.")
+	}
+	if album.URL == "" {
+		album.URL = rawURL
+	}
+	return &album, nil
+}
+
+// processAlbum muestra el menú de pistas de un set o álbum.
+func (b *DownloadBot) processAlbum(key sessionKey, msgID, replyTo int, rawURL string) {
+	album, err := b.fetchAlbum(rawURL)
+	if err != nil {
+		b.editMessage(key.ChatID, msgID, err.Error())
+		return
+	}
+
+	meta := &VideoMetaData{Title: album.Title, WebpageURL: album.URL, Uploader: album.Uploader, Thumbnail: album.Thumbnail}
+	b.state.SaveSession(key, &UserSession{Meta: meta, MsgID: msgID, ReplyTo: replyTo, Album: album})
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	// El álbum completo es una ventaja premium; las pistas sueltas, de todos
+	premium := b.hasPremiumPerks(key.UserID)
+	if premium {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⬇️ Descargar todo (%d pistas)", len(album.Entries)), "album:all"),
+		))
+	}
+	for i, entry := range album.Entries {
+		if i >= maxAlbumButtons {
+			break
+		}
+		label := fmt.Sprintf("🎵 %d. %s", i+1, entry.Title)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "album:"+strconv.Itoa(i)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Cancelar", "cancel"),
+	))
+
+	text := fmt.Sprintf("💿 *%s*\n👤 %s\n\nElige una pista o descarga el álbum completo:", escapeMarkdown(album.Title), escapeMarkdown(album.Uploader))
+	if !premium {
+		text = fmt.Sprintf("💿 *%s*\n👤 %s\n\nElige una pista. 💎 Con /premium puedes descargar el álbum completo de una vez.", escapeMarkdown(album.Title), escapeMarkdown(album.Uploader))
+	}
+	if len(album.Entries) > maxAlbumButtons {
+		text += fmt.Sprintf("\n\n_Se muestran las primeras %d pistas._", maxAlbumButtons)
+	}
+	b.editMessageMarkup(key.ChatID, msgID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// handleAlbumCallback descarga la pista elegida ("album:<índice>") o todas ("album:all").
+func (b *DownloadBot) handleAlbumCallback(key sessionKey, sess *UserSession, choice string) {
+	album := sess.Album
+	if album == nil {
+		return
+	}
+	var tracks []int
+	if choice == "all" {
+		if !b.hasPremiumPerks(key.UserID) {
+			return // El botón no se ofrece sin premium
+		}
+		for i := range album.Entries {
+			tracks = append(tracks, i)
+		}
+	} else {
+		i, err := strconv.Atoi(choice)
+		if err != nil || i < 0 || i >= len(album.Entries) {
+			return
+		}
+		tracks = []int{i}
+	}
+	b.state.DeleteSession(key)
+
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	defer b.finishUsageJob(job)
+
+	// La miniatura del álbum sirve de portada para todas las pistas
+	fileBase := fmt.Sprintf("album_%d_%d_%d", key.ChatID, key.UserID, time.Now().Unix())
+	thumbPath := b.downloadThumbnail(key.ChatID, sess.Meta, fileBase)
+	if thumbPath != "" {
+		defer os.Remove(thumbPath)
+	}
+
+	failed := 0
+	for n, i := range tracks {
+		b.editMessage(key.ChatID, sess.MsgID, fmt.Sprintf("💿 *%s*\n\nPista %d de %d...", escapeMarkdown(album.Title), n+1, len(tracks)))
+		size, err := b.sendAlbumTrack(key.ChatID, sess.MsgID, sess.ReplyTo, album, i, fileBase, thumbPath)
+		if err != nil {
+			log.Printf("Error con la pista %d de %s: %v", i+1, album.URL, err)
+			failed++
+		}
+		job.bytes += size
+	}
+
+	job.ok = failed < len(tracks)
+	if failed > 0 {
+		b.editMessage(key.ChatID, sess.MsgID, fmt.Sprintf("⚠️ *%s*\n\nSe enviaron %d de %d pistas.", escapeMarkdown(album.Title), len(tracks)-failed, len(tracks)))
+		return
+	}
+	b.deleteMessage(key.ChatID, sess.MsgID)
+}
+
+// sendAlbumTrack descarga, etiqueta y envía una pista; devuelve los bytes enviados.
+func (b *DownloadBot) sendAlbumTrack(chatID int64, msgID, replyTo int, album *albumInfo, index int, fileBase, thumbPath string) (int64, error) {
+	entry := album.Entries[index]
+	uploader := entry.Uploader
+	if uploader == "" {
+		uploader = album.Uploader
+	}
+	meta := &VideoMetaData{
+		ID:         entry.ID,
+		Title:      entry.Title,
+		Duration:   entry.Duration,
+		WebpageURL: entry.URL,
+		Uploader:   uploader,
+	}
+
+	path, err := b.downloadMedia(chatID, msgID, meta, "audio", "best", downloadOptions{}, fmt.Sprintf("%s_%d", fileBase, index+1))
+	var tooLarge *fileTooLargeError
+	if errors.As(err, &tooLarge) {
+		os.Remove(tooLarge.Path)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(path)
+
+	if err := tagAlbumTrack(path, album.Title, uploader, entry.Title, index+1, len(album.Entries)); err != nil {
+		log.Printf("⚠️ No se pudieron escribir las etiquetas de la pista: %v", err)
+	}
+
+	target := uploadTarget{
+		ChatID:  chatID,
+		ReplyTo: replyTo,
+		Caption: fmt.Sprintf("💿 %s · %d/%d", album.Title, index+1, len(album.Entries)),
+	}
+	if _, err := b.uploadFile(target, path, thumbPath, "audio", meta); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, nil
+	}
+	return info.Size(), nil
+}
+
+// tagAlbumTrack escribe álbum, artista, título y número de pista en el MP3.
+func tagAlbumTrack(path, album, artist, title string, track, total int) error {
+	tagged := path + ".tagged" + filepath.Ext(path)
+	cmd := exec.Command(ffmpegBin, "-y", "-i", path, "-c", "copy",
+		"-metadata", "album="+album,
+		"-metadata", "artist="+artist,
+		"-metadata", "title="+title,
+		"-metadata", fmt.Sprintf("track=%d/%d", track, total),
+		tagged)
+	if err := cmd.Run(); err != nil {
+		os.Remove(tagged)
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(tagged, path)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ritmo de los anuncios: Telegram admite unos 30 mensajes/s en total, se deja margen
+const (
+	announceBatchSize     = 25
+	announceBatchInterval = time.Second
+)
+
+// Cada cuánto se actualiza el "último visto" de un usuario en disco
+const userSeenResolution = 24 * time.Hour
+
+// Cuánto espera un anuncio a ser confirmado
+const announceConfirmTTL = 30 * time.Minute
+
+// KnownUser es un usuario que ha hablado con el bot en privado: los
+// destinatarios de los anuncios.
+type KnownUser struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// El usuario bloqueó el bot o borró su cuenta: no se le envían anuncios
+	// hasta que vuelva a escribir
+	Unreachable bool `json:"unreachable,omitempty"`
+}
+
+// pendingAnnouncement es un anuncio con la vista previa enviada, a la espera
+// de que el administrador lo confirme.
+type pendingAnnouncement struct {
+	Text    string
+	AdminID int64
+	Created time.Time
+}
+
+var pendingAnnouncements sync.Map // id -> pendingAnnouncement
+
+// backfillUsers añade a los destinatarios de los anuncios a quienes ya
+// usaban el bot antes de que existiera la lista (por su uso, historial,
+// ajustes o invitaciones). Los que no tengan chat privado con el bot se
+// marcan como inalcanzables en el primer anuncio.
+func (d *storeData) backfillUsers() {
+	known := make(map[int64]bool, len(d.Users))
+	for id := range d.Users {
+		known[id] = true
+	}
+	add := func(id int64, seen time.Time) {
+		if id <= 0 || known[id] {
+			return // Grupos, canales, las descargas de la API y los ya apuntados
+		}
+		user := d.Users[id]
+		if user.FirstSeen.IsZero() || (!seen.IsZero() && seen.Before(user.FirstSeen)) {
+			user.FirstSeen = seen
+		}
+		if seen.After(user.LastSeen) {
+			user.LastSeen = seen
+		}
+		d.Users[id] = user
+	}
+	for month, users := range d.Usage {
+		at, _ := time.Parse(usageMonthLayout, month)
+		for id := range users {
+			add(id, at)
+		}
+	}
+	for id, last := range d.LastDownloads {
+		add(id, last.At)
+	}
+	for id := range d.Settings {
+		add(id, time.Time{})
+	}
+	for id, referral := range d.Referrals {
+		add(id, referral.At)
+	}
+	for key, entry := range d.Archive {
+		// Las claves del historial empiezan por el chat: "<chat>:..."
+		if chat, _, ok := strings.Cut(key, ":"); ok {
+			if id, err := strconv.ParseInt(chat, 10, 64); err == nil {
+				add(id, entry.SentAt)
+			}
+		}
+	}
+}
+
+// storePendingAnnouncement guarda el anuncio a confirmar y olvida los que
+// caducaron sin que nadie los confirmara.
+func storePendingAnnouncement(id string, announcement pendingAnnouncement) {
+	pendingAnnouncements.Range(func(key, val any) bool {
+		if time.Since(val.(pendingAnnouncement).Created) > announceConfirmTTL {
+			pendingAnnouncements.Delete(key)
+		}
+		return true
+	})
+	pendingAnnouncements.Store(id, announcement)
+}
+
+// recordUser apunta al usuario como destinatario de los anuncios. Solo se
+// escribe a disco si es nuevo, vuelve tras bloquear el bot o hace más de
+// userSeenResolution que no se actualizaba.
+func (s *Store) recordUser(userID int64, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.data.Users[userID]
+	if ok && !user.Unreachable && at.Sub(user.LastSeen) < userSeenResolution {
+		return
+	}
+	if !ok {
+		user.FirstSeen = at
+	}
+	user.LastSeen = at
+	user.Unreachable = false
+	s.data.Users[userID] = user
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando usuarios: %v", err)
+	}
+}
+
+func (s *Store) markUnreachable(userIDs []int64) {
+	if len(userIDs) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range userIDs {
+		if user, ok := s.data.Users[id]; ok {
+			user.Unreachable = true
+			s.data.Users[id] = user
+		}
+	}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando usuarios: %v", err)
+	}
+}
+
+// announcementRecipients devuelve los usuarios que pueden recibir anuncios y
+// cuántos los han desactivado con /notifications.
+func (s *Store) announcementRecipients() (recipients []int64, optedOut int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, user := range s.data.Users {
+		if user.Unreachable {
+			continue
+		}
+		if settings, ok := s.data.Settings[id]; ok && settings.MuteAnnouncements {
+			optedOut++
+			continue
+		}
+		recipients = append(recipients, id)
+	}
+	return recipients, optedOut
+}
+
+// userGone reconoce los errores de envío que indican que el usuario ya no
+// puede recibir mensajes del bot.
+func userGone(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "bot was blocked by the user") ||
+		strings.Contains(msg, "user is deactivated") ||
+		strings.Contains(msg, "chat not found") ||
+		strings.Contains(msg, "bot can't initiate conversation")
+}
+
+// handleNotificationsCommand activa o desactiva los anuncios del bot:
+// /notifications [on|off]. Sin argumento cambia el estado actual.
+func (b *DownloadBot) handleNotificationsCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil {
+		return
+	}
+	arg := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	settings := b.store.updateUserSettings(message.From.ID, func(s *UserSettings) {
+		switch arg {
+		case "on":
+			s.MuteAnnouncements = false
+		case "off":
+			s.MuteAnnouncements = true
+		default:
+			s.MuteAnnouncements = !s.MuteAnnouncements
+		}
+	})
+	if settings.MuteAnnouncements {
+		b.sendReply(chatID, message.MessageID, "🔕 Ya no recibirás anuncios del bot. Usa /notifications on para volver a activarlos.")
+		return
+	}
+	b.sendReply(chatID, message.MessageID, "🔔 Recibirás los anuncios del bot (novedades, mantenimientos...). Usa /notifications off para desactivarlos.")
+}
+
+// announcementText es el mensaje tal como lo reciben los usuarios.
+func announcementText(text string) string {
+	return "📣 " + text + "\n\n_🔕 /notifications off para no recibir más anuncios_"
+}
+
+// handleAnnounceCommand prepara un anuncio para todos los usuarios:
+// /announce <texto en Markdown>. Se envía primero una vista previa al
+// administrador, que lo confirma o lo cancela con los botones.
+func (b *DownloadBot) handleAnnounceCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		b.sendReply(chatID, message.MessageID, "📣 Uso: /announce <mensaje>\n\nAdmite Markdown. Verás una vista previa antes de enviarlo.")
+		return
+	}
+
+	id := randomToken(4)
+	recipients, optedOut := b.store.announcementRecipients()
+	preview := tgbotapi.NewMessage(chatID, announcementText(text))
+	preview.ParseMode = "Markdown"
+	preview.DisableWebPagePreview = true
+	preview.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("✅ Enviar a %d usuarios", len(recipients)), "ann:send:"+id),
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancelar", "ann:cancel:"+id),
+		),
+	)
+	if _, err := b.bot.Send(preview); err != nil {
+		b.sendReply(chatID, message.MessageID, "❌ El anuncio no se pudo mostrar; revisa el formato Markdown.")
+		return
+	}
+	storePendingAnnouncement(id, pendingAnnouncement{Text: text, AdminID: message.From.ID, Created: time.Now()})
+	if optedOut > 0 {
+		b.sendMessage(chatID, fmt.Sprintf("👆 Vista previa. %d usuarios tienen los anuncios desactivados y no lo recibirán.", optedOut))
+	}
+}
+
+// handleAnnounceCallback confirma o cancela un anuncio: "ann:<send|cancel>:<id>"
+func (b *DownloadBot) handleAnnounceCallback(cb *tgbotapi.CallbackQuery) {
+	if !b.cfg().isAdmin(cb.From.ID) {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "⛔ Solo para administradores."))
+		return
+	}
+	parts := strings.Split(cb.Data, ":")
+	if len(parts) != 3 {
+		return
+	}
+	chatID, msgID := cb.Message.Chat.ID, cb.Message.MessageID
+	val, ok := pendingAnnouncements.LoadAndDelete(parts[2])
+	if !ok || time.Since(val.(pendingAnnouncement).Created) > announceConfirmTTL {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Este anuncio ya se envió o ha caducado."))
+		b.bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, msgID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		return
+	}
+	b.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+	b.bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, msgID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	if parts[1] != "send" {
+		b.sendReply(chatID, msgID, "❌ Anuncio cancelado.")
+		return
+	}
+	announcement := val.(pendingAnnouncement)
+	log.Printf("📣 Anuncio confirmado por %d", cb.From.ID)
+	go b.deliverAnnouncement(chatID, msgID, announcement)
+}
+
+// deliverAnnouncement envía el anuncio por lotes para no pasar del límite
+// global de Telegram, informa del progreso al administrador y termina con
+// las estadísticas de entrega.
+func (b *DownloadBot) deliverAnnouncement(adminChat int64, previewID int, announcement pendingAnnouncement) {
+	recipients, _ := b.store.announcementRecipients()
+	status, _ := b.bot.Send(tgbotapi.NewMessage(adminChat, fmt.Sprintf("📣 Enviando anuncio a %d usuarios...", len(recipients))))
+
+	text := announcementText(announcement.Text)
+	started := time.Now()
+	var sent, failed int
+	var gone []int64
+	for start := 0; start < len(recipients); start += announceBatchSize {
+		batchStart := time.Now()
+		end := min(start+announceBatchSize, len(recipients))
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for _, userID := range recipients[start:end] {
+			wg.Add(1)
+			go func(userID int64) {
+				defer wg.Done()
+				msg := tgbotapi.NewMessage(userID, text)
+				msg.ParseMode = "Markdown"
+				msg.DisableWebPagePreview = true
+				_, err := b.bot.Send(msg)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil:
+					sent++
+				case userGone(err):
+					gone = append(gone, userID)
+				default:
+					failed++
+				}
+			}(userID)
+		}
+		wg.Wait()
+
+		if status.MessageID != 0 {
+			b.editMessage(adminChat, status.MessageID, fmt.Sprintf("📣 Enviando anuncio... %d/%d", end, len(recipients)))
+		}
+		if wait := announceBatchInterval - time.Since(batchStart); wait > 0 && end < len(recipients) {
+			time.Sleep(wait)
+		}
+	}
+	b.store.markUnreachable(gone)
+
+	log.Printf("📣 Anuncio entregado: %d enviados, %d bloqueados, %d errores", sent, len(gone), failed)
+	report := fmt.Sprintf("📣 *Anuncio enviado*\n\n✅ Entregados: %d\n🚫 Bot bloqueado o cuenta borrada: %d\n⚠️ Errores: %d\n⏱ Duración: %s",
+		sent, len(gone), failed, time.Since(started).Round(time.Second))
+	if status.MessageID != 0 {
+		b.editMessage(adminChat, status.MessageID, report)
+		return
+	}
+	b.sendReply(adminChat, previewID, report)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Cuánto se recuerda el estado de una descarga de la API
+const apiJobTTL = 24 * time.Hour
+
+// Las descargas de la API comparten una fila del scheduler, como un chat más:
+// van de una en una y no acaparan los huecos de los usuarios de Telegram.
+const apiChatID = 0
+
+// Estados de una descarga de la API
+const (
+	apiJobQueued  = "queued"
+	apiJobRunning = "running"
+	apiJobDone    = "done"
+	apiJobFailed  = "failed"
+)
+
+var (
+	apiJobIDPattern  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	videoHeightRegex = regexp.MustCompile(`^\d{3,4}$`)
+)
+
+// Calidad cuando la petición (API o -cli) no indica ninguna
+var defaultQualities = map[string]string{"video": "720", "audio": "mp3"}
+
+// apiJob es una descarga pedida por la API REST, tal como la ve el cliente.
+type apiJob struct {
+	ID      string     `json:"id"`
+	URL     string     `json:"url"`
+	Mode    string     `json:"mode"`
+	Quality string     `json:"quality"`
+	Status  string     `json:"status"`
+	Title   string     `json:"title,omitempty"`
+	FileURL string     `json:"file_url,omitempty"`
+	Size    int64      `json:"size,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"` // Caducidad de file_url; nil = no caduca
+	Error   string     `json:"error,omitempty"`
+	Created time.Time  `json:"created"`
+	Updated time.Time  `json:"updated"`
+}
+
+type apiDownloadRequest struct {
+	URL     string `json:"url"`
+	Mode    string `json:"mode"`    // "video" (por defecto) o "audio"
+	Quality string `json:"quality"` // Altura del video ("720") o formato/tasa del audio ("mp3", "192")
+}
+
+func (b *DownloadBot) registerAPI() {
+	http.HandleFunc("POST /downloads", b.apiAuth(b.apiCreateDownload))
+	http.HandleFunc("GET /downloads/{id}", b.apiAuth(b.apiGetDownload))
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// apiAuth exige "Authorization: Bearer <clave>" con una de API_KEYS. Sin
+// claves configuradas la API no existe.
+func (b *DownloadBot) apiAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := b.cfg().APIKeys
+		if len(keys) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		valid := false
+		for _, key := range keys {
+			if found && subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				valid = true
+			}
+		}
+		if !valid {
+			writeAPIError(w, http.StatusUnauthorized, "clave de API inválida")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validQuality comprueba que la calidad tenga sentido para el modo.
+func validQuality(mode, quality string) bool {
+	if mode == "video" {
+		return quality == "fit" || videoHeightRegex.MatchString(quality)
+	}
+	_, bitrate := audioBitrate(quality)
+	return bitrate || quality == "native" || slices.Contains(audioFormats, quality)
+}
+
+// apiCreateDownload encola una descarga: POST /downloads
+func (b *DownloadBot) apiCreateDownload(w http.ResponseWriter, r *http.Request) {
+	var req apiDownloadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "JSON inválido")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = "video"
+	}
+	if req.Quality == "" {
+		req.Quality = defaultQualities[req.Mode]
+	}
+	if (req.Mode != "video" && req.Mode != "audio") || !validQuality(req.Mode, req.Quality) {
+		writeAPIError(w, http.StatusBadRequest, "mode debe ser video o audio, con una quality válida para ese modo")
+		return
+	}
+	if notice, paused := b.inMaintenance(0); paused {
+		writeAPIError(w, http.StatusServiceUnavailable, notice)
+		return
+	}
+	url := resolveSiteLink(b.rewriteURL(expandShortLink(strings.TrimSpace(req.URL))))
+	if err := b.validateLink(url); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	job := &apiJob{
+		ID:      randomToken(8),
+		URL:     url,
+		Mode:    req.Mode,
+		Quality: req.Quality,
+		Status:  apiJobQueued,
+		Created: now,
+		Updated: now,
+	}
+	b.state.SaveAPIJob(job)
+	b.dispatchAPIDownload(job.ID)
+	log.Printf("🔌 Descarga %s pedida por la API: %s (%s %s)", job.ID, url, job.Mode, job.Quality)
+
+	w.Header().Set("Location", "/downloads/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// apiGetDownload devuelve el estado y, al terminar, el enlace al archivo: GET /downloads/{id}
+func (b *DownloadBot) apiGetDownload(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !apiJobIDPattern.MatchString(id) {
+		writeAPIError(w, http.StatusNotFound, "descarga no encontrada")
+		return
+	}
+	job, ok := b.state.LoadAPIJob(id)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "descarga no encontrada")
+		return
+	}
+	writeJSON(w, job)
+}
+
+// dispatchAPIDownload usa la misma cola que las descargas de Telegram: los
+// workers si los hay y, si no (o si Redis falla), el scheduler de este proceso.
+// Sin almacenamiento externo el archivo se sirve desde /files/ de este
+// proceso, así que tiene que descargarse aquí y no en un worker.
+func (b *DownloadBot) dispatchAPIDownload(id string) {
+	if b.queue != nil && b.remote != nil {
+		err := b.queue.push(downloadJob{API: id})
+		if err == nil {
+			return
+		}
+		log.Printf("⚠️ No se pudo encolar la descarga de la API, se hace localmente: %v", err)
+	}
+	wait := func() bool {
+		if b.waitForDisk(sessionKey{ChatID: apiChatID, UserID: apiChatID}, &UserSession{}, 0) {
+			return true
+		}
+		if job, ok := b.state.LoadAPIJob(id); ok {
+			job.Status, job.Error, job.Updated = apiJobFailed, "sin espacio en disco", time.Now()
+			b.state.SaveAPIJob(job)
+		}
+		return false
+	}
+	b.scheduler.submitAfter(apiChatID, priorityFree, wait, func() { b.runAPIDownload(id) }, func(int) {})
+}
+
+// runAPIDownload descarga y publica el archivo de una descarga de la API. Sin
+// límite de tamaño de Telegram: el resultado siempre se entrega por enlace.
+func (b *DownloadBot) runAPIDownload(id string) {
+	job, ok := b.state.LoadAPIJob(id)
+	if !ok {
+		log.Printf("⚠️ Descarga %s de la API caducada antes de empezar", id)
+		return
+	}
+	fail := func(err error) {
+		log.Printf("❌ Descarga %s de la API fallida: %v", id, err)
+		job.Status, job.Error, job.Updated = apiJobFailed, err.Error(), time.Now()
+		b.state.SaveAPIJob(job)
+	}
+	usage := b.beginDownload(sessionKey{ChatID: apiChatID, UserID: apiChatID}, &UserSession{}, 0)
+	if usage == nil {
+		fail(errors.New("límite diario de descarga de la API alcanzado"))
+		return
+	}
+	defer b.finishUsageJob(usage)
+	job.Status, job.Updated = apiJobRunning, time.Now()
+	b.state.SaveAPIJob(job)
+
+	meta, path, err := b.downloadStandalone(apiChatID, job.URL, job.Mode, job.Quality, "api_"+id)
+	if meta != nil {
+		job.Title = meta.Title
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer os.Remove(path)
+	if info, err := os.Stat(path); err == nil {
+		job.Size = info.Size()
+		usage.downloaded = info.Size()
+	}
+
+	link, ttl, err := b.publishFile(path)
+	if err != nil {
+		fail(fmt.Errorf("❌ No se pudo publicar el archivo: %w", err))
+		return
+	}
+	usage.ok = true
+	job.Status, job.FileURL, job.Updated = apiJobDone, link, time.Now()
+	if ttl > 0 {
+		expires := job.Updated.Add(ttl)
+		job.Expires = &expires
+	}
+	b.state.SaveAPIJob(job)
+	log.Printf("🔌 Descarga %s de la API lista: %s", id, link)
+}
+
+// publishFile deja el archivo accesible por enlace: en el almacenamiento
+// externo si lo hay o servido por el propio bot (/files/).
+func (b *DownloadBot) publishFile(path string) (string, time.Duration, error) {
+	if b.remote == nil {
+		link, err := b.serveLarge(path)
+		return link, b.cfg().ServedFileTTL, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), offloadUploadTimeout)
+	defer cancel()
+	link, err := b.remote.Upload(ctx, path, randomToken(16)+"/"+filepath.Base(path))
+	return link, b.remote.LinkTTL(), err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIAuth(t *testing.T) {
+	b := &DownloadBot{}
+	b.config.Store(&Config{APIKeys: []string{"Kx9-QrT2mZ", "otraclave"}})
+	handler := b.apiAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"clave con mayúsculas", "Bearer Kx9-QrT2mZ", http.StatusNoContent},
+		{"segunda clave", "Bearer otraclave", http.StatusNoContent},
+		{"mayúsculas cambiadas", "Bearer kx9-qrt2mz", http.StatusUnauthorized},
+		{"sin Bearer", "Kx9-QrT2mZ", http.StatusUnauthorized},
+		{"sin cabecera", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/download", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Authorization %q: estado %d, quiero %d", tt.header, rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIAuthWithoutKeys(t *testing.T) {
+	b := &DownloadBot{}
+	b.config.Store(&Config{})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/download", nil)
+	req.Header.Set("Authorization", "Bearer cualquiera")
+	b.apiAuth(func(http.ResponseWriter, *http.Request) { t.Error("sin API_KEYS no debe llegar al handler") })(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("estado %d, quiero %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ArchiveEntry recuerda el último envío de un contenido a un chat, para
+// poder reenviarlo por file_id sin volver a descargarlo.
+type ArchiveEntry struct {
+	FileID  string    `json:"file_id"`
+	Mode    string    `json:"mode"`
+	Quality string    `json:"quality"`
+	Title   string    `json:"title"`
+	URL     string    `json:"url,omitempty"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+func archiveKey(chatID int64, meta *VideoMetaData) string {
+	id := meta.ID
+	if id == "" {
+		id = meta.WebpageURL
+	}
+	return fmt.Sprintf("%d:%s:%s", chatID, meta.Extractor, id)
+}
+
+func (s *Store) archiveLookup(chatID int64, meta *VideoMetaData) (ArchiveEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.data.Archive[archiveKey(chatID, meta)]
+	return entry, ok
+}
+
+func (s *Store) archiveRecord(chatID int64, meta *VideoMetaData, entry ArchiveEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Archive[archiveKey(chatID, meta)] = entry
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando archivo de descargas: %v", err)
+	}
+}
+
+func (s *Store) archiveForget(chatID int64, meta *VideoMetaData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Archive, archiveKey(chatID, meta))
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando archivo de descargas: %v", err)
+	}
+}
+
+// sentFileID obtiene el file_id del archivo contenido en un mensaje enviado.
+func sentFileID(msg tgbotapi.Message) string {
+	switch {
+	case msg.Video != nil:
+		return msg.Video.FileID
+	case msg.Audio != nil:
+		return msg.Audio.FileID
+	case msg.Voice != nil:
+		return msg.Voice.FileID
+	case msg.VideoNote != nil:
+		return msg.VideoNote.FileID
+	case msg.Document != nil:
+		return msg.Document.FileID
+	case msg.Sticker != nil:
+		return msg.Sticker.FileID
+	}
+	return ""
+}
+
+func archiveLabel(entry ArchiveEntry) string {
+	switch entry.Mode {
+	case "audio":
+		return "Audio " + choiceLabel(entry.Mode, entry.Quality)
+	case "voice", "note", "sticker":
+		return choiceLabel(entry.Mode, entry.Quality)
+	}
+	return "Video " + videoQualityLabel(entry.Quality)
+}
+
+// offerArchive pregunta al usuario si quiere el archivo ya enviado o una descarga nueva.
+func (b *DownloadBot) offerArchive(chatID int64, msgID int, meta *VideoMetaData, entry ArchiveEntry) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📦 Enviar de nuevo (caché)", "archive:send"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Descargar de nuevo", "archive:fresh"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("❌ Cancelar", "cancel"),
+		),
+	)
+	text := fmt.Sprintf("🎥 *%s*\n\n📦 Ya descargaste este contenido (%s) el %s.\n¿Qué quieres hacer?",
+		escapeMarkdown(meta.Title), archiveLabel(entry), entry.SentAt.Format("02/01/2006 15:04"))
+	b.editMessageMarkup(chatID, msgID, text, keyboard)
+}
+
+func (b *DownloadBot) handleArchiveCallback(key sessionKey, sess *UserSession, action string) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+
+	if action == "send" {
+		entry, ok := b.store.archiveLookup(chatID, meta)
+		if ok {
+			if err := b.sendArchived(chatID, sess.ReplyTo, meta, entry, b.attributionCaption(key.UserID, meta)); err == nil {
+				b.state.DeleteSession(key)
+				b.deleteMessage(chatID, msgID)
+				return
+			}
+			// El file_id ya no es válido: lo olvidamos y ofrecemos descargar
+			b.store.archiveForget(chatID, meta)
+		}
+		b.sendReply(chatID, sess.ReplyTo, "⚠️ El archivo en caché ya no está disponible. Elige una calidad para descargarlo de nuevo.")
+	}
+
+	keyboard := b.createQualityKeyboard(key, meta, 0)
+	b.editMessageMarkup(chatID, msgID, infoCard(meta), keyboard)
+}
+
+// sendArchived reenvía un archivo ya subido por su file_id. caption es el pie
+// con el origen; si está vacío se usa el título.
+func (b *DownloadBot) sendArchived(chatID int64, replyTo int, meta *VideoMetaData, entry ArchiveEntry, caption string) error {
+	file := tgbotapi.FileID(entry.FileID)
+
+	var msg tgbotapi.Chattable
+	if entry.Mode == "audio" {
+		audio := tgbotapi.NewAudio(chatID, file)
+		audio.Title = meta.Title
+		audio.Performer = "Bot Download"
+		audio.Caption = caption
+		audio.ReplyToMessageID = replyTo
+		msg = audio
+	} else if entry.Mode == "voice" {
+		voice := tgbotapi.NewVoice(chatID, file)
+		voice.Caption = "🎙 " + meta.Title
+		if caption != "" {
+			voice.Caption = caption
+		}
+		voice.ReplyToMessageID = replyTo
+		msg = voice
+	} else if entry.Mode == "note" {
+		note := tgbotapi.NewVideoNote(chatID, videoNoteSize, file)
+		note.ReplyToMessageID = replyTo
+		msg = note
+	} else if entry.Mode == "sticker" {
+		sticker := tgbotapi.NewSticker(chatID, file)
+		sticker.ReplyToMessageID = replyTo
+		msg = sticker
+	} else {
+		video := tgbotapi.NewVideo(chatID, file)
+		video.Caption = fmt.Sprintf("🎬 %s", meta.Title)
+		if caption != "" {
+			video.Caption = caption
+		}
+		video.ReplyToMessageID = replyTo
+		msg = video
+	}
+
+	_, err := b.bot.Send(msg)
+	if err != nil {
+		log.Printf("Error reenviando desde caché: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Plantilla de pie de foto por defecto para las publicaciones en el canal
+const defaultAutopostCaption = "🎬 {title}\n👤 {uploader}\n🔗 {url}"
+
+// AutopostConfig describe el modo de publicación automática en un canal:
+// los enlaces que envía un admin (o cualquiera en el grupo de control) se
+// descargan y se publican directamente en el canal enlazado.
+type AutopostConfig struct {
+	Enabled       bool   `json:"enabled"`
+	ChannelID     int64  `json:"channel_id"`
+	ChannelTitle  string `json:"channel_title"`
+	ControlChatID int64  `json:"control_chat_id"`
+	Caption       string `json:"caption"`
+	Quality       string `json:"quality"` // Altura máxima del video, p. ej. "720"
+}
+
+func (s *Store) autopost() AutopostConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Autopost
+}
+
+func (s *Store) updateAutopost(fn func(*AutopostConfig)) AutopostConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.data.Autopost)
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando configuración del canal: %v", err)
+	}
+	return s.data.Autopost
+}
+
+// renderCaption sustituye los campos {title}, {uploader}, {duration} y {url}.
+func renderCaption(template string, meta *VideoMetaData) string {
+	duration := time.Duration(meta.Duration) * time.Second
+	return strings.NewReplacer(
+		"{title}", meta.Title,
+		"{uploader}", meta.Uploader,
+		"{duration}", duration.String(),
+		"{url}", meta.WebpageURL,
+	).Replace(template)
+}
+
+// isAutopostSource indica si un mensaje con enlace debe publicarse en el canal.
+func (b *DownloadBot) isAutopostSource(message *tgbotapi.Message) bool {
+	ap := b.store.autopost()
+	if !ap.Enabled || ap.ChannelID == 0 {
+		return false
+	}
+	if ap.ControlChatID != 0 && message.Chat.ID == ap.ControlChatID {
+		return true
+	}
+	return message.Chat.IsPrivate() && message.From != nil && b.cfg().isAdmin(message.From.ID)
+}
+
+func (b *DownloadBot) handleChannelCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		b.sendReply(chatID, message.MessageID, autopostStatus(b.store.autopost()))
+		return
+	}
+
+	switch args[0] {
+	case "link":
+		if len(args) < 2 {
+			b.sendReply(chatID, message.MessageID, "📡 Uso: /channel link <@canal o ID>")
+			return
+		}
+		channel, err := b.resolveChannel(args[1])
+		if err != nil {
+			b.sendReply(chatID, message.MessageID, "❌ No pude acceder al canal. Añádeme como administrador y vuelve a intentarlo.")
+			return
+		}
+		ap := b.store.updateAutopost(func(ap *AutopostConfig) {
+			ap.ChannelID = channel.ID
+			ap.ChannelTitle = channel.Title
+			ap.Enabled = true
+			if ap.Caption == "" {
+				ap.Caption = defaultAutopostCaption
+			}
+			if ap.Quality == "" {
+				ap.Quality = "720"
+			}
+		})
+		b.sendReply(chatID, message.MessageID, autopostStatus(ap))
+	case "group":
+		if !isGroupChat(message.Chat) {
+			b.sendReply(chatID, message.MessageID, "⚠️ Ejecuta /channel group dentro del grupo de control.")
+			return
+		}
+		ap := b.store.updateAutopost(func(ap *AutopostConfig) { ap.ControlChatID = chatID })
+		b.sendReply(chatID, message.MessageID, autopostStatus(ap))
+	case "caption":
+		template := strings.TrimSpace(strings.TrimPrefix(message.CommandArguments(), "caption"))
+		if template == "" {
+			template = defaultAutopostCaption
+		}
+		ap := b.store.updateAutopost(func(ap *AutopostConfig) { ap.Caption = template })
+		b.sendReply(chatID, message.MessageID, autopostStatus(ap))
+	case "quality":
+		if len(args) < 2 {
+			b.sendReply(chatID, message.MessageID, "📡 Uso: /channel quality <altura, p. ej. 720>")
+			return
+		}
+		if _, err := strconv.Atoi(args[1]); err != nil {
+			b.sendReply(chatID, message.MessageID, "❌ La calidad debe ser una altura en píxeles, p. ej. 720.")
+			return
+		}
+		ap := b.store.updateAutopost(func(ap *AutopostConfig) { ap.Quality = args[1] })
+		b.sendReply(chatID, message.MessageID, autopostStatus(ap))
+	case "on", "off":
+		ap := b.store.updateAutopost(func(ap *AutopostConfig) { ap.Enabled = args[0] == "on" })
+		b.sendReply(chatID, message.MessageID, autopostStatus(ap))
+	default:
+		b.sendReply(chatID, message.MessageID, "📡 Uso: /channel [link <canal> | group | caption <plantilla> | quality <altura> | on | off]")
+	}
+}
+
+// resolveChannel obtiene el chat a partir de "@usuario" o de su ID numérico.
+func (b *DownloadBot) resolveChannel(ref string) (tgbotapi.Chat, error) {
+	config := tgbotapi.ChatInfoConfig{}
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		config.ChatID = id
+	} else {
+		config.SuperGroupUsername = "@" + strings.TrimPrefix(ref, "@")
+	}
+	return b.bot.GetChat(config)
+}
+
+func autopostStatus(ap AutopostConfig) string {
+	if ap.ChannelID == 0 {
+		return "📡 *Publicación automática*\n\nNo hay canal enlazado. Usa /channel link <@canal>."
+	}
+	state := "✅ Activada"
+	if !ap.Enabled {
+		state = "⏸️ Pausada"
+	}
+	control := "ninguno"
+	if ap.ControlChatID != 0 {
+		control = strconv.FormatInt(ap.ControlChatID, 10)
+	}
+	return fmt.Sprintf("📡 *Publicación automática*\n\nEstado: %s\nCanal: %s\nGrupo de control: %s\nCalidad máx.: %sp\nPlantilla:\n%s",
+		state, escapeMarkdown(ap.ChannelTitle), control, ap.Quality, escapeMarkdown(ap.Caption))
+}
+
+// autopostLink descarga el enlace y lo publica en el canal configurado.
+func (b *DownloadBot) autopostLink(message *tgbotapi.Message, url string) {
+	chatID := message.Chat.ID
+	b.markLinkSeen(message, url)
+	ap := b.store.autopost()
+	url = b.rewriteURL(url)
+
+	userID := chatID
+	if message.From != nil {
+		userID = message.From.ID
+	}
+	job := startUsageJob(userID)
+	defer b.finishUsageJob(job)
+
+	msg := b.sendReply(chatID, message.MessageID, "📡 *Preparando publicación...*")
+
+	meta, err := b.fetchMetadata(url)
+	if err != nil {
+		b.editMessage(chatID, msg.MessageID, err.Error())
+		return
+	}
+
+	if !b.waitForDisk(sessionKey{ChatID: chatID, UserID: userID}, &UserSession{MsgID: msg.MessageID}, b.expectedSize(meta, "video", ap.Quality)) {
+		return
+	}
+	fileName := fmt.Sprintf("post_%d_%d", chatID, time.Now().Unix())
+	release := b.scheduler.hold(b.taskPriority(userID))
+	finalPath, err := b.downloadMedia(chatID, msg.MessageID, meta, "video", ap.Quality, downloadOptions{}, fileName)
+	release()
+	var tooLarge *fileTooLargeError
+	if errors.As(err, &tooLarge) {
+		os.Remove(tooLarge.Path) // Un canal no admite enlaces externos en lugar del video
+	}
+	if err != nil {
+		b.editMessage(chatID, msg.MessageID, err.Error())
+		return
+	}
+	thumbPath := b.downloadThumbnail(chatID, meta, fileName)
+	defer func() {
+		os.Remove(finalPath)
+		if thumbPath != "" {
+			os.Remove(thumbPath)
+		}
+	}()
+
+	b.editMessage(chatID, msg.MessageID, "📤 *Publicando en el canal...*")
+	target := uploadTarget{ChatID: ap.ChannelID, Caption: renderCaption(ap.Caption, meta)}
+	sent, err := b.uploadFile(target, finalPath, thumbPath, "video", meta)
+	if err != nil {
+		b.editMessage(chatID, msg.MessageID, "❌ No se pudo publicar en el canal.")
+		return
+	}
+	job.delivered(finalPath)
+	b.store.recordMirror(MirroredPost{
+		ID:         randomToken(4),
+		SourceURL:  meta.WebpageURL,
+		Title:      meta.Title,
+		Deliveries: []MirrorDelivery{{ChatID: ap.ChannelID, MessageID: sent.MessageID}},
+		PostedAt:   time.Now(),
+	})
+	b.editMessage(chatID, msg.MessageID, fmt.Sprintf("✅ Publicado en *%s*: %s", escapeMarkdown(ap.ChannelTitle), escapeMarkdown(meta.Title)))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Formato de las claves de día en la tabla de tráfico
+const bandwidthDayLayout = "2006-01-02"
+
+// Días de tráfico que se conservan
+const bandwidthHistoryDays = 31
+
+// DailyBandwidth es el tráfico de un usuario en un día: lo que el bot
+// descargó para él y lo que le envió por Telegram.
+type DailyBandwidth struct {
+	Downloaded int64 `json:"downloaded"`
+	Uploaded   int64 `json:"uploaded"`
+}
+
+func (s *Store) recordBandwidth(userID int64, at time.Time, downloaded, uploaded int64) {
+	if downloaded == 0 && uploaded == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := at.Format(bandwidthDayLayout)
+	users, found := s.data.Bandwidth[day]
+	if !found {
+		users = make(map[int64]*DailyBandwidth)
+		s.data.Bandwidth[day] = users
+		// Día nuevo: se olvidan los que ya no hacen falta
+		oldest := at.AddDate(0, 0, -bandwidthHistoryDays).Format(bandwidthDayLayout)
+		for d := range s.data.Bandwidth {
+			if d < oldest {
+				delete(s.data.Bandwidth, d)
+			}
+		}
+	}
+	traffic, found := users[userID]
+	if !found {
+		traffic = &DailyBandwidth{}
+		users[userID] = traffic
+	}
+	traffic.Downloaded += downloaded
+	traffic.Uploaded += uploaded
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando tráfico: %v", err)
+	}
+}
+
+func (s *Store) bandwidth(userID int64, day string) DailyBandwidth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if traffic, ok := s.data.Bandwidth[day][userID]; ok {
+		return *traffic
+	}
+	return DailyBandwidth{}
+}
+
+// setByteBudget fija el presupuesto diario de un usuario en bytes (0 = sin
+// límite); con reset vuelve al de la configuración.
+func (s *Store) setByteBudget(userID, budget int64, reset bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reset {
+		delete(s.data.ByteBudgets, userID)
+	} else {
+		s.data.ByteBudgets[userID] = budget
+	}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando presupuestos: %v", err)
+	}
+}
+
+func (s *Store) byteBudget(userID int64) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	budget, ok := s.data.ByteBudgets[userID]
+	return budget, ok
+}
+
+// dailyByteBudget es lo que el usuario puede descargar al día (0 = sin
+// límite): el fijado por un admin o, si no, el de su plan. La API REST cuenta
+// como el usuario apiChatID, sin límite salvo que un admin le fije uno.
+func (b *DownloadBot) dailyByteBudget(userID int64) int64 {
+	if b.cfg().isAdmin(userID) {
+		return 0
+	}
+	if budget, ok := b.store.byteBudget(userID); ok {
+		return budget
+	}
+	if userID == apiChatID {
+		return 0
+	}
+	if b.isPremium(userID) {
+		return b.cfg().PremiumDailyBudgetMB * 1024 * 1024
+	}
+	return b.cfg().DailyBudgetMB * 1024 * 1024
+}
+
+// checkByteBudget rechaza la descarga si el usuario ya gastó su presupuesto
+// del día o esta lo haría pasar. Devuelve false si la descarga no debe seguir.
+func (b *DownloadBot) checkByteBudget(key sessionKey, sess *UserSession, expected int64) bool {
+	budget := b.dailyByteBudget(key.UserID)
+	if budget <= 0 {
+		return true
+	}
+	used := b.store.bandwidth(key.UserID, time.Now().Format(bandwidthDayLayout)).Downloaded
+	if used+expected <= budget {
+		return true
+	}
+	b.state.DeleteSession(key)
+	text := fmt.Sprintf("📶 *Has llegado a tu límite diario.*\n\nHoy has descargado %s de %s. El contador se reinicia a medianoche; mira tu consumo con /me.",
+		humanSize(used), humanSize(budget))
+	if !b.isPremium(key.UserID) && b.cfg().PremiumDailyBudgetMB*1024*1024 != budget {
+		text += "\n\n💎 Con /premium tienes más margen."
+	}
+	b.editMessage(key.ChatID, sess.MsgID, text)
+	return false
+}
+
+// beginDownload es la entrada común de todas las descargas (también
+// capítulos, álbumes, galerías, directos o vistas previas): comprueba el
+// presupuesto diario y empieza a medir la tarea. Devuelve nil si no debe seguir.
+func (b *DownloadBot) beginDownload(key sessionKey, sess *UserSession, expected int64) *usageJob {
+	if !b.checkByteBudget(key, sess, expected) {
+		return nil
+	}
+	return startUsageJob(key.UserID)
+}
+
+// handleMeCommand muestra al usuario su consumo: tráfico de hoy, presupuesto
+// y descargas del mes.
+func (b *DownloadBot) handleMeCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil {
+		return
+	}
+	userID := message.From.ID
+	now := time.Now()
+	today := b.store.bandwidth(userID, now.Format(bandwidthDayLayout))
+
+	text := fmt.Sprintf("👤 *Tu consumo*\n\n📥 Descargado hoy: %s\n📤 Enviado hoy: %s\n", humanSize(today.Downloaded), humanSize(today.Uploaded))
+	if budget := b.dailyByteBudget(userID); budget > 0 {
+		left := max(budget-today.Downloaded, 0)
+		text += fmt.Sprintf("📶 Límite diario: %s (te quedan %s)\n", humanSize(budget), humanSize(left))
+	} else {
+		text += "📶 Límite diario: sin límite\n"
+	}
+	if b.isPremium(userID) {
+		text += "💎 Premium activo\n"
+	}
+	month := b.store.usageForMonth(now.Format(usageMonthLayout))[userID]
+	text += fmt.Sprintf("\n📅 Este mes: %d descargas (%d fallidas), %s enviados", month.Jobs, month.Failed, humanSize(month.Bytes))
+	b.sendReply(chatID, message.MessageID, text)
+}
+
+// handleAdminBudget fija el presupuesto diario de un usuario:
+// /admin budget <userID> <MB|0|default>
+func (b *DownloadBot) handleAdminBudget(message *tgbotapi.Message, args []string) {
+	chatID := message.Chat.ID
+	if len(args) < 2 {
+		b.sendReply(chatID, message.MessageID, "📶 Uso: /admin budget <userID> <MB> (0 = sin límite, default = el del plan)")
+		return
+	}
+	userID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		b.sendReply(chatID, message.MessageID, "❌ Usuario inválido.")
+		return
+	}
+	if args[1] == "default" {
+		b.store.setByteBudget(userID, 0, true)
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("✅ El usuario %d vuelve al límite de su plan.", userID))
+		return
+	}
+	mb, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || mb < 0 {
+		b.sendReply(chatID, message.MessageID, "❌ Cantidad inválida: indica los MB diarios.")
+		return
+	}
+	b.store.setByteBudget(userID, mb*1024*1024, false)
+	if mb == 0 {
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("✅ El usuario %d no tiene límite diario.", userID))
+		return
+	}
+	b.sendReply(chatID, message.MessageID, fmt.Sprintf("✅ Límite diario del usuario %d: %d MB.", userID, mb))
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -14,11 +17,10 @@ import (
 	"os/signal"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -28,6 +30,7 @@ import (
 const (
 	MaxFileSizeBotAPI = 50 * 1024 * 1024 // 50MB (Límite estándar de Telegram Bot API)
 	DownloadDir       = "./temp_downloads"
+	DataDir           = "./data"        // Estado persistente (archivo de descargas, etc.)
 	UpdateInterval    = 3 * time.Second // Intervalo para actualizar la barra de progreso
 	
 	// Token del bot - CAMBIA ESTO CON TU TOKEN REAL
@@ -41,34 +44,104 @@ const (
 )
 
 type DownloadBot struct {
-	bot        *tgbotapi.BotAPI
+	bot        *floodSafeBot // Bot API con control de flood (sender.go)
 	httpClient *http.Client
-	userStates sync.Map // Thread-safe map
+	state      StateStore // Sesiones, updates procesados y contadores (memoria o Redis)
+	queue      *jobQueue  // nil = las descargas se hacen en este proceso
+	worker     bool       // Proceso -worker: solo descarga lo que llega por la cola
+	scheduler  *scheduler // Una descarga por chat y límite global
+
+	pendingLinks sync.Map // sessionKey -> *pendingLink (esperando suscripción)
+	memberCache  sync.Map // userID -> time.Time hasta la que vale la verificación
+	store        *Store
+	config       atomic.Pointer[Config] // Se lee con cfg(); /reload y SIGHUP la sustituyen
+	remote       remoteStorage // nil si no hay almacenamiento externo configurado
+
+	rewriteRules []rewriteRule
+	ytdlpOptions []string         // Opciones validadas del operador para yt-dlp
+	mtproto      *mtprotoUploader // nil si no hay sesión de usuario configurada
+	uploaders    *uploaderPool    // Bot principal y auxiliares para subir archivos
+
+	liveRecordings  sync.Map // sessionKey -> *liveRecording en curso
+	lastFailures    sync.Map // userID -> userFailure, para adjuntarlo a /report
+	pendingCaptchas sync.Map // sessionKey -> *pendingCaptcha (usuario nuevo sin verificar)
 }
 
 type VideoMetaData struct {
-	ID         string  `json:"id"`
-	Title      string  `json:"title"`
-	Duration   float64 `json:"duration"`
-	Thumbnail  string  `json:"thumbnail"`
-	WebpageURL string  `json:"webpage_url"`
-	Formats    []struct {
-		FormatID   string `json:"format_id"`
-		Ext        string `json:"ext"`
-		Height     int    `json:"height"`
-		VideoCodec string `json:"vcodec"`
-		AudioCodec string `json:"acodec"`
-		Filesize   int64  `json:"filesize,omitempty"`
-	} `json:"formats"`
+	ID         string        `json:"id"`
+	Title      string        `json:"title"`
+	Duration   float64       `json:"duration"`
+	Thumbnail  string        `json:"thumbnail"`
+	Thumbnails []Thumbnail   `json:"thumbnails,omitempty"`
+	WebpageURL string        `json:"webpage_url"`
+	Uploader   string        `json:"uploader"`
+	ViewCount  int64         `json:"view_count"`
+	Extractor  string        `json:"extractor_key"`
+	IsLive     bool          `json:"is_live"`
+	Chapters   []Chapter     `json:"chapters"`
+	Formats    []VideoFormat `json:"formats"`
+
+	// Posición dentro de un post con varios videos (0 = video suelto) y, en
+	// los metadatos del post, sus videos
+	PlaylistIndex int              `json:"playlist_index,omitempty"`
+	Entries       []*VideoMetaData `json:"entries,omitempty"`
+
+	// Idioma -> formatos disponibles (solo nos interesan los idiomas)
+	Subtitles         map[string][]SubtitleFormat `json:"subtitles"`
+	AutomaticCaptions map[string][]SubtitleFormat `json:"automatic_captions"`
+}
+
+type SubtitleFormat struct {
+	Ext  string `json:"ext"`
+	Name string `json:"name,omitempty"`
+}
+
+type VideoFormat struct {
+	FormatID       string  `json:"format_id"`
+	Ext            string  `json:"ext"`
+	Height         int     `json:"height"`
+	VideoCodec     string  `json:"vcodec"`
+	AudioCodec     string  `json:"acodec"`
+	Language       string  `json:"language,omitempty"` // Idioma de la pista de audio (doblajes)
+	Filesize       int64   `json:"filesize,omitempty"`
+	FilesizeApprox int64   `json:"filesize_approx,omitempty"`
+	TBR            float64 `json:"tbr,omitempty"` // Tasa total en kbit/s
+	ABR            float64 `json:"abr,omitempty"`
 }
 
 func main() {
+	login := flag.Bool("mtproto-login", false, "iniciar sesión MTProto de forma interactiva y salir")
+	worker := flag.Bool("worker", false, "solo consumir descargas de la cola (JOB_QUEUE), sin webhook")
+	cliURL := flag.String("cli", "", "descargar este enlace sin Telegram y salir")
+	cliMode := flag.String("mode", "video", "con -cli: video o audio")
+	cliQuality := flag.String("quality", "", "con -cli: altura del video (720, fit) o formato del audio (mp3, 192...)")
+	cliOut := flag.String("o", ".", "con -cli: carpeta donde guardar el archivo")
+	flag.Parse()
+	if err := loadConfigFile(); err != nil {
+		log.Fatal("❌ Error leyendo CONFIG_FILE:", err)
+	}
+	if *login {
+		if err := mtprotoLogin(loadConfig()); err != nil {
+			log.Fatal("❌ Error iniciando sesión MTProto:", err)
+		}
+		return
+	}
+
 	// Verificar herramientas externas
-	if _, err := exec.LookPath("yt-dlp"); err != nil {
-		log.Fatal("❌ 'yt-dlp' no está instalado o no está en el PATH.")
+	setBinaries(loadConfig())
+	if _, err := exec.LookPath(ytdlpBin); err != nil {
+		log.Fatalf("❌ '%s' no está instalado o no está en el PATH (YTDLP_BIN).", ytdlpBin)
 	}
-	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		log.Fatal("❌ 'ffmpeg' no está instalado. Es necesario para procesar videos.")
+	// Sin ffmpeg el bot arranca igualmente, pero solo con audio original
+	watchDependencies()
+	if !ffmpegAvailable.Load() {
+		log.Printf("⚠️ 'ffmpeg' no está instalado o no funciona: video, MP3 y capítulos desactivados.")
+	}
+	if *cliURL != "" {
+		if err := runCLI(*cliURL, *cliMode, *cliQuality, *cliOut); err != nil {
+			log.Fatal("❌ ", err)
+		}
+		return
 	}
 
 	// Crear instancia del bot
@@ -80,41 +153,146 @@ func main() {
 	bot.Debug = false
 	log.Printf("🤖 Bot iniciado como: @%s", bot.Self.UserName)
 
-	// Configurar webhook
-	log.Println("🌐 Configurando webhook...")
-	_, err = bot.Request(tgbotapi.NewWebhook(WebhookURL))
-	if err != nil {
-		log.Fatal("❌ Error configurando webhook:", err)
-	}
-
 	// Crear directorio temporal
 	if err := os.MkdirAll(DownloadDir, 0755); err != nil {
 		log.Fatal("❌ Error creando directorio:", err)
 	}
 
+	// Abrir almacenamiento persistente
+	store, err := openStore(filepath.Join(DataDir, "state.json"))
+	if err != nil {
+		log.Fatal("❌ Error abriendo almacenamiento:", err)
+	}
+	cleanupOrphans(store.resumableJobs())
+
+	updates, err := openUpdateGuard(filepath.Join(DataDir, "updates.json"))
+	if err != nil {
+		log.Fatal("❌ Error abriendo registro de updates:", err)
+	}
+
+	// Estado compartido entre réplicas (Redis) o local
+	cfg := loadConfig()
+	state, err := openStateStore(cfg, updates)
+	if err != nil {
+		log.Fatal("❌ Error abriendo estado compartido:", err)
+	}
+
 	// Crear instancia del bot de descarga
 	downloadBot := &DownloadBot{
-		bot:        bot,
+		bot:        newFloodSafeBot(bot),
 		httpClient: &http.Client{Timeout: 30 * time.Second},
+		state:      state,
+		store:      store,
 	}
+	downloadBot.config.Store(cfg)
+	downloadBot.setDebug(cfg.Debug)
+	downloadBot.remote = newRemoteStorage(cfg)
+	downloadBot.mtproto = startMTProto(cfg)
+
+	rules, err := loadRewriteRules(cfg.RewriteRulesFile)
+	if err != nil {
+		log.Fatal("❌ Error en las reglas de reescritura:", err)
+	}
+	downloadBot.rewriteRules = rules
+
+	ytdlpOptions, err := loadYtdlpOptions(cfg.YtdlpOptionsFile)
+	if err != nil {
+		log.Fatal("❌ Error en las opciones de yt-dlp:", err)
+	}
+	downloadBot.ytdlpOptions = ytdlpOptions
+
+	queue, err := openJobQueue(cfg)
+	if err != nil {
+		log.Fatal("❌ Error en la cola de descargas:", err)
+	}
+	downloadBot.queue = queue
+	downloadBot.worker = *worker
+	// Con workers, el almacén se comparte en Redis para que todos vean lo mismo
+	if queue != nil {
+		if err := store.share(queue.client); err != nil {
+			log.Fatal("❌ Error compartiendo el almacén en Redis:", err)
+		}
+	}
+	// Un worker descarga con WORKER_CONCURRENCY: el ancho de banda se reparte entre esas
+	slots := cfg.MaxConcurrentDownloads
+	if *worker {
+		slots = cfg.WorkerConcurrency
+	}
+	downloadBot.scheduler = newScheduler(slots, cfg.DownloadRateLimit, cfg.TotalRateLimit)
+	downloadBot.uploaders = downloadBot.newUploaderPool()
 
 	// Limpiador automático en segundo plano
 	go downloadBot.autoCleaner()
 
 	// Manejo graceful shutdown
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, shutdownSignals...)
 
 	go func() {
 		<-sigChan
 		log.Println("🔄 Apagando bot y limpiando...")
-		os.RemoveAll(DownloadDir)
+		if *worker && queue != nil {
+			queue.retire(workerProcessName())
+		}
+		// Los parciales de las descargas en curso se quedan para reanudarlas
+		purgeTempFiles(0, false, store.resumableJobs())
 		os.Exit(0)
 	}()
 
+	// SIGHUP recarga la configuración sin cortar el webhook ni las descargas
+	// (en Windows no existe: queda /reload)
+	reloadChan := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(reloadChan, reloadSignals...)
+	}
+	go func() {
+		for range reloadChan {
+			if _, err := downloadBot.reloadConfig(); err != nil {
+				log.Printf("⚠️ Error recargando configuración: %v", err)
+			}
+		}
+	}()
+
+	// Las descargas que cortó el reinicio: los workers las retoman de la cola
+	if !*worker {
+		downloadBot.resumeDownloads()
+	}
+
+	// Los workers solo descargan: el webhook y los avisos son del proceso principal
+	if *worker {
+		downloadBot.runWorker()
+	}
+
+	// Configurar webhook
+	log.Println("🌐 Configurando webhook...")
+	webhook, err := tgbotapi.NewWebhook(WebhookURL)
+	if err != nil {
+		log.Fatal("❌ Error configurando webhook:", err)
+	}
+	_, err = bot.Request(webhook)
+	if err != nil {
+		log.Fatal("❌ Error configurando webhook:", err)
+	}
+
+	// Vigilancia de caducidad de cookies por plataforma
+	go downloadBot.cookieWatcher()
+
+	// Avisos de renovación y caducidad del premium
+	go downloadBot.premiumWatcher()
+
+	// Workers caídos: sus descargas vuelven a la cola
+	if queue != nil {
+		go downloadBot.watchWorkers()
+	}
+
 	// Configurar endpoints HTTP
 	http.HandleFunc("/webhook", downloadBot.webhookHandler)
 	http.HandleFunc("/health", downloadBot.healthHandler)
+	downloadBot.registerHealth()
+	downloadBot.registerWebApp()
+	downloadBot.registerAPI()
+	downloadBot.registerDashboard()
+	http.HandleFunc("/files/", downloadBot.filesHandler)
 	
 	// Info endpoint
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -140,6 +318,11 @@ func (b *DownloadBot) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// tgbotapi no conoce los temas de los foros: se leen del cuerpo en crudo
+	if raw, err := io.ReadAll(r.Body); err == nil {
+		noteTopics(raw)
+		r.Body = io.NopCloser(bytes.NewReader(raw))
+	}
 	update, err := b.bot.HandleUpdate(r)
 	if err != nil {
 		log.Printf("❌ Error procesando update: %v", err)
@@ -147,6 +330,13 @@ func (b *DownloadBot) webhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Telegram reintenta webhooks sin respuesta: ignorar los ya procesados
+	if !b.state.MarkUpdate(update.UpdateID) {
+		log.Printf("⏭️ Update %d repetido, ignorado", update.UpdateID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	// Procesar update en goroutine para no bloquear
 	go b.handleUpdate(*update)
 	
@@ -169,8 +359,14 @@ func (b *DownloadBot) handleUpdate(update tgbotapi.Update) {
 
 	if update.Message != nil {
 		b.handleMessage(update.Message)
+	} else if update.EditedMessage != nil {
+		b.handleEditedMessage(update.EditedMessage)
 	} else if update.CallbackQuery != nil {
 		b.handleCallback(update.CallbackQuery)
+	} else if update.PreCheckoutQuery != nil {
+		b.handlePreCheckout(update.PreCheckoutQuery)
+	} else if update.InlineQuery != nil {
+		b.handleInlineQuery(update.InlineQuery)
 	}
 }
 
@@ -178,97 +374,461 @@ func (b *DownloadBot) handleMessage(message *tgbotapi.Message) {
 	chatID := message.Chat.ID
 	text := strings.TrimSpace(message.Text)
 
+	if message.SuccessfulPayment != nil {
+		b.handleSuccessfulPayment(message)
+		return
+	}
+
+	if message.Chat.IsPrivate() && message.From != nil {
+		b.store.recordUser(message.From.ID, time.Now())
+	}
+
 	if message.IsCommand() {
+		if !b.commandForUs(message) {
+			return
+		}
 		switch message.Command() {
 		case "start", "help":
-			b.sendMessage(chatID, "🎬 *Video Downloader Pro*\n\nEnvía un enlace de YouTube, TikTok, Instagram, Twitter, etc.\n\nEl bot detectará automáticamente las calidades disponibles.")
+			if code, ok := strings.CutPrefix(message.CommandArguments(), referralPrefix); ok && message.Command() == "start" {
+				b.handleReferralStart(message, code)
+			} else if url, ok := decodeStartPayload(message.CommandArguments()); ok && message.Command() == "start" {
+				// Enlace profundo desde otra app o web: se procesa directamente
+				b.processLink(message, url)
+				return
+			}
+			b.sendReply(chatID, message.MessageID, "🎬 *Video Downloader Pro*\n\nEnvía un enlace de YouTube, TikTok, Instagram, Twitter, etc.\n\nEl bot detectará automáticamente las calidades disponibles.\n\n⚡ Usa /preset para descargar directamente con tu calidad favorita (/forget olvida las calidades fijas).\n📱 Usa /app para ver tu historial.\n🔁 Usa /redo para repetir tu última descarga.\n👤 Usa /me para ver tu consumo.\n⭐ Usa /saved para ver tus enlaces guardados.\n📝 Usa /report para avisarnos de un problema.\n🔔 Usa /notifications para activar o desactivar los anuncios.\n🎁 Usa /invite para invitar a tus amigos.\n\n👥 En grupos: usa /dl <enlace> o mencióname junto al enlace. Si otro ya lo envió, respóndele con /dl.")
 		case "status":
-			b.sendMessage(chatID, "✅ Bot funcionando correctamente\n\nEnvía un enlace para descargar contenido.")
+			b.handleStatusCommand(message)
+		case "dl":
+			url := extractURL(message.CommandArguments())
+			if url == "" {
+				url = repliedURL(message)
+			}
+			if url == "" {
+				b.sendReply(chatID, message.MessageID, "📥 Uso: /dl <enlace>, o responde con /dl a un mensaje que tenga el enlace.")
+				return
+			}
+			b.processLink(message, url)
+		case "channel":
+			b.handleChannelCommand(message)
+		case "preset":
+			b.handlePresetCommand(message)
+		case "forget":
+			b.handleForgetCommand(message)
+		case "redo":
+			b.handleRedoCommand(message)
+		case "saved":
+			b.handleSavedCommand(message)
+		case "report":
+			b.handleReportCommand(message)
+		case "notifications":
+			b.handleNotificationsCommand(message)
+		case "announce":
+			b.handleAnnounceCommand(message)
+		case "stats":
+			b.handleStatsCommand(message)
+		case "debug":
+			b.handleDebugCommand(message)
+		case "reload":
+			b.handleReloadCommand(message)
+		case "maintenance":
+			b.handleMaintenanceCommand(message)
+		case "me":
+			b.handleMeCommand(message)
+		case "dashboard":
+			b.handleDashboardCommand(message)
+		case "app":
+			b.sendWebAppButton(chatID)
+		case "premium":
+			b.handlePremiumCommand(message)
+		case "invite":
+			b.handleInviteCommand(message)
+		case "referrals":
+			b.handleReferralsCommand(message)
+		case "settings":
+			b.handleSettingsCommand(message)
+		case "admin":
+			b.handleAdminCommand(message)
 		}
 		return
 	}
 
-	if strings.HasPrefix(text, "http") {
-		b.processLink(chatID, text)
-	} else {
-		b.sendMessage(chatID, "📥 Por favor, envía un enlace válido (YouTube, TikTok, Instagram, etc.).")
+	// Respuestas del operador a los reportes de /report
+	if b.handleReportReply(message) {
+		return
+	}
+
+	// Modo canal: los enlaces de admins o del grupo de control se publican directamente
+	if url := messageURL(message); url != "" && b.isAutopostSource(message) {
+		b.autopostLink(message, url)
+		return
+	}
+
+	// En grupos solo reaccionamos a menciones (o a /dl, arriba)
+	if isGroupChat(message.Chat) {
+		if !b.mentionsBot(text) && !b.mentionsBot(message.Caption) {
+			return
+		}
+		if url := messageURL(message); url != "" {
+			b.processLink(message, url)
+		} else if url := repliedURL(message); url != "" {
+			b.processLink(message, url)
+		} else {
+			b.sendReply(chatID, message.MessageID, "📥 Mencióname junto a un enlace o usa /dl <enlace>; también puedes responder así al mensaje que lo tenga.")
+		}
+		return
+	}
+
+	// Los enlaces compartidos desde otras apps suelen venir con texto alrededor
+	if url := messageURL(message); url != "" {
+		b.processLink(message, url)
+	} else if b.noteInvalidLink(message) {
+		b.sendReply(chatID, message.MessageID, "📥 Por favor, envía un enlace válido (YouTube, TikTok, Instagram, etc.).")
 	}
 }
 
-func (b *DownloadBot) processLink(chatID int64, url string) {
-	msg := b.sendMessage(chatID, "🔍 *Analizando enlace...*")
+func (b *DownloadBot) processLink(message *tgbotapi.Message, url string) {
+	b.processLinkWith(message, url, nil)
+}
 
-	// Usamos contexto para cancelar si tarda mucho
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// processLinkWith es processLink con una elección ya hecha (p. ej. /redo):
+// si no es nil se descarga así, sin teclado.
+func (b *DownloadBot) processLinkWith(message *tgbotapi.Message, url string, choice *downloadChoice) {
+	b.markLinkSeen(message, url)
+	if !b.allowLink(message, url) {
+		return
+	}
+	if message.From != nil {
+		if notice, paused := b.inMaintenance(message.From.ID); paused {
+			b.sendReply(message.Chat.ID, message.MessageID, notice)
+			return
+		}
+	}
 
-	cmd := exec.CommandContext(ctx, "yt-dlp", "-j", "--no-playlist", url)
-	output, err := cmd.Output()
+	// Los enlaces cortos y de espejos se traducen a la URL canónica antes de todo
+	url = resolveSiteLink(b.rewriteURL(expandShortLink(url)))
 
-	if err != nil {
-		log.Printf("Error yt-dlp: %v", err)
-		b.editMessage(chatID, msg.MessageID, "❌ No se pudo procesar el enlace. Verifica que sea público y válido.")
+	// Validación barata: la extracción de metadatos se hace una sola vez, más abajo
+	if err := b.validateLink(url); err != nil {
+		if b.noteInvalidLink(message) {
+			b.sendReply(message.Chat.ID, message.MessageID, err.Error())
+		}
 		return
 	}
 
-	var meta VideoMetaData
-	if err := json.Unmarshal(output, &meta); err != nil {
-		b.editMessage(chatID, msg.MessageID, "❌ Error leyendo metadatos.")
+	if !b.checkModeration(message, url) {
+		return
+	}
+	if !b.requireCaptcha(message, url) {
+		return
+	}
+	if !b.requireSubscription(message, url) {
+		return
+	}
+
+	chatID := message.Chat.ID
+	key := sessionKey{ChatID: chatID, UserID: chatID}
+	if message.From != nil {
+		key.UserID = message.From.ID
+	}
+
+	// En grupos respondemos en hilo al mensaje original
+	replyTo := 0
+	if isGroupChat(message.Chat) {
+		replyTo = message.MessageID
+	}
+
+	status := "🔍 *Analizando enlace...*"
+	if platform := detectPlatform(url); platform != "" {
+		status = fmt.Sprintf("🔍 *Analizando enlace de %s...*", escapeMarkdown(platformDisplayName(platform)))
+	}
+	msg := b.sendReply(chatID, replyTo, status)
+	key.MsgID = msg.MessageID
+
+	// Sets de SoundCloud y álbumes de Bandcamp: menú de pistas
+	if isAlbumURL(url) {
+		b.processAlbum(key, msg.MessageID, replyTo, url)
+		return
+	}
+
+	meta, err := b.fetchMetadata(url)
+	// Carruseles de fotos de TikTok: se convierten en video
+	if isTikTokSlideshow(url, meta) && b.processSlideshow(key, msg.MessageID, replyTo, url, meta) {
+		return
+	}
+	if err != nil {
+		// Posts de imágenes o carruseles: segundo intento con gallery-dl
+		if galleryFallback(url) && b.processGallery(key, msg.MessageID, replyTo, url) {
+			return
+		}
+		b.editMessage(chatID, msg.MessageID, err.Error())
 		return
 	}
 
 	// Guardamos estado temporalmente
-	b.userStates.Store(chatID, &meta)
+	sess := &UserSession{Meta: meta, MsgID: msg.MessageID, ReplyTo: replyTo, LinkStart: linkTimestamp(url)}
+	b.state.SaveSession(key, sess)
+
+	// Posts con varios videos: primero se elige cuál
+	if len(meta.Entries) > 1 {
+		b.offerEntries(key, sess)
+		return
+	}
+
+	// Los directos no tienen calidades que elegir: se ofrece grabarlos
+	if meta.IsLive {
+		b.offerLiveRecording(chatID, msg.MessageID, meta)
+		return
+	}
+
+	// Con una elección fija o un preset de descarga rápida no se muestra ningún teclado
+	settings := b.store.userSettings(key.UserID)
+	mode, quality, ok := settings.autoChoice(detectPlatform(meta.WebpageURL))
+	if choice != nil {
+		mode, quality, ok = choice.Mode, choice.Quality, true
+	}
+	if ok && (ffmpegAvailable.Load() || !needsFFmpeg(mode, quality)) {
+		entry, ok := b.store.archiveLookup(chatID, meta)
+		if ok && entry.Mode == mode && entry.Quality == quality {
+			if err := b.sendArchived(chatID, replyTo, meta, entry, b.attributionCaption(key.UserID, meta)); err == nil {
+				b.state.DeleteSession(key)
+				b.deleteMessage(chatID, msg.MessageID)
+				return
+			}
+		}
+		b.dispatchDownload(key, sess, mode, quality)
+		return
+	}
+
+	// Si ya se envió este contenido antes, ofrecer reenviarlo desde caché
+	if entry, ok := b.store.archiveLookup(chatID, meta); ok {
+		b.offerArchive(chatID, msg.MessageID, meta, entry)
+		return
+	}
 
 	// Crear teclado
-	keyboard := b.createQualityKeyboard(chatID, &meta)
-	b.editMessageMarkup(chatID, msg.MessageID, fmt.Sprintf("🎥 *%s*\n\nSelecciona una opción:", escapeMarkdown(meta.Title)), keyboard)
+	keyboard := b.createQualityKeyboard(key, meta, 0)
+	b.editMessageMarkup(chatID, msg.MessageID, infoCard(meta), keyboard)
 }
 
-func (b *DownloadBot) createQualityKeyboard(chatID int64, meta *VideoMetaData) tgbotapi.InlineKeyboardMarkup {
+// fetchMetadata obtiene los metadatos del enlace con yt-dlp. El error devuelto
+// está listo para mostrarse al usuario; el detalle técnico queda en el log.
+func (b *DownloadBot) fetchMetadata(url string) (*VideoMetaData, error) {
+	// Usamos contexto para cancelar si tarda mucho
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().ProbeTimeout)
+	defer cancel()
+
+	// Enlaces que ya fallaron de forma permanente: no volver a lanzar yt-dlp
+	if failure, ok := b.store.knownFailure(url); ok {
+		return nil, failure.userError(true)
+	}
+
+	cmd := b.ytdlpCommand(ctx, url, "-j", "--no-playlist", url)
+	output, err := cmd.Output()
+
+	if err != nil {
+		log.Printf("Error yt-dlp: %v", err)
+		if timedOut(ctx) {
+			return nil, errors.New("⏱️ El sitio tardó demasiado en responder. Inténtalo de nuevo en unos minutos.")
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if kind := classifyFailure(string(exitErr.Stderr)); kind != "" {
+				failure := FailureEntry{Kind: kind, Title: b.store.titleForURL(url), FailedAt: time.Now()}
+				b.store.recordFailure(url, failure)
+				return nil, failure.userError(false)
+			}
+			if msg, ok := ytdlpErrorMessage(string(exitErr.Stderr)); ok {
+				return nil, errors.New(msg)
+			}
+		}
+		return nil, errors.New("❌ No se pudo procesar el enlace. Verifica que sea público y válido.")
+	}
+
+	entries, err := decodeMetadataLines(output)
+	if err != nil {
+		log.Printf("Error leyendo metadatos de %s: %v", url, err)
+		return nil, errors.New("❌ Error leyendo metadatos.")
+	}
+	if len(entries) > 1 {
+		return multiEntryMeta(url, entries), nil
+	}
+	return entries[0], nil
+}
+
+func (b *DownloadBot) createQualityKeyboard(key sessionKey, meta *VideoMetaData, page int) tgbotapi.InlineKeyboardMarkup {
 	var rows [][]tgbotapi.InlineKeyboardButton
+	settings := b.store.userSettings(key.UserID)
 
-	// 1. Botón Audio MP3
-	rows = append(rows, []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("🎵 Audio (MP3)", "dl:audio:best"),
-	})
+	ffmpegOK := ffmpegAvailable.Load()
+
+	// 0. Mejor calidad en un toque: el mejor stream que quepa en el límite, sin elegir formato
+	if ffmpegOK {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("⭐ Mejor calidad", "dl:video:fit"),
+		})
+	}
+
+	// 0b. Atajos: valores predeterminados de /settings y última calidad elegida por el usuario en esta plataforma
+	if mode, quality := settings.preset(); settings.DefaultMode != "" && (ffmpegOK || !needsFFmpeg(mode, quality)) {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("⚡ Predeterminado: "+choiceLabel(mode, quality), "dl:"+mode+":"+quality),
+		})
+	}
+	if mode, quality, ok := b.store.lastChoice(key.UserID, detectPlatform(meta.WebpageURL)); ok && (ffmpegOK || !needsFFmpeg(mode, quality)) {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("⭐ Última elección: "+choiceLabel(mode, quality), "dl:"+mode+":"+quality),
+		})
+	}
+
+	// 0c. Idioma del audio, si el video tiene doblajes
+	if langs := audioLanguages(meta); len(langs) > 1 {
+		current := "Original"
+		if sess, ok := b.loadSession(key); ok && sess.Options.AudioLang != "" {
+			current = languageLabel(sess.Options.AudioLang)
+		}
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("🌐 Idioma del audio: "+current, "lang:menu"),
+		})
+	}
+
+	// 0d. Subtítulos (archivo, pista o quemados); la conversión a SRT necesita ffmpeg
+	if ffmpegOK && len(subtitleTracks(meta)) > 0 {
+		label := "💬 Subtítulos"
+		if sess, ok := b.loadSession(key); ok && sess.Options.SubLang != "" {
+			label += ": " + subtitleChoiceLabel(sess.Options)
+		}
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(label, "sub:menu"),
+		})
+	}
 
-	// 2. Analizar resoluciones de video únicas
-	resolutions := make(map[int]bool)
-	for _, f := range meta.Formats {
-		// Solo queremos formatos de video que tengan una altura definida
-		if f.VideoCodec != "none" && f.Height > 0 {
-			resolutions[f.Height] = true
+	// 0e. Transcripción en texto, sin descargar el video (con whisper si no hay subtítulos)
+	if ffmpegOK {
+		if _, ok := transcriptTrack(meta); ok || b.whisperEnabled() {
+			rows = append(rows, []tgbotapi.InlineKeyboardButton{
+				tgbotapi.NewInlineKeyboardButtonData("📝 Transcripción", "tr:menu"),
+			})
 		}
 	}
 
-	// Convertir map a slice para ordenar
-	var heights []int
-	for h := range resolutions {
-		heights = append(heights, h)
+	// 0f. Reducir la resolución tras descargar, si la fuente no ofrece alturas bajas
+	if targets := downscaleTargets(meta); ffmpegOK && len(targets) > 0 {
+		current := 0
+		if sess, ok := b.loadSession(key); ok {
+			current = sess.Options.Downscale
+		}
+		row := []tgbotapi.InlineKeyboardButton{}
+		for _, h := range targets {
+			label := fmt.Sprintf("📉 %dp", h)
+			if h == current {
+				label = "✅ " + label
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("scale:%d", h)))
+		}
+		rows = append(rows, row)
+	}
+
+	// 0g. Ajustar el video a un tamaño concreto (p. ej. para grupos con límites menores)
+	if ffmpegOK {
+		label := "🎯 Ajustar a un tamaño"
+		if sess, ok := b.loadSession(key); ok && sess.Options.TargetMB > 0 {
+			label = fmt.Sprintf("🎯 Ajustar a: %dMB", sess.Options.TargetMB)
+		}
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(label, "size:menu"),
+		})
+	}
+
+	// 0h. Clip desde el segundo que indica el enlace (?t=90)
+	if sess, ok := b.loadSession(key); ok && ffmpegOK && sess.LinkStart > 0 && (meta.Duration == 0 || float64(sess.LinkStart) < meta.Duration) {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(clipButtonLabel(sess.LinkStart, sess.Options), "clip:menu"),
+		})
+	}
+
+	// 1. Botón Audio (sin ffmpeg no se puede convertir: se envía el original)
+	audioButton := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🎵 Audio (%s)", strings.ToUpper(settings.audioFormat())), "dl:audio:"+settings.audioFormat())
+	if !ffmpegOK {
+		audioButton = tgbotapi.NewInlineKeyboardButtonData("🎵 Audio (formato original)", "dl:audio:native")
+	}
+	// Con vista previa para comprobar el enlace antes de descargarlo entero
+	if ffmpegOK && meta.Duration > audioPreviewSeconds {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{audioButton,
+			tgbotapi.NewInlineKeyboardButtonData("🎧 Vista previa", "preview:audio")})
+	} else {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{audioButton})
+	}
+
+	// 1a. Nota de voz (OGG/Opus) para escucharlo con el reproductor de Telegram
+	if ffmpegOK {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("🎙 Nota de voz", "dl:voice:best"),
+		})
+	}
+
+	// 1b. Video nota (redonda): los primeros 60 segundos recortados a un cuadrado
+	if ffmpegOK {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("🔘 Video nota", "dl:note:best"),
+		})
+	}
+
+	// 1c. Sticker de video, solo para videos que caben enteros en uno
+	if ffmpegOK && meta.Duration > 0 && meta.Duration <= stickerMaxDuration {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData("🩷 Convertir en sticker", "dl:sticker:best"),
+		})
 	}
-	sort.Sort(sort.Reverse(sort.IntSlice(heights))) // De mayor a menor
 
-	// Crear botones para resoluciones (máximo 4 para no saturar)
-	var videoRow []tgbotapi.InlineKeyboardButton
-	count := 0
-	for _, h := range heights {
-		if count >= 4 {
-			break
+	// 1d. Enlace directo sin descargar (no consume ancho de banda del bot) y,
+	// si la hay, la miniatura o portada a máxima resolución
+	linkRow := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData("🔗 Solo enlace", "dl:link:best"),
+	}
+	if meta.Thumbnail != "" || len(meta.Thumbnails) > 0 {
+		linkRow = append(linkRow, tgbotapi.NewInlineKeyboardButtonData("🖼 Miniatura", "thumb:best"))
+	}
+	rows = append(rows, linkRow)
+
+	// 1e. Audio dividido por capítulos, si el video los tiene
+	if len(meta.Chapters) > 1 && ffmpegOK {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📑 Audio por capítulos (%d)", len(meta.Chapters)), "dl:chapters:best"),
+		})
+	}
+
+	// 2. Lista completa de resoluciones y tasas de audio, paginada
+	options, page, pages := formatPage(formatOptions(meta, b.cfg().FormatPolicy), page)
+	var formatButtons []tgbotapi.InlineKeyboardButton
+	for _, opt := range options {
+		label, data := opt.Label, "dl:"+opt.Mode+":"+opt.Quality
+		if !ffmpegOK {
+			// Se muestran pero marcadas, para que se entienda por qué no funcionan
+			label, data = "🚫 "+label+" (sin ffmpeg)", "unavailable"
 		}
-		label := fmt.Sprintf("%dp", h)
-		data := fmt.Sprintf("dl:video:%d", h)
-		videoRow = append(videoRow, tgbotapi.NewInlineKeyboardButtonData(label, data))
-		count++
+		formatButtons = append(formatButtons, tgbotapi.NewInlineKeyboardButtonData(label, data))
 	}
 
-	// Dividir botones de video en filas de 2
-	for i := 0; i < len(videoRow); i += 2 {
+	// Dividir botones de formato en filas de 2
+	for i := 0; i < len(formatButtons); i += 2 {
 		end := i + 2
-		if end > len(videoRow) {
-			end = len(videoRow)
+		if end > len(formatButtons) {
+			end = len(formatButtons)
 		}
-		rows = append(rows, videoRow[i:end])
+		rows = append(rows, formatButtons[i:end])
+	}
+
+	if pages > 1 {
+		var nav []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("page:%d", page-1)))
+		}
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page+1, pages), fmt.Sprintf("page:%d", page)))
+		if page < pages-1 {
+			nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("page:%d", page+1)))
+		}
+		rows = append(rows, nav)
 	}
 
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{
@@ -279,42 +839,284 @@ func (b *DownloadBot) createQualityKeyboard(chatID int64, meta *VideoMetaData) t
 }
 
 func (b *DownloadBot) handleCallback(cb *tgbotapi.CallbackQuery) {
-	data := cb.Data
+	data, sealed, valid := b.resolveCallback(cb)
+	if !valid {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "⛔ Este botón ha caducado o no es válido."))
+		return
+	}
+	cb.Data = data // Los manejadores de abajo leen la acción real
 	chatID := cb.Message.Chat.ID
 	msgID := cb.Message.MessageID
 
+	if data == "verify_sub" {
+		b.handleVerifySubscription(cb)
+		return
+	}
+	if choice, ok := strings.CutPrefix(data, "captcha:"); ok {
+		b.handleCaptchaCallback(cb, choice)
+		return
+	}
+	if strings.HasPrefix(data, "mod:") {
+		b.handleModerationCallback(cb)
+		return
+	}
+	if strings.HasPrefix(data, "ann:") {
+		b.handleAnnounceCallback(cb)
+		return
+	}
+	if strings.HasPrefix(data, "set:") {
+		b.handleSettingsCallback(cb)
+		return
+	}
+	if args, ok := strings.CutPrefix(data, "file:"); ok && sealed {
+		b.handleDeliveryCallback(cb, strings.Split(args, ":"))
+		return
+	}
+
+	key := sessionKey{ChatID: chatID, UserID: cb.From.ID, MsgID: msgID}
+
+	// Los menús de sesión solo aceptan botones con token: los datos en claro
+	// se podrían falsificar
+	sess, ok := b.loadSession(key)
+	if !ok || sess.MsgID != msgID || !sealed {
+		// En grupos el menú puede ser de otro miembro: no lo tocamos
+		if isGroupChat(cb.Message.Chat) {
+			b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "⛔ Este menú es de otro usuario o ha expirado."))
+			return
+		}
+		b.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+		if data == "cancel" {
+			b.deleteMessage(chatID, msgID)
+			return
+		}
+		b.editMessage(chatID, msgID, "❌ Sesión expirada. Envía el enlace de nuevo.")
+		return
+	}
+
+	// Opciones que necesitan ffmpeg cuando no está disponible (también teclados antiguos)
+	if dl := strings.Split(data, ":"); data == "unavailable" ||
+		(len(dl) == 3 && dl[0] == "dl" && !ffmpegAvailable.Load() && needsFFmpeg(dl[1], dl[2])) {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, ffmpegUnavailableNotice))
+		return
+	}
+
 	// Respuesta rápida para que el relojito de carga desaparezca
 	b.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
 
 	if data == "cancel" {
 		b.deleteMessage(chatID, msgID)
-		b.userStates.Delete(chatID)
+		b.state.DeleteSession(key)
 		return
 	}
 
 	parts := strings.Split(data, ":")
-	if len(parts) < 3 || parts[0] != "dl" {
+	if len(parts) == 2 && parts[0] == "archive" {
+		b.handleArchiveCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "page" {
+		page, _ := strconv.Atoi(parts[1])
+		b.editMessageMarkup(chatID, msgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, page))
+		return
+	}
+	if len(parts) == 2 && parts[0] == "lang" {
+		b.handleLanguageCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) >= 2 && parts[0] == "sub" {
+		b.handleSubtitleCallback(key, sess, parts[1:])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "tr" {
+		b.handleTranscriptCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "scale" {
+		// Pulsar de nuevo la altura elegida la quita
+		height, _ := strconv.Atoi(parts[1])
+		if height == sess.Options.Downscale {
+			height = 0
+		}
+		sess.Options.Downscale = height
+		b.state.SaveSession(key, sess)
+		b.editMessageMarkup(chatID, msgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+		return
+	}
+	if len(parts) == 2 && parts[0] == "size" {
+		b.handleTargetSizeCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "clip" {
+		b.handleClipCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "entry" {
+		b.handleEntryCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "thumb" {
+		b.handleThumbnailCallback(key, sess)
+		return
+	}
+	if len(parts) == 2 && parts[0] == "preview" {
+		b.handlePreviewCallback(key, sess)
+		return
+	}
+	if len(parts) == 2 && parts[0] == "live" {
+		b.handleLiveCallback(key, sess, parts[1])
+		return
+	}
+	if len(parts) == 2 && parts[0] == "album" {
+		if b.claimSelection(key, sess) {
+			b.schedule(key, sess, func() { b.handleAlbumCallback(key, sess, parts[1]) })
+		}
+		return
+	}
+	// "force:" es un "dl:" confirmado tras el aviso de tamaño
+	if len(parts) < 3 || (parts[0] != "dl" && parts[0] != "force") {
 		return
 	}
 
 	mode := parts[1] // video o audio
 	quality := parts[2]
 
-	val, ok := b.userStates.Load(chatID)
-	if !ok {
-		b.editMessage(chatID, msgID, "❌ Sesión expirada. Envía el enlace de nuevo.")
+	if parts[0] == "dl" && b.warnIfTooLarge(key, sess, mode, quality) {
+		return
+	}
+	if !b.claimSelection(key, sess) {
+		return
+	}
+	if mode == "chapters" {
+		b.schedule(key, sess, func() { b.downloadChapters(key, sess) })
+		return
+	}
+	if mode == "link" {
+		go b.sendDirectLinks(key, sess)
+		return
+	}
+	b.store.rememberChoice(key.UserID, detectPlatform(sess.Meta.WebpageURL), mode, quality)
+
+	// Iniciar proceso de descarga (aquí o en un worker)
+	b.dispatchDownload(key, sess, mode, quality)
+}
+
+// Ventana en la que se ignoran más pulsaciones de descarga del mismo menú
+const selectionDedupeTTL = 10 * time.Second
+
+// claimSelection deja pasar solo la primera elección de descarga de un menú
+// durante selectionDedupeTTL (un doble toque lanzaría dos descargas) y quita
+// el teclado al momento para que no se pueda volver a pulsar. El contador
+// vive en el StateStore para que valga también entre réplicas.
+func (b *DownloadBot) claimSelection(key sessionKey, sess *UserSession) bool {
+	if b.state.Incr(fmt.Sprintf("select:%d:%d", key.ChatID, sess.MsgID), selectionDedupeTTL) > 1 {
+		return false
+	}
+	noKeyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	b.editMessageMarkup(key.ChatID, sess.MsgID, "⏳ *Preparando...*", noKeyboard)
+	return true
+}
+
+func (b *DownloadBot) performDownload(key sessionKey, sess *UserSession, mode, quality string) {
+	b.performDownloadAs(key, sess, mode, quality, downloadFileName(key))
+}
+
+// performDownloadAs descarga con un nombre de archivo fijo. La descarga queda
+// apuntada en el almacén mientras dura: si el bot se reinicia, se reanuda con
+// el mismo nombre y yt-dlp continúa desde el archivo parcial.
+func (b *DownloadBot) performDownloadAs(key sessionKey, sess *UserSession, mode, quality, fileName string) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	expected := b.expectedSize(meta, mode, quality)
+	// El disco ya se esperó antes de tomar el hueco (scheduleSized, runJob)
+	if !b.checkChatQuota(key, sess, expected) {
+		return
+	}
+	job := b.beginDownload(key, sess, expected)
+	if job == nil {
 		return
 	}
-	meta := val.(*VideoMetaData)
+	defer b.finishUsageJob(job)
+	// En un worker la reanuda el stream de la cola (queue.go), no el almacén
+	if !b.worker {
+		b.store.recordJob(fileName, PersistedJob{Key: key, Session: sess, Mode: mode, Quality: quality, Started: time.Now()})
+		defer b.store.finishJob(fileName)
+	}
+
+	// 1-4. Descargar y verificar
+	opts := b.downloadOptions(key.UserID, sess)
+	finalPath, err := b.downloadMedia(chatID, msgID, meta, mode, quality, opts, fileName)
+	var tooLarge *fileTooLargeError
+	if err == nil {
+		if info, statErr := os.Stat(finalPath); statErr == nil {
+			job.downloaded = info.Size()
+		}
+	}
+	if errors.As(err, &tooLarge) {
+		job.downloaded = tooLarge.Size
+		// Demasiado grande para la Bot API: MTProto o enlace externo
+		delivered := b.deliverLarge(key.UserID, chatID, msgID, sess.ReplyTo, tooLarge, mode, meta)
+		os.Remove(tooLarge.Path)
+		if delivered {
+			job.ok, job.bytes = true, tooLarge.Size
+			b.state.DeleteSession(key)
+			b.deleteMessage(chatID, msgID)
+			return
+		}
+	}
+	if err != nil {
+		if tooLarge == nil {
+			b.reportFailure("descarga", key, meta.WebpageURL, err)
+		}
+		b.editMessage(chatID, msgID, err.Error())
+		return
+	}
+
+	// 5. Descargar miniatura (Thumbnail)
+	thumbPath := b.downloadThumbnail(chatID, meta, fileName)
 
-	// Iniciar proceso de descarga en goroutine
-	go b.performDownload(chatID, msgID, meta, mode, quality)
+	// 6. Subir a Telegram
+	b.editMessage(chatID, msgID, "📤 *Subiendo a Telegram...*")
+	target := uploadTarget{ChatID: chatID, ReplyTo: sess.ReplyTo, Caption: b.attributionCaption(key.UserID, meta)}
+	heightField := ""
+	if mode == "video" {
+		heightField = quality
+	}
+	target.FileName = b.sentFileName(key.UserID, meta, heightField, filepath.Ext(finalPath))
+	if sent, err := b.uploadFile(target, finalPath, thumbPath, mode, meta); err != nil {
+		b.reportFailure("envío", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando el archivo a Telegram.")
+	} else {
+		job.delivered(finalPath)
+		b.moderationHook(key, meta, sent.MessageID)
+		b.attachDeliveryKeyboard(key, sent.MessageID, meta, mode, quality)
+		// Los archivos con opciones (doblaje, subtítulos, cortes...) no se archivan: el archivo se ofrecería como el original
+		if fileID := sentFileID(sent); fileID != "" && opts == (downloadOptions{}) {
+			b.store.archiveRecord(chatID, meta, ArchiveEntry{
+				FileID:  fileID,
+				Mode:    mode,
+				Quality: quality,
+				Title:   meta.Title,
+				URL:     meta.WebpageURL,
+				SentAt:  time.Now(),
+			})
+			b.store.recordServedFile(meta, sent)
+		}
+	}
+	
+	// 7. Limpieza final
+	os.Remove(finalPath)
+	if thumbPath != "" {
+		os.Remove(thumbPath)
+	}
+	b.state.DeleteSession(key)
+	b.deleteMessage(chatID, msgID) // Borrar mensaje de estado
 }
 
-func (b *DownloadBot) performDownload(chatID int64, msgID int, meta *VideoMetaData, mode, quality string) {
-	// 1. Preparar rutas
-	fileName := fmt.Sprintf("vid_%d_%d", chatID, time.Now().Unix())
-	filePathNoExt := filepath.Join(DownloadDir, fileName)
+// downloadMedia ejecuta yt-dlp mostrando el progreso en el mensaje de estado y
+// devuelve la ruta del archivo final. El error está listo para el usuario; si es
+// un *fileTooLargeError el archivo sigue en disco y el llamador debe borrarlo.
+// opts son el idioma de audio y los subtítulos elegidos en el teclado.
+func (b *DownloadBot) downloadMedia(chatID int64, msgID int, meta *VideoMetaData, mode, quality string, opts downloadOptions, fileName string) (string, error) {
+	filePathNoExt := filepath.Join(chatDir(chatID), fileName)
 	
 	// Plantilla de salida para yt-dlp
 	outputTemplate := filePathNoExt + ".%(ext)s"
@@ -322,12 +1124,66 @@ func (b *DownloadBot) performDownload(chatID int64, msgID int, meta *VideoMetaDa
 	var args []string
 	var finalExt string
 
-	// 2. Configurar argumentos de yt-dlp
-	if mode == "audio" {
+	// Configurar argumentos de yt-dlp
+	if mode == "audio" && (quality == "native" || !ffmpegAvailable.Load()) {
+		// Sin conversión: el audio tal cual lo sirve la plataforma (no necesita ffmpeg)
+		args = []string{
+			"-f", "bestaudio[ext=m4a]/bestaudio/best",
+			"-o", outputTemplate,
+			meta.WebpageURL,
+		}
+	} else if mode == "voice" {
+		// Las notas de voz deben ser Opus en contenedor OGG; 64K basta para voz y música
+		finalExt = ".opus"
+		args = []string{
+			"-f", "bestaudio/best",
+			"-x", "--audio-format", "opus",
+			"--audio-quality", "64K",
+			"-o", outputTemplate,
+			meta.WebpageURL,
+		}
+	} else if mode == "note" {
+		// Solo se descarga el primer minuto; el recorte a cuadrado se hace después
+		finalExt = ".mp4"
+		args = []string{
+			"-f", "bv*[height<=720]+ba/b[height<=720]/b",
+			"--download-sections", fmt.Sprintf("*0-%d", videoNoteMaxDuration),
+			"--merge-output-format", "mp4",
+			"-o", outputTemplate,
+			meta.WebpageURL,
+		}
+	} else if mode == "sticker" {
+		// Solo los primeros segundos (o el clip elegido); el WEBM se crea después
+		finalExt = ".mp4"
+		args = []string{
+			"-f", "bv*[height<=720]+ba/b[height<=720]/b",
+			"--merge-output-format", "mp4",
+			"-o", outputTemplate,
+			meta.WebpageURL,
+		}
+		if opts.ClipStart == 0 && opts.ClipLength == 0 {
+			args = append([]string{"--download-sections", fmt.Sprintf("*0-%d", stickerMaxDuration)}, args...)
+		}
+	} else if kbps, ok := audioBitrate(quality); mode == "audio" && ok {
+		// Nivel de audio (320/192/128/64): el mejor original convertido a MP3 a esa tasa
 		finalExt = ".mp3"
 		args = []string{
 			"-f", "bestaudio/best",
 			"-x", "--audio-format", "mp3",
+			"--audio-quality", fmt.Sprintf("%dK", kbps),
+			"-o", outputTemplate,
+			meta.WebpageURL,
+		}
+	} else if mode == "audio" {
+		// Para audio la calidad es el formato de salida ("best" equivale a MP3)
+		format := quality
+		if format == "" || format == "best" {
+			format = "mp3"
+		}
+		finalExt = "." + format
+		args = []string{
+			"-f", "bestaudio/best",
+			"-x", "--audio-format", format,
 			"--audio-quality", "0",
 			"-o", outputTemplate,
 			meta.WebpageURL,
@@ -335,29 +1191,97 @@ func (b *DownloadBot) performDownload(chatID int64, msgID int, meta *VideoMetaDa
 	} else {
 		// Video: Usar fusión de streams si es necesario
 		finalExt = ".mp4"
-		formatSelector := fmt.Sprintf("bestvideo[height<=%s]+bestaudio/best[height<=%s]/best", quality, quality)
+		// La calidad es un peldaño de la escalera: se pide hasta la altura real
+		// más alta que se agrupó en él
+		limit := quality
+		if rung, err := strconv.Atoi(quality); err == nil {
+			limit = strconv.Itoa(rungMaxHeight(meta, rung))
+		}
+		formatSelector := fmt.Sprintf("bestvideo[height<=%s]+bestaudio/best[height<=%s]/best", limit, limit)
+		var sortFields []string
+		if quality == "fit" {
+			// La mejor calidad que quepa en el límite de la Bot API: primero
+			// los formatos que seguro caben (por tamaño exacto o estimado) y
+			// solo si no hay ninguno, el más cercano al límite
+			formatSelector = "bv*[filesize<40M]+ba[filesize<10M]/b[filesize<50M]/" +
+				"bv*[filesize_approx<40M]+ba[filesize_approx<10M]/b[filesize_approx<50M]/bv*+ba/b"
+			sortFields = []string{"filesize:48M"}
+		} else if b.cfg().FormatPolicy == formatPolicySize {
+			// Entre los formatos de la altura elegida, el más ligero
+			sortFields = []string{"res:" + limit, "+size"}
+		}
+		if opts.CompatMode {
+			// A igual resolución, H.264/AAC: así casi nunca hace falta recodificar
+			if len(sortFields) == 0 {
+				sortFields = []string{"res"}
+			}
+			sortFields = append([]string{sortFields[0], "vcodec:h264", "acodec:aac"}, sortFields[1:]...)
+		}
+		var sortArgs []string
+		if len(sortFields) > 0 {
+			sortArgs = []string{"-S", strings.Join(sortFields, ",")}
+		}
 		
-		args = []string{
+		args = append(sortArgs,
 			"-f", formatSelector,
 			"--merge-output-format", "mp4",
 			"-o", outputTemplate,
 			meta.WebpageURL,
+		)
+	}
+
+	// Pista de audio en el idioma elegido, si existe
+	if opts.AudioLang != "" {
+		for i := 0; i < len(args)-1; i++ {
+			if args[i] == "-f" {
+				args[i+1] = withLanguage(args[i+1], opts.AudioLang)
+			}
+		}
+	}
+	// Formatos que prefiere el sitio (sites.go), p. ej. TikTok sin marca de agua
+	if filter := siteFormatFilter(meta.WebpageURL); filter != "" {
+		for i := 0; i < len(args)-1; i++ {
+			if args[i] == "-f" {
+				// Filtran el video (p. ej. la marca de agua), no la pista de audio
+				args[i+1] = withFormatFilter(args[i+1], filter, true)
+			}
 		}
 	}
+	// Solo el tramo elegido o el de la vista previa (la video nota ya recorta su primer minuto)
+	if (opts.ClipStart > 0 || opts.ClipLength > 0) && mode != "note" {
+		args = append(clipArgs(opts), args...)
+	}
+	// Un video concreto de un post con varios
+	if meta.PlaylistIndex > 0 {
+		args = append([]string{"--yes-playlist", "--playlist-items", strconv.Itoa(meta.PlaylistIndex)}, args...)
+	}
+	// SponsorBlock solo conoce YouTube; el audio original no pasa por ffmpeg
+	if opts.SkipSponsors && detectPlatform(meta.WebpageURL) == "youtube" && quality != "native" {
+		args = append([]string{"--sponsorblock-remove", b.cfg().SponsorBlockCategories}, args...)
+	}
+	// Subtítulos: se descargan junto al video para incrustarlos o quemarlos
+	if mode == "video" && opts.SubLang != "" {
+		args = append(subtitleArgs(opts), args...)
+	}
 
-	// 3. Ejecutar descarga con monitoreo de progreso
+	// Ejecutar descarga con monitoreo de progreso
 	b.editMessage(chatID, msgID, "🚀 *Iniciando descarga...*")
 	
 	finalPath := filePathNoExt + finalExt
 	
 	// Usamos un cmd wrapper para leer stdout
-	cmd := exec.Command("yt-dlp", args...)
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().DownloadTimeout)
+	defer cancel()
+	// Si hay un .part de una descarga interrumpida con este nombre, yt-dlp lo
+	// continúa por defecto
+	cmd := b.ytdlpCommand(ctx, meta.WebpageURL, args...)
+	stderr := &tailWriter{}
+	cmd.Stderr = stderr
 	
 	// Pipe para leer el progreso
 	stdout, _ := cmd.StdoutPipe()
 	if err := cmd.Start(); err != nil {
-		b.editMessage(chatID, msgID, "❌ Error al iniciar descarga.")
-		return
+		return "", &downloadFailure{userMsg: "❌ Error al iniciar descarga.", cause: err}
 	}
 
 	// Monitor de progreso
@@ -366,47 +1290,139 @@ func (b *DownloadBot) performDownload(chatID int64, msgID int, meta *VideoMetaDa
 
 	err := cmd.Wait()
 	done <- true // Detener monitor
+	if debugMode.Load() {
+		log.Printf("🐞 yt-dlp (%s):\n%s", meta.WebpageURL, stderr.String())
+	}
 
 	if err != nil {
 		log.Printf("Error descarga: %v", err)
-		b.editMessage(chatID, msgID, "❌ Error durante la descarga o conversión.")
-		os.Remove(finalPath) // Limpieza
-		return
+		// Limpieza, incluidos fragmentos y .part que queden
+		if partial, _ := filepath.Glob(filePathNoExt + ".*"); len(partial) > 0 {
+			for _, path := range partial {
+				os.Remove(path)
+			}
+		}
+		failure := &downloadFailure{userMsg: "❌ Error durante la descarga o conversión.", cause: err, stderr: stderr.String()}
+		if msg, ok := ytdlpErrorMessage(failure.stderr); ok {
+			failure.userMsg = msg
+		}
+		if timedOut(ctx) {
+			failure.userMsg = fmt.Sprintf("⏱️ La descarga superó el tiempo máximo (%s) y se canceló.", formatClock(b.cfg().DownloadTimeout))
+		}
+		return "", failure
+	}
+
+	// Sin extensión fija (audio original): buscar lo que escribió yt-dlp
+	if finalExt == "" {
+		if matches, _ := filepath.Glob(filePathNoExt + ".*"); len(matches) > 0 {
+			finalPath = matches[0]
+		}
+	}
+
+	// yt-dlp guarda el Opus como .opus; Telegram lo espera como .ogg (mismo contenedor)
+	if mode == "voice" {
+		oggPath := filePathNoExt + ".ogg"
+		if err := os.Rename(finalPath, oggPath); err == nil {
+			finalPath = oggPath
+		}
+	}
+
+	if opts.NormalizeAudio && (mode == "audio" || mode == "voice") && quality != "native" {
+		b.editMessage(chatID, msgID, "🔊 *Normalizando volumen...*")
+		kbps, _ := audioBitrate(quality)
+		if mode == "voice" {
+			kbps = 64
+		}
+		// Si falla se envía sin normalizar: el audio sigue siendo válido
+		if err := normalizeLoudness(finalPath, kbps); err != nil {
+			log.Printf("Error normalizando volumen: %v", err)
+		}
+	}
+
+	if mode == "video" && opts.SubMode == subModeBurn && opts.SubLang != "" {
+		b.editMessage(chatID, msgID, "🔥 *Añadiendo subtítulos al video...*")
+		subPath := filePathNoExt + "." + opts.SubLang + ".srt"
+		err := burnSubtitles(finalPath, subPath)
+		os.Remove(subPath)
+		if err != nil {
+			log.Printf("Error quemando subtítulos: %v", err)
+			os.Remove(finalPath)
+			return "", errors.New("❌ No se pudieron añadir los subtítulos al video.")
+		}
+	}
+
+	if mode == "video" && opts.TargetMB > 0 {
+		// La reducción de resolución va en la misma codificación
+		b.editMessage(chatID, msgID, fmt.Sprintf("🎯 *Ajustando a %dMB (dos pasadas)...*", opts.TargetMB))
+		if err := encodeToSize(finalPath, int64(opts.TargetMB)*1024*1024, opts.Downscale); err != nil {
+			log.Printf("Error ajustando al tamaño: %v", err)
+			os.Remove(finalPath)
+			if errors.Is(err, errTargetTooSmall) {
+				return "", fmt.Errorf("❌ %dMB es demasiado poco para la duración de este video. Elige un tamaño mayor.", opts.TargetMB)
+			}
+			return "", errors.New("❌ No se pudo ajustar el video al tamaño elegido.")
+		}
+	} else if mode == "video" && opts.Downscale > 0 {
+		b.editMessage(chatID, msgID, fmt.Sprintf("📉 *Reduciendo a %dp...*", opts.Downscale))
+		if err := downscaleVideo(finalPath, opts.Downscale); err != nil {
+			log.Printf("Error reduciendo resolución: %v", err)
+			os.Remove(finalPath)
+			return "", errors.New("❌ No se pudo reducir la resolución del video.")
+		}
+	}
+
+	// Después de quemar subtítulos y reducir, que ya dejan el video en H.264
+	if mode == "video" && opts.CompatMode {
+		b.editMessage(chatID, msgID, "⚙️ *Comprobando compatibilidad...*")
+		// Si falla se envía tal cual: puede que no se reproduzca en línea, pero se puede descargar
+		if err := ensureCompatible(finalPath); err != nil {
+			log.Printf("Error convirtiendo a H.264/AAC: %v", err)
+		}
+	}
+
+	if mode == "note" {
+		b.editMessage(chatID, msgID, "⚙️ *Creando video nota...*")
+		if err := convertVideoNote(finalPath); err != nil {
+			log.Printf("Error creando video nota: %v", err)
+			os.Remove(finalPath)
+			return "", errors.New("❌ No se pudo convertir el video a video nota.")
+		}
 	}
 
-	// 4. Verificación de archivo
+	if mode == "sticker" {
+		b.editMessage(chatID, msgID, "⚙️ *Creando sticker...*")
+		sticker, err := convertSticker(finalPath)
+		if err != nil {
+			log.Printf("Error creando sticker: %v", err)
+			os.Remove(finalPath)
+			return "", errors.New("❌ No se pudo convertir el video en sticker.")
+		}
+		finalPath = sticker
+	}
+
+	// Verificación de archivo
 	fileInfo, err := os.Stat(finalPath)
 	if err != nil {
-		b.editMessage(chatID, msgID, "❌ Archivo no encontrado tras descarga.")
-		return
+		return "", errors.New("❌ Archivo no encontrado tras descarga.")
 	}
 
 	if fileInfo.Size() > MaxFileSizeBotAPI {
-		b.editMessage(chatID, msgID, fmt.Sprintf("❌ El archivo es demasiado grande (%d MB). El límite de Telegram es 50MB.", fileInfo.Size()/(1024*1024)))
-		os.Remove(finalPath)
-		return
+		return "", &fileTooLargeError{Path: finalPath, Size: fileInfo.Size()}
 	}
 
-	// 5. Descargar miniatura (Thumbnail)
-	thumbPath := ""
-	if meta.Thumbnail != "" {
-		thumbPath = filepath.Join(DownloadDir, fileName+"_thumb.jpg")
-		if err := b.downloadFile(meta.Thumbnail, thumbPath); err != nil {
-			thumbPath = "" // Si falla, enviamos sin thumbnail
-		}
-	}
+	return finalPath, nil
+}
 
-	// 6. Subir a Telegram
-	b.editMessage(chatID, msgID, "📤 *Subiendo a Telegram...*")
-	b.uploadFile(chatID, finalPath, thumbPath, mode, meta, msgID)
-	
-	// 7. Limpieza final
-	os.Remove(finalPath)
-	if thumbPath != "" {
-		os.Remove(thumbPath)
+// downloadThumbnail baja la miniatura junto al archivo; devuelve "" si no hay o falla.
+func (b *DownloadBot) downloadThumbnail(chatID int64, meta *VideoMetaData, fileName string) string {
+	if meta.Thumbnail == "" {
+		return ""
 	}
-	b.userStates.Delete(chatID)
-	b.deleteMessage(chatID, msgID) // Borrar mensaje de estado
+	thumbPath := filepath.Join(chatDir(chatID), fileName+"_thumb.jpg")
+	if err := b.downloadFile(meta.Thumbnail, thumbPath); err != nil {
+		return "" // Si falla, enviamos sin thumbnail
+	}
+	return thumbPath
 }
 
 func (b *DownloadBot) monitorProgress(r io.Reader, chatID int64, msgID int, done chan bool) {
@@ -448,8 +1464,36 @@ func (b *DownloadBot) monitorProgress(r io.Reader, chatID int64, msgID int, done
 	}
 }
 
-func (b *DownloadBot) uploadFile(chatID int64, filePath, thumbPath, mode string, meta *VideoMetaData, statusMsgID int) {
-	file := tgbotapi.FilePath(filePath)
+// uploadTarget indica a qué chat se entrega un archivo y cómo.
+type uploadTarget struct {
+	ChatID   int64
+	ReplyTo  int
+	Caption  string // Si está vacío se usa el título del video
+	FileName string // Nombre con el que se envía; vacío = el del archivo en disco
+}
+
+func (b *DownloadBot) uploadFile(target uploadTarget, filePath, thumbPath, mode string, meta *VideoMetaData) (tgbotapi.Message, error) {
+	sent, err := b.sendUpload(target, func(chatID int64, replyTo int) (tgbotapi.Chattable, func()) {
+		return buildUpload(target, chatID, replyTo, filePath, thumbPath, mode, meta)
+	})
+	if err != nil {
+		log.Printf("Error enviando archivo: %v", err)
+	}
+	return sent, err
+}
+
+// buildUpload prepara el mensaje con el archivo para chatID. Cada intento
+// abre el archivo de nuevo (un lector ya enviado no se puede reutilizar);
+// la función devuelta lo cierra.
+func buildUpload(target uploadTarget, chatID int64, replyTo int, filePath, thumbPath, mode string, meta *VideoMetaData) (tgbotapi.Chattable, func()) {
+	done := func() {}
+	var file tgbotapi.RequestFileData = tgbotapi.FilePath(filePath)
+	if target.FileName != "" {
+		if f, err := os.Open(filePath); err == nil {
+			done = func() { f.Close() }
+			file = tgbotapi.FileReader{Name: target.FileName, Reader: f}
+		}
+	}
 
 	var msg tgbotapi.Chattable
 	
@@ -457,18 +1501,47 @@ func (b *DownloadBot) uploadFile(chatID int64, filePath, thumbPath, mode string,
 		audio := tgbotapi.NewAudio(chatID, file)
 		audio.Title = meta.Title
 		audio.Performer = "Bot Download"
+		if meta.Uploader != "" {
+			audio.Performer = meta.Uploader
+		}
+		audio.ReplyToMessageID = replyTo
+		audio.Caption = target.Caption
 		if thumbPath != "" {
 			thumb := tgbotapi.FilePath(thumbPath)
 			audio.Thumb = thumb
 		}
 		msg = audio
+	} else if mode == "voice" {
+		voice := tgbotapi.NewVoice(chatID, file)
+		voice.Caption = "🎙 " + meta.Title
+		if target.Caption != "" {
+			voice.Caption = target.Caption
+		}
+		voice.Duration = int(meta.Duration)
+		voice.ReplyToMessageID = replyTo
+		msg = voice
+	} else if mode == "note" {
+		// Las notas de video no admiten pie ni miniatura propia
+		note := tgbotapi.NewVideoNote(chatID, videoNoteSize, file)
+		note.Duration = int(math.Min(meta.Duration, videoNoteMaxDuration))
+		note.ReplyToMessageID = replyTo
+		msg = note
+	} else if mode == "sticker" {
+		// Los stickers tampoco llevan pie: Telegram reconoce el WEBM como sticker de video
+		sticker := tgbotapi.NewSticker(chatID, file)
+		sticker.ReplyToMessageID = replyTo
+		msg = sticker
 	} else {
 		video := tgbotapi.NewVideo(chatID, file)
 		video.Caption = fmt.Sprintf("🎬 %s", meta.Title)
+		if target.Caption != "" {
+			video.Caption = target.Caption
+		}
 		video.Duration = int(meta.Duration)
 		
 		// Determinar dimensiones aproximadas si es posible, o dejar que Telegram decida
 		video.SupportsStreaming = true
+		video.ReplyToMessageID = replyTo
 		
 		if thumbPath != "" {
 			thumb := tgbotapi.FilePath(thumbPath)
@@ -477,11 +1550,7 @@ func (b *DownloadBot) uploadFile(chatID int64, filePath, thumbPath, mode string,
 		msg = video
 	}
 
-	_, err := b.bot.Send(msg)
-	if err != nil {
-		log.Printf("Error enviando archivo: %v", err)
-		b.sendMessage(chatID, "❌ Ocurrió un error enviando el archivo a Telegram.")
-	}
+	return msg, done
 }
 
 // Utilidades
@@ -519,7 +1588,20 @@ func (b *DownloadBot) sendMessage(chatID int64, text string) tgbotapi.Message {
 	return sent
 }
 
+// notifyAdmin envía un aviso al chat del operador, si está configurado.
+func (b *DownloadBot) notifyAdmin(text string) {
+	if b.cfg().AdminChatID == 0 {
+		log.Printf("ℹ️ Aviso para el operador (sin ADMIN_CHAT_ID): %s", text)
+		return
+	}
+	b.sendMessage(b.cfg().AdminChatID, text)
+}
+
 func (b *DownloadBot) editMessage(chatID int64, msgID int, text string) {
+	// Sin mensaje de estado (descargas de la API) no hay nada que editar
+	if msgID == 0 {
+		return
+	}
 	msg := tgbotapi.NewEditMessageText(chatID, msgID, text)
 	msg.ParseMode = "Markdown"
 	b.bot.Send(msg)
@@ -528,6 +1610,7 @@ func (b *DownloadBot) editMessage(chatID int64, msgID int, text string) {
 func (b *DownloadBot) editMessageMarkup(chatID int64, msgID int, text string, markup tgbotapi.InlineKeyboardMarkup) {
 	msg := tgbotapi.NewEditMessageText(chatID, msgID, text)
 	msg.ParseMode = "Markdown"
+	markup = b.sealKeyboard(chatID, msgID, markup)
 	msg.ReplyMarkup = &markup
 	b.bot.Send(msg)
 }
@@ -536,19 +1619,6 @@ func (b *DownloadBot) deleteMessage(chatID int64, msgID int) {
 	b.bot.Send(tgbotapi.NewDeleteMessage(chatID, msgID))
 }
 
-func (b *DownloadBot) autoCleaner() {
-	ticker := time.NewTicker(10 * time.Minute)
-	for range ticker.C {
-		files, _ := filepath.Glob(filepath.Join(DownloadDir, "*"))
-		for _, f := range files {
-			info, err := os.Stat(f)
-			if err == nil && time.Since(info.ModTime()) > 30*time.Minute {
-				os.Remove(f)
-			}
-		}
-	}
-}
-
 func escapeMarkdown(text string) string {
 	// Simple escape para evitar errores básicos de markdown
 	return strings.NewReplacer("_", "\\_", "*", "\\*", "[", "\\[", "`", "\\`").Replace(text)
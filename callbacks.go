@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Los botones de los menús no llevan la acción en claro: llevan este prefijo
+// y un token, y la acción (con los IDs de formato, que pueden pasar de los 64
+// bytes que admite Telegram) se guarda en el StateStore.
+const callbackTokenPrefix = "t:"
+
+// callbackTarget es la acción real de un botón y el mensaje al que pertenece:
+// un token solo vale pulsado desde ese mensaje.
+type callbackTarget struct {
+	ChatID int64  `json:"chat_id"`
+	MsgID  int    `json:"msg_id"`
+	Data   string `json:"data"`
+}
+
+// callbackToken deriva el token del botón. Al ser determinista, volver a
+// pintar el mismo menú no crea tokens nuevos; inventarse uno no sirve porque
+// solo existen los que el bot guardó.
+func callbackToken(chatID int64, msgID int, data string) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(chatID, 10) + ":" + strconv.Itoa(msgID) + ":" + data))
+	return callbackTokenPrefix + base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// sealKeyboard sustituye los datos de cada botón por su token y guarda las
+// acciones para cuando se pulsen. Los botones viven lo que la sesión.
+func (b *DownloadBot) sealKeyboard(chatID int64, msgID int, markup tgbotapi.InlineKeyboardMarkup) tgbotapi.InlineKeyboardMarkup {
+	return b.sealKeyboardFor(chatID, msgID, markup, sessionTTL)
+}
+
+// sealKeyboardFor es sealKeyboard para botones que viven ttl.
+func (b *DownloadBot) sealKeyboardFor(chatID int64, msgID int, markup tgbotapi.InlineKeyboardMarkup, ttl time.Duration) tgbotapi.InlineKeyboardMarkup {
+	targets := make(map[string]callbackTarget)
+	sealed := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: make([][]tgbotapi.InlineKeyboardButton, len(markup.InlineKeyboard))}
+	for i, row := range markup.InlineKeyboard {
+		sealed.InlineKeyboard[i] = make([]tgbotapi.InlineKeyboardButton, len(row))
+		for j, button := range row {
+			if button.CallbackData != nil && !strings.HasPrefix(*button.CallbackData, callbackTokenPrefix) {
+				token := callbackToken(chatID, msgID, *button.CallbackData)
+				targets[token] = callbackTarget{ChatID: chatID, MsgID: msgID, Data: *button.CallbackData}
+				button.CallbackData = &token
+			}
+			sealed.InlineKeyboard[i][j] = button
+		}
+	}
+	if len(targets) > 0 {
+		b.state.SaveCallbacks(targets, ttl)
+	}
+	return sealed
+}
+
+// resolveCallback devuelve la acción real del botón pulsado. sealed indica si
+// venía con token (los menús de sesión solo aceptan esos); ok es false si el
+// token no existe o es de otro mensaje.
+func (b *DownloadBot) resolveCallback(cb *tgbotapi.CallbackQuery) (data string, sealed, ok bool) {
+	if !strings.HasPrefix(cb.Data, callbackTokenPrefix) {
+		return cb.Data, false, true
+	}
+	target, found := b.state.LoadCallback(cb.Data)
+	if !found || target.ChatID != cb.Message.Chat.ID || target.MsgID != cb.Message.MessageID {
+		return "", true, false
+	}
+	return target.Data, true, true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestCallbackToken(t *testing.T) {
+	base := callbackToken(1, 10, "q:720")
+	tests := []struct {
+		name   string
+		chatID int64
+		msgID  int
+		data   string
+		same   bool
+	}{
+		{"mismos datos", 1, 10, "q:720", true},
+		{"otro chat", 2, 10, "q:720", false},
+		{"otro mensaje", 1, 11, "q:720", false},
+		{"otra acción", 1, 10, "q:1080", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := callbackToken(tt.chatID, tt.msgID, tt.data)
+			if !strings.HasPrefix(token, callbackTokenPrefix) || len(token) > 64 {
+				t.Errorf("token %q sin prefijo o demasiado largo para Telegram", token)
+			}
+			if (token == base) != tt.same {
+				t.Errorf("callbackToken(%d, %d, %q) = %q; igual al base: %v, quiero %v", tt.chatID, tt.msgID, tt.data, token, token == base, tt.same)
+			}
+		})
+	}
+}
+
+func TestSealAndResolveCallback(t *testing.T) {
+	b := &DownloadBot{state: newMemoryState(nil)}
+	markup := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("720p", "q:"+strings.Repeat("f", 80)),
+			tgbotapi.NewInlineKeyboardButtonURL("Web", "https://example.com"),
+		),
+	)
+	sealed := b.sealKeyboardFor(1, 10, markup, time.Hour)
+	token := *sealed.InlineKeyboard[0][0].CallbackData
+	if sealed.InlineKeyboard[0][1].CallbackData != nil {
+		t.Fatalf("el botón de enlace no debería llevar datos")
+	}
+	// Volver a sellar un teclado ya sellado no cambia los tokens
+	if again := b.sealKeyboard(1, 10, sealed); *again.InlineKeyboard[0][0].CallbackData != token {
+		t.Fatalf("resellar cambió el token")
+	}
+
+	callback := func(data string, chatID int64, msgID int) *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{Data: data, Message: &tgbotapi.Message{MessageID: msgID, Chat: &tgbotapi.Chat{ID: chatID}}}
+	}
+	tests := []struct {
+		name       string
+		cb         *tgbotapi.CallbackQuery
+		wantData   string
+		wantSealed bool
+		wantOK     bool
+	}{
+		{"token válido", callback(token, 1, 10), "q:" + strings.Repeat("f", 80), true, true},
+		{"datos en claro", callback("cancel", 1, 10), "cancel", false, true},
+		{"otro mensaje", callback(token, 1, 11), "", true, false},
+		{"otro chat", callback(token, 2, 10), "", true, false},
+		{"token inventado", callback(callbackTokenPrefix+"inventado", 1, 10), "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, isSealed, ok := b.resolveCallback(tt.cb)
+			if data != tt.wantData || isSealed != tt.wantSealed || ok != tt.wantOK {
+				t.Errorf("resolveCallback() = %q, %v, %v; quiero %q, %v, %v", data, isSealed, ok, tt.wantData, tt.wantSealed, tt.wantOK)
+			}
+		})
+	}
+}
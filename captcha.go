@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Opciones del captcha: el usuario debe pulsar la que se le pide
+var captchaChoices = []struct{ Emoji, Name string }{
+	{"🍎", "la manzana"},
+	{"🐶", "el perro"},
+	{"🚗", "el coche"},
+	{"⚽", "el balón"},
+	{"🌵", "el cactus"},
+	{"🎸", "la guitarra"},
+}
+
+// Intentos fallidos antes de tener que esperar captchaCooldown
+const (
+	maxCaptchaFailures = 2
+	captchaCooldown    = 10 * time.Minute
+)
+
+// pendingCaptcha es un enlace retenido hasta que el usuario pase el captcha.
+type pendingCaptcha struct {
+	pendingLink
+	Answer int
+}
+
+func (s *Store) isVerified(userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Verified[userID]; ok {
+		return true
+	}
+	// Quien ya descargaba antes de activar el captcha no es nuevo
+	_, ok := s.data.LastDownloads[userID]
+	return ok
+}
+
+func (s *Store) markVerified(userID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Verified[userID] = time.Now()
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando verificación: %v", err)
+	}
+}
+
+// requireCaptcha retiene el primer enlace de un usuario nuevo y le pide que
+// pulse un botón concreto, para frenar a otros bots. Devuelve true si puede
+// continuar.
+func (b *DownloadBot) requireCaptcha(message *tgbotapi.Message, url string) bool {
+	if !b.cfg().NewUserCaptcha || message.From == nil || b.cfg().isAdmin(message.From.ID) || b.store.isVerified(message.From.ID) {
+		return true
+	}
+	userID := message.From.ID
+	if b.state.Count(fmt.Sprintf("captcha:fail:%d", userID)) >= maxCaptchaFailures {
+		b.sendReply(message.Chat.ID, message.MessageID, "⏳ Has fallado la verificación. Espera unos minutos y vuelve a enviar el enlace.")
+		return false
+	}
+
+	answer := rand.IntN(len(captchaChoices))
+	key := sessionKey{ChatID: message.Chat.ID, UserID: userID}
+	b.pendingCaptchas.Store(key, &pendingCaptcha{pendingLink: pendingLink{Message: message, URL: url}, Answer: answer})
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, i := range rand.Perm(len(captchaChoices)) {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(captchaChoices[i].Emoji, "captcha:"+strconv.Itoa(i)))
+	}
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("🤖 *Verificación rápida*\n\nEs tu primera vez aquí. Para comprobar que no eres un bot, pulsa *%s*:", captchaChoices[answer].Name))
+	msg.ParseMode = "Markdown"
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	b.bot.Send(msg)
+	return false
+}
+
+// handleCaptchaCallback comprueba la respuesta: "captcha:<opción>". La
+// respuesta correcta solo está en el servidor, así que no sirve falsificar
+// los datos del botón.
+func (b *DownloadBot) handleCaptchaCallback(cb *tgbotapi.CallbackQuery, choice string) {
+	chatID := cb.Message.Chat.ID
+	key := sessionKey{ChatID: chatID, UserID: cb.From.ID}
+	val, ok := b.pendingCaptchas.LoadAndDelete(key)
+	if !ok {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Esta verificación no es para ti o ya ha caducado."))
+		return
+	}
+	pending := val.(*pendingCaptcha)
+	b.deleteMessage(chatID, cb.Message.MessageID)
+
+	if choice != strconv.Itoa(pending.Answer) {
+		fails := b.state.Incr(fmt.Sprintf("captcha:fail:%d", cb.From.ID), captchaCooldown)
+		log.Printf("🤖 Captcha fallado por %d (%d)", cb.From.ID, fails)
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "❌ Respuesta incorrecta."))
+		// Otro intento o, si ya no le quedan, el aviso de que espere
+		b.requireCaptcha(pending.Message, pending.URL)
+		return
+	}
+
+	b.store.markVerified(cb.From.ID)
+	b.bot.Request(tgbotapi.NewCallback(cb.ID, "✅ Verificado"))
+	b.processLink(pending.Message, pending.URL)
+}
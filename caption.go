@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Límite de los pies de foto/video de Telegram
+const maxCaptionLength = 1024
+
+// attributionCaption arma el pie con el origen del archivo (CAPTION_TEMPLATE),
+// para que al reenviarlo se sepa de dónde salió. Usa los mismos campos que la
+// plantilla de nombre; las líneas cuyos campos están todos vacíos se omiten.
+// Devuelve "" si el operador lo desactivó o el usuario no lo quiere.
+func (b *DownloadBot) attributionCaption(userID int64, meta *VideoMetaData) string {
+	if b.cfg().CaptionTemplate == "" || b.store.userSettings(userID).NoAttribution {
+		return ""
+	}
+	duration := ""
+	if meta.Duration > 0 {
+		duration = formatClock(time.Duration(meta.Duration) * time.Second)
+	}
+	fields := map[string]string{
+		"title":       meta.Title,
+		"uploader":    meta.Uploader,
+		"channel":     meta.Uploader,
+		"id":          meta.ID,
+		"extractor":   meta.Extractor,
+		"duration":    duration,
+		"webpage_url": meta.WebpageURL,
+	}
+
+	// Las plantillas de entorno no admiten saltos de línea reales
+	template := strings.ReplaceAll(b.cfg().CaptionTemplate, `\n`, "\n")
+	var lines []string
+	for _, line := range strings.Split(template, "\n") {
+		found, filled := 0, 0
+		line = templateFieldPattern.ReplaceAllStringFunc(line, func(field string) string {
+			found++
+			value := fields[templateFieldPattern.FindStringSubmatch(field)[1]]
+			if value != "" {
+				filled++
+			}
+			return value
+		})
+		if found > 0 && filled == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	caption := strings.TrimSpace(strings.Join(lines, "\n"))
+	for utf8.RuneCountInString(caption) > maxCaptionLength {
+		_, size := utf8.DecodeLastRuneInString(caption)
+		caption = caption[:len(caption)-size]
+	}
+	return caption
+}
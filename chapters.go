@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// A partir de cuántos capítulos se envía un ZIP en lugar de un audio por capítulo
+const chaptersZipThreshold = 10
+
+// Chapter es un capítulo de los metadatos de yt-dlp.
+type Chapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+}
+
+// downloadChapters baja el audio dividido por capítulos (--split-chapters) y
+// envía cada capítulo como un MP3 etiquetado, o un ZIP si son muchos.
+func (b *DownloadBot) downloadChapters(key sessionKey, sess *UserSession) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	defer b.finishUsageJob(job)
+	defer b.state.DeleteSession(key)
+
+	dir := filepath.Join(chatDir(chatID), fmt.Sprintf("chapters_%d_%d_%d", chatID, key.UserID, time.Now().Unix()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		b.editMessage(chatID, msgID, "❌ Error al iniciar descarga.")
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{
+		"-f", "bestaudio/best",
+		"-x", "--audio-format", "mp3",
+		"--audio-quality", "0",
+		"--split-chapters",
+		"-o", filepath.Join(dir, "full.%(ext)s"),
+		"-o", "chapter:" + filepath.Join(dir, "chapter_%(section_number)03d.%(ext)s"),
+		meta.WebpageURL,
+	}
+
+	b.editMessage(chatID, msgID, "🚀 *Iniciando descarga por capítulos...*")
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().DownloadTimeout)
+	defer cancel()
+	cmd := b.ytdlpCommand(ctx, meta.WebpageURL, args...)
+	stderr := &tailWriter{}
+	cmd.Stderr = stderr
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		b.editMessage(chatID, msgID, "❌ Error al iniciar descarga.")
+		return
+	}
+	done := make(chan bool)
+	go b.monitorProgress(stdout, chatID, msgID, done)
+	err := cmd.Wait()
+	done <- true
+	if err != nil {
+		log.Printf("Error descarga por capítulos: %v", err)
+		failure := &downloadFailure{userMsg: "❌ Error durante la descarga o división por capítulos.", cause: err, stderr: stderr.String()}
+		if msg, ok := ytdlpErrorMessage(failure.stderr); ok {
+			failure.userMsg = msg
+		}
+		b.reportFailure("descarga por capítulos", key, meta.WebpageURL, failure)
+		if timedOut(ctx) {
+			b.editMessage(chatID, msgID, fmt.Sprintf("⏱️ La descarga superó el tiempo máximo (%s) y se canceló.", formatClock(b.cfg().DownloadTimeout)))
+			return
+		}
+		b.editMessage(chatID, msgID, failure.userMsg)
+		return
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "chapter_*.mp3"))
+	sort.Strings(files)
+	if len(files) == 0 {
+		b.editMessage(chatID, msgID, "❌ yt-dlp no generó ningún capítulo.")
+		return
+	}
+
+	b.editMessage(chatID, msgID, "⚙️ *Etiquetando capítulos...*")
+	for i, path := range files {
+		if err := tagAlbumTrack(path, meta.Title, meta.Uploader, chapterTitle(meta, i), i+1, len(files)); err != nil {
+			log.Printf("⚠️ No se pudieron etiquetar los capítulos: %v", err)
+		}
+	}
+
+	if len(files) > chaptersZipThreshold {
+		if zipPath, err := zipChapters(dir, meta, files); err == nil {
+			if info, err := os.Stat(zipPath); err == nil && info.Size() <= MaxFileSizeBotAPI {
+				b.editMessage(chatID, msgID, "📤 *Subiendo ZIP de capítulos...*")
+				doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(zipPath))
+				doc.Caption = fmt.Sprintf("📑 %s · %d capítulos", meta.Title, len(files))
+				doc.ReplyToMessageID = sess.ReplyTo
+				if _, err := b.bot.Send(doc); err == nil {
+					job.ok, job.bytes = true, info.Size()
+					b.deleteMessage(chatID, msgID)
+					return
+				}
+			}
+		}
+		// Si el ZIP no cabe o falla, se envían los capítulos uno a uno
+	}
+
+	failed := 0
+	for i, path := range files {
+		b.editMessage(chatID, msgID, fmt.Sprintf("📤 *Enviando capítulo %d de %d...*", i+1, len(files)))
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > MaxFileSizeBotAPI {
+			failed++
+			continue
+		}
+		chapterMeta := *meta
+		chapterMeta.Title = fmt.Sprintf("%02d. %s", i+1, chapterTitle(meta, i))
+		target := uploadTarget{ChatID: chatID, ReplyTo: sess.ReplyTo, Caption: fmt.Sprintf("📑 %s · %d/%d", meta.Title, i+1, len(files))}
+		if _, err := b.uploadFile(target, path, "", "audio", &chapterMeta); err != nil {
+			failed++
+			continue
+		}
+		job.bytes += info.Size()
+	}
+	job.ok = failed < len(files)
+
+	if failed > 0 {
+		b.editMessage(chatID, msgID, fmt.Sprintf("⚠️ Se enviaron %d de %d capítulos.", len(files)-failed, len(files)))
+		return
+	}
+	b.deleteMessage(chatID, msgID)
+}
+
+func chapterTitle(meta *VideoMetaData, i int) string {
+	if i < len(meta.Chapters) && meta.Chapters[i].Title != "" {
+		return meta.Chapters[i].Title
+	}
+	return fmt.Sprintf("Capítulo %d", i+1)
+}
+
+// zipChapters empaqueta los capítulos con nombres legibles ("01 - Título.mp3").
+func zipChapters(dir string, meta *VideoMetaData, files []string) (string, error) {
+	zipPath := filepath.Join(dir, "capitulos.zip")
+	out, err := os.Create(zipPath)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	// Caracteres no válidos en nombres de archivo de Windows
+	clean := strings.NewReplacer("/", "-", "\\", "-", ":", "-", "*", "", "?", "", "\"", "", "<", "", ">", "", "|", "")
+	for i, path := range files {
+		name := fmt.Sprintf("%02d - %s.mp3", i+1, clean.Replace(chapterTitle(meta, i)))
+		// Store: los MP3 ya están comprimidos
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return zipPath, zw.Close()
+}
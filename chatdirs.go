@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Prefijo de las subcarpetas de cada chat dentro de DownloadDir
+const chatDirPrefix = "chat_"
+
+// chatDir devuelve (creándola si hace falta) la carpeta temporal del chat. Cada
+// chat descarga en la suya: los globs de findDownloadedFile no pueden tocar
+// archivos de otro usuario y la cuota se mide por carpeta. Si no se puede
+// crear, se usa DownloadDir como antes.
+func chatDir(chatID int64) string {
+	dir := filepath.Join(DownloadDir, chatDirPrefix+strconv.FormatInt(chatID, 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("⚠️ No se pudo crear la carpeta del chat %d: %v", chatID, err)
+		return DownloadDir
+	}
+	return dir
+}
+
+// checkChatQuota rechaza la descarga si, con lo que ya ocupa la carpeta del
+// chat (descargas en curso), pasaría de CHAT_DIR_QUOTA_MB. Devuelve false si
+// la descarga no debe seguir.
+func (b *DownloadBot) checkChatQuota(key sessionKey, sess *UserSession, expected int64) bool {
+	quota := b.cfg().ChatDirQuotaMB * 1024 * 1024
+	if quota <= 0 {
+		return true
+	}
+	used, _ := dirSize(chatDir(key.ChatID))
+	if used+expected <= quota {
+		return true
+	}
+	log.Printf("📁 Cuota del chat %d superada: %s ocupados + %s", key.ChatID, humanSize(used), humanSize(expected))
+	b.state.DeleteSession(key)
+	b.editMessage(key.ChatID, sess.MsgID, fmt.Sprintf("📁 *Demasiadas descargas a la vez en este chat.*\n\nTus descargas en curso ya ocupan %s y el límite es %s. Espera a que terminen y vuelve a intentarlo.",
+		humanSize(used), humanSize(quota)))
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bytes liberados por el limpiador desde el arranque, para /stats
+var cleanerReclaimed atomic.Int64
+
+// busyChats cuenta las tareas en curso de cada chat: el limpiador no toca su
+// carpeta aunque los archivos sean viejos (una subida lenta, una espera por
+// disco...).
+var busyChats = struct {
+	sync.Mutex
+	count map[int64]int
+}{count: make(map[int64]int)}
+
+// holdChatDir marca la carpeta del chat como en uso hasta llamar a la
+// función devuelta.
+func holdChatDir(chatID int64) func() {
+	busyChats.Lock()
+	busyChats.count[chatID]++
+	busyChats.Unlock()
+	return func() {
+		busyChats.Lock()
+		defer busyChats.Unlock()
+		if busyChats.count[chatID]--; busyChats.count[chatID] <= 0 {
+			delete(busyChats.count, chatID)
+		}
+	}
+}
+
+func chatDirBusy(name string) bool {
+	id, err := strconv.ParseInt(strings.TrimPrefix(name, chatDirPrefix), 10, 64)
+	if err != nil {
+		return false
+	}
+	busyChats.Lock()
+	defer busyChats.Unlock()
+	return busyChats.count[id] > 0
+}
+
+// autoCleaner borra cada CLEANER_INTERVAL los temporales con más de
+// CLEANER_MAX_AGE, salvo los de chats con tareas en curso.
+func (b *DownloadBot) autoCleaner() {
+	if b.cfg().CleanerInterval <= 0 {
+		log.Printf("🧹 Limpiador de temporales desactivado (CLEANER_INTERVAL=0)")
+		return
+	}
+	log.Printf("🧹 Limpiador cada %s, borra temporales de más de %s", b.cfg().CleanerInterval, b.cfg().CleanerMaxAge)
+	ticker := time.NewTicker(b.cfg().CleanerInterval)
+	for range ticker.C {
+		b.cleanTempFiles()
+		// Los archivos servidos por enlace viven hasta que caduca su enlace
+		cleanServedFiles()
+	}
+}
+
+func (b *DownloadBot) cleanTempFiles() {
+	var removed int
+	var reclaimed int64
+	cutoff := time.Now().Add(-b.cfg().CleanerMaxAge)
+	filepath.Walk(DownloadDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == DownloadDir {
+			return nil
+		}
+		if info.IsDir() {
+			if path == servedDir() || (filepath.Dir(path) == filepath.Clean(DownloadDir) && chatDirBusy(info.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.ModTime().Before(cutoff) && os.Remove(path) == nil {
+			removed++
+			reclaimed += info.Size()
+		}
+		return nil
+	})
+	if removed > 0 {
+		cleanerReclaimed.Add(reclaimed)
+		log.Printf("🧹 Limpiador: %d archivos borrados, %s liberados", removed, humanSize(reclaimed))
+	}
+}
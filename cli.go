@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// downloadStandalone extrae y descarga un enlace sin sesión ni mensajes de
+// Telegram (API y -cli). Sin límite de la Bot API: el archivo se devuelve
+// aunque lo supere. Publicaciones con varios videos: el primero.
+func (b *DownloadBot) downloadStandalone(chatID int64, rawURL, mode, quality, fileName string) (*VideoMetaData, string, error) {
+	meta, err := b.fetchMetadata(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(meta.Entries) > 0 {
+		meta = meta.Entries[0]
+	}
+	path, err := b.downloadMedia(chatID, 0, meta, mode, quality, downloadOptions{}, fileName)
+	var tooLarge *fileTooLargeError
+	if errors.As(err, &tooLarge) {
+		return meta, tooLarge.Path, nil
+	}
+	return meta, path, err
+}
+
+// runCLI descarga un enlace con el mismo pipeline que el bot pero sin
+// Telegram: bot -cli <url> [-mode audio] [-quality 1080] [-o carpeta]. Sirve
+// para probar la extracción y las conversiones, o para descargas con cron.
+// Usa su propio estado (data/cli_state.json) para no pisar el del bot.
+func runCLI(rawURL, mode, quality, outDir string) error {
+	cfg := loadConfig()
+	if quality == "" {
+		quality = defaultQualities[mode]
+	}
+	if (mode != "video" && mode != "audio") || !validQuality(mode, quality) {
+		return errors.New("modo o calidad inválidos: -mode video|audio, -quality 720|fit para video o mp3|m4a|opus|native|192 para audio")
+	}
+	store, err := openStore(filepath.Join(DataDir, "cli_state.json"))
+	if err != nil {
+		return err
+	}
+	b := &DownloadBot{state: newMemoryState(nil), store: store}
+	b.config.Store(cfg)
+	debugMode.Store(cfg.Debug)
+	if b.rewriteRules, err = loadRewriteRules(cfg.RewriteRulesFile); err != nil {
+		return fmt.Errorf("reglas de reescritura: %w", err)
+	}
+	if b.ytdlpOptions, err = loadYtdlpOptions(cfg.YtdlpOptionsFile); err != nil {
+		return fmt.Errorf("opciones de yt-dlp: %w", err)
+	}
+
+	rawURL = resolveSiteLink(b.rewriteURL(expandShortLink(rawURL)))
+	if err := b.validateLink(rawURL); err != nil {
+		return err
+	}
+	log.Printf("⬇️ Descargando %s (%s %s)", rawURL, mode, quality)
+	meta, path, err := b.downloadStandalone(0, rawURL, mode, quality, downloadFileName(sessionKey{}))
+	if err != nil {
+		return err
+	}
+	heightField := ""
+	if mode == "video" {
+		heightField = quality
+	}
+	dest := filepath.Join(outDir, b.sentFileName(0, meta, heightField, filepath.Ext(path)))
+	if err := moveFile(path, dest); err != nil {
+		os.Remove(path)
+		return err
+	}
+	log.Printf("✅ Guardado en %s", dest)
+	// La ruta sola en stdout, para usarla desde scripts
+	fmt.Println(dest)
+	return nil
+}
+
+// moveFile mueve el archivo, copiándolo si el destino está en otro disco.
+func moveFile(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if os.Rename(src, dest) == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Duraciones que se ofrecen para el clip, en segundos (0 = hasta el final)
+var clipLengths = []int{30, 60, 120, 300, 0}
+
+// "1h2m3s", "1m30s", "90s" o "90"
+var timestampPattern = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s?)?$`)
+
+// linkTimestamp lee el segundo de inicio de un enlace (?t=90, ?t=1m30s,
+// #t=90, ?start=90). Devuelve 0 si no lo indica.
+func linkTimestamp(rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+	value := u.Query().Get("t")
+	if value == "" {
+		value = u.Query().Get("start")
+	}
+	if value == "" {
+		value = strings.TrimPrefix(u.Fragment, "t=")
+	}
+	m := timestampPattern.FindStringSubmatch(value)
+	if value == "" || m == nil {
+		return 0
+	}
+	h, _ := strconv.Atoi(m[1])
+	mins, _ := strconv.Atoi(m[2])
+	secs, _ := strconv.Atoi(m[3])
+	return h*3600 + mins*60 + secs
+}
+
+func clipLengthLabel(seconds int) string {
+	switch {
+	case seconds == 0:
+		return "Hasta el final"
+	case seconds < 60:
+		return fmt.Sprintf("%d s", seconds)
+	}
+	return fmt.Sprintf("%d min", seconds/60)
+}
+
+// clipButtonLabel es el botón del teclado principal: la oferta o el clip elegido.
+func clipButtonLabel(start int, opts downloadOptions) string {
+	from := formatClock(time.Duration(start) * time.Second)
+	if opts.ClipStart == 0 {
+		return "✂️ Clip desde " + from
+	}
+	return fmt.Sprintf("✂️ Clip: %s · %s", from, strings.ToLower(clipLengthLabel(opts.ClipLength)))
+}
+
+// clipArgs limita la descarga al tramo elegido. Se cortan los fotogramas
+// clave en los límites para que el clip empiece justo en el segundo pedido.
+func clipArgs(opts downloadOptions) []string {
+	end := "inf"
+	if opts.ClipLength > 0 {
+		end = strconv.Itoa(opts.ClipStart + opts.ClipLength)
+	}
+	return []string{"--download-sections", fmt.Sprintf("*%d-%s", opts.ClipStart, end), "--force-keyframes-at-cuts"}
+}
+
+// handleClipCallback atiende el menú del clip: "clip:menu", "clip:<segundos>"
+// (duración desde el inicio del enlace) o "clip:off".
+func (b *DownloadBot) handleClipCallback(key sessionKey, sess *UserSession, value string) {
+	if sess.LinkStart <= 0 {
+		return
+	}
+	if value == "menu" {
+		var rows [][]tgbotapi.InlineKeyboardButton
+		var row []tgbotapi.InlineKeyboardButton
+		for _, length := range clipLengths {
+			label := clipLengthLabel(length)
+			if sess.Options.ClipStart > 0 && sess.Options.ClipLength == length {
+				label = "✅ " + label
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "clip:"+strconv.Itoa(length)))
+			if len(row) == 3 {
+				rows = append(rows, row)
+				row = nil
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		rows = append(rows,
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🚫 Video completo", "clip:off")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")),
+		)
+		text := fmt.Sprintf("✂️ *Clip desde %s*\n\nEl enlace empieza en ese momento. ¿Cuánto quieres descargar? Después elige la calidad.",
+			formatClock(time.Duration(sess.LinkStart)*time.Second))
+		b.editMessageMarkup(key.ChatID, sess.MsgID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+		return
+	}
+
+	if value == "off" {
+		sess.Options.ClipStart, sess.Options.ClipLength = 0, 0
+	} else {
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 {
+			return
+		}
+		sess.Options.ClipStart, sess.Options.ClipLength = sess.LinkStart, length
+	}
+	b.state.SaveSession(key, sess)
+	b.editMessageMarkup(key.ChatID, sess.MsgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+}
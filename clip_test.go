@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestLinkTimestamp(t *testing.T) {
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"https://youtu.be/abc", 0},
+		{"https://youtu.be/abc?t=90", 90},
+		{"https://youtu.be/abc?t=90s", 90},
+		{"https://youtu.be/abc?t=1m30s", 90},
+		{"https://youtu.be/abc?t=1h2m3s", 3723},
+		{"https://www.youtube.com/watch?v=abc&start=45", 45},
+		{"https://vimeo.com/123#t=120", 120},
+		{"https://vimeo.com/123#comentarios", 0},
+		{"https://youtu.be/abc?t=abc", 0},
+		{"://no es un enlace", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := linkTimestamp(tt.url); got != tt.want {
+				t.Errorf("linkTimestamp(%q) = %d, quiero %d", tt.url, got, tt.want)
+			}
+		})
+	}
+}
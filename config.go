@@ -0,0 +1,403 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config agrupa los ajustes que el operador puede cambiar sin recompilar.
+// Se leen de variables de entorno; si no existen se usan los valores por defecto.
+// Con CONFIG_FILE se leen también de ese fichero, que se recarga con SIGHUP o /reload.
+type Config struct {
+	// Chat (usuario, grupo o canal) del operador para avisos del bot
+	AdminChatID int64
+	// Chat donde se envían los informes detallados de errores (por defecto el del operador)
+	ErrorReportChatID int64
+	// Usuarios con acceso a los comandos de administración
+	AdminIDs []int64
+
+	// Directorio con cookies por plataforma (youtube.txt, instagram.txt, ...)
+	CookiesDir          string
+	CookieCheckInterval time.Duration
+	CookieWarnBefore    time.Duration
+
+	// Canal al que hay que estar suscrito para usar el bot (vacío = desactivado)
+	ForceSubChannel string
+	ForceSubURL     string // Enlace de invitación; por defecto t.me/<canal>
+
+	// Plan premium. Sin token de proveedor se cobra en Telegram Stars (XTR)
+	PaymentProviderToken string
+	PremiumCurrency      string
+	PremiumPrice         int // En la unidad mínima de la moneda (estrellas para XTR)
+	PremiumDuration      time.Duration
+	ReferralBonus        time.Duration // Premium que gana quien invita por cada amigo nuevo (0 = sin premio)
+
+	// Lo que cada usuario puede descargar al día, en MB (0 = sin límite)
+	DailyBudgetMB        int64
+	PremiumDailyBudgetMB int64
+
+	// Clave para firmar la exportación de ajustes. Debe ser la misma en todas
+	// las instancias entre las que se quieran migrar ajustes.
+	SettingsSigningKey string
+
+	// Almacenamiento externo para archivos que superan el límite de Telegram
+	S3Endpoint      string // p. ej. https://s3.eu-west-1.amazonaws.com o un MinIO
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3LinkTTL       time.Duration // Vigencia del enlace prefirmado (máx. 7 días)
+	WebDAVURL       string
+	WebDAVPublicURL string // Base de los enlaces que se envían al usuario
+	WebDAVUser      string
+	WebDAVPassword  string
+
+	// Servidor HTTP propio para archivos grandes (alternativa sin S3/WebDAV)
+	ServeLargeFiles bool
+	ServedFileTTL   time.Duration
+
+	// Claves de la API REST (POST /downloads, GET /downloads/{id}); vacío = API desactivada
+	APIKeys []string
+
+	// Reglas de reescritura de enlaces de espejos (ver rewrite_rules.example.txt)
+	RewriteRulesFile string
+
+	// Opciones extra de yt-dlp del operador (ver ytdlp_options.example.txt)
+	YtdlpOptionsFile string
+
+	// Cliente MTProto con sesión de usuario para enviar archivos de hasta 2GB.
+	// La cuenta sube al canal de almacén y el bot copia el mensaje al usuario,
+	// así que el bot debe ser administrador de ese canal.
+	MTProtoAppID          int
+	MTProtoAppHash        string
+	MTProtoSessionFile    string
+	MTProtoStorageChannel string // @usuario del canal de almacén
+
+	// Bots auxiliares para subir archivos en paralelo. Suben al canal de
+	// almacén (por defecto el de MTProto), del que deben ser administradores
+	// igual que el bot principal, y este copia el mensaje al usuario.
+	UploadBotTokens      []string
+	UploadStorageChannel string
+
+	// Duración máxima de una grabación de directo
+	LiveMaxDuration time.Duration
+
+	// Palabras que marcan una descarga para revisión (/admin review)
+	ModerationKeywords []string
+
+	// Registro detallado de la API de Telegram y de yt-dlp (se cambia con /debug)
+	Debug bool
+	// Diagnóstico completo de /status para todos (si no, solo para admins)
+	StatusPublic bool
+
+	// Heurísticas de abuso (0 = desactivada) y duración del bloqueo temporal
+	AbuseLinksPerMinute int64
+	AbuseRepeatLimit    int64
+	AbuseInvalidLimit   int64
+	AbuseBanDuration    time.Duration
+	// Pedir un captcha a los usuarios nuevos antes de su primer enlace
+	NewUserCaptcha bool
+
+	// Puerto propio para /healthz y /readyz (vacío = en el servidor principal)
+	HealthPort string
+	// Espacio libre mínimo en disco para declararse listo
+	HealthMinFreeMB int64
+
+	// Margen de disco que debe quedar libre además del tamaño esperado de
+	// una descarga, y cuánto espera una descarga a que se libere espacio
+	DiskReserveMB   int64
+	DiskWaitTimeout time.Duration
+	// Espacio máximo que pueden ocupar a la vez las descargas de un chat (0 = sin límite)
+	ChatDirQuotaMB int64
+
+	// Cada cuánto pasa el limpiador de temporales y qué antigüedad borra
+	CleanerInterval time.Duration
+	CleanerMaxAge   time.Duration
+
+	// Redis para compartir sesiones y deduplicación entre varias réplicas
+	// (vacío = estado en memoria, una sola instancia)
+	RedisURL string
+
+	// Aceptar sitios sin extractor propio (los prueba el extractor genérico de yt-dlp)
+	AllowGenericExtractor bool
+
+	// Plantilla de yt-dlp para el nombre de los archivos enviados
+	FilenameTemplate string
+	// Plantilla del pie con el origen de los archivos (vacía = sin pie); "\n" separa líneas
+	CaptionTemplate string
+
+	// Qué formato se prefiere entre varios de la misma resolución: "bitrate" o "size"
+	FormatPolicy string
+
+	// Tiempo máximo de yt-dlp para analizar un enlace y para descargarlo
+	ProbeTimeout    time.Duration
+	DownloadTimeout time.Duration
+
+	// Descargas simultáneas en este proceso (en cada chat, de una en una)
+	MaxConcurrentDownloads int
+
+	// Cola de descargas para procesos worker separados ("redis" o vacío)
+	JobQueue          string
+	WorkerConcurrency int
+
+	// Programas externos: nombre en el PATH o ruta completa (en Windows, p. ej.
+	// C:\tools\yt-dlp.exe). Solo se leen al arrancar
+	YtdlpBin     string
+	FFmpegBin    string
+	FFprobeBin   string
+	GalleryDLBin string
+
+	// Transcripción local con whisper para videos sin subtítulos (vacío = desactivada)
+	WhisperBin      string
+	WhisperKind     string // "cpp" (whisper.cpp) u "openai" (openai-whisper)
+	WhisperModel    string // Ruta al .bin en whisper.cpp, nombre ("base", "small") en openai-whisper
+	WhisperLanguage string // Código de idioma o "auto"
+
+	// Categorías de SponsorBlock que se quitan si el usuario lo activa
+	SponsorBlockCategories string
+
+	// Ancho de banda en bytes/s ("500K", "2M"): por descarga y total del
+	// proceso, para no saturar la salida de un servidor compartido (0 = sin límite)
+	DownloadRateLimit int64
+	TotalRateLimit    int64
+}
+
+func loadConfig() *Config {
+	return &Config{
+		AdminChatID:         envInt64("ADMIN_CHAT_ID", 0),
+		AdminIDs:            envInt64List("ADMIN_IDS"),
+		ErrorReportChatID:   envInt64("ERROR_REPORT_CHAT_ID", envInt64("ADMIN_CHAT_ID", 0)),
+		CookiesDir:          envString("COOKIES_DIR", "./cookies"),
+		CookieCheckInterval: envPositiveDuration("COOKIE_CHECK_INTERVAL", 6*time.Hour),
+		CookieWarnBefore:    envDuration("COOKIE_WARN_BEFORE", 72*time.Hour),
+		ForceSubChannel:     envString("FORCE_SUB_CHANNEL", ""),
+		ForceSubURL:         envString("FORCE_SUB_URL", ""),
+
+		PaymentProviderToken: envString("PAYMENT_PROVIDER_TOKEN", ""),
+		PremiumCurrency:      envString("PREMIUM_CURRENCY", "XTR"),
+		PremiumPrice:         int(envInt64("PREMIUM_PRICE", 100)),
+		PremiumDuration:      envDuration("PREMIUM_DURATION", 30*24*time.Hour),
+		ReferralBonus:        envDuration("REFERRAL_BONUS", 3*24*time.Hour),
+
+		DailyBudgetMB:        envInt64("DAILY_BUDGET_MB", 0),
+		PremiumDailyBudgetMB: envInt64("PREMIUM_DAILY_BUDGET_MB", 0),
+
+		SettingsSigningKey: envString("SETTINGS_SIGNING_KEY", BotToken),
+
+		S3Endpoint:      envString("S3_ENDPOINT", ""),
+		S3Region:        envString("S3_REGION", "us-east-1"),
+		S3Bucket:        envString("S3_BUCKET", ""),
+		S3AccessKey:     envString("S3_ACCESS_KEY", ""),
+		S3SecretKey:     envString("S3_SECRET_KEY", ""),
+		S3LinkTTL:       envDuration("S3_LINK_TTL", 24*time.Hour),
+		WebDAVURL:       envString("WEBDAV_URL", ""),
+		WebDAVPublicURL: envString("WEBDAV_PUBLIC_URL", ""),
+		WebDAVUser:      envString("WEBDAV_USER", ""),
+		WebDAVPassword:  envString("WEBDAV_PASSWORD", ""),
+
+		ServeLargeFiles: envBool("SERVE_LARGE_FILES", false),
+		ServedFileTTL:   envDuration("SERVED_FILE_TTL", 6*time.Hour),
+
+		APIKeys: envSecretList("API_KEYS"),
+
+		RewriteRulesFile: envString("REWRITE_RULES_FILE", "./rewrite_rules.txt"),
+		YtdlpOptionsFile: envString("YTDLP_OPTIONS_FILE", "./ytdlp_options.txt"),
+
+		MTProtoAppID:          int(envInt64("MTPROTO_APP_ID", 0)),
+		MTProtoAppHash:        envString("MTPROTO_APP_HASH", ""),
+		MTProtoSessionFile:    envString("MTPROTO_SESSION_FILE", filepath.Join(DataDir, "mtproto.session")),
+		MTProtoStorageChannel: envString("MTPROTO_STORAGE_CHANNEL", ""),
+
+		UploadBotTokens:      envSecretList("UPLOAD_BOT_TOKENS"),
+		UploadStorageChannel: envString("UPLOAD_STORAGE_CHANNEL", envString("MTPROTO_STORAGE_CHANNEL", "")),
+
+		LiveMaxDuration: envDuration("LIVE_MAX_DURATION", 30*time.Minute),
+
+		ModerationKeywords: envStringList("MODERATION_KEYWORDS"),
+
+		Debug:        envBool("DEBUG", false),
+		StatusPublic: envBool("STATUS_PUBLIC", false),
+
+		AbuseLinksPerMinute: envInt64("ABUSE_LINKS_PER_MINUTE", 10),
+		AbuseRepeatLimit:    envInt64("ABUSE_REPEAT_LIMIT", 5),
+		AbuseInvalidLimit:   envInt64("ABUSE_INVALID_LIMIT", 10),
+		AbuseBanDuration:    envDuration("ABUSE_BAN_DURATION", 15*time.Minute),
+		NewUserCaptcha:      envBool("NEW_USER_CAPTCHA", false),
+
+		HealthPort:      envString("HEALTH_PORT", ""),
+		HealthMinFreeMB: envInt64("HEALTH_MIN_FREE_MB", 500),
+
+		DiskReserveMB:   envInt64("DISK_RESERVE_MB", 500),
+		DiskWaitTimeout: envDuration("DISK_WAIT_TIMEOUT", 10*time.Minute),
+		ChatDirQuotaMB:  envInt64("CHAT_DIR_QUOTA_MB", 4096),
+
+		CleanerInterval: envDuration("CLEANER_INTERVAL", 10*time.Minute),
+		CleanerMaxAge:   envDuration("CLEANER_MAX_AGE", 30*time.Minute),
+
+		RedisURL: envString("REDIS_URL", ""),
+
+		AllowGenericExtractor: envBool("ALLOW_GENERIC_EXTRACTOR", true),
+
+		FilenameTemplate: envString("FILENAME_TEMPLATE", "%(title)s"),
+		CaptionTemplate:  envString("CAPTION_TEMPLATE", `🎬 %(title)s\n👤 %(uploader)s · ⏱ %(duration)s\n🔗 %(webpage_url)s`),
+		FormatPolicy:     envString("FORMAT_POLICY", formatPolicyBitrate),
+
+		ProbeTimeout:    envDuration("YTDLP_PROBE_TIMEOUT", 30*time.Second),
+		DownloadTimeout: envDuration("YTDLP_DOWNLOAD_TIMEOUT", 30*time.Minute),
+
+		MaxConcurrentDownloads: int(envInt64("MAX_CONCURRENT_DOWNLOADS", 3)),
+
+		JobQueue:          envString("JOB_QUEUE", ""),
+		WorkerConcurrency: int(envInt64("WORKER_CONCURRENCY", 2)),
+
+		YtdlpBin:     envString("YTDLP_BIN", "yt-dlp"),
+		FFmpegBin:    envString("FFMPEG_BIN", "ffmpeg"),
+		FFprobeBin:   envString("FFPROBE_BIN", "ffprobe"),
+		GalleryDLBin: envString("GALLERY_DL_BIN", "gallery-dl"),
+
+		WhisperBin:      envString("WHISPER_BIN", ""),
+		WhisperKind:     envString("WHISPER_KIND", whisperCpp),
+		WhisperModel:    envString("WHISPER_MODEL", defaultWhisperModel(envString("WHISPER_KIND", whisperCpp))),
+		WhisperLanguage: envString("WHISPER_LANGUAGE", "auto"),
+
+		SponsorBlockCategories: envString("SPONSORBLOCK_CATEGORIES", "sponsor,selfpromo,interaction,intro"),
+
+		DownloadRateLimit: envByteRate("YTDLP_LIMIT_RATE"),
+		TotalRateLimit:    envByteRate("TOTAL_RATE_LIMIT"),
+	}
+}
+
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt64(key string, def int64) int64 {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Printf("⚠️ Valor inválido para %s (%q), usando %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("⚠️ Valor inválido para %s (%q), usando %t", key, v, def)
+		return def
+	}
+	return b
+}
+
+// envInt64List lee una lista de enteros separados por comas.
+func envInt64List(key string) []int64 {
+	var list []int64
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			log.Printf("⚠️ Valor inválido en %s: %q", key, part)
+			continue
+		}
+		list = append(list, n)
+	}
+	return list
+}
+
+// envStringList lee una lista de palabras separadas por comas, en minúsculas.
+func envStringList(key string) []string {
+	list := envSecretList(key)
+	for i, part := range list {
+		list[i] = strings.ToLower(part)
+	}
+	return list
+}
+
+// envSecretList lee una lista separada por comas respetando mayúsculas:
+// tokens y claves distinguen entre unas y otras.
+func envSecretList(key string) []string {
+	var list []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	return list
+}
+
+func (c *Config) isAdmin(userID int64) bool {
+	for _, id := range c.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// envByteRate lee una tasa como la de --limit-rate de yt-dlp: "500K", "1.5M" o bytes.
+func envByteRate(key string) int64 {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return 0
+	}
+	raw, multiplier := v, 1.0
+	switch strings.ToUpper(v[len(v)-1:]) {
+	case "K":
+		multiplier = 1024
+	case "M":
+		multiplier = 1024 * 1024
+	case "G":
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		log.Printf("⚠️ Valor inválido para %s (%q), sin límite", key, raw)
+		return 0
+	}
+	return int64(n * multiplier)
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("⚠️ Valor inválido para %s (%q), usando %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envPositiveDuration es envDuration para intervalos que no pueden ser 0 ni
+// negativos (p. ej. los de un time.Ticker, que entraría en pánico).
+func envPositiveDuration(key string, def time.Duration) time.Duration {
+	d := envDuration(key, def)
+	if d <= 0 {
+		log.Printf("⚠️ %s debe ser mayor que 0, usando %s", key, def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvStringList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"vacía", "", nil},
+		{"una", "Casino", []string{"casino"}},
+		{"espacios y huecos", " Apuestas , ,CRYPTO ,", []string{"apuestas", "crypto"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_LIST", tt.value)
+			if got := envStringList("TEST_LIST"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("envStringList(%q) = %q, quiero %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvSecretList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"vacía", "", nil},
+		{"token de bot con mayúsculas", "123456:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw", []string{"123456:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"}},
+		{"varios con espacios", " 1:AbC , ,2:dEf", []string{"1:AbC", "2:dEf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_SECRETS", tt.value)
+			if got := envSecretList("TEST_SECRETS"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("envSecretList(%q) = %q, quiero %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
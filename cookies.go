@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cookies que representan la sesión iniciada en cada plataforma. Si una jar no
+// contiene ninguna, se toma como referencia la cookie que más tarde expira.
+var authCookieNames = map[string][]string{
+	"youtube":   {"__Secure-3PSID", "SID", "LOGIN_INFO"},
+	"instagram": {"sessionid"},
+	"twitter":   {"auth_token"},
+	"tiktok":    {"sessionid"},
+	"facebook":  {"c_user", "xs"},
+	"reddit":    {"reddit_session"},
+}
+
+// cookieArgs devuelve los argumentos de yt-dlp para usar la jar de la plataforma, si existe.
+func (b *DownloadBot) cookieArgs(rawURL string) []string {
+	platform := detectPlatform(rawURL)
+	if platform == "" {
+		return nil
+	}
+	path := filepath.Join(b.cfg().CookiesDir, platform+".txt")
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return []string{"--cookies", path}
+}
+
+// cookieJarExpiry lee una jar en formato Netscape y devuelve cuándo caduca la sesión.
+func cookieJarExpiry(path, platform string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	wanted := make(map[string]bool)
+	for _, name := range authCookieNames[platform] {
+		wanted[name] = true
+	}
+
+	var authExpiry, latest time.Time
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Las cookies HttpOnly vienen con el prefijo "#HttpOnly_"
+		line = strings.TrimPrefix(line, "#HttpOnly_")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			continue
+		}
+		count++
+
+		ts, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil || ts == 0 {
+			continue // Cookie de sesión del navegador, sin fecha
+		}
+		expiry := time.Unix(ts, 0)
+		if expiry.After(latest) {
+			latest = expiry
+		}
+		if wanted[fields[5]] && (authExpiry.IsZero() || expiry.Before(authExpiry)) {
+			authExpiry = expiry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	if count == 0 {
+		return time.Time{}, fmt.Errorf("no contiene cookies válidas")
+	}
+	if !authExpiry.IsZero() {
+		return authExpiry, nil
+	}
+	return latest, nil
+}
+
+// cookieWatcher revisa periódicamente las jars y avisa al operador antes de que caduquen.
+func (b *DownloadBot) cookieWatcher() {
+	// Último aviso enviado por archivo, para no repetirlo en cada revisión
+	warned := make(map[string]string)
+
+	check := func() {
+		files, _ := filepath.Glob(filepath.Join(b.cfg().CookiesDir, "*.txt"))
+		for _, path := range files {
+			name := filepath.Base(path)
+			platform := strings.TrimSuffix(name, ".txt")
+
+			var level, text string
+			expiry, err := cookieJarExpiry(path, platform)
+			switch {
+			case err != nil:
+				level = "invalid"
+				text = fmt.Sprintf("❌ *Cookies de %s ilegibles*\n`%s`: %s", escapeMarkdown(platform), name, escapeMarkdown(err.Error()))
+			case expiry.IsZero():
+				continue // Solo cookies de sesión: no hay fecha que vigilar
+			case time.Now().After(expiry):
+				level = "expired"
+				text = fmt.Sprintf("❌ *Cookies de %s caducadas* desde %s.\nLas descargas autenticadas fallarán hasta que actualices `%s`.",
+					escapeMarkdown(platform), expiry.Format("02/01/2006 15:04"), name)
+			case time.Until(expiry) < b.cfg().CookieWarnBefore:
+				level = "expiring"
+				text = fmt.Sprintf("⚠️ *Cookies de %s a punto de caducar*\nExpiran el %s (en %s). Renueva `%s`.",
+					escapeMarkdown(platform), expiry.Format("02/01/2006 15:04"), time.Until(expiry).Round(time.Hour), name)
+			default:
+				level = "ok"
+			}
+
+			previous := warned[path]
+			warned[path] = level
+
+			if level != "ok" && level != previous {
+				log.Printf("🍪 %s: %s", name, level)
+				b.notifyAdmin(text)
+			}
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(b.cfg().CookieCheckInterval)
+	for range ticker.C {
+		check()
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Filas de cada tabla del panel de administración
+const (
+	dashboardTopUsers     = 20
+	dashboardRecentErrors = 20
+)
+
+// dashboardDownload es una descarga en curso tal como la ve el panel.
+type dashboardDownload struct {
+	UserID  int64     `json:"user_id"`
+	Title   string    `json:"title"`
+	URL     string    `json:"url"`
+	Mode    string    `json:"mode"`
+	Quality string    `json:"quality"`
+	Started time.Time `json:"started"`
+}
+
+type dashboardUser struct {
+	UserID int64 `json:"user_id"`
+	UsageStats
+	Downloaded int64 `json:"downloaded_today"`
+	Budget     int64 `json:"budget"` // Bytes al día, 0 = sin límite
+	Banned     bool  `json:"banned"`
+}
+
+type dashboardError struct {
+	UserID int64 `json:"user_id"`
+	userFailure
+}
+
+// dashboardOverview es todo lo que muestra el panel en cada refresco.
+type dashboardOverview struct {
+	Uptime      string              `json:"uptime"`
+	Maintenance MaintenanceState    `json:"maintenance"`
+	Health      healthReport        `json:"health"`
+	Slots       int                 `json:"slots"`
+	Active      int                 `json:"active"`
+	Waiting     int                 `json:"waiting"`
+	Queued      int                 `json:"queued"`
+	Workers     *[2]int64           `json:"workers,omitempty"` // Pendientes y en marcha en la cola de Redis
+	Downloads   []dashboardDownload `json:"downloads"`
+	DiskFree    int64               `json:"disk_free"`
+	DiskTotal   int64               `json:"disk_total"`
+	TempUsed    int64               `json:"temp_used"`
+	Reclaimed   int64               `json:"reclaimed"`
+	Users       []dashboardUser     `json:"users"`
+	Banned      []int64             `json:"banned"`
+	Errors      []dashboardError    `json:"errors"`
+}
+
+func (s *Store) runningJobs() []dashboardDownload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	downloads := make([]dashboardDownload, 0, len(s.data.Jobs))
+	for _, job := range s.data.Jobs {
+		d := dashboardDownload{UserID: job.Key.UserID, Mode: job.Mode, Quality: job.Quality, Started: job.Started}
+		if job.Session != nil && job.Session.Meta != nil {
+			d.Title, d.URL = job.Session.Meta.Title, job.Session.Meta.WebpageURL
+		}
+		downloads = append(downloads, d)
+	}
+	sort.Slice(downloads, func(i, j int) bool { return downloads[i].Started.Before(downloads[j].Started) })
+	return downloads
+}
+
+func (s *Store) bannedUsers() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]int64, 0, len(s.data.Moderation.Banned))
+	for id := range s.data.Moderation.Banned {
+		users = append(users, id)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+func dashboardURL() string {
+	return strings.TrimSuffix(WebhookURL, "/webhook") + "/admin"
+}
+
+// adminAuth es webAppAuth restringido a los administradores.
+func (b *DownloadBot) adminAuth(next func(w http.ResponseWriter, r *http.Request, userID int64)) http.HandlerFunc {
+	return b.webAppAuth(func(w http.ResponseWriter, r *http.Request, userID int64) {
+		if !b.cfg().isAdmin(userID) {
+			http.Error(w, "solo para administradores", http.StatusForbidden)
+			return
+		}
+		next(w, r, userID)
+	})
+}
+
+func (b *DownloadBot) registerDashboard() {
+	http.HandleFunc("/admin", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := webAppFiles.ReadFile("webapp/admin.html")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+	http.HandleFunc("/admin/api/overview", b.adminAuth(b.dashboardOverview))
+	http.HandleFunc("/admin/api/ban", b.adminAuth(b.dashboardBan))
+	http.HandleFunc("/admin/api/budget", b.adminAuth(b.dashboardBudget))
+	http.HandleFunc("/admin/api/maintenance", b.adminAuth(b.dashboardMaintenance))
+}
+
+func (b *DownloadBot) dashboardOverview(w http.ResponseWriter, r *http.Request, userID int64) {
+	now := time.Now()
+	overview := dashboardOverview{
+		Uptime:      time.Since(startedAt).Round(time.Minute).String(),
+		Maintenance: b.store.maintenance(),
+		Health:      b.currentHealth(),
+		Slots:       b.scheduler.slots,
+		Downloads:   b.store.runningJobs(),
+		Reclaimed:   cleanerReclaimed.Load(),
+		Banned:      b.store.bannedUsers(),
+	}
+	overview.Active, overview.Waiting, overview.Queued = b.scheduler.load()
+	if b.queue != nil {
+		if pending, running, err := b.queue.depth(); err == nil {
+			overview.Workers = &[2]int64{pending, running}
+		}
+	}
+	overview.DiskFree, overview.DiskTotal, _ = diskSpace()
+	overview.TempUsed, _ = dirSize(DownloadDir)
+
+	// Los que más descargan este mes
+	banned := make(map[int64]bool, len(overview.Banned))
+	for _, id := range overview.Banned {
+		banned[id] = true
+	}
+	today := now.Format(bandwidthDayLayout)
+	for id, stats := range b.store.usageForMonth(now.Format(usageMonthLayout)) {
+		overview.Users = append(overview.Users, dashboardUser{
+			UserID:     id,
+			UsageStats: stats,
+			Downloaded: b.store.bandwidth(id, today).Downloaded,
+			Budget:     b.dailyByteBudget(id),
+			Banned:     banned[id],
+		})
+	}
+	sort.Slice(overview.Users, func(i, j int) bool { return overview.Users[i].Jobs > overview.Users[j].Jobs })
+	if len(overview.Users) > dashboardTopUsers {
+		overview.Users = overview.Users[:dashboardTopUsers]
+	}
+
+	// Último fallo de cada usuario, del más reciente al más antiguo
+	b.lastFailures.Range(func(key, val any) bool {
+		overview.Errors = append(overview.Errors, dashboardError{UserID: key.(int64), userFailure: val.(userFailure)})
+		return true
+	})
+	sort.Slice(overview.Errors, func(i, j int) bool { return overview.Errors[i].At.After(overview.Errors[j].At) })
+	if len(overview.Errors) > dashboardRecentErrors {
+		overview.Errors = overview.Errors[:dashboardRecentErrors]
+	}
+	writeJSON(w, overview)
+}
+
+// dashboardBan banea o desbanea a un usuario: {"user_id": 1, "banned": true}
+func (b *DownloadBot) dashboardBan(w http.ResponseWriter, r *http.Request, adminID int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		UserID int64 `json:"user_id"`
+		Banned bool  `json:"banned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if req.Banned && b.cfg().isAdmin(req.UserID) {
+		http.Error(w, "no se puede banear a un administrador", http.StatusBadRequest)
+		return
+	}
+	b.store.updateModeration(func(m *ModerationState) {
+		if req.Banned {
+			m.Banned[req.UserID] = time.Now()
+		} else {
+			delete(m.Banned, req.UserID)
+		}
+	})
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+// dashboardBudget fija el presupuesto diario de un usuario, como /admin
+// budget: {"user_id": 1, "mb": 500} o {"user_id": 1, "default": true}
+func (b *DownloadBot) dashboardBudget(w http.ResponseWriter, r *http.Request, adminID int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		UserID  int64 `json:"user_id"`
+		MB      int64 `json:"mb"`
+		Default bool  `json:"default"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 || req.MB < 0 {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	b.store.setByteBudget(req.UserID, req.MB*1024*1024, req.Default)
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+// dashboardMaintenance activa o desactiva el mantenimiento, como
+// /maintenance: {"enabled": true, "message": "..."}
+func (b *DownloadBot) dashboardMaintenance(w http.ResponseWriter, r *http.Request, adminID int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Enabled bool   `json:"enabled"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	state := MaintenanceState{}
+	if req.Enabled {
+		state = MaintenanceState{Enabled: true, Message: strings.TrimSpace(req.Message), Since: time.Now()}
+	}
+	b.store.setMaintenance(state)
+	writeJSON(w, state)
+}
+
+// handleDashboardCommand envía el botón del panel de administración: /dashboard
+func (b *DownloadBot) handleDashboardCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+	button := webAppButton{Text: "🛠 Abrir panel de administración"}
+	button.WebApp.URL = dashboardURL()
+
+	msg := tgbotapi.NewMessage(chatID, "🛠 *Panel de administración*\n\nCola en vivo, uso por usuario, errores recientes, disco y controles de baneos, límites y mantenimiento.")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = webAppMarkup{InlineKeyboard: [][]webAppButton{{button}}}
+	b.bot.Send(msg)
+}
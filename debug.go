@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// debugMode activa el registro detallado: cada llamada a la API de Telegram
+// y la salida --verbose de yt-dlp. Se cambia en caliente con /debug. No se
+// usa el Debug de tgbotapi: lo leen todas las peticiones sin sincronizar y
+// cambiarlo en marcha sería una carrera de datos.
+var debugMode atomic.Bool
+
+func (b *DownloadBot) setDebug(on bool) {
+	debugMode.Store(on)
+	log.Printf("🐞 Modo depuración: %v", on)
+}
+
+// debugClient registra las llamadas a la Bot API mientras la depuración está
+// activa. Solo el método: la URL lleva el token del bot.
+type debugClient struct {
+	base tgbotapi.HTTPClient
+}
+
+func (c *debugClient) Do(req *http.Request) (*http.Response, error) {
+	if !debugMode.Load() {
+		return c.base.Do(req)
+	}
+	started := time.Now()
+	resp, err := c.base.Do(req)
+	method := path.Base(req.URL.Path)
+	if err != nil {
+		log.Printf("🐞 Telegram %s: %v (%s)", method, err, time.Since(started).Round(time.Millisecond))
+		return resp, err
+	}
+	log.Printf("🐞 Telegram %s: %s (%s)", method, resp.Status, time.Since(started).Round(time.Millisecond))
+	return resp, nil
+}
+
+// Opciones de yt-dlp cuyo valor puede llevar credenciales
+var secretYtdlpOptions = map[string]bool{
+	"--proxy": true, "--geo-verification-proxy": true,
+	"-u": true, "--username": true, "-p": true, "--password": true,
+	"--video-password": true, "--ap-username": true, "--ap-password": true,
+	"-2": true, "--twofactor": true, "--add-header": true, "--add-headers": true,
+	"--client-certificate-password": true,
+}
+
+// redactArgs oculta las credenciales de los argumentos de yt-dlp antes de
+// registrarlos: los valores de las opciones sensibles y el usuario y la
+// contraseña de cualquier URL.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		name, _, inline := strings.Cut(arg, "=")
+		switch {
+		case inline && secretYtdlpOptions[name]:
+			arg = name + "=***"
+		case i > 0 && secretYtdlpOptions[args[i-1]]:
+			arg = "***"
+		default:
+			if u, err := url.Parse(arg); err == nil && u.User != nil {
+				u.User = url.User("***")
+				arg = u.String()
+			}
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// handleDebugCommand activa o desactiva la depuración: /debug [on|off]
+func (b *DownloadBot) handleDebugCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(message.CommandArguments())) {
+	case "on":
+		b.setDebug(true)
+	case "off":
+		b.setDebug(false)
+	case "":
+	default:
+		b.sendReply(chatID, message.MessageID, "🐞 Uso: /debug [on|off]")
+		return
+	}
+	if debugMode.Load() {
+		b.sendReply(chatID, message.MessageID, "🐞 Depuración *activada*: se registran las llamadas a Telegram y la salida detallada de yt-dlp. Desactívala con /debug off.")
+		return
+	}
+	b.sendReply(chatID, message.MessageID, "🐞 Depuración *desactivada*.")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Los botones de un archivo entregado se siguen usando días después (repetir
+// o guardar desde el historial del chat), mucho más de lo que vive una sesión
+const deliveryButtonTTL = 30 * 24 * time.Hour
+
+// deliveryKeyboard son los botones que acompañan a un archivo entregado. Los
+// datos van sellados (callbacks.go), así que pueden llevar lo que haga falta.
+func (b *DownloadBot) deliveryKeyboard(userID int64, meta *VideoMetaData, mode, quality string) [][]tgbotapi.InlineKeyboardButton {
+	owner := strconv.FormatInt(userID, 10)
+	first := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔁 Repetir", "file:"+owner+":redo:"+mode+":"+quality+":"+meta.WebpageURL),
+	)
+	if !b.store.isSaved(userID, meta.WebpageURL) {
+		first = append(first, tgbotapi.NewInlineKeyboardButtonData("⭐ Guardar", saveButtonData(owner, meta, mode, quality)))
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{first}
+
+	// Ofrecer recordar la elección si la plataforma aún no tiene una fija. Las
+	// conversiones puntuales (nota de voz, video nota, sticker) no se ofrecen:
+	// nadie las quiere para todo lo que envía
+	platform := detectPlatform(meta.WebpageURL)
+	oneOff := mode == "voice" || mode == "note" || mode == "sticker"
+	if _, _, ok := b.store.alwaysChoice(userID, platform); !ok && platform != "" && !oneOff {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("📌 Usar siempre %s en %s", choiceLabel(mode, quality), platformDisplayName(platform)),
+			"file:"+owner+":always:"+platform+":"+mode+":"+quality,
+		)))
+	}
+	return rows
+}
+
+// attachDeliveryKeyboard añade los botones al archivo ya enviado (también
+// sirve para las copias de los bots de subida).
+func (b *DownloadBot) attachDeliveryKeyboard(key sessionKey, msgID int, meta *VideoMetaData, mode, quality string) {
+	rows := b.deliveryKeyboard(key.UserID, meta, mode, quality)
+	if msgID == 0 {
+		return
+	}
+	markup := b.sealKeyboardFor(key.ChatID, msgID, tgbotapi.NewInlineKeyboardMarkup(rows...), deliveryButtonTTL)
+	b.bot.Request(tgbotapi.NewEditMessageReplyMarkup(key.ChatID, msgID, markup))
+}
+
+// handleDeliveryCallback atiende los botones de un archivo entregado:
+// "file:<usuario>:<acción>:...". Solo los puede usar quien pidió el archivo.
+func (b *DownloadBot) handleDeliveryCallback(cb *tgbotapi.CallbackQuery, args []string) {
+	if len(args) < 2 || args[0] != strconv.FormatInt(cb.From.ID, 10) {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "⛔ Este botón es de otro usuario."))
+		return
+	}
+	switch args[1] {
+	case "redo", "get":
+		// La URL va al final porque puede contener ":"
+		if len(args) < 5 {
+			return
+		}
+		notice := "🔁 Repitiendo la descarga..."
+		if args[1] == "get" {
+			notice = "⬇️ Descargando..."
+		}
+		b.downloadFromButton(cb, strings.Join(args[4:], ":"), downloadChoice{Mode: args[2], Quality: args[3]}, notice)
+	case "save":
+		if len(args) < 6 {
+			return
+		}
+		title, _ := url.QueryUnescape(args[4])
+		b.store.saveLink(cb.From.ID, SavedLink{URL: strings.Join(args[5:], ":"), Title: title, Mode: args[2], Quality: args[3], SavedAt: time.Now()})
+		b.bot.Request(tgbotapi.NewCallback(cb.ID, "⭐ Guardado. Lo tienes en /saved."))
+		b.removeDeliveryButton(cb, "save")
+	case "unsave":
+		if len(args) < 3 {
+			return
+		}
+		b.store.unsaveLink(cb.From.ID, strings.Join(args[2:], ":"))
+		b.bot.Request(tgbotapi.NewCallback(cb.ID, "🗑 Quitado de guardados."))
+		text, markup := b.savedMenu(cb.From.ID)
+		b.editMessageMarkup(cb.Message.Chat.ID, cb.Message.MessageID, text, markup)
+	case "always":
+		if len(args) != 5 {
+			return
+		}
+		platform, mode, quality := args[2], args[3], args[4]
+		b.store.setAlwaysChoice(cb.From.ID, platform, mode, quality)
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, fmt.Sprintf("📌 Los enlaces de %s se descargarán directamente en %s. Usa /forget para volver al menú.",
+			platformDisplayName(platform), choiceLabel(mode, quality))))
+		b.removeDeliveryButton(cb, "always")
+	}
+}
+
+// removeDeliveryButton quita del archivo el botón de la acción ya hecha.
+func (b *DownloadBot) removeDeliveryButton(cb *tgbotapi.CallbackQuery, action string) {
+	if cb.Message.ReplyMarkup == nil {
+		return
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{}
+	for _, row := range cb.Message.ReplyMarkup.InlineKeyboard {
+		var kept []tgbotapi.InlineKeyboardButton
+		for _, button := range row {
+			if button.CallbackData != nil {
+				if target, ok := b.state.LoadCallback(*button.CallbackData); ok && strings.HasPrefix(target.Data, "file:"+strconv.FormatInt(cb.From.ID, 10)+":"+action+":") {
+					continue
+				}
+			}
+			kept = append(kept, button)
+		}
+		if len(kept) > 0 {
+			rows = append(rows, kept)
+		}
+	}
+	b.bot.Request(tgbotapi.NewEditMessageReplyMarkup(cb.Message.Chat.ID, cb.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}))
+}
+
+// handleForgetCommand borra las elecciones fijas: /forget [plataforma]
+func (b *DownloadBot) handleForgetCommand(message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	platform := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if b.store.forgetChoices(message.From.ID, platform) == 0 {
+		b.sendReply(message.Chat.ID, message.MessageID, "🤷 No tenías ninguna calidad fija guardada.")
+		return
+	}
+	text := "🧹 Listo: volverás a ver el menú de formatos en todas las plataformas."
+	if platform != "" {
+		text = fmt.Sprintf("🧹 Listo: volverás a ver el menú de formatos en %s.", platformDisplayName(platform))
+	}
+	b.sendReply(message.Chat.ID, message.MessageID, text)
+}
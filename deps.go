@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// Cada cuánto se vuelve a comprobar que ffmpeg sigue funcionando
+const depsCheckInterval = 5 * time.Minute
+
+// Programas externos que usa el bot; setBinaries los toma de la configuración
+var (
+	ytdlpBin     = "yt-dlp"
+	ffmpegBin    = "ffmpeg"
+	ffprobeBin   = "ffprobe"
+	galleryDLBin = "gallery-dl"
+)
+
+func setBinaries(cfg *Config) {
+	ytdlpBin, ffmpegBin, ffprobeBin, galleryDLBin = cfg.YtdlpBin, cfg.FFmpegBin, cfg.FFprobeBin, cfg.GalleryDLBin
+}
+
+// Sin ffmpeg no se pueden fusionar streams, convertir a MP3 ni dividir por
+// capítulos: el bot sigue funcionando solo con audio en su formato original.
+// Cuenta también ffprobe, que viene con él y con el que se miden los códecs
+// y la duración de lo descargado.
+var ffmpegAvailable atomic.Bool
+
+// Mensaje para los botones que necesitan ffmpeg cuando no está disponible
+const ffmpegUnavailableNotice = "⚠️ Esta opción necesita ffmpeg, que no está disponible ahora mismo. Prueba con el audio original."
+
+// checkFFmpeg ejecuta "ffmpeg -version" y "ffprobe -version": además de que
+// existan, comprueba que arrancan. Devuelve el que falla ("" si ninguno).
+func checkFFmpeg() string {
+	for _, bin := range []string{ffmpegBin, ffprobeBin} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := exec.CommandContext(ctx, bin, "-version").Run()
+		cancel()
+		if err != nil {
+			return bin
+		}
+	}
+	return ""
+}
+
+// watchDependencies hace la comprobación inicial y la repite en segundo plano,
+// avisando en el log cuando ffmpeg desaparece o vuelve.
+func watchDependencies() {
+	// Se parte de "disponible" para que una falta al arrancar quede en el log
+	ffmpegAvailable.Store(true)
+	updateDependencies()
+	go func() {
+		for range time.Tick(depsCheckInterval) {
+			updateDependencies()
+		}
+	}()
+}
+
+func updateDependencies() {
+	missing := checkFFmpeg()
+	ok := missing == ""
+	if ffmpegAvailable.Swap(ok) == ok {
+		return
+	}
+	if ok {
+		log.Printf("✅ ffmpeg y ffprobe disponibles: todas las opciones de descarga activas")
+	} else {
+		log.Printf("⚠️ %s no disponible: solo se ofrece audio en formato original", missing)
+	}
+}
+
+// needsFFmpeg indica si una opción del teclado depende de ffmpeg.
+func needsFFmpeg(mode, quality string) bool {
+	return mode != "link" && !(mode == "audio" && quality == "native")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Cada cuánto se vuelve a mirar el disco mientras una descarga espera espacio
+const diskPollInterval = 15 * time.Second
+
+// Último aviso al operador por falta de disco, para no repetirlo en cada descarga
+var lowDiskNotified atomic.Int64
+
+// diskNeeded estima el espacio que ocupará una descarga: el archivo y, como
+// yt-dlp baja video y audio por separado antes de unirlos, otro tanto para
+// los temporales. Más el margen de DISK_RESERVE_MB.
+func (b *DownloadBot) diskNeeded(expected int64) int64 {
+	return 2*expected + b.cfg().DiskReserveMB*1024*1024
+}
+
+// waitForDisk comprueba que hay espacio para la descarga antes de empezarla.
+// Si falta, la descarga espera (avisando al usuario) hasta DISK_WAIT_TIMEOUT
+// a que otras terminen y el limpiador libere espacio; si no llega, se
+// rechaza. Devuelve false si la descarga no debe seguir.
+func (b *DownloadBot) waitForDisk(key sessionKey, sess *UserSession, expected int64) bool {
+	need := b.diskNeeded(expected)
+	deadline := time.Now().Add(b.cfg().DiskWaitTimeout)
+	warned := false
+	for {
+		free, _, err := diskSpace()
+		if err != nil || free >= need {
+			// Si no se puede medir el disco no se bloquea nada
+			return true
+		}
+		if !warned {
+			log.Printf("💾 Poco disco para una descarga del chat %d: libre %s, necesita %s", key.ChatID, humanSize(free), humanSize(need))
+			b.notifyLowDisk(free)
+			if b.cfg().DiskWaitTimeout <= 0 {
+				break
+			}
+			b.editMessage(key.ChatID, sess.MsgID, fmt.Sprintf("💾 *El servidor anda justo de espacio.*\n\nTu descarga empezará en cuanto se libere (como mucho %d min de espera).", int(b.cfg().DiskWaitTimeout.Minutes())))
+			warned = true
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(diskPollInterval)
+	}
+	b.state.DeleteSession(key)
+	b.editMessage(key.ChatID, sess.MsgID, "❌ El servidor no tiene espacio libre para esta descarga ahora mismo. Inténtalo de nuevo más tarde.")
+	return false
+}
+
+// notifyLowDisk avisa al operador como mucho una vez por hora.
+func (b *DownloadBot) notifyLowDisk(free int64) {
+	last := lowDiskNotified.Load()
+	now := time.Now().Unix()
+	if now-last < int64(time.Hour/time.Second) || !lowDiskNotified.CompareAndSwap(last, now) {
+		return
+	}
+	b.notifyAdmin(fmt.Sprintf("💾 Queda poco disco en la carpeta de descargas: %s libres. Las descargas nuevas esperan o se rechazan.", humanSize(free)))
+}
+
+// dirSize suma el tamaño de los archivos de una carpeta y sus subcarpetas.
+func dirSize(dir string) (size int64, files int) {
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+// handleStatsCommand muestra al administrador el estado del servidor: disco,
+// descargas en curso, usuarios y uso del mes.
+func (b *DownloadBot) handleStatsCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+
+	text := "📊 *Estadísticas*\n\n"
+	if free, total, err := diskSpace(); err == nil {
+		used, files := dirSize(DownloadDir)
+		text += fmt.Sprintf("💾 Disco: %s libres de %s (%.0f%% ocupado)\n📁 Descargas: %s en %d archivos\n🛡 Margen reservado: %d MB\n🧹 Liberado por el limpiador: %s\n\n",
+			humanSize(free), humanSize(total), 100*float64(total-free)/float64(total), humanSize(used), files, b.cfg().DiskReserveMB, humanSize(cleanerReclaimed.Load()))
+	} else {
+		text += "💾 Disco: no se pudo consultar\n\n"
+	}
+
+	recipients, optedOut := b.store.announcementRecipients()
+	month := time.Now().Format("2006-01")
+	var jobs, failed int
+	var bytes int64
+	for _, stats := range b.store.usageForMonth(month) {
+		jobs += stats.Jobs
+		failed += stats.Failed
+		bytes += stats.Bytes
+	}
+	text += fmt.Sprintf("⚙️ Descargas en curso: %d\n👥 Usuarios con anuncios: %d (%d desactivados)\n📅 Este mes: %d descargas, %d fallidas, %s enviados",
+		activeJobs.Load(), len(recipients), optedOut, jobs, failed, humanSize(bytes))
+	b.sendReply(chatID, message.MessageID, text)
+}
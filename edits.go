@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Cuánto se recuerda qué enlace se procesó de cada mensaje
+const editedLinkWindow = 48 * time.Hour
+
+func linkSeenKey(message *tgbotapi.Message, url string) string {
+	return fmt.Sprintf("link:%d:%d:%s", message.Chat.ID, message.MessageID, url)
+}
+
+// markLinkSeen apunta que el enlace del mensaje ya se procesó, para no
+// repetir la descarga si luego se edita el mensaje sin cambiar el enlace.
+func (b *DownloadBot) markLinkSeen(message *tgbotapi.Message, url string) {
+	b.state.Incr(linkSeenKey(message, url), editedLinkWindow)
+}
+
+// editedLink es el enlace que haría reaccionar al bot en el mensaje: el de
+// /dl o, sin comando, el del propio mensaje o el del mensaje respondido.
+func editedLink(message *tgbotapi.Message) string {
+	if message.IsCommand() {
+		if message.Command() != "dl" {
+			return ""
+		}
+		if url := extractURL(message.CommandArguments()); url != "" {
+			return url
+		}
+		return repliedURL(message)
+	}
+	if url := messageURL(message); url != "" {
+		return url
+	}
+	return repliedURL(message)
+}
+
+// handleEditedMessage vuelve a procesar un mensaje editado cuando su enlace
+// ha cambiado, p. ej. al corregir una URL mal escrita. Se pasa por
+// handleMessage para aplicar las mismas reglas (menciones en grupos, /dl,
+// modo canal) y la validación desde el principio.
+func (b *DownloadBot) handleEditedMessage(message *tgbotapi.Message) {
+	// Las respuestas del operador a los reportes ya se enviaron al usuario
+	if message.Chat.ID == b.reportChatID() {
+		return
+	}
+	// De los mensajes más antiguos ya no se recuerda qué enlace se procesó:
+	// editarlos volvería a descargar un enlace ya atendido
+	if time.Since(message.Time()) > editedLinkWindow {
+		return
+	}
+	url := editedLink(message)
+	if url == "" || b.state.Count(linkSeenKey(message, url)) > 0 {
+		return
+	}
+	b.handleMessage(message)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Videos que se listan como botones en el selector de un post con varios
+const maxEntryButtons = 20
+
+// decodeMetadataLines lee la salida de yt-dlp -j: un objeto JSON por línea.
+// Los posts con varios videos (tweets, Reddit) dan una línea por video.
+func decodeMetadataLines(output []byte) ([]*VideoMetaData, error) {
+	var entries []*VideoMetaData
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	// Cada línea trae la lista completa de formatos: puede ser muy larga
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var meta VideoMetaData
+		if err := json.Unmarshal(line, &meta); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &meta)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("salida vacía")
+	}
+	return entries, nil
+}
+
+// multiEntryMeta agrupa los videos de un post en unos metadatos "padre" que
+// solo sirven para el selector.
+func multiEntryMeta(url string, entries []*VideoMetaData) *VideoMetaData {
+	first := entries[0]
+	return &VideoMetaData{
+		ID:         first.ID,
+		Title:      first.Title,
+		Thumbnail:  first.Thumbnail,
+		WebpageURL: url,
+		Uploader:   first.Uploader,
+		Extractor:  first.Extractor,
+		Entries:    entries,
+	}
+}
+
+// offerEntries muestra el selector de videos de un post: uno concreto (que
+// sigue con el teclado de calidades) o todos como álbum.
+func (b *DownloadBot) offerEntries(key sessionKey, sess *UserSession) {
+	entries := sess.Meta.Entries
+	var rows [][]tgbotapi.InlineKeyboardButton
+	// Todos a la vez es una ventaja premium; los videos sueltos, de todos
+	premium := b.hasPremiumPerks(key.UserID)
+	if ffmpegAvailable.Load() && premium {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📚 Descargar todos como álbum (%d)", len(entries)), "entry:all"),
+		))
+	}
+	for i, entry := range entries {
+		if i >= maxEntryButtons {
+			break
+		}
+		label := fmt.Sprintf("🎬 Video %d/%d", i+1, len(entries))
+		if entry.Duration > 0 {
+			label += " · " + formatClock(time.Duration(entry.Duration*float64(time.Second)))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, "entry:"+strconv.Itoa(i)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Cancelar", "cancel"),
+	))
+
+	text := fmt.Sprintf("🎞 *%s*\n\nEste post tiene %d videos. Elige uno o descárgalos todos:", escapeMarkdown(sess.Meta.Title), len(entries))
+	if !premium {
+		text = fmt.Sprintf("🎞 *%s*\n\nEste post tiene %d videos. Elige uno. 💎 Con /premium puedes descargarlos todos de una vez.", escapeMarkdown(sess.Meta.Title), len(entries))
+	}
+	b.editMessageMarkup(key.ChatID, sess.MsgID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// handleEntryCallback atiende el selector: "entry:<índice>" o "entry:all".
+func (b *DownloadBot) handleEntryCallback(key sessionKey, sess *UserSession, choice string) {
+	entries := sess.Meta.Entries
+	if choice == "all" {
+		if len(entries) > 0 && b.hasPremiumPerks(key.UserID) && b.claimSelection(key, sess) {
+			b.schedule(key, sess, func() { b.downloadAllEntries(key, sess) })
+		}
+		return
+	}
+	i, err := strconv.Atoi(choice)
+	if err != nil || i < 0 || i >= len(entries) {
+		return
+	}
+	// A partir de aquí la sesión es la de un video normal
+	sess.Meta = entries[i]
+	b.state.SaveSession(key, sess)
+	b.editMessageMarkup(key.ChatID, sess.MsgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+}
+
+// downloadAllEntries descarga cada video del post en la mejor calidad que
+// cabe y los envía juntos como álbum.
+func (b *DownloadBot) downloadAllEntries(key sessionKey, sess *UserSession) {
+	chatID, msgID, parent := key.ChatID, sess.MsgID, sess.Meta
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	defer b.finishUsageJob(job)
+
+	fileBase := fmt.Sprintf("entries_%d_%d_%d", chatID, key.UserID, time.Now().Unix())
+	var media []interface{}
+	var paths []string
+	defer func() {
+		for _, path := range paths {
+			os.Remove(path)
+		}
+	}()
+	for i, entry := range parent.Entries {
+		b.editMessage(chatID, msgID, fmt.Sprintf("🎞 *Video %d de %d...*", i+1, len(parent.Entries)))
+		path, err := b.downloadMedia(chatID, msgID, entry, "video", "fit", downloadOptions{}, fmt.Sprintf("%s_%d", fileBase, i+1))
+		var tooLarge *fileTooLargeError
+		if errors.As(err, &tooLarge) {
+			os.Remove(tooLarge.Path)
+		}
+		if err != nil {
+			log.Printf("Error con el video %d de %s: %v", i+1, parent.WebpageURL, err)
+			continue
+		}
+		paths = append(paths, path)
+		item := tgbotapi.NewInputMediaVideo(tgbotapi.FilePath(path))
+		item.SupportsStreaming = true
+		media = append(media, item)
+		if info, err := os.Stat(path); err == nil {
+			job.bytes += info.Size()
+		}
+	}
+	if len(media) == 0 {
+		b.reportFailure("descarga", key, parent.WebpageURL, errors.New("ningún video del post se pudo descargar"))
+		b.editMessage(chatID, msgID, "❌ No se pudo descargar ningún video del post.")
+		return
+	}
+
+	b.editMessage(chatID, msgID, fmt.Sprintf("📤 *Enviando %d videos...*", len(media)))
+	caption := b.attributionCaption(key.UserID, parent)
+	sentAll := true
+	for start := 0; start < len(media); start += maxMediaGroupSize {
+		end := min(start+maxMediaGroupSize, len(media))
+		if !b.sendMediaChunk(chatID, sess.ReplyTo, media[start:end], caption) {
+			sentAll = false
+		}
+		caption = "" // Solo el primer álbum lleva pie
+	}
+	job.ok = sentAll
+	b.state.DeleteSession(key)
+	if !sentAll {
+		b.editMessage(chatID, msgID, "⚠️ No se pudieron enviar todos los videos.")
+		return
+	}
+	if len(media) < len(parent.Entries) {
+		b.editMessage(chatID, msgID, fmt.Sprintf("⚠️ Se enviaron %d de %d videos.", len(media), len(parent.Entries)))
+		return
+	}
+	b.deleteMessage(chatID, msgID)
+}
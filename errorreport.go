@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Cuánto stderr de yt-dlp/ffmpeg se conserva para los informes de error
+const (
+	stderrTailBytes = 8 * 1024
+	stderrTailLines = 15
+)
+
+// Límite de texto de un mensaje de Telegram (con margen)
+const maxReportLength = 4000
+
+// tailWriter guarda solo los últimos bytes escritos: basta para ver por qué
+// falló yt-dlp sin acumular en memoria toda su salida.
+type tailWriter struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailBytes {
+		t.buf = t.buf[len(t.buf)-stderrTailBytes:]
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// downloadFailure es un error para el usuario (Error) que conserva la causa y
+// el stderr del proceso para el informe al operador.
+type downloadFailure struct {
+	userMsg string
+	cause   error
+	stderr  string
+}
+
+func (e *downloadFailure) Error() string { return e.userMsg }
+func (e *downloadFailure) Unwrap() error { return e.cause }
+
+// reportFailure envía al chat de errores los detalles de un fallo: enlace,
+// usuario, causa, cola del stderr y desde dónde se llamó. El usuario solo ve
+// el mensaje genérico.
+func (b *DownloadBot) reportFailure(op string, key sessionKey, url string, err error) {
+	last := userFailure{URL: url, Error: err.Error(), At: time.Now()}
+	b.lastFailures.Store(key.UserID, last)
+	lastFailure.Store(&last)
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "🐞 Fallo en %s\n\n🔗 %s\n👤 Usuario: %d\n💬 Chat: %d\n🕒 %s\n\n❌ %v\n",
+		op, url, key.UserID, key.ChatID, time.Now().Format("02/01/2006 15:04:05"), err)
+
+	var failure *downloadFailure
+	if errors.As(err, &failure) {
+		if failure.cause != nil {
+			fmt.Fprintf(&text, "⚙️ Causa: %v\n", failure.cause)
+		}
+		if tail := lastLines(failure.stderr, stderrTailLines); tail != "" {
+			fmt.Fprintf(&text, "\n📄 stderr:\n%s\n", tail)
+		}
+	}
+	fmt.Fprintf(&text, "\n🧭 %s", callerChain(2))
+
+	report := text.String()
+	// Se corta por caracteres: cortar por bytes podría partir una ñ o un
+	// emoji y Telegram rechaza el texto por no ser UTF-8 válido
+	if runes := []rune(report); len(runes) > maxReportLength {
+		report = string(runes[:maxReportLength]) + "…"
+	}
+	if b.cfg().ErrorReportChatID == 0 {
+		log.Printf("ℹ️ Informe de error (sin ERROR_REPORT_CHAT_ID):\n%s", report)
+		return
+	}
+	// Sin Markdown: el stderr y las URLs romperían el formato
+	msg := tgbotapi.NewMessage(b.cfg().ErrorReportChatID, report)
+	msg.DisableWebPagePreview = true
+	if _, err := b.bot.Send(msg); err != nil {
+		log.Printf("Error enviando informe de error: %v", err)
+	}
+}
+
+// lastLines devuelve las últimas n líneas no vacías del texto.
+func lastLines(text string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		// El progreso de yt-dlp reescribe la línea con \r: nos quedamos con lo último
+		if i := strings.LastIndex(line, "\r"); i >= 0 {
+			line = line[i+1:]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// callerChain resume la pila de llamadas del paquete (sin runtime) desde skip.
+func callerChain(skip int) string {
+	pcs := make([]uintptr, 10)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var chain []string
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, "main.") {
+			chain = append(chain, fmt.Sprintf("%s:%d", strings.TrimPrefix(frame.Function, "main."), frame.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	return strings.Join(chain, " ← ")
+}
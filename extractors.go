@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cada cuánto se vuelve a leer la lista de extractores (cambia al actualizar yt-dlp)
+const extractorListTTL = 24 * time.Hour
+
+// extractorCache guarda los nombres de extractor de `yt-dlp --list-extractors`
+// para validar enlaces sin lanzar una extracción completa.
+type extractorCache struct {
+	mu       sync.Mutex
+	names    map[string]bool
+	loadedAt time.Time
+	loading  chan struct{} // Abierto mientras un yt-dlp lee la lista
+}
+
+var extractors extractorCache
+
+// load refresca la lista si caducó. Si yt-dlp falla se conserva la anterior.
+// yt-dlp se lanza sin el mutex: mientras lee, los demás usan la lista
+// anterior o, si aún no hay, esperan a esa misma lectura.
+func (c *extractorCache) load(b *DownloadBot) map[string]bool {
+	c.mu.Lock()
+	if c.names != nil && time.Since(c.loadedAt) < extractorListTTL {
+		defer c.mu.Unlock()
+		return c.names
+	}
+	if c.loading != nil {
+		names, loading := c.names, c.loading
+		c.mu.Unlock()
+		if names != nil {
+			return names
+		}
+		<-loading
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.names
+	}
+	loading := make(chan struct{})
+	c.loading = loading
+	c.mu.Unlock()
+
+	names := readExtractors(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if names != nil {
+		c.names, c.loadedAt = names, time.Now()
+	}
+	c.loading = nil
+	close(loading)
+	return c.names
+}
+
+// readExtractors lanza `yt-dlp --list-extractors`; nil si falla.
+func readExtractors(b *DownloadBot) map[string]bool {
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().ProbeTimeout)
+	defer cancel()
+	out, err := b.ytdlpCommand(ctx, "", "--list-extractors").Output()
+	if err != nil {
+		log.Printf("⚠️ No se pudo leer la lista de extractores: %v", err)
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, line := range strings.Split(string(out), "\n") {
+		// "youtube:tab", "Instagram (CURRENTLY BROKEN)" -> "youtube", "instagram"
+		name := strings.ToLower(strings.TrimSpace(line))
+		name, _, _ = strings.Cut(name, ":")
+		name, _, _ = strings.Cut(name, " ")
+		if name != "" && name != "generic" {
+			names[name] = true
+		}
+	}
+	log.Printf("🧩 %d extractores de yt-dlp en caché", len(names))
+	return names
+}
+
+// hasExtractor comprueba si algún nombre del dominio (p. ej. "vimeo" en
+// player.vimeo.com) corresponde a un extractor propio de yt-dlp.
+func (b *DownloadBot) hasExtractor(host string) bool {
+	names := extractors.load(b)
+	if names == nil {
+		return true // Sin lista no podemos descartar nada
+	}
+	labels := strings.Split(strings.TrimPrefix(host, "www."), ".")
+	// El último es el TLD: no identifica al sitio
+	for _, label := range labels[:len(labels)-1] {
+		if names[label] || names[strings.ReplaceAll(label, "-", "")] {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLink descarta con un análisis barato los enlaces que no se pueden
+// procesar, antes de lanzar la extracción de metadatos (que es la única).
+func (b *DownloadBot) validateLink(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(u.Hostname(), ".") {
+		return errors.New("❌ El enlace no es válido. Envía una URL completa que empiece por http:// o https://")
+	}
+	// Las plataformas conocidas (incluidos dominios cortos como youtu.be) no se comprueban
+	_, known := platformNames[detectPlatform(rawURL)]
+	if !b.cfg().AllowGenericExtractor && !known && !b.hasExtractor(strings.ToLower(u.Hostname())) {
+		return errors.New("❌ Este sitio no está soportado.")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Cuánto tiempo se recuerda un enlace que falló de forma permanente antes de
+// volver a intentarlo con yt-dlp (un video privado puede hacerse público).
+const failureMemoryTTL = 30 * 24 * time.Hour
+
+// Tipos de fallo permanente
+const (
+	failurePrivate = "private"
+	failureRemoved = "removed"
+	failureGeo     = "geo"
+	failureAge     = "age" // Ya no se guarda: solo para ignorar los antiguos
+	failureDRM     = "drm"
+)
+
+// Fragmentos del stderr de yt-dlp que indican un fallo que no se arregla
+// reintentando. El orden importa: se usa la primera coincidencia.
+var failurePatterns = []struct {
+	kind     string
+	patterns []string
+}{
+	{failurePrivate, []string{"private video", "this video is private", "this account is private"}},
+	{failureGeo, []string{"not available in your country", "geo restricted", "geo-restricted"}},
+	{failureDRM, []string{"drm protected", "drm-protected", "is drm"}},
+	{failureRemoved, []string{"video unavailable", "has been removed", "no longer available", "has been terminated", "does not exist", "http error 404", "post not found", "this tweet is unavailable"}},
+}
+
+// Fallos que pueden arreglarse solos (o con otra elección): no se recuerdan,
+// pero el usuario recibe una explicación en vez de un error genérico.
+var transientFailures = []struct {
+	patterns []string
+	message  string
+}{
+	{[]string{"http error 429", "too many requests", "rate-limit", "rate limit"},
+		"🚦 El sitio está limitando las descargas del servidor. Inténtalo de nuevo en unos minutos."},
+	{[]string{"not a bot", "login required", "log in to", "use --cookies", "requires authentication"},
+		"🔐 El sitio pide iniciar sesión o comprobar que no eres un robot. Inténtalo más tarde; si sigue pasando, avisa con /report."},
+	// Con otras cookies (una cuenta verificada o miembro del canal) sí se
+	// pueden descargar: no se recuerdan como fallo permanente
+	{[]string{"confirm your age", "age-restricted", "age restricted", "inappropriate for some users"},
+		"🔞 Este contenido tiene restricción de edad y el servidor no tiene una cuenta verificada para verlo."},
+	{[]string{"members-only", "join this channel to get access"},
+		"🔒 Este contenido es solo para miembros del canal y el servidor no tiene acceso."},
+	{[]string{"premieres in", "live event will begin", "this live event", "is upcoming"},
+		"⏳ Este directo o estreno aún no ha empezado. Vuelve a enviarlo cuando esté en emisión."},
+	{[]string{"requested format is not available"},
+		"🎞 La calidad elegida no está disponible para este contenido. Prueba con otra."},
+	{[]string{"unsupported url"},
+		"❌ Este enlace no lleva a un video que se pueda descargar."},
+	{[]string{"no space left on device"},
+		"💾 El servidor se ha quedado sin espacio. Inténtalo de nuevo más tarde."},
+	{[]string{"unable to download", "connection reset", "timed out", "temporary failure in name resolution"},
+		"📡 Hubo un problema de red al hablar con el sitio. Inténtalo de nuevo."},
+}
+
+// ytdlpErrorMessage traduce el stderr de yt-dlp a un mensaje útil para el
+// usuario. Devuelve false si no reconoce la causa.
+func ytdlpErrorMessage(stderr string) (string, bool) {
+	if kind := classifyFailure(stderr); kind != "" {
+		return FailureEntry{Kind: kind}.userError(false).Error(), true
+	}
+	lower := strings.ToLower(stderr)
+	for _, failure := range transientFailures {
+		for _, pattern := range failure.patterns {
+			if strings.Contains(lower, pattern) {
+				return failure.message, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FailureEntry es un enlace que falló de forma permanente.
+type FailureEntry struct {
+	Kind     string    `json:"kind"`
+	Title    string    `json:"title,omitempty"` // Título conocido por el historial, para sugerir una búsqueda
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// classifyFailure devuelve el tipo de fallo permanente o "" si puede ser transitorio.
+func classifyFailure(stderr string) string {
+	stderr = strings.ToLower(stderr)
+	for _, group := range failurePatterns {
+		for _, pattern := range group.patterns {
+			if strings.Contains(stderr, pattern) {
+				return group.kind
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Store) knownFailure(rawURL string) (FailureEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.data.Failures[rawURL]
+	// Las restricciones de edad se guardaban como permanentes: ya no lo son
+	if !ok || entry.Kind == failureAge || time.Since(entry.FailedAt) > failureMemoryTTL {
+		return FailureEntry{}, false
+	}
+	return entry, true
+}
+
+// recordFailure guarda el fallo y, de paso, descarta los que ya caducaron.
+func (s *Store) recordFailure(rawURL string, entry FailureEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, old := range s.data.Failures {
+		if time.Since(old.FailedAt) > failureMemoryTTL {
+			delete(s.data.Failures, key)
+		}
+	}
+	s.data.Failures[rawURL] = entry
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando enlaces fallidos: %v", err)
+	}
+}
+
+// titleForURL busca en el historial el título de un enlace ya descargado.
+func (s *Store) titleForURL(rawURL string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.data.Archive {
+		if entry.URL == rawURL && entry.Title != "" {
+			return entry.Title
+		}
+	}
+	return ""
+}
+
+// userError construye el mensaje para el usuario con una búsqueda alternativa.
+func (f FailureEntry) userError(remembered bool) error {
+	var text string
+	switch f.Kind {
+	case failurePrivate:
+		text = "🔒 Este contenido es privado o requiere iniciar sesión."
+	case failureGeo:
+		text = "🌍 Este contenido no está disponible en la región del servidor."
+	case failureDRM:
+		text = "🔏 Este contenido está protegido con DRM y no se puede descargar."
+	default:
+		text = "🗑️ Este contenido fue eliminado o ya no está disponible."
+	}
+	if remembered {
+		text += fmt.Sprintf("\n_Comprobado el %s._", f.FailedAt.Format("02/01/2006"))
+	}
+	if f.Title != "" {
+		search := "https://www.youtube.com/results?search_query=" + url.QueryEscape(f.Title)
+		text += fmt.Sprintf("\n\n🔎 ¿Buscas otra copia? [Buscar «%s» en YouTube](%s)", escapeMarkdown(f.Title), search)
+	}
+	return errors.New(text)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Reportes por usuario y hora, para que /report no sirva para inundar al operador
+const maxReportsPerHour = 5
+
+// Línea del reporte con el chat y el mensaje a los que va la respuesta del operador
+var reportOriginPattern = regexp.MustCompile(`(?m)^💬 Chat (-?\d+) · mensaje (\d+)$`)
+
+// userFailure es el último fallo de un usuario, para adjuntarlo a su reporte.
+type userFailure struct {
+	URL   string    `json:"url"`
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+// reportChatID es el chat del operador que recibe los reportes.
+func (b *DownloadBot) reportChatID() int64 {
+	if b.cfg().AdminChatID != 0 {
+		return b.cfg().AdminChatID
+	}
+	return b.cfg().ErrorReportChatID
+}
+
+// handleReportCommand envía la opinión del usuario al operador, con su último
+// fallo si lo hubo: /report <texto>. El operador contesta respondiendo al
+// mensaje y el bot entrega la respuesta (handleReportReply).
+func (b *DownloadBot) handleReportCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil {
+		return
+	}
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		b.sendReply(chatID, message.MessageID, "📝 Uso: /report <mensaje>\n\nCuéntanos qué ha fallado o qué te gustaría mejorar. Si tu última descarga falló, se adjunta automáticamente.")
+		return
+	}
+	adminChat := b.reportChatID()
+	if adminChat == 0 {
+		b.sendReply(chatID, message.MessageID, "⚠️ Los reportes no están disponibles en este bot.")
+		return
+	}
+	if b.state.Incr(fmt.Sprintf("report:%d", message.From.ID), time.Hour) > maxReportsPerHour {
+		b.sendReply(chatID, message.MessageID, "⏳ Has enviado muchos reportes seguidos. Inténtalo de nuevo más tarde.")
+		return
+	}
+
+	var report strings.Builder
+	name := strings.TrimSpace(message.From.FirstName + " " + message.From.LastName)
+	if message.From.UserName != "" {
+		name += " @" + message.From.UserName
+	}
+	fmt.Fprintf(&report, "📨 Reporte de usuario\n\n👤 %s (%d)\n💬 Chat %d · mensaje %d\n\n%s\n", name, message.From.ID, chatID, message.MessageID, text)
+	if val, ok := b.lastFailures.Load(message.From.ID); ok {
+		failure := val.(userFailure)
+		fmt.Fprintf(&report, "\n❌ Último fallo (%s):\n🔗 %s\n%s\n", failure.At.Format("02/01/2006 15:04"), failure.URL, failure.Error)
+	}
+	report.WriteString("\n↩️ Responde a este mensaje para contestar al usuario.")
+
+	// Sin Markdown: el texto del usuario y las URLs romperían el formato
+	msg := tgbotapi.NewMessage(adminChat, report.String())
+	msg.DisableWebPagePreview = true
+	if _, err := b.bot.Send(msg); err != nil {
+		b.sendReply(chatID, message.MessageID, "❌ No se pudo enviar el reporte. Inténtalo de nuevo más tarde.")
+		return
+	}
+	b.sendReply(chatID, message.MessageID, "✅ ¡Gracias! Tu reporte ha llegado al equipo. Si hace falta, te responderemos por aquí.")
+}
+
+// handleReportReply entrega al usuario la respuesta del operador a un
+// reporte. Devuelve false si el mensaje no es una respuesta a un reporte.
+func (b *DownloadBot) handleReportReply(message *tgbotapi.Message) bool {
+	original := message.ReplyToMessage
+	if original == nil || original.From == nil || original.From.ID != b.bot.Self.ID || message.Chat.ID != b.reportChatID() {
+		return false
+	}
+	m := reportOriginPattern.FindStringSubmatch(original.Text)
+	if m == nil || message.Text == "" {
+		return false
+	}
+	chatID, _ := strconv.ParseInt(m[1], 10, 64)
+	replyTo, _ := strconv.Atoi(m[2])
+
+	msg := tgbotapi.NewMessage(chatID, "💬 Respuesta del equipo a tu reporte:\n\n"+message.Text)
+	msg.ReplyToMessageID = replyTo
+	msg.AllowSendingWithoutReply = true
+	if _, err := b.bot.Send(msg); err != nil {
+		log.Printf("⚠️ No se pudo entregar la respuesta al reporte: %v", err)
+		b.sendReply(message.Chat.ID, message.MessageID, "❌ No se pudo entregar la respuesta (¿el usuario bloqueó el bot?).")
+		return true
+	}
+	b.sendReply(message.Chat.ID, message.MessageID, "✅ Respuesta enviada.")
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Longitud máxima del nombre (sin extensión) de los archivos enviados
+const maxSentFileName = 100
+
+// Campos de plantilla de yt-dlp: %(title)s, %(id)s, %(height)d...
+var templateFieldPattern = regexp.MustCompile(`%\(([a-z_]+)\)[sd]`)
+
+// Caracteres que no se admiten en nombres de archivo en alguno de los clientes de Telegram
+var unsafeFileNameChars = strings.NewReplacer("/", "-", "\\", "-", ":", "-", "*", "", "?", "", "\"", "", "<", "", ">", "", "|", "")
+
+// expandFileTemplate sustituye los campos de yt-dlp que conocemos de los
+// metadatos; los demás quedan como "NA", igual que hace yt-dlp.
+func expandFileTemplate(template string, meta *VideoMetaData, quality string) string {
+	fields := map[string]string{
+		"title":     meta.Title,
+		"id":        meta.ID,
+		"uploader":  meta.Uploader,
+		"channel":   meta.Uploader,
+		"extractor": meta.Extractor,
+		"duration":  strconv.Itoa(int(meta.Duration)),
+		"height":    quality,
+	}
+	return templateFieldPattern.ReplaceAllStringFunc(template, func(field string) string {
+		name := templateFieldPattern.FindStringSubmatch(field)[1]
+		if value := fields[name]; value != "" {
+			return value
+		}
+		return "NA"
+	})
+}
+
+// sanitizeFileName deja el nombre apto para Telegram: sin separadores de ruta
+// ni caracteres de control, sin espacios sobrantes y de longitud acotada.
+func sanitizeFileName(name string) string {
+	name = unsafeFileNameChars.Replace(name)
+	name = strings.Map(func(r rune) rune {
+		// Saltos de línea y tabuladores separan palabras: pasan a espacio
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+	for utf8.RuneCountInString(name) > maxSentFileName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return strings.Trim(name, " .")
+}
+
+// sentFileName decide con qué nombre se envía el archivo: la plantilla del
+// usuario o, si no tiene, la del operador (FILENAME_TEMPLATE).
+func (b *DownloadBot) sentFileName(userID int64, meta *VideoMetaData, quality, ext string) string {
+	template := b.cfg().FilenameTemplate
+	if custom := b.store.userSettings(userID).FilenameTemplate; custom != "" {
+		template = custom
+	}
+	name := sanitizeFileName(expandFileTemplate(template, meta, quality))
+	if name == "" {
+		name = "video"
+	}
+	return name + ext
+}
+
+// handleFilenameSetting cambia la plantilla del usuario: /settings name <plantilla> | reset
+func (b *DownloadBot) handleFilenameSetting(message *tgbotapi.Message, args []string) {
+	chatID, userID := message.Chat.ID, message.From.ID
+	if len(args) == 0 {
+		current := b.store.userSettings(userID).FilenameTemplate
+		if current == "" {
+			current = b.cfg().FilenameTemplate + " (predeterminada)"
+		}
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("📝 Plantilla de nombre: `%s`\n\nCambiar: /settings name <plantilla>\nCampos: %%(title)s, %%(uploader)s, %%(id)s, %%(height)s, %%(extractor)s\nVolver a la predeterminada: /settings name reset", current))
+		return
+	}
+
+	template := strings.Join(args, " ")
+	if template == "reset" {
+		template = ""
+	} else if !templateFieldPattern.MatchString(template) {
+		b.sendReply(chatID, message.MessageID, "❌ La plantilla debe incluir al menos un campo, p. ej. `%(title)s`.")
+		return
+	}
+	b.store.updateUserSettings(userID, func(s *UserSettings) { s.FilenameTemplate = template })
+	if template == "" {
+		b.sendReply(chatID, message.MessageID, "✅ Se usará la plantilla de nombre predeterminada.")
+		return
+	}
+	b.sendReply(chatID, message.MessageID, "✅ Plantilla de nombre guardada.")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"normal", "Mi video", "Mi video"},
+		{"separadores de ruta", "../a/b\\c", "-a-b-c"},
+		{"caracteres prohibidos", `¿Qué? "hola" <a|b> *c*: d`, "¿Qué hola ab c- d"},
+		{"control y espacios", "  uno\t\ndos \x00 tres  ", "uno dos tres"},
+		{"puntos y espacios en los bordes", " . nombre . ", "nombre"},
+		{"solo prohibidos", "???", ""},
+		{"largo con multibyte", strings.Repeat("ñ", 150), strings.Repeat("ñ", maxSentFileName)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeFileName(tt.in)
+			if got != tt.want {
+				t.Errorf("sanitizeFileName(%q) = %q, quiero %q", tt.in, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sanitizeFileName(%q) devolvió UTF-8 inválido", tt.in)
+			}
+		})
+	}
+}
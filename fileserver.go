@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subdirectorio de DownloadDir con los archivos servidos por HTTP. Cada archivo
+// se llama <token>_<caducidad unix>_<nombre>, así el servidor y el limpiador
+// no necesitan estado en memoria y sobreviven a un reinicio.
+const servedDirName = "served"
+
+var servedTokenRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func servedDir() string {
+	return filepath.Join(DownloadDir, servedDirName)
+}
+
+func publicBaseURL() string {
+	return strings.TrimSuffix(WebhookURL, "/webhook")
+}
+
+// serveLarge mueve el archivo al directorio servido y devuelve su enlace directo.
+func (b *DownloadBot) serveLarge(path string) (string, error) {
+	if err := os.MkdirAll(servedDir(), 0755); err != nil {
+		return "", err
+	}
+	token := randomToken(16)
+	expires := time.Now().Add(b.cfg().ServedFileTTL).Unix()
+	name := filepath.Base(path)
+	dest := filepath.Join(servedDir(), fmt.Sprintf("%s_%d_%s", token, expires, name))
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/files/%s/%s", publicBaseURL(), token, name), nil
+}
+
+// parseServedName extrae token, caducidad y nombre original de un archivo servido.
+func parseServedName(base string) (token string, expires time.Time, name string, ok bool) {
+	parts := strings.SplitN(base, "_", 3)
+	if len(parts) != 3 {
+		return "", time.Time{}, "", false
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, "", false
+	}
+	return parts[0], time.Unix(ts, 0), parts[2], true
+}
+
+// filesHandler sirve /files/<token>/<nombre>. El nombre es solo decorativo.
+func (b *DownloadBot) filesHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/files/"), "/", 2)
+	token := parts[0]
+	if !servedTokenRe.MatchString(token) {
+		http.NotFound(w, r)
+		return
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(servedDir(), token+"_*"))
+	if len(matches) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	_, expires, name, ok := parseServedName(filepath.Base(matches[0]))
+	if !ok || time.Now().After(expires) {
+		http.Error(w, "El enlace ha caducado", http.StatusGone)
+		return
+	}
+
+	f, err := os.Open(matches[0])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// cleanServedFiles borra los archivos servidos cuyo enlace ya caducó.
+func cleanServedFiles() {
+	files, _ := filepath.Glob(filepath.Join(servedDir(), "*"))
+	for _, f := range files {
+		_, expires, _, ok := parseServedName(filepath.Base(f))
+		if !ok || time.Now().After(expires) {
+			if err := os.Remove(f); err == nil {
+				log.Printf("🧹 Enlace caducado, archivo borrado: %s", filepath.Base(f))
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Botones de formato por página del teclado de calidades (filas de 2)
+const formatsPerPage = 6
+
+// formatOption es un botón de la lista de formatos: una resolución de video o
+// una tasa de bits de audio.
+type formatOption struct {
+	Mode    string // "video" o "audio"
+	Quality string // Altura ("720") o "kbps<N>" para audio
+	Label   string
+	Size    int64 // Tamaño esperado; 0 si no se puede calcular
+	Approx  bool  // Size es una estimación
+}
+
+// Escalera de resoluciones estándar: alturas cercanas (1036, 1088...) se
+// agrupan en el peldaño más próximo para no mostrar botones casi iguales
+var videoLadder = []int{144, 240, 360, 480, 720, 1080, 1440, 2160, 4320}
+
+// ladderRung devuelve el peldaño más próximo a una altura (a igual distancia,
+// el de abajo): 1088 -> 1080, 400 -> 360. Por encima del último peldaño (con
+// un 5% de margen) se queda la altura real.
+func ladderRung(height int) int {
+	top := videoLadder[len(videoLadder)-1]
+	if height*100 > top*105 {
+		return height
+	}
+	best := videoLadder[0]
+	for _, rung := range videoLadder[1:] {
+		if abs(height-rung) < abs(height-best) {
+			best = rung
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// rungMaxHeight devuelve la mayor altura real de los formatos del peldaño,
+// para pedir a yt-dlp height<= esa y no el peldaño (un 400p está en el de
+// 360 y height<=360 lo dejaría fuera). Sin formatos del peldaño, el peldaño.
+func rungMaxHeight(meta *VideoMetaData, rung int) int {
+	limit := 0
+	for _, f := range meta.Formats {
+		if f.VideoCodec != "none" && f.Height > 0 && ladderRung(f.Height) == rung {
+			limit = max(limit, f.Height)
+		}
+	}
+	if limit == 0 {
+		return rung
+	}
+	return limit
+}
+
+// audioTier es una calidad de MP3 con nombre, en lugar de los formatos crudos
+// de la plataforma: la mayoría solo quiere "alta", "media" o "pequeña".
+type audioTier struct {
+	Kbps  int
+	Label string
+}
+
+var audioTiers = []audioTier{
+	{320, "alta"},
+	{192, "media"},
+	{128, "normal"},
+	{64, "pequeña"},
+}
+
+// formatOptions construye la lista completa: resoluciones de mayor a menor y
+// después los niveles de audio que tiene sentido ofrecer para el original.
+func formatOptions(meta *VideoMetaData, policy string) []formatOption {
+	heights := make(map[int]bool)
+	var maxABR float64
+	for _, f := range meta.Formats {
+		switch {
+		case f.VideoCodec != "none" && f.Height > 0:
+			heights[ladderRung(f.Height)] = true
+		case f.VideoCodec == "none" && f.AudioCodec != "none":
+			maxABR = math.Max(maxABR, f.ABR)
+		}
+	}
+
+	var options []formatOption
+	for _, h := range sortedDesc(heights) {
+		opt := formatOption{Mode: "video", Quality: strconv.Itoa(h), Label: fmt.Sprintf("%dp", h)}
+		opt.Size, opt.Approx = videoSize(meta, h, policy)
+		options = append(options, opt.withSize())
+	}
+	for i, tier := range audioTiers {
+		// Convertir a más calidad que el original solo engorda el archivo
+		// (con margen: un Opus de 160kbps suena como un MP3 de 192kbps)
+		if maxABR > 0 && float64(tier.Kbps) > maxABR*1.25 && i < len(audioTiers)-1 {
+			continue
+		}
+		// Se convierte a MP3 a esa tasa: el tamaño sale de la duración
+		opt := formatOption{Mode: "audio", Quality: fmt.Sprintf("kbps%d", tier.Kbps), Label: fmt.Sprintf("🎵 %dkbps (%s)", tier.Kbps, tier.Label)}
+		opt.Size, opt.Approx = int64(float64(tier.Kbps)*1000/8*meta.Duration), true
+		options = append(options, opt.withSize())
+	}
+	return options
+}
+
+// withSize añade el tamaño a la etiqueta, con "~" si es estimado.
+func (o formatOption) withSize() formatOption {
+	if o.Size > 0 {
+		approx := ""
+		if o.Approx {
+			approx = "~"
+		}
+		o.Label += " · " + approx + humanSize(o.Size)
+	}
+	return o
+}
+
+// formatSize devuelve el tamaño de un formato: el exacto si yt-dlp lo conoce,
+// si no filesize_approx y, como último recurso, tasa total × duración.
+func formatSize(f VideoFormat, duration float64) (int64, bool) {
+	switch {
+	case f.Filesize > 0:
+		return f.Filesize, false
+	case f.FilesizeApprox > 0:
+		return f.FilesizeApprox, true
+	case f.TBR > 0 && duration > 0:
+		return int64(f.TBR * 1000 / 8 * duration), true
+	}
+	return 0, false
+}
+
+// Políticas para elegir entre formatos del mismo peldaño (FORMAT_POLICY)
+const (
+	formatPolicyBitrate = "bitrate" // El de mayor tasa (por defecto, como yt-dlp)
+	formatPolicySize    = "size"    // El más pequeño
+)
+
+// videoSize estima lo que ocupará la descarga de un peldaño: el formato que
+// elige la política (el más pesado o el más ligero) más el mejor audio si
+// viene aparte.
+func videoSize(meta *VideoMetaData, rung int, policy string) (int64, bool) {
+	var video, audio int64
+	var videoApprox, audioApprox, separateAudio bool
+	for _, f := range meta.Formats {
+		size, approx := formatSize(f, meta.Duration)
+		if size == 0 {
+			continue
+		}
+		better := size > video
+		if policy == formatPolicySize {
+			better = video == 0 || size < video
+		}
+		switch {
+		case f.VideoCodec != "none" && f.Height > 0 && ladderRung(f.Height) == rung && better:
+			video, videoApprox = size, approx
+			separateAudio = f.AudioCodec == "none"
+		case f.VideoCodec == "none" && f.AudioCodec != "none" && size > audio:
+			audio, audioApprox = size, approx
+		}
+	}
+	if video == 0 {
+		return 0, false
+	}
+	if separateAudio {
+		return video + audio, videoApprox || audioApprox
+	}
+	return video, videoApprox
+}
+
+// humanSize muestra un tamaño en KB, MB o GB.
+func humanSize(size int64) string {
+	switch {
+	case size >= 1024*1024*1024:
+		return fmt.Sprintf("%.1fGB", float64(size)/(1024*1024*1024))
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.0fMB", float64(size)/(1024*1024))
+	}
+	return fmt.Sprintf("%.0fKB", float64(size)/1024)
+}
+
+func sortedDesc(set map[int]bool) []int {
+	list := make([]int, 0, len(set))
+	for v := range set {
+		list = append(list, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(list)))
+	return list
+}
+
+// formatPage devuelve las opciones de la página pedida (ajustada al rango) y
+// el número total de páginas.
+func formatPage(options []formatOption, page int) ([]formatOption, int, int) {
+	pages := (len(options) + formatsPerPage - 1) / formatsPerPage
+	if pages == 0 {
+		return nil, 0, 0
+	}
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+	end := (page + 1) * formatsPerPage
+	if end > len(options) {
+		end = len(options)
+	}
+	return options[page*formatsPerPage : end], page, pages
+}
+
+// audioBitrate extrae los kbps de una calidad de audio "kbps<N>".
+func audioBitrate(quality string) (int, bool) {
+	rest, ok := strings.CutPrefix(quality, "kbps")
+	if !ok {
+		return 0, false
+	}
+	kbps, err := strconv.Atoi(rest)
+	return kbps, err == nil && kbps > 0
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Tiempo máximo para que gallery-dl baje todas las imágenes de un post
+const galleryTimeout = 3 * time.Minute
+
+// Telegram admite de 2 a 10 elementos por álbum y fotos de hasta 10MB
+const (
+	maxMediaGroupSize = 10
+	maxPhotoSize      = 10 * 1024 * 1024
+)
+
+// Plataformas con posts de imágenes que yt-dlp no sabe descargar
+var galleryPlatforms = map[string]bool{
+	"instagram": true,
+	"twitter":   true,
+	"reddit":    true,
+}
+
+var galleryImageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+var galleryVideoExts = map[string]bool{".mp4": true, ".mov": true, ".webm": true}
+
+// galleryFallback indica si un enlace que yt-dlp no pudo procesar puede
+// intentarse con gallery-dl (instalado y plataforma con posts de imágenes).
+func galleryFallback(rawURL string) bool {
+	if !galleryPlatforms[detectPlatform(rawURL)] {
+		return false
+	}
+	_, err := exec.LookPath(galleryDLBin)
+	return err == nil
+}
+
+// downloadGallery baja todos los archivos del post a dir y los devuelve en orden.
+func (b *DownloadBot) downloadGallery(rawURL, dir string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), galleryTimeout)
+	defer cancel()
+
+	// Igual que con yt-dlp, no dependemos de la configuración global del host
+	args := append([]string{"--config-ignore", "-D", dir}, b.cookieArgs(rawURL)...)
+	args = append(args, rawURL)
+	cmd := exec.CommandContext(ctx, galleryDLBin, args...)
+	killGroupOnCancel(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("gallery-dl: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (galleryImageExts[ext] || galleryVideoExts[ext]) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	// gallery-dl numera los archivos del carrusel: el orden alfabético lo respeta
+	sort.Strings(files)
+	return files, nil
+}
+
+// processGallery descarga un post de imágenes con gallery-dl y lo envía como
+// álbum. Devuelve false si no se pudo, para que el llamador muestre el error original.
+func (b *DownloadBot) processGallery(key sessionKey, msgID, replyTo int, rawURL string) bool {
+	sess := &UserSession{MsgID: msgID}
+	if !b.waitForDisk(key, sess, 0) {
+		return true // Ya se avisó de la falta de espacio
+	}
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return true // Ya se avisó del límite diario
+	}
+	defer b.finishUsageJob(job)
+	b.editMessage(key.ChatID, msgID, "🖼 *Descargando imágenes del post...*")
+
+	dir := filepath.Join(chatDir(key.ChatID), fmt.Sprintf("gallery_%d_%d_%d", key.ChatID, key.UserID, time.Now().Unix()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Error creando carpeta de galería: %v", err)
+		return false
+	}
+	defer os.RemoveAll(dir)
+
+	files, err := b.downloadGallery(rawURL, dir)
+	if err != nil || len(files) == 0 {
+		log.Printf("Error descargando galería %s: %v", rawURL, err)
+		return false
+	}
+
+	b.editMessage(key.ChatID, msgID, fmt.Sprintf("📤 *Enviando %d archivos...*", len(files)))
+	caption := "🖼 " + rawURL
+	var media []interface{}
+	var documents []string
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		job.downloaded += info.Size()
+		if info.Size() > MaxFileSizeBotAPI {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		switch {
+		case galleryVideoExts[ext]:
+			item := tgbotapi.NewInputMediaVideo(tgbotapi.FilePath(path))
+			item.SupportsStreaming = true
+			media = append(media, item)
+		case info.Size() > maxPhotoSize:
+			// Fotos muy grandes: Telegram solo las acepta como documento
+			documents = append(documents, path)
+		default:
+			media = append(media, tgbotapi.NewInputMediaPhoto(tgbotapi.FilePath(path)))
+		}
+	}
+
+	sentAny := false
+	for start := 0; start < len(media); start += maxMediaGroupSize {
+		end := start + maxMediaGroupSize
+		if end > len(media) {
+			end = len(media)
+		}
+		if b.sendMediaChunk(key.ChatID, replyTo, media[start:end], caption) {
+			sentAny = true
+		}
+		caption = "" // Solo el primer álbum lleva pie
+	}
+	for _, path := range documents {
+		doc := tgbotapi.NewDocument(key.ChatID, tgbotapi.FilePath(path))
+		doc.ReplyToMessageID = replyTo
+		if _, err := b.bot.Send(doc); err == nil {
+			sentAny = true
+		}
+	}
+	if !sentAny {
+		return false
+	}
+
+	job.ok, job.bytes = true, job.downloaded
+	b.state.DeleteSession(key)
+	b.deleteMessage(key.ChatID, msgID)
+	return true
+}
+
+// sendMediaChunk envía hasta 10 elementos; con uno solo no se puede usar un álbum.
+func (b *DownloadBot) sendMediaChunk(chatID int64, replyTo int, chunk []interface{}, caption string) bool {
+	if len(chunk) == 1 {
+		var msg tgbotapi.Chattable
+		switch item := chunk[0].(type) {
+		case tgbotapi.InputMediaVideo:
+			video := tgbotapi.NewVideo(chatID, item.Media)
+			video.Caption, video.ReplyToMessageID, video.SupportsStreaming = caption, replyTo, true
+			msg = video
+		case tgbotapi.InputMediaPhoto:
+			photo := tgbotapi.NewPhoto(chatID, item.Media)
+			photo.Caption, photo.ReplyToMessageID = caption, replyTo
+			msg = photo
+		}
+		if _, err := b.bot.Send(msg); err != nil {
+			log.Printf("Error enviando archivo de galería: %v", err)
+			return false
+		}
+		return true
+	}
+
+	switch item := chunk[0].(type) {
+	case tgbotapi.InputMediaVideo:
+		item.Caption = caption
+		chunk[0] = item
+	case tgbotapi.InputMediaPhoto:
+		item.Caption = caption
+		chunk[0] = item
+	}
+	group := tgbotapi.NewMediaGroup(chatID, chunk)
+	group.ReplyToMessageID = replyTo
+	if _, err := b.bot.SendMediaGroup(group); err != nil {
+		log.Printf("Error enviando álbum: %v", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cada cuánto se comprueba la conexión con Telegram y yt-dlp. Las sondas de
+// Kubernetes y similares llaman a menudo: responden con el último resultado.
+const healthCheckInterval = 30 * time.Second
+
+// healthReport es la respuesta JSON de /healthz y /readyz.
+type healthReport struct {
+	Status     string `json:"status"`
+	Telegram   bool   `json:"telegram"`
+	Ytdlp      bool   `json:"ytdlp"`
+	FFmpeg     bool   `json:"ffmpeg"`
+	DiskFreeMB int64  `json:"disk_free_mb"`
+	ActiveJobs int64  `json:"active_jobs"`
+	// Tareas del scheduler que esperan detrás de otra de su chat
+	QueuedJobs int `json:"queued_jobs"`
+	// Cola de Redis (JOB_QUEUE); nil sin ella
+	Queue     *queueDepth `json:"queue,omitempty"`
+	CheckedAt time.Time   `json:"checked_at"`
+
+	// Bytes que el limpiador de temporales ha liberado desde el arranque
+	CleanerReclaimedBytes int64 `json:"cleaner_reclaimed_bytes"`
+}
+
+// queueDepth es el estado del stream de descargas de Redis.
+type queueDepth struct {
+	Length  int64 `json:"stream_length"` // Entradas en el stream, repartidas o no
+	Waiting int64 `json:"waiting"`       // Sin repartir a ningún worker
+	Pending int64 `json:"pending"`       // Repartidas y sin confirmar
+}
+
+type healthState struct {
+	mu       sync.Mutex
+	telegram bool
+	ytdlp    bool
+	version  string // Salida de yt-dlp --version
+	checked  time.Time
+}
+
+var health healthState
+
+// healthWatcher mantiene actualizado el estado de las dependencias externas.
+func (b *DownloadBot) healthWatcher() {
+	for {
+		_, tgErr := b.bot.GetMe()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		version, ytErr := exec.CommandContext(ctx, ytdlpBin, "--version").Output()
+		cancel()
+
+		health.mu.Lock()
+		if health.telegram != (tgErr == nil) && !health.checked.IsZero() {
+			log.Printf("🩺 Conexión con Telegram: %v", tgErr == nil)
+		}
+		health.telegram, health.ytdlp, health.checked = tgErr == nil, ytErr == nil, time.Now()
+		if ytErr == nil {
+			health.version = strings.TrimSpace(string(version))
+		}
+		health.mu.Unlock()
+
+		time.Sleep(healthCheckInterval)
+	}
+}
+
+// ytdlpVersion devuelve la versión de yt-dlp de la última comprobación ("" si aún no hay).
+func ytdlpVersion() string {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	return health.version
+}
+
+// diskFreeMB devuelve el espacio libre en la carpeta de descargas.
+func diskFreeMB() int64 {
+	free, _, err := diskSpace()
+	if err != nil {
+		return -1
+	}
+	return free / (1024 * 1024)
+}
+
+func (b *DownloadBot) currentHealth() healthReport {
+	health.mu.Lock()
+	report := healthReport{
+		Telegram:  health.telegram,
+		Ytdlp:     health.ytdlp,
+		CheckedAt: health.checked,
+	}
+	health.mu.Unlock()
+	report.FFmpeg = ffmpegAvailable.Load()
+	report.DiskFreeMB = diskFreeMB()
+	report.ActiveJobs = activeJobs.Load()
+	_, _, report.QueuedJobs = b.scheduler.load()
+	if b.queue != nil {
+		report.Queue = b.queue.healthDepth()
+	}
+	report.CleanerReclaimedBytes = cleanerReclaimed.Load()
+	return report
+}
+
+// healthDepth lee el stream de descargas para las sondas; nil si Redis falla.
+func (q *jobQueue) healthDepth() *queueDepth {
+	length, err := q.client.XLen(context.Background(), jobStream).Result()
+	if err != nil {
+		log.Printf("⚠️ Error leyendo la cola de Redis: %v", err)
+		return nil
+	}
+	waiting, pending, err := q.depth()
+	if err != nil {
+		log.Printf("⚠️ Error leyendo la cola de Redis: %v", err)
+		return nil
+	}
+	return &queueDepth{Length: length, Waiting: waiting, Pending: pending}
+}
+
+// healthzHandler es la sonda de vida: el proceso responde.
+func (b *DownloadBot) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	report := b.currentHealth()
+	report.Status = "ok"
+	writeHealth(w, http.StatusOK, report)
+}
+
+// readyzHandler es la sonda de disponibilidad: hay conexión con Telegram,
+// yt-dlp funciona y queda disco suficiente para descargar.
+func (b *DownloadBot) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := b.currentHealth()
+	report.Status = "ready"
+	code := http.StatusOK
+	if !report.Telegram || !report.Ytdlp || report.DiskFreeMB < b.cfg().HealthMinFreeMB {
+		report.Status = "not_ready"
+		code = http.StatusServiceUnavailable
+	}
+	writeHealth(w, code, report)
+}
+
+func writeHealth(w http.ResponseWriter, code int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+// registerHealth expone /healthz y /readyz en el servidor principal o, si se
+// configuró HEALTH_PORT, en un listener aparte que no depende del webhook.
+func (b *DownloadBot) registerHealth() {
+	go b.healthWatcher()
+
+	if b.cfg().HealthPort == "" {
+		http.HandleFunc("/healthz", b.healthzHandler)
+		http.HandleFunc("/readyz", b.readyzHandler)
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", b.healthzHandler)
+	mux.HandleFunc("/readyz", b.readyzHandler)
+	go func() {
+		log.Printf("🩺 Sondas de salud en puerto %s", b.cfg().HealthPort)
+		if err := http.ListenAndServe(":"+b.cfg().HealthPort, mux); err != nil {
+			log.Printf("❌ Error en el servidor de salud: %v", err)
+		}
+	}()
+}
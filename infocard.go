@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// infoCard es el texto del mensaje con el teclado de formatos: miniatura,
+// título, autor, duración y visitas, para confirmar que es el video correcto.
+// La miniatura va como enlace invisible al principio para que Telegram la
+// muestre como vista previa; así el mensaje sigue siendo de texto y se puede
+// editar con el progreso igual que antes.
+func infoCard(meta *VideoMetaData) string {
+	var card strings.Builder
+	if meta.Thumbnail != "" {
+		fmt.Fprintf(&card, "[​](%s)", meta.Thumbnail)
+	}
+	fmt.Fprintf(&card, "🎥 *%s*\n", escapeMarkdown(meta.Title))
+
+	var details []string
+	if meta.Uploader != "" {
+		details = append(details, "👤 "+escapeMarkdown(meta.Uploader))
+	}
+	if meta.Duration > 0 {
+		details = append(details, "⏱ "+formatClock(time.Duration(meta.Duration)*time.Second))
+	}
+	if meta.ViewCount > 0 {
+		details = append(details, "👁 "+formatCount(meta.ViewCount)+" vistas")
+	}
+	if len(details) > 0 {
+		card.WriteString(strings.Join(details, " · ") + "\n")
+	}
+	card.WriteString("\nSelecciona una opción:")
+	return card.String()
+}
+
+// formatCount abrevia cifras grandes: 1234 -> 1,2K; 5600000 -> 5,6M.
+func formatCount(n int64) string {
+	var s string
+	switch {
+	case n >= 1_000_000_000:
+		s = fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1_000_000:
+		s = fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		s = fmt.Sprintf("%.1fK", float64(n)/1e3)
+	default:
+		return fmt.Sprint(n)
+	}
+	return strings.Replace(strings.Replace(s, ".0", "", 1), ".", ",", 1)
+}
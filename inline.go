@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Cuánto se reutilizan los metadatos de un enlace consultado en inline
+	// (los errores, menos: puede ser un fallo pasajero del sitio)
+	inlineResultTTL = 10 * time.Minute
+	inlineErrorTTL  = time.Minute
+	// Cuánto se ofrece en inline un archivo ya enviado por su file_id
+	servedFileTTL = 7 * 24 * time.Hour
+	// Segundos que Telegram guarda la respuesta: sin archivo en caché es corto
+	// para que aparezca en cuanto alguien lo descargue
+	inlineCacheTime       = 300
+	inlinePendingTime     = 30
+	inlineMaxCacheEntries = 1000
+	// Telegram manda una consulta por tecla: solo se atiende la última de
+	// cada usuario tras esta pausa
+	inlineDebounce = 700 * time.Millisecond
+	// Consultas a sitios (yt-dlp) por usuario y minuto si ABUSE_LINKS_PER_MINUTE no fija otro
+	inlineLookupsPerMinute = 10
+)
+
+// Última consulta inline de cada usuario, para descartar las que se quedan atrás
+var inlineLatest sync.Map // int64 -> string (ID de la consulta)
+
+// ServedFile es el último archivo enviado de una URL, en cualquier chat.
+type ServedFile struct {
+	FileID string    `json:"file_id"`
+	Kind   string    `json:"kind"` // video, audio, voice o document
+	Title  string    `json:"title"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// sentFileKind devuelve el tipo de archivo de un mensaje enviado, como lo
+// necesitan los resultados inline (que no aceptan notas de video).
+func sentFileKind(msg tgbotapi.Message) string {
+	switch {
+	case msg.Video != nil:
+		return "video"
+	case msg.Audio != nil:
+		return "audio"
+	case msg.Voice != nil:
+		return "voice"
+	case msg.Document != nil:
+		return "document"
+	}
+	return ""
+}
+
+func (s *Store) recordServedFile(meta *VideoMetaData, sent tgbotapi.Message) {
+	kind := sentFileKind(sent)
+	if kind == "" || meta.WebpageURL == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for url, file := range s.data.ServedFiles {
+		if now.Sub(file.SentAt) > servedFileTTL {
+			delete(s.data.ServedFiles, url)
+		}
+	}
+	s.data.ServedFiles[meta.WebpageURL] = ServedFile{FileID: sentFileID(sent), Kind: kind, Title: meta.Title, SentAt: now}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando archivos enviados: %v", err)
+	}
+}
+
+func (s *Store) servedFile(url string) (ServedFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.data.ServedFiles[url]
+	if !ok || time.Since(file.SentAt) > servedFileTTL {
+		return ServedFile{}, false
+	}
+	return file, true
+}
+
+// inlineEntry son los metadatos de un enlace consultado en inline. Mientras
+// se obtienen, las consultas iguales esperan a done en vez de lanzar otro yt-dlp.
+type inlineEntry struct {
+	done    chan struct{}
+	meta    *VideoMetaData
+	err     error
+	expires time.Time
+}
+
+var inlineResults = struct {
+	sync.Mutex
+	entries map[string]*inlineEntry
+}{entries: make(map[string]*inlineEntry)}
+
+// inlineLookup obtiene los metadatos del enlace de una consulta inline,
+// reutilizando los de consultas recientes del mismo enlace.
+func (b *DownloadBot) inlineLookup(rawURL string) (*VideoMetaData, error) {
+	inlineResults.Lock()
+	entry, ok := inlineResults.entries[rawURL]
+	if ok {
+		select {
+		case <-entry.done:
+			ok = time.Now().Before(entry.expires)
+		default: // En curso: se espera abajo
+		}
+	}
+	if !ok {
+		if len(inlineResults.entries) > inlineMaxCacheEntries {
+			now := time.Now()
+			for url, e := range inlineResults.entries {
+				select {
+				case <-e.done:
+					if now.After(e.expires) {
+						delete(inlineResults.entries, url)
+					}
+				default:
+				}
+			}
+		}
+		entry = &inlineEntry{done: make(chan struct{})}
+		inlineResults.entries[rawURL] = entry
+		inlineResults.Unlock()
+
+		url := resolveSiteLink(b.rewriteURL(expandShortLink(rawURL)))
+		if entry.err = b.validateLink(url); entry.err == nil {
+			entry.meta, entry.err = b.fetchMetadata(url)
+		}
+		ttl := inlineResultTTL
+		if entry.err != nil {
+			ttl = inlineErrorTTL
+		}
+		entry.expires = time.Now().Add(ttl)
+		close(entry.done)
+		return entry.meta, entry.err
+	}
+	inlineResults.Unlock()
+	<-entry.done
+	return entry.meta, entry.err
+}
+
+// handleInlineQuery responde a "@bot <enlace>": el archivo ya enviado, si
+// alguien lo descargó hace poco, y un botón para descargarlo en privado.
+func (b *DownloadBot) handleInlineQuery(q *tgbotapi.InlineQuery) {
+	answer := tgbotapi.InlineConfig{InlineQueryID: q.ID, CacheTime: inlinePendingTime, Results: []interface{}{}}
+	respond := func(switchText, payload string) {
+		answer.SwitchPMText, answer.SwitchPMParameter = switchText, payload
+		if _, err := b.bot.Request(answer); err != nil {
+			log.Printf("⚠️ Error respondiendo consulta inline: %v", err)
+		}
+	}
+
+	rawURL := extractURL(q.Query)
+	if rawURL == "" {
+		respond("📥 Pega un enlace de video", "inline")
+		return
+	}
+
+	// Mientras se escribe el enlace llega una consulta por tecla
+	inlineLatest.Store(q.From.ID, q.ID)
+	time.Sleep(inlineDebounce)
+	if latest, _ := inlineLatest.Load(q.From.ID); latest != q.ID {
+		return
+	}
+	inlineLatest.CompareAndDelete(q.From.ID, q.ID)
+
+	// Los mismos filtros que un enlace enviado al chat, sin mensajes: solo
+	// se puede contestar con el botón de ir al chat del bot
+	if b.store.isBanned(q.From.ID) || b.state.Count(fmt.Sprintf("abuse:ban:%d", q.From.ID)) > 0 {
+		respond("", "")
+		return
+	}
+	if _, paused := b.inMaintenance(q.From.ID); paused {
+		respond("🛠 Bot en mantenimiento", "inline")
+		return
+	}
+	if b.cfg().NewUserCaptcha && !b.cfg().isAdmin(q.From.ID) && !b.store.isVerified(q.From.ID) {
+		respond("🤖 Verifícate en el chat del bot", "inline")
+		return
+	}
+	if !b.isSubscribed(q.From.ID) {
+		respond("🔒 Únete al canal para usar el bot", "inline")
+		return
+	}
+	if b.validateLink(rawURL) != nil || b.store.isBlocked(rawURL) {
+		respond("❌ No se pudo procesar el enlace", "inline")
+		return
+	}
+
+	// Enlace canónico ya enviado: se responde sin consultar el sitio
+	file, cached := b.store.servedFile(rawURL)
+	var meta *VideoMetaData
+	if !cached {
+		if !b.allowInlineLookup(q.From.ID, rawURL) {
+			respond("⏳ Demasiadas consultas, espera un momento", "inline")
+			return
+		}
+		var err error
+		if meta, err = b.inlineLookup(rawURL); err != nil {
+			respond("❌ No se pudo procesar el enlace", "inline")
+			return
+		}
+		if b.store.isBlocked(meta.WebpageURL) {
+			respond("❌ No se pudo procesar el enlace", "inline")
+			return
+		}
+		file, cached = b.store.servedFile(meta.WebpageURL)
+	}
+	title, link := file.Title, rawURL
+	if meta != nil {
+		title, link = meta.Title, meta.WebpageURL
+	}
+
+	if cached {
+		answer.Results = append(answer.Results, inlineFileResult(file, title))
+		answer.CacheTime = inlineCacheTime
+	}
+	if meta != nil {
+		article := tgbotapi.NewInlineQueryResultArticle("link", title, link)
+		article.Description = "🔗 Compartir el enlace"
+		if meta.Uploader != "" {
+			article.Description = fmt.Sprintf("👤 %s · 🔗 Compartir el enlace", meta.Uploader)
+		}
+		article.ThumbURL = meta.Thumbnail
+		answer.Results = append(answer.Results, article)
+	}
+
+	payload, ok := encodeStartPayload(link)
+	if !ok {
+		payload = "inline"
+	}
+	respond("📥 Descargar en el chat del bot", payload)
+}
+
+// allowInlineLookup limita las consultas a sitios por usuario: las que ya
+// están en la caché de inlineLookup no cuentan porque no lanzan yt-dlp.
+func (b *DownloadBot) allowInlineLookup(userID int64, rawURL string) bool {
+	if b.cfg().isAdmin(userID) {
+		return true
+	}
+	inlineResults.Lock()
+	entry, ok := inlineResults.entries[rawURL]
+	inlineResults.Unlock()
+	if ok {
+		select {
+		case <-entry.done:
+			if time.Now().Before(entry.expires) {
+				return true
+			}
+		default: // En curso: se espera a esa misma consulta
+			return true
+		}
+	}
+	limit := b.cfg().AbuseLinksPerMinute
+	if limit <= 0 {
+		limit = inlineLookupsPerMinute
+	}
+	return b.state.Incr(fmt.Sprintf("inline:lookups:%d", userID), time.Minute) <= limit
+}
+
+// inlineFileResult es el resultado inline que reenvía un archivo por su file_id.
+func inlineFileResult(file ServedFile, title string) interface{} {
+	caption := "🎬 " + title
+	switch file.Kind {
+	case "audio":
+		audio := tgbotapi.NewInlineQueryResultCachedAudio("file", file.FileID)
+		audio.Caption = caption
+		return audio
+	case "voice":
+		voice := tgbotapi.NewInlineQueryResultCachedVoice("file", file.FileID, title)
+		voice.Caption = caption
+		return voice
+	case "document":
+		doc := tgbotapi.NewInlineQueryResultCachedDocument("file", file.FileID, title)
+		doc.Caption = caption
+		return doc
+	}
+	video := tgbotapi.NewInlineQueryResultCachedVideo("file", file.FileID, title)
+	video.Caption = caption
+	return video
+}
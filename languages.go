@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Nombres de los idiomas de doblaje más habituales; el resto se muestra por código
+var languageNames = map[string]string{
+	"es": "Español",
+	"en": "Inglés",
+	"pt": "Portugués",
+	"fr": "Francés",
+	"de": "Alemán",
+	"it": "Italiano",
+	"ru": "Ruso",
+	"ja": "Japonés",
+	"ko": "Coreano",
+	"zh": "Chino",
+	"hi": "Hindi",
+	"ar": "Árabe",
+}
+
+// languageLabel muestra "Español (es-419)" o el código si no lo conocemos.
+func languageLabel(code string) string {
+	base, _, _ := strings.Cut(code, "-")
+	name, ok := languageNames[strings.ToLower(base)]
+	if !ok {
+		return code
+	}
+	if base != code {
+		return name + " (" + code + ")"
+	}
+	return name
+}
+
+// audioLanguages devuelve los idiomas distintos de las pistas de audio. Solo
+// tiene sentido preguntar si hay más de uno (videos con doblajes).
+func audioLanguages(meta *VideoMetaData) []string {
+	seen := make(map[string]bool)
+	for _, f := range meta.Formats {
+		if f.AudioCodec != "none" && f.Language != "" {
+			seen[f.Language] = true
+		}
+	}
+	langs := make([]string, 0, len(seen))
+	for lang := range seen {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// withLanguage antepone a cada alternativa del selector de formato una copia
+// que exige la pista de audio en ese idioma; las originales quedan como
+// respaldo por si el formato combinado no lo tiene.
+// "bv*+ba/b" -> "bv*+ba[language=es]/b[language=es]/bv*+ba/b"
+func withLanguage(selector, lang string) string {
+	return withFormatFilter(selector, "[language="+lang+"]", false)
+}
+
+// withFormatFilter antepone a cada alternativa del selector una copia con el
+// filtro, dejando las originales como respaldo. En las alternativas
+// "video+audio" el filtro va en la parte de video si onVideo y, si no, en la
+// de audio; las de un solo formato lo llevan siempre.
+func withFormatFilter(selector, filter string, onVideo bool) string {
+	alternatives := strings.Split(selector, "/")
+	filtered := make([]string, 0, len(alternatives)*2)
+	for _, alt := range alternatives {
+		if video, audio, merged := strings.Cut(alt, "+"); merged && onVideo {
+			filtered = append(filtered, video+filter+"+"+audio)
+		} else {
+			filtered = append(filtered, alt+filter)
+		}
+	}
+	return strings.Join(append(filtered, alternatives...), "/")
+}
+
+// languageMenuKeyboard lista los idiomas de audio para elegir el doblaje.
+func languageMenuKeyboard(langs []string, current string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	defaultLabel := "Original"
+	if current == "" {
+		defaultLabel = "✅ " + defaultLabel
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(defaultLabel, "lang:")))
+	for _, lang := range langs {
+		label := languageLabel(lang)
+		if lang == current {
+			label = "✅ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, "lang:"+lang)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleLanguageCallback muestra el menú de idiomas ("lang:menu") o guarda el
+// elegido en la sesión y vuelve al teclado de formatos.
+func (b *DownloadBot) handleLanguageCallback(key sessionKey, sess *UserSession, value string) {
+	if value == "menu" {
+		b.editMessageMarkup(key.ChatID, sess.MsgID, "🌐 *Idioma del audio*\n\nElige la pista de audio para el video o el audio:", languageMenuKeyboard(audioLanguages(sess.Meta), sess.Options.AudioLang))
+		return
+	}
+	sess.Options.AudioLang = value
+	b.state.SaveSession(key, sess)
+	b.editMessageMarkup(key.ChatID, sess.MsgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+}
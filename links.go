@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Tiempo máximo para que yt-dlp resuelva los enlaces directos
+const directLinkTimeout = time.Minute
+
+// sendDirectLinks responde con las URLs directas del contenido (yt-dlp -g) en
+// lugar de descargarlo, para que el usuario lo reproduzca o baje por su cuenta.
+func (b *DownloadBot) sendDirectLinks(key sessionKey, sess *UserSession) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	defer b.state.DeleteSession(key)
+	b.editMessage(chatID, msgID, "🔗 *Obteniendo enlace directo...*")
+
+	ctx, cancel := context.WithTimeout(context.Background(), directLinkTimeout)
+	defer cancel()
+	// Preferimos un archivo con audio y video juntos; si no hay, dos enlaces separados
+	out, err := b.ytdlpCommand(ctx, meta.WebpageURL, "-g", "-f", "b/bv*+ba", "--no-playlist", meta.WebpageURL).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			log.Printf("Error obteniendo enlace directo: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		b.editMessage(chatID, msgID, "❌ No se pudo obtener el enlace directo de este contenido.")
+		return
+	}
+	links := strings.Fields(string(out))
+	if len(links) == 0 {
+		b.editMessage(chatID, msgID, "❌ No se pudo obtener el enlace directo de este contenido.")
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "🔗 %s\n\n", meta.Title)
+	labels := []string{"🎬 Video:", "🎵 Audio:"}
+	for i, link := range links {
+		if len(links) > 1 && i < len(labels) {
+			text.WriteString(labels[i] + "\n")
+		}
+		text.WriteString(link + "\n\n")
+	}
+	if expires, ok := linkExpiry(links[0]); ok {
+		fmt.Fprintf(&text, "⏳ El enlace caduca el %s.", expires.Format("02/01/2006 15:04"))
+	} else {
+		text.WriteString("⏳ El enlace caduca en unas horas y puede estar ligado a la IP del bot.")
+	}
+
+	// Sin Markdown: las URLs directas suelen tener guiones bajos
+	msg := tgbotapi.NewMessage(chatID, text.String())
+	msg.ReplyToMessageID = sess.ReplyTo
+	msg.DisableWebPagePreview = true
+	if _, err := b.bot.Send(msg); err != nil {
+		log.Printf("Error enviando enlace directo: %v", err)
+		b.editMessage(chatID, msgID, "❌ El enlace es demasiado largo para enviarlo por Telegram.")
+		return
+	}
+	b.deleteMessage(chatID, msgID)
+}
+
+// linkExpiry lee la caducidad de enlaces firmados que la indican (p. ej. googlevideo: expire=<unix>).
+func linkExpiry(rawURL string) (time.Time, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, param := range []string{"expire", "expires", "Expires"} {
+		if ts, err := strconv.ParseInt(u.Query().Get(param), 10, 64); err == nil && ts > 0 {
+			return time.Unix(ts, 0), true
+		}
+	}
+	return time.Time{}, false
+}
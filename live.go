@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Cada cuánto se actualiza el tiempo grabado en el mensaje de estado
+const liveStatusInterval = 5 * time.Second
+
+// liveRecording es una grabación de directo en curso que el usuario puede detener.
+type liveRecording struct {
+	cmd      *exec.Cmd
+	stopOnce sync.Once
+}
+
+// stop interrumpe yt-dlp con SIGINT para que cierre el archivo de forma ordenada.
+func (r *liveRecording) stop() {
+	r.stopOnce.Do(func() {
+		if r.cmd.Process != nil {
+			r.cmd.Process.Signal(os.Interrupt)
+		}
+	})
+}
+
+// offerLiveRecording sustituye el teclado de calidades cuando el enlace es un directo.
+func (b *DownloadBot) offerLiveRecording(chatID int64, msgID int, meta *VideoMetaData) {
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🔴 Grabar desde ahora", "live:now")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⏪ Grabar desde el inicio", "live:start")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Cancelar", "cancel")),
+	)
+	text := fmt.Sprintf("🔴 *%s*\n\nEste enlace es una transmisión en directo. La grabación se detiene sola a los %s o cuando pulses ⏹.",
+		escapeMarkdown(meta.Title), formatClock(b.cfg().LiveMaxDuration))
+	b.editMessageMarkup(chatID, msgID, text, keyboard)
+}
+
+// handleLiveCallback inicia ("live:now", "live:start") o detiene ("live:stop") una grabación.
+func (b *DownloadBot) handleLiveCallback(key sessionKey, sess *UserSession, action string) {
+	if action == "stop" {
+		if val, ok := b.liveRecordings.Load(key); ok {
+			b.editMessage(key.ChatID, sess.MsgID, "⏹ *Deteniendo grabación...*")
+			val.(*liveRecording).stop()
+		}
+		return
+	}
+	if _, busy := b.liveRecordings.Load(key); busy {
+		return
+	}
+	go b.recordLive(key, sess, action == "start")
+}
+
+func (b *DownloadBot) recordLive(key sessionKey, sess *UserSession, fromStart bool) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	defer holdChatDir(chatID)()
+	fileName := fmt.Sprintf("live_%d_%d_%d", chatID, key.UserID, time.Now().Unix())
+	base := filepath.Join(chatDir(chatID), fileName)
+
+	// MPEG-TS sin .part: si se interrumpe, lo grabado hasta ahí sigue siendo reproducible
+	args := []string{"-f", "best[height<=720]/best", "--hls-use-mpegts", "--no-part", "-o", base + ".%(ext)s"}
+	if fromStart {
+		args = append(args, "--live-from-start")
+	}
+	args = append(args, meta.WebpageURL)
+
+	if !b.waitForDisk(key, sess, 0) {
+		return
+	}
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	defer b.finishUsageJob(job)
+
+	// La grabación ocupa un hueco: cuenta para el límite total de ancho de banda
+	defer b.scheduler.hold(b.taskPriority(key.UserID))()
+	cmd := b.ytdlpCommand(context.Background(), meta.WebpageURL, args...)
+	if err := cmd.Start(); err != nil {
+		b.editMessage(chatID, msgID, "❌ No se pudo iniciar la grabación.")
+		return
+	}
+
+	rec := &liveRecording{cmd: cmd}
+	b.liveRecordings.Store(key, rec)
+	defer b.liveRecordings.Delete(key)
+
+	capTimer := time.AfterFunc(b.cfg().LiveMaxDuration, rec.stop)
+	defer capTimer.Stop()
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	stopKeyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⏹ Detener y enviar", "live:stop")),
+	)
+	started := time.Now()
+	ticker := time.NewTicker(liveStatusInterval)
+	defer ticker.Stop()
+
+	var waitErr error
+recording:
+	for {
+		select {
+		case waitErr = <-done:
+			break recording
+		case <-ticker.C:
+			b.editMessageMarkup(chatID, msgID, fmt.Sprintf("🔴 *Grabando: %s* / máx. %s\n\n%s",
+				formatClock(time.Since(started)), formatClock(b.cfg().LiveMaxDuration), escapeMarkdown(meta.Title)), stopKeyboard)
+		}
+	}
+
+	// Al detenerlo yt-dlp puede salir con error aunque el archivo sea válido
+	matches, _ := filepath.Glob(base + ".*")
+	if len(matches) == 0 {
+		log.Printf("Error grabando directo: %v", waitErr)
+		b.editMessage(chatID, msgID, "❌ La grabación no produjo ningún archivo.")
+		b.state.DeleteSession(key)
+		return
+	}
+	recorded := matches[0]
+
+	b.editMessage(chatID, msgID, "⚙️ *Procesando grabación...*")
+	finalPath := base + "_rec.mp4"
+	remux := exec.Command(ffmpegBin, "-y", "-i", recorded, "-c", "copy", "-movflags", "+faststart", finalPath)
+	if err := remux.Run(); err != nil {
+		log.Printf("Error remuxando grabación: %v", err)
+		finalPath = recorded
+	} else {
+		os.Remove(recorded)
+	}
+	defer os.Remove(finalPath)
+
+	// La duración real es la grabada, no la del directo
+	recordedMeta := *meta
+	recordedMeta.Duration = time.Since(started).Seconds()
+
+	info, err := os.Stat(finalPath)
+	if err != nil {
+		b.editMessage(chatID, msgID, "❌ No se pudo leer la grabación.")
+		b.state.DeleteSession(key)
+		return
+	}
+	if info.Size() > MaxFileSizeBotAPI {
+		tooLarge := &fileTooLargeError{Path: finalPath, Size: info.Size()}
+		if !b.deliverLarge(key.UserID, chatID, msgID, sess.ReplyTo, tooLarge, "video", &recordedMeta) {
+			b.editMessage(chatID, msgID, tooLarge.Error())
+			b.state.DeleteSession(key)
+			return
+		}
+		job.ok, job.bytes = true, info.Size()
+	} else {
+		b.editMessage(chatID, msgID, "📤 *Subiendo a Telegram...*")
+		target := uploadTarget{ChatID: chatID, ReplyTo: sess.ReplyTo, Caption: "🔴 " + meta.Title}
+		if _, err := b.uploadFile(target, finalPath, "", "video", &recordedMeta); err != nil {
+			b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando la grabación a Telegram.")
+		} else {
+			job.delivered(finalPath)
+		}
+	}
+	b.state.DeleteSession(key)
+	b.deleteMessage(chatID, msgID)
+}
+
+// formatClock muestra una duración como mm:ss o h:mm:ss.
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
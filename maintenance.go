@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Mensaje por defecto del modo mantenimiento
+const defaultMaintenanceMessage = "🛠 El bot está en mantenimiento. Volvemos enseguida, inténtalo de nuevo en unos minutos."
+
+// MaintenanceState pausa las descargas nuevas; las que ya estaban en marcha
+// terminan con normalidad. Se guarda en disco para sobrevivir a un reinicio
+// (p. ej. durante una migración).
+type MaintenanceState struct {
+	Enabled bool      `json:"enabled"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+func (s *Store) maintenance() MaintenanceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Maintenance
+}
+
+func (s *Store) setMaintenance(state MaintenanceState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Maintenance = state
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando modo mantenimiento: %v", err)
+	}
+}
+
+// inMaintenance devuelve el aviso para el usuario si las descargas nuevas
+// están pausadas. Los administradores pueden seguir descargando para probar.
+func (b *DownloadBot) inMaintenance(userID int64) (string, bool) {
+	state := b.store.maintenance()
+	if !state.Enabled || b.cfg().isAdmin(userID) {
+		return "", false
+	}
+	if state.Message != "" {
+		return "🛠 " + state.Message, true
+	}
+	return defaultMaintenanceMessage, true
+}
+
+// handleMaintenanceCommand activa o desactiva el mantenimiento:
+// /maintenance on [mensaje] | off
+func (b *DownloadBot) handleMaintenanceCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+	action, text, _ := strings.Cut(strings.TrimSpace(message.CommandArguments()), " ")
+	switch strings.ToLower(action) {
+	case "on":
+		b.store.setMaintenance(MaintenanceState{Enabled: true, Message: strings.TrimSpace(text), Since: time.Now()})
+		log.Printf("🛠 Modo mantenimiento activado por %d", message.From.ID)
+		notice, _ := b.inMaintenance(0)
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("🛠 Mantenimiento *activado*. Las descargas en curso terminan; las nuevas reciben:\n\n%s\n\n%d descargas siguen en marcha.",
+			notice, activeJobs.Load()))
+	case "off":
+		b.store.setMaintenance(MaintenanceState{})
+		log.Printf("🛠 Modo mantenimiento desactivado por %d", message.From.ID)
+		b.sendReply(chatID, message.MessageID, "✅ Mantenimiento *desactivado*: el bot vuelve a aceptar descargas.")
+	default:
+		state := b.store.maintenance()
+		status := "desactivado"
+		if state.Enabled {
+			status = "activado desde el " + state.Since.Format("02/01/2006 15:04")
+		}
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("🛠 Uso: /maintenance on [mensaje] | off\n\nAhora: %s. Descargas en marcha: %d.", status, activeJobs.Load()))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Máximo de publicaciones espejadas que se recuerdan para poder retirarlas
+const maxMirroredPosts = 500
+
+// MirroredPost es un video publicado en uno o más destinos (canal de
+// publicación automática) con los mensajes entregados en cada uno.
+type MirroredPost struct {
+	ID         string           `json:"id"`
+	SourceURL  string           `json:"source_url"`
+	Title      string           `json:"title"`
+	Deliveries []MirrorDelivery `json:"deliveries"`
+	PostedAt   time.Time        `json:"posted_at"`
+	Retracted  bool             `json:"retracted,omitempty"`
+}
+
+// MirrorDelivery es la copia de una publicación en un destino concreto.
+type MirrorDelivery struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int   `json:"message_id"`
+}
+
+func (s *Store) recordMirror(post MirroredPost) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mirrors := append(s.data.Mirrors, post)
+	if len(mirrors) > maxMirroredPosts {
+		mirrors = mirrors[len(mirrors)-maxMirroredPosts:]
+	}
+	s.data.Mirrors = mirrors
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando publicaciones espejadas: %v", err)
+	}
+}
+
+// findMirrors busca las publicaciones vigentes por ID o por URL de origen.
+func (s *Store) findMirrors(ref string) []MirroredPost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []MirroredPost
+	for _, post := range s.data.Mirrors {
+		if !post.Retracted && (post.ID == ref || post.SourceURL == ref) {
+			found = append(found, post)
+		}
+	}
+	return found
+}
+
+func (s *Store) recentMirrors(limit int) []MirroredPost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []MirroredPost
+	for i := len(s.data.Mirrors) - 1; i >= 0 && len(list) < limit; i-- {
+		if !s.data.Mirrors[i].Retracted {
+			list = append(list, s.data.Mirrors[i])
+		}
+	}
+	return list
+}
+
+func (s *Store) markRetracted(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Mirrors {
+		if s.data.Mirrors[i].ID == id {
+			s.data.Mirrors[i].Retracted = true
+		}
+	}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando publicaciones espejadas: %v", err)
+	}
+}
+
+// handleAdminRetract retira una publicación espejada en todos sus destinos:
+//
+//	/admin retract                 lista las últimas publicaciones
+//	/admin retract <ID o URL>      borra los mensajes entregados
+//	/admin retract <ID o URL> <nota>  sustituye el pie de foto por la nota
+func (b *DownloadBot) handleAdminRetract(message *tgbotapi.Message, args []string) {
+	chatID := message.Chat.ID
+	if len(args) == 0 {
+		posts := b.store.recentMirrors(10)
+		if len(posts) == 0 {
+			b.sendReply(chatID, message.MessageID, "📡 No hay publicaciones espejadas.")
+			return
+		}
+		var lines []string
+		for _, post := range posts {
+			lines = append(lines, fmt.Sprintf("`%s` %s (%d destinos)", post.ID, escapeMarkdown(post.Title), len(post.Deliveries)))
+		}
+		b.sendReply(chatID, message.MessageID, "📡 *Últimas publicaciones*\n\n"+strings.Join(lines, "\n")+"\n\nUso: /admin retract <ID o URL> [nota]")
+		return
+	}
+
+	posts := b.store.findMirrors(args[0])
+	if len(posts) == 0 {
+		b.sendReply(chatID, message.MessageID, "❌ No encontré ninguna publicación con ese ID o URL.")
+		return
+	}
+	note := strings.Join(args[1:], " ")
+
+	ok, failed := 0, 0
+	for _, post := range posts {
+		for _, d := range post.Deliveries {
+			var err error
+			if note != "" {
+				edit := tgbotapi.NewEditMessageCaption(d.ChatID, d.MessageID, "⚠️ "+note)
+				_, err = b.bot.Request(edit)
+			} else {
+				_, err = b.bot.Request(tgbotapi.NewDeleteMessage(d.ChatID, d.MessageID))
+			}
+			if err != nil {
+				log.Printf("Error retirando %s en %d: %v", post.ID, d.ChatID, err)
+				failed++
+				continue
+			}
+			ok++
+		}
+		b.store.markRetracted(post.ID)
+	}
+
+	action := "borrados"
+	if note != "" {
+		action = "editados"
+	}
+	text := fmt.Sprintf("✅ Mensajes %s: %d", action, ok)
+	if failed > 0 {
+		text += fmt.Sprintf("\n⚠️ Fallidos: %d (el mensaje ya no existe o el bot perdió permisos)", failed)
+	}
+	b.sendReply(chatID, message.MessageID, text)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Máximo de descargas marcadas que se conservan pendientes de revisión
+const maxFlaggedDownloads = 200
+
+// Descargas marcadas que se muestran en cada /admin review
+const reviewPageSize = 10
+
+// ModerationState guarda las listas de bloqueo, los baneos y las descargas
+// marcadas por los hooks de moderación.
+type ModerationState struct {
+	BlockedURLs    map[string]time.Time `json:"blocked_urls"`
+	BlockedDomains map[string]time.Time `json:"blocked_domains"`
+	Banned         map[int64]time.Time  `json:"banned"`
+	Flagged        []FlaggedDownload    `json:"flagged"`
+}
+
+// FlaggedDownload es una descarga entregada que un hook marcó para revisión.
+type FlaggedDownload struct {
+	ID        string    `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	MessageID int       `json:"message_id"` // Mensaje entregado, para poder borrarlo
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Reason    string    `json:"reason"`
+	At        time.Time `json:"at"`
+}
+
+// urlDomain devuelve el host del enlace sin "www.".
+func urlDomain(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func (s *Store) isBanned(userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data.Moderation.Banned[userID]
+	return ok
+}
+
+// isBlocked comprueba el enlace contra la lista de URLs y de dominios (incluye subdominios).
+func (s *Store) isBlocked(rawURL string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Moderation.BlockedURLs[rawURL]; ok {
+		return true
+	}
+	domain := urlDomain(rawURL)
+	for blocked := range s.data.Moderation.BlockedDomains {
+		if domain == blocked || strings.HasSuffix(domain, "."+blocked) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) flagDownload(entry FlaggedDownload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flagged := append(s.data.Moderation.Flagged, entry)
+	if len(flagged) > maxFlaggedDownloads {
+		flagged = flagged[len(flagged)-maxFlaggedDownloads:]
+	}
+	s.data.Moderation.Flagged = flagged
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando moderación: %v", err)
+	}
+}
+
+// recentFlagged devuelve las últimas descargas marcadas, de la más reciente a la más antigua.
+func (s *Store) recentFlagged(limit int) []FlaggedDownload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []FlaggedDownload
+	for i := len(s.data.Moderation.Flagged) - 1; i >= 0 && len(list) < limit; i-- {
+		list = append(list, s.data.Moderation.Flagged[i])
+	}
+	return list
+}
+
+// resolveFlagged saca una descarga de la cola de revisión y la devuelve.
+func (s *Store) resolveFlagged(id string) (FlaggedDownload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, entry := range s.data.Moderation.Flagged {
+		if entry.ID == id {
+			s.data.Moderation.Flagged = append(s.data.Moderation.Flagged[:i], s.data.Moderation.Flagged[i+1:]...)
+			if err := s.save(); err != nil {
+				log.Printf("⚠️ Error guardando moderación: %v", err)
+			}
+			return entry, true
+		}
+	}
+	return FlaggedDownload{}, false
+}
+
+// flaggedByID devuelve una descarga de la cola de revisión sin sacarla.
+func (s *Store) flaggedByID(id string) (FlaggedDownload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.data.Moderation.Flagged {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return FlaggedDownload{}, false
+}
+
+func (s *Store) updateModeration(fn func(*ModerationState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.data.Moderation)
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando moderación: %v", err)
+	}
+}
+
+// checkModeration rechaza enlaces de usuarios baneados o de URLs/dominios bloqueados.
+func (b *DownloadBot) checkModeration(message *tgbotapi.Message, rawURL string) bool {
+	if message.From != nil && b.store.isBanned(message.From.ID) {
+		b.sendReply(message.Chat.ID, message.MessageID, "⛔ No puedes usar este bot.")
+		return false
+	}
+	if b.store.isBlocked(rawURL) {
+		b.sendReply(message.Chat.ID, message.MessageID, "🚫 Este enlace está bloqueado en el bot.")
+		return false
+	}
+	return true
+}
+
+// moderationHook revisa una descarga entregada y la marca si el título
+// contiene alguna de las palabras configuradas.
+func (b *DownloadBot) moderationHook(key sessionKey, meta *VideoMetaData, deliveredMsgID int) {
+	title := strings.ToLower(meta.Title)
+	for _, word := range b.cfg().ModerationKeywords {
+		if !strings.Contains(title, word) {
+			continue
+		}
+		b.store.flagDownload(FlaggedDownload{
+			ID:        randomToken(4),
+			ChatID:    key.ChatID,
+			UserID:    key.UserID,
+			MessageID: deliveredMsgID,
+			URL:       meta.WebpageURL,
+			Title:     meta.Title,
+			Reason:    fmt.Sprintf("palabra «%s»", word),
+			At:        time.Now(),
+		})
+		b.notifyAdmin(fmt.Sprintf("🚩 Descarga marcada para revisión: %s\nUsa /admin review.", escapeMarkdown(meta.Title)))
+		return
+	}
+}
+
+const adminUsage = "🛠️ Uso: /admin review | unblock [dominio, URL o userID] | retract [ID o URL] [nota] | report [AAAA-MM] | budget <userID> <MB>"
+
+// handleAdminCommand agrupa las herramientas de administración: /admin <subcomando>
+func (b *DownloadBot) handleAdminCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		b.sendReply(chatID, message.MessageID, adminUsage)
+		return
+	}
+	switch args[0] {
+	case "review":
+		b.handleAdminReview(message)
+	case "unblock":
+		b.handleAdminUnblock(message, args[1:])
+	case "retract":
+		b.handleAdminRetract(message, args[1:])
+	case "report":
+		b.handleAdminReport(message, args[1:])
+	case "budget":
+		b.handleAdminBudget(message, args[1:])
+	default:
+		b.sendReply(chatID, message.MessageID, adminUsage)
+	}
+}
+
+func (b *DownloadBot) handleAdminReview(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	flagged := b.store.recentFlagged(reviewPageSize)
+	if len(flagged) == 0 {
+		b.sendReply(chatID, message.MessageID, "✅ No hay descargas pendientes de revisión.")
+		return
+	}
+
+	for _, entry := range flagged {
+		text := fmt.Sprintf("🚩 *%s*\n%s\n\n👤 Usuario: `%d`\n💬 Chat: `%d`\n🔎 Motivo: %s\n🕒 %s",
+			escapeMarkdown(entry.Title), escapeMarkdown(entry.URL), entry.UserID, entry.ChatID,
+			escapeMarkdown(entry.Reason), entry.At.Format("02/01/2006 15:04"))
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ParseMode = "Markdown"
+		msg.DisableWebPagePreview = true
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🗑 Borrar", "mod:del:"+entry.ID),
+				tgbotapi.NewInlineKeyboardButtonData("🔨 Banear", "mod:ban:"+entry.ID),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🚫 Bloquear URL", "mod:url:"+entry.ID),
+				tgbotapi.NewInlineKeyboardButtonData("🌐 Bloquear dominio", "mod:domain:"+entry.ID),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("⚡ Todo", "mod:all:"+entry.ID),
+				tgbotapi.NewInlineKeyboardButtonData("👌 Ignorar", "mod:ok:"+entry.ID),
+			),
+		)
+		b.bot.Send(msg)
+	}
+}
+
+// handleModerationCallback ejecuta la acción elegida en /admin review: "mod:<acción>:<id>"
+func (b *DownloadBot) handleModerationCallback(cb *tgbotapi.CallbackQuery) {
+	if !b.cfg().isAdmin(cb.From.ID) {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "⛔ Solo para administradores."))
+		return
+	}
+	parts := strings.Split(cb.Data, ":")
+	if len(parts) != 3 {
+		return
+	}
+	action, id := parts[1], parts[2]
+
+	// Bloquear el dominio de una plataforma principal (youtube.com...) dejaría
+	// el bot inservible para todos: solo se permite bloquear la URL
+	if action == "domain" {
+		if entry, ok := b.store.flaggedByID(id); ok && isMajorPlatform(entry.URL) {
+			b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "⚠️ Es una plataforma principal: no se bloquea el dominio entero. Bloquea la URL."))
+			return
+		}
+	}
+
+	entry, ok := b.store.resolveFlagged(id)
+	if !ok {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Esta descarga ya fue revisada."))
+		b.deleteMessage(cb.Message.Chat.ID, cb.Message.MessageID)
+		return
+	}
+	b.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+
+	var done []string
+	if action == "del" || action == "all" {
+		b.deleteMessage(entry.ChatID, entry.MessageID)
+		done = append(done, "🗑 mensaje borrado")
+	}
+	if action == "ban" || action == "all" {
+		b.store.updateModeration(func(m *ModerationState) { m.Banned[entry.UserID] = time.Now() })
+		done = append(done, "🔨 usuario "+strconv.FormatInt(entry.UserID, 10)+" baneado")
+	}
+	if action == "url" || action == "all" {
+		b.store.updateModeration(func(m *ModerationState) { m.BlockedURLs[entry.URL] = time.Now() })
+		done = append(done, "🚫 URL bloqueada")
+	}
+	if action == "domain" || action == "all" {
+		if isMajorPlatform(entry.URL) {
+			done = append(done, "⚠️ dominio "+urlDomain(entry.URL)+" sin bloquear: es una plataforma principal")
+		} else if domain := urlDomain(entry.URL); domain != "" {
+			b.store.updateModeration(func(m *ModerationState) { m.BlockedDomains[domain] = time.Now() })
+			done = append(done, "🌐 dominio "+domain+" bloqueado")
+		}
+	}
+	if len(done) == 0 {
+		done = append(done, "👌 ignorada")
+	}
+
+	log.Printf("🛠️ Moderación por %d sobre %s: %s", cb.From.ID, entry.URL, strings.Join(done, ", "))
+	b.editMessage(cb.Message.Chat.ID, cb.Message.MessageID,
+		fmt.Sprintf("✅ *%s*\n\n%s", escapeMarkdown(entry.Title), escapeMarkdown(strings.Join(done, "\n"))))
+}
+
+// isMajorPlatform dice si el enlace es de una de las plataformas con nombre
+// propio (platformNames), cuyo dominio no se debe bloquear entero.
+func isMajorPlatform(rawURL string) bool {
+	_, ok := platformNames[detectPlatform(rawURL)]
+	return ok
+}
+
+// handleAdminUnblock deshace un bloqueo de /admin review: un dominio, una URL
+// o el baneo de un usuario. Sin argumentos lista lo bloqueado.
+func (b *DownloadBot) handleAdminUnblock(message *tgbotapi.Message, args []string) {
+	chatID := message.Chat.ID
+	if len(args) == 0 {
+		b.sendReply(chatID, message.MessageID, b.store.blocklistText())
+		return
+	}
+	target := args[0]
+	removed := false
+	b.store.updateModeration(func(m *ModerationState) {
+		if userID, err := strconv.ParseInt(target, 10, 64); err == nil {
+			if _, ok := m.Banned[userID]; ok {
+				delete(m.Banned, userID)
+				removed = true
+			}
+		}
+		if _, ok := m.BlockedURLs[target]; ok {
+			delete(m.BlockedURLs, target)
+			removed = true
+		}
+		domain := strings.TrimPrefix(strings.ToLower(target), "www.")
+		if strings.Contains(target, "://") {
+			domain = urlDomain(target)
+		}
+		if _, ok := m.BlockedDomains[domain]; ok {
+			delete(m.BlockedDomains, domain)
+			removed = true
+		}
+	})
+	if !removed {
+		b.sendReply(chatID, message.MessageID, "❌ No hay ningún bloqueo con ese dominio, URL o usuario.\n\n"+b.store.blocklistText())
+		return
+	}
+	log.Printf("🛠️ Moderación por %d: desbloqueado %s", message.From.ID, target)
+	b.sendReply(chatID, message.MessageID, "✅ Desbloqueado: "+escapeMarkdown(target))
+}
+
+// blocklistText resume los dominios bloqueados y el número de URLs y baneos.
+func (s *Store) blocklistText() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.data.Moderation
+	domains := make([]string, 0, len(m.BlockedDomains))
+	for domain := range m.BlockedDomains {
+		domains = append(domains, escapeMarkdown(domain))
+	}
+	sort.Strings(domains)
+	text := "🌐 *Dominios bloqueados:* "
+	if len(domains) == 0 {
+		text += "ninguno"
+	} else {
+		text += strings.Join(domains, ", ")
+	}
+	return text + fmt.Sprintf("\n🚫 URLs bloqueadas: %d\n🔨 Usuarios baneados: %d\n\nUso: /admin unblock <dominio, URL o userID>",
+		len(m.BlockedURLs), len(m.Banned))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/styling"
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// Límite de tamaño para archivos subidos con una cuenta de usuario (2GB)
+const MaxFileSizeMTProto = 2000 * 1024 * 1024
+
+// Espera entre reconexiones del cliente MTProto: se dobla en cada fallo
+// seguido hasta el máximo
+const (
+	mtprotoRetryMin = 5 * time.Second
+	mtprotoRetryMax = 5 * time.Minute
+)
+
+// errMTProtoLogin indica que la sesión no está iniciada: reconectar no sirve
+var errMTProtoLogin = errors.New("sesión no iniciada; ejecuta el bot con -mtproto-login")
+
+// mtprotoUploader sube archivos grandes con una sesión de usuario al canal de
+// almacén; después el bot copia el mensaje al chat del usuario.
+type mtprotoUploader struct {
+	cfg     *Config
+	storage string // @usuario del canal de almacén
+
+	mu    sync.Mutex
+	api   *tg.Client // nil hasta que la sesión está lista
+	ready bool
+}
+
+func newMTProtoClient(cfg *Config) *telegram.Client {
+	return telegram.NewClient(cfg.MTProtoAppID, cfg.MTProtoAppHash, telegram.Options{
+		SessionStorage: &session.FileStorage{Path: cfg.MTProtoSessionFile},
+	})
+}
+
+// startMTProto arranca el cliente en segundo plano. Devuelve nil si no está
+// configurado; si la sesión no es válida el uploader queda inactivo.
+func startMTProto(cfg *Config) *mtprotoUploader {
+	if cfg.MTProtoAppID == 0 || cfg.MTProtoAppHash == "" || cfg.MTProtoStorageChannel == "" {
+		return nil
+	}
+	m := &mtprotoUploader{
+		cfg:     cfg,
+		storage: "@" + strings.TrimPrefix(cfg.MTProtoStorageChannel, "@"),
+	}
+	go m.keepConnected()
+	return m
+}
+
+// keepConnected mantiene el cliente conectado: si la conexión se cae (red,
+// reinicio de los servidores de Telegram) se vuelve a conectar con un
+// cliente nuevo, esperando cada vez más entre intentos fallidos. Mientras
+// tanto los archivos grandes se sirven por los demás medios.
+func (m *mtprotoUploader) keepConnected() {
+	retry := mtprotoRetryMin
+	for {
+		started := time.Now()
+		err := m.run()
+		m.mu.Lock()
+		m.api, m.ready = nil, false
+		m.mu.Unlock()
+		if errors.Is(err, errMTProtoLogin) {
+			log.Printf("⚠️ Cliente MTProto detenido: %v", err)
+			return
+		}
+		// Una conexión que aguantó un rato no cuenta como fallo seguido
+		if time.Since(started) > mtprotoRetryMax {
+			retry = mtprotoRetryMin
+		}
+		log.Printf("⚠️ Cliente MTProto desconectado (%v); reintentando en %s", err, retry)
+		time.Sleep(retry)
+		retry = min(2*retry, mtprotoRetryMax)
+	}
+}
+
+// run conecta un cliente nuevo y lo deja listo hasta que se cae la conexión.
+func (m *mtprotoUploader) run() error {
+	client := newMTProtoClient(m.cfg)
+	return client.Run(context.Background(), func(ctx context.Context) error {
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return err
+		}
+		if !status.Authorized {
+			return errMTProtoLogin
+		}
+		m.mu.Lock()
+		m.api, m.ready = client.API(), true
+		m.mu.Unlock()
+		log.Println("📡 Cliente MTProto listo: archivos de hasta 2GB habilitados")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+}
+
+func (m *mtprotoUploader) available() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ready
+}
+
+// mtprotoProgress muestra el avance de la subida en el mensaje de estado.
+type mtprotoProgress struct {
+	b       *DownloadBot
+	chatID  int64
+	msgID   int
+	lastAt  time.Time
+	started bool
+}
+
+func (p *mtprotoProgress) Chunk(ctx context.Context, state uploader.ProgressState) error {
+	if state.Total <= 0 || (p.started && time.Since(p.lastAt) < UpdateInterval) {
+		return nil
+	}
+	p.started, p.lastAt = true, time.Now()
+	percent := fmt.Sprintf("%.1f", float64(state.Uploaded)*100/float64(state.Total))
+	p.b.editMessage(p.chatID, p.msgID, fmt.Sprintf("📤 *Subiendo archivo grande: %s%%*\n%s", percent, generateProgressBar(percent)))
+	return nil
+}
+
+// upload sube el archivo al canal de almacén y devuelve el ID del mensaje.
+func (m *mtprotoUploader) upload(ctx context.Context, path, mode string, meta *VideoMetaData, progress uploader.Progress) (int, error) {
+	m.mu.Lock()
+	api := m.api
+	m.mu.Unlock()
+	if api == nil {
+		return 0, errors.New("cliente MTProto no disponible")
+	}
+
+	file, err := uploader.NewUploader(api).WithProgress(progress).FromPath(ctx, path)
+	if err != nil {
+		return 0, fmt.Errorf("subiendo: %w", err)
+	}
+
+	duration := time.Duration(meta.Duration) * time.Second
+	doc := message.UploadedDocument(file, styling.Plain(meta.Title)).Filename(filepath.Base(path))
+	var media message.MediaOption
+	switch mode {
+	case "audio":
+		media = doc.MIME("audio/mpeg").Audio().Title(meta.Title).Performer(meta.Uploader).Duration(duration)
+	case "voice":
+		media = doc.MIME("audio/ogg").Voice().Duration(duration)
+	case "note":
+		media = doc.MIME("video/mp4").RoundVideo().Duration(duration)
+	default:
+		media = doc.MIME("video/mp4").Video().Duration(duration).SupportsStreaming()
+	}
+
+	updates, err := message.NewSender(api).Resolve(m.storage).Media(ctx, media)
+	if err != nil {
+		return 0, fmt.Errorf("enviando al canal de almacén: %w", err)
+	}
+	if id, ok := sentMessageID(updates); ok {
+		return id, nil
+	}
+	return 0, errors.New("no se encontró el mensaje enviado")
+}
+
+// sentMessageID extrae el ID del mensaje recién enviado de la respuesta.
+func sentMessageID(updates tg.UpdatesClass) (int, bool) {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	}
+	for _, update := range list {
+		switch u := update.(type) {
+		case *tg.UpdateMessageID:
+			return u.ID, true
+		case *tg.UpdateNewChannelMessage:
+			if msg, ok := u.Message.(*tg.Message); ok {
+				return msg.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// deliverLarge entrega un archivo que excede la Bot API: por MTProto si cabe en
+// 2GB, la sesión está activa y el usuario es premium, y si no, mediante un
+// enlace de descarga.
+func (b *DownloadBot) deliverLarge(userID, chatID int64, msgID, replyTo int, tooLarge *fileTooLargeError, mode string, meta *VideoMetaData) bool {
+	if tooLarge.Size <= b.sendLimit(userID) {
+		if err := b.sendViaMTProto(chatID, msgID, replyTo, tooLarge.Path, mode, meta); err != nil {
+			log.Printf("Error enviando por MTProto: %v", err)
+		} else {
+			return true
+		}
+	}
+	return b.offloadLarge(chatID, msgID, replyTo, tooLarge, meta)
+}
+
+func (b *DownloadBot) sendViaMTProto(chatID int64, msgID, replyTo int, path, mode string, meta *VideoMetaData) error {
+	storage, err := b.resolveChannel(b.mtproto.storage)
+	if err != nil {
+		return fmt.Errorf("el bot no accede al canal de almacén: %w", err)
+	}
+
+	b.editMessage(chatID, msgID, "📤 *Subiendo archivo grande...*")
+	ctx, cancel := context.WithTimeout(context.Background(), offloadUploadTimeout)
+	defer cancel()
+
+	stored, err := b.mtproto.upload(ctx, path, mode, meta, &mtprotoProgress{b: b, chatID: chatID, msgID: msgID})
+	if err != nil {
+		return err
+	}
+	// El mensaje del almacén se borra tras copiarlo: la copia conserva el archivo
+	defer b.deleteMessage(storage.ID, stored)
+
+	copyMsg := tgbotapi.NewCopyMessage(chatID, storage.ID, stored)
+	copyMsg.ReplyToMessageID = replyTo
+	_, err = b.bot.CopyMessage(copyMsg)
+	return err
+}
+
+// mtprotoLogin inicia sesión de forma interactiva y guarda la sesión en disco.
+func mtprotoLogin(cfg *Config) error {
+	if cfg.MTProtoAppID == 0 || cfg.MTProtoAppHash == "" {
+		return errors.New("faltan MTPROTO_APP_ID y MTPROTO_APP_HASH")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.MTProtoSessionFile), 0755); err != nil {
+		return err
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	prompt := func(label string) (string, error) {
+		fmt.Print(label)
+		line, err := stdin.ReadString('\n')
+		return strings.TrimSpace(line), err
+	}
+
+	phone, err := prompt("Teléfono (formato internacional): ")
+	if err != nil {
+		return err
+	}
+	password, err := prompt("Contraseña 2FA (vacío si no tiene): ")
+	if err != nil {
+		return err
+	}
+	code := auth.CodeAuthenticatorFunc(func(ctx context.Context, _ *tg.AuthSentCode) (string, error) {
+		return prompt("Código recibido en Telegram: ")
+	})
+
+	client := newMTProtoClient(cfg)
+	return client.Run(context.Background(), func(ctx context.Context) error {
+		flow := auth.NewFlow(auth.Constant(phone, password, code), auth.SendCodeOptions{})
+		if err := client.Auth().IfNecessary(ctx, flow); err != nil {
+			return err
+		}
+		self, err := client.Self(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Sesión guardada en %s para %s\n", cfg.MTProtoSessionFile, self.FirstName)
+		return nil
+	})
+}
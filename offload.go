@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tiempo máximo para subir un archivo grande al almacenamiento externo
+const offloadUploadTimeout = 30 * time.Minute
+
+// fileTooLargeError indica que el archivo supera el límite de la Bot API. El
+// archivo se conserva en disco para que el llamador pueda entregarlo por otra
+// vía (almacenamiento externo) o borrarlo.
+type fileTooLargeError struct {
+	Path string
+	Size int64
+}
+
+func (e *fileTooLargeError) Error() string {
+	return fmt.Sprintf("❌ El archivo es demasiado grande (%d MB). El límite de Telegram es 50MB.", e.Size/(1024*1024))
+}
+
+// remoteStorage sube un archivo y devuelve un enlace de descarga para el usuario.
+type remoteStorage interface {
+	Upload(ctx context.Context, localPath, key string) (link string, err error)
+	// LinkTTL es la vigencia del enlace; 0 si no caduca.
+	LinkTTL() time.Duration
+}
+
+// S3 no acepta enlaces prefirmados de más de 7 días
+const s3MaxLinkTTL = 7 * 24 * time.Hour
+
+// newRemoteStorage elige el backend configurado: S3 tiene prioridad sobre WebDAV.
+func newRemoteStorage(cfg *Config) remoteStorage {
+	switch {
+	case cfg.S3Bucket != "" && cfg.S3Endpoint != "":
+		linkTTL := cfg.S3LinkTTL
+		if linkTTL <= 0 || linkTTL > s3MaxLinkTTL {
+			linkTTL = s3MaxLinkTTL
+			if cfg.S3LinkTTL <= 0 {
+				linkTTL = 24 * time.Hour
+			}
+			log.Printf("⚠️ S3_LINK_TTL=%s fuera de rango (máx. 7 días), usando %s", cfg.S3LinkTTL, linkTTL)
+		}
+		return &s3Storage{
+			endpoint:  strings.TrimSuffix(cfg.S3Endpoint, "/"),
+			region:    cfg.S3Region,
+			bucket:    cfg.S3Bucket,
+			accessKey: cfg.S3AccessKey,
+			secretKey: cfg.S3SecretKey,
+			linkTTL:   linkTTL,
+		}
+	case cfg.WebDAVURL != "":
+		public := cfg.WebDAVPublicURL
+		if public == "" {
+			public = cfg.WebDAVURL
+		}
+		return &webDAVStorage{
+			baseURL:   strings.TrimSuffix(cfg.WebDAVURL, "/"),
+			publicURL: strings.TrimSuffix(public, "/"),
+			user:      cfg.WebDAVUser,
+			password:  cfg.WebDAVPassword,
+		}
+	}
+	return nil
+}
+
+// randomToken genera un identificador aleatorio en hexadecimal.
+func randomToken(bytes int) string {
+	buf := make([]byte, bytes)
+	// Un token predecible dejaría adivinar enlaces y trabajos: mejor parar
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("sin fuente de aleatoriedad: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// offloadLarge entrega por enlace un archivo que excede el límite de Telegram:
+// lo sube al almacenamiento externo o, si no hay, lo sirve desde el propio bot.
+// Devuelve false si no hay ninguna vía configurada o la entrega falla.
+func (b *DownloadBot) offloadLarge(chatID int64, msgID, replyTo int, tooLarge *fileTooLargeError, meta *VideoMetaData) bool {
+	var link string
+	var ttl time.Duration
+	var err error
+
+	switch {
+	case b.remote != nil:
+		b.editMessage(chatID, msgID, "☁️ *El archivo supera el límite de Telegram. Subiendo a almacenamiento externo...*")
+
+		ctx, cancel := context.WithTimeout(context.Background(), offloadUploadTimeout)
+		defer cancel()
+
+		key := randomToken(16) + "/" + filepath.Base(tooLarge.Path)
+		link, err = b.remote.Upload(ctx, tooLarge.Path, key)
+		ttl = b.remote.LinkTTL()
+	case b.cfg().ServeLargeFiles && !b.worker:
+		// Un worker no sirve /files/: el enlace apuntaría al proceso principal,
+		// que no tiene el archivo
+		link, err = b.serveLarge(tooLarge.Path)
+		ttl = b.cfg().ServedFileTTL
+	default:
+		return false
+	}
+	if err != nil {
+		log.Printf("Error entregando archivo grande: %v", err)
+		return false
+	}
+
+	expiry := ""
+	if ttl > 0 {
+		expiry = fmt.Sprintf("\n\n⏳ El enlace caduca en %s.", ttl.Round(time.Minute))
+	}
+	b.sendReply(chatID, replyTo, fmt.Sprintf("📦 *%s*\n\nEl archivo pesa %d MB y supera el límite de Telegram, así que lo dejé aquí:\n[⬇️ Descargar](%s)%s",
+		escapeMarkdown(meta.Title), tooLarge.Size/(1024*1024), link, expiry))
+	return true
+}
+
+// s3Storage sube a un bucket compatible con S3 usando URLs prefirmadas (SigV4).
+type s3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	linkTTL   time.Duration
+}
+
+func (s *s3Storage) LinkTTL() time.Duration { return s.linkTTL }
+
+func (s *s3Storage) Upload(ctx context.Context, localPath, key string) (string, error) {
+	putURL, err := s.presign(http.MethodPut, key, 15*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if err := httpPutFile(ctx, putURL, localPath, nil); err != nil {
+		return "", err
+	}
+	return s.presign(http.MethodGet, key, s.linkTTL)
+}
+
+// presign genera una URL prefirmada con AWS Signature V4 (estilo path: /bucket/key).
+func (s *s3Storage) presign(method, key string, expires time.Duration) (string, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+
+	segments := []string{s.bucket}
+	segments = append(segments, strings.Split(key, "/")...)
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	canonicalURI := "/" + strings.Join(segments, "/")
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hashed[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	signingKey = hmacSHA256(signingKey, s.region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s", u.Scheme, u.Host, canonicalURI, canonicalQuery, signature), nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// webDAVStorage sube por PUT a un servidor WebDAV. Los enlaces no caducan:
+// la limpieza queda a cargo del servidor.
+type webDAVStorage struct {
+	baseURL   string
+	publicURL string
+	user      string
+	password  string
+}
+
+func (w *webDAVStorage) LinkTTL() time.Duration { return 0 }
+
+func (w *webDAVStorage) Upload(ctx context.Context, localPath, key string) (string, error) {
+	dir := key[:strings.LastIndex(key, "/")]
+	if err := w.mkcol(ctx, dir); err != nil {
+		return "", err
+	}
+	setAuth := func(req *http.Request) {
+		if w.user != "" {
+			req.SetBasicAuth(w.user, w.password)
+		}
+	}
+	if err := httpPutFile(ctx, w.baseURL+"/"+key, localPath, setAuth); err != nil {
+		return "", err
+	}
+	return w.publicURL + "/" + key, nil
+}
+
+// mkcol crea la carpeta del token (WebDAV no crea directorios intermedios en PUT).
+func (w *webDAVStorage) mkcol(ctx context.Context, dir string) error {
+	req, err := http.NewRequestWithContext(ctx, "MKCOL", w.baseURL+"/"+dir, nil)
+	if err != nil {
+		return err
+	}
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// 405: la carpeta ya existe
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("MKCOL %s: %s", dir, resp.Status)
+	}
+	return nil
+}
+
+// httpPutFile sube un archivo por PUT en streaming, sin cargarlo en memoria.
+func httpPutFile(ctx context.Context, target, localPath string, prepare func(*http.Request)) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if prepare != nil {
+		prepare(req)
+	}
+
+	// Sin timeout propio: lo controla el contexto
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("PUT: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Señales que apagan el bot y que recargan la configuración
+var (
+	shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	reloadSignals   = []os.Signal{syscall.SIGHUP}
+)
+
+// diskSpace devuelve el espacio libre y total, en bytes, del disco de la
+// carpeta de descargas.
+func diskSpace() (free, total int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(DownloadDir, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
+
+// killGroupOnCancel hace que, al vencer el contexto, se mate todo el grupo de
+// procesos: yt-dlp lanza ffmpeg como hijo y matar solo al padre lo dejaría
+// huérfano y con los pipes abiertos, bloqueando Wait.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Por si algún nieto sigue con stdout abierto tras la señal
+	cmd.WaitDelay = 10 * time.Second
+}
@@ -0,0 +1,58 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// En Windows llegan Ctrl+C (os.Interrupt) y, al cerrar la consola, cerrar
+// sesión o apagar, SIGTERM (Go traduce esos eventos). No hay SIGHUP: la
+// configuración se recarga con /reload.
+var (
+	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	reloadSignals   []os.Signal
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskSpace devuelve el espacio libre y total, en bytes, del disco de la
+// carpeta de descargas.
+func diskSpace() (free, total int64, err error) {
+	dir, err := filepath.Abs(DownloadDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var available, size, totalFree uint64
+	ok, _, callErr := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&available)), uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&totalFree)))
+	if ok == 0 {
+		return 0, 0, callErr
+	}
+	return int64(available), int64(size), nil
+}
+
+// killGroupOnCancel hace que, al vencer el contexto, se mate el árbol de
+// procesos: Windows no tiene grupos a los que enviar una señal, así que
+// taskkill /T se encarga del ffmpeg que lanzó yt-dlp.
+func killGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	cmd.Cancel = func() error {
+		if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	// Por si algún nieto sigue con stdout abierto tras matar el árbol
+	cmd.WaitDelay = 10 * time.Second
+}
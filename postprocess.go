@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Objetivo de sonoridad EBU R128 (el de la mayoría de plataformas de podcasts)
+const loudnormFilter = "loudnorm=I=-16:TP=-1.5:LRA=11"
+
+// audioCodecArgs elige el códec para recodificar un audio según su extensión,
+// manteniendo la tasa elegida (kbps) o, si no hay, una alta.
+func audioCodecArgs(ext string, kbps int) ([]string, bool) {
+	bitrate := func(def int) string {
+		if kbps > 0 {
+			return fmt.Sprintf("%dk", kbps)
+		}
+		return fmt.Sprintf("%dk", def)
+	}
+	switch ext {
+	case ".mp3":
+		if kbps == 0 {
+			return []string{"-c:a", "libmp3lame", "-q:a", "0"}, true
+		}
+		return []string{"-c:a", "libmp3lame", "-b:a", bitrate(0)}, true
+	case ".m4a":
+		return []string{"-c:a", "aac", "-b:a", bitrate(256)}, true
+	case ".opus", ".ogg":
+		return []string{"-c:a", "libopus", "-b:a", bitrate(128)}, true
+	}
+	return nil, false
+}
+
+// normalizeLoudness aplica loudnorm al audio, reemplazando el archivo, para
+// que podcasts y música suenen al mismo volumen.
+func normalizeLoudness(path string, kbps int) error {
+	ext := filepath.Ext(path)
+	codec, ok := audioCodecArgs(ext, kbps)
+	if !ok {
+		return fmt.Errorf("formato de audio no soportado: %s", ext)
+	}
+	normalized := path + ".norm" + ext
+	args := append([]string{"-y", "-i", path, "-vn", "-af", loudnormFilter}, codec...)
+	// Conserva las etiquetas (título, artista)
+	args = append(args, "-map_metadata", "0", normalized)
+	if err := exec.Command(ffmpegBin, args...).Run(); err != nil {
+		os.Remove(normalized)
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(normalized, path)
+}
+
+// probeCodecs devuelve los códecs de video y audio del archivo ("" si no hay pista).
+func probeCodecs(path string) (video, audio string, err error) {
+	out, err := exec.Command(ffprobeBin, "-v", "error",
+		"-show_entries", "stream=codec_type,codec_name",
+		"-of", "csv=p=0", path).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("ffprobe: %w", err)
+	}
+	// Una línea por pista: "h264,video", "opus,audio"
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		name, kind, _ := strings.Cut(strings.TrimSpace(line), ",")
+		switch {
+		case kind == "video" && video == "":
+			video = name
+		case kind == "audio" && audio == "":
+			audio = name
+		}
+	}
+	return video, audio, nil
+}
+
+// ensureCompatible deja el video en H.264/AAC dentro de MP4, que se reproduce
+// en línea en todos los clientes (VP9, AV1 y Opus fallan en iOS). Solo
+// recodifica las pistas que lo necesitan; si ya son compatibles no hace nada.
+func ensureCompatible(path string) error {
+	video, audio, err := probeCodecs(path)
+	if err != nil {
+		return err
+	}
+	videoOK := video == "" || video == "h264"
+	audioOK := audio == "" || audio == "aac"
+	if videoOK && audioOK {
+		return nil
+	}
+
+	args := []string{"-y", "-i", path}
+	if videoOK {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p")
+	}
+	if audioOK {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args, "-c:a", "aac", "-b:a", "160k")
+	}
+	converted := path + ".compat.mp4"
+	args = append(args, "-movflags", "+faststart", converted)
+	if err := exec.Command(ffmpegBin, args...).Run(); err != nil {
+		os.Remove(converted)
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(converted, path)
+}
+
+// Alturas a las que se puede reducir un video tras descargarlo
+var downscaleHeights = []int{720, 480, 360}
+
+// downscaleTargets devuelve las alturas de reducción útiles: las que la fuente
+// no ofrece y están por debajo de su mayor resolución.
+func downscaleTargets(meta *VideoMetaData) []int {
+	available := make(map[int]bool)
+	maxHeight := 0
+	for _, f := range meta.Formats {
+		if f.VideoCodec != "none" && f.Height > 0 {
+			available[ladderRung(f.Height)] = true
+			maxHeight = max(maxHeight, f.Height)
+		}
+	}
+	var targets []int
+	for _, h := range downscaleHeights {
+		if h < maxHeight && !available[h] {
+			targets = append(targets, h)
+		}
+	}
+	return targets
+}
+
+// downscaleVideo reduce el video a la altura dada (sin ampliar si ya es
+// menor), reemplazando el archivo.
+func downscaleVideo(path string, height int) error {
+	converted := path + ".scaled.mp4"
+	cmd := exec.Command(ffmpegBin, "-y", "-i", path,
+		"-vf", fmt.Sprintf("scale=-2:'min(ih,%d)'", height),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "26",
+		"-c:a", "copy",
+		"-movflags", "+faststart",
+		converted)
+	if err := cmd.Run(); err != nil {
+		os.Remove(converted)
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(converted, path)
+}
+
+// Tamaños ofrecidos para "ajustar a un tamaño", en MB
+var targetSizesMB = []int{8, 10, 16, 25, 50}
+
+// Tasa mínima de video con la que el resultado sigue siendo mínimamente visible
+const minTargetVideoKbps = 100
+
+var errTargetTooSmall = errors.New("tamaño objetivo demasiado pequeño para la duración")
+
+// probeDuration lee la duración real del archivo en segundos.
+func probeDuration(path string) (float64, error) {
+	out, err := exec.Command(ffprobeBin, "-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "csv=p=0", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+// encodeToSize recodifica el video en dos pasadas con la tasa que da el tamaño
+// objetivo (menos audio y un margen para el contenedor), reemplazando el
+// archivo. Si height > 0 también reduce la resolución.
+func encodeToSize(path string, target int64, height int) error {
+	duration, err := probeDuration(path)
+	if err != nil || duration <= 0 {
+		return fmt.Errorf("duración desconocida: %v", err)
+	}
+	audioKbps := 96
+	if target < 16*1024*1024 {
+		audioKbps = 64
+	}
+	totalKbps := float64(target) * 8 * 0.97 / duration / 1000
+	videoKbps := int(totalKbps) - audioKbps
+	if videoKbps < minTargetVideoKbps {
+		return errTargetTooSmall
+	}
+
+	video := []string{"-c:v", "libx264", "-preset", "medium", "-b:v", fmt.Sprintf("%dk", videoKbps)}
+	if height > 0 {
+		video = append(video, "-vf", fmt.Sprintf("scale=-2:'min(ih,%d)'", height))
+	}
+	passLog := path + ".2pass"
+	defer func() {
+		logs, _ := filepath.Glob(passLog + "*")
+		for _, f := range logs {
+			os.Remove(f)
+		}
+	}()
+
+	// Primera pasada: solo analiza el video
+	first := append([]string{"-y", "-i", path}, video...)
+	first = append(first, "-pass", "1", "-passlogfile", passLog, "-an", "-f", "mp4", os.DevNull)
+	if err := exec.Command(ffmpegBin, first...).Run(); err != nil {
+		return fmt.Errorf("ffmpeg (pasada 1): %w", err)
+	}
+
+	converted := path + ".sized.mp4"
+	second := append([]string{"-y", "-i", path}, video...)
+	second = append(second, "-pass", "2", "-passlogfile", passLog,
+		"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", audioKbps),
+		"-movflags", "+faststart", converted)
+	if err := exec.Command(ffmpegBin, second...).Run(); err != nil {
+		os.Remove(converted)
+		return fmt.Errorf("ffmpeg (pasada 2): %w", err)
+	}
+	return os.Rename(converted, path)
+}
+
+// handleTargetSizeCallback gestiona "size:menu" y "size:<MB>" (0 = quitar).
+func (b *DownloadBot) handleTargetSizeCallback(key sessionKey, sess *UserSession, value string) {
+	if value == "menu" {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, mb := range targetSizesMB {
+			label := fmt.Sprintf("%dMB", mb)
+			if mb == sess.Options.TargetMB {
+				label = "✅ " + label
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("size:%d", mb)))
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			row,
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🚫 Sin ajustar", "size:0")),
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")),
+		)
+		b.editMessageMarkup(key.ChatID, sess.MsgID, "🎯 *Ajustar a un tamaño*\n\nEl video se recodificará para ocupar como mucho el tamaño elegido. Después elige la calidad de origen.", keyboard)
+		return
+	}
+	mb, _ := strconv.Atoi(value)
+	sess.Options.TargetMB = mb
+	b.state.SaveSession(key, sess)
+	b.editMessageMarkup(key.ChatID, sess.MsgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Payload de la factura del plan premium; se valida en el pre-checkout
+const premiumPayload = "premium_plan"
+
+// Con cuánta antelación se avisa al usuario de que su premium va a caducar
+const premiumReminderBefore = 72 * time.Hour
+
+// PremiumEntitlement es el derecho premium de un usuario y su caducidad.
+type PremiumEntitlement struct {
+	Until     time.Time `json:"until"`
+	ChargeIDs []string  `json:"charge_ids,omitempty"` // Cargos de Telegram, para reembolsos
+	Reminded  bool      `json:"reminded,omitempty"`   // Aviso de renovación enviado
+	Expired   bool      `json:"expired,omitempty"`    // Aviso de caducidad enviado
+}
+
+func (s *Store) premium(userID int64) (PremiumEntitlement, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entitlement, ok := s.data.Premium[userID]
+	if !ok {
+		return PremiumEntitlement{}, false
+	}
+	return *entitlement, true
+}
+
+// extendPremium suma la duración al premium vigente (o desde ahora si ya caducó).
+func (s *Store) extendPremium(userID int64, d time.Duration, chargeID string) PremiumEntitlement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entitlement, ok := s.data.Premium[userID]
+	if !ok {
+		entitlement = &PremiumEntitlement{}
+		s.data.Premium[userID] = entitlement
+	}
+	start := time.Now()
+	if entitlement.Until.After(start) {
+		start = entitlement.Until
+	}
+	entitlement.Until = start.Add(d)
+	entitlement.Reminded, entitlement.Expired = false, false
+	if chargeID != "" {
+		entitlement.ChargeIDs = append(entitlement.ChargeIDs, chargeID)
+	}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando premium: %v", err)
+	}
+	return *entitlement
+}
+
+// isPremium indica si el usuario tiene un plan premium vigente.
+func (b *DownloadBot) isPremium(userID int64) bool {
+	entitlement, ok := b.store.premium(userID)
+	return ok && time.Now().Before(entitlement.Until)
+}
+
+// hasPremiumPerks dice si el usuario tiene las ventajas de pago (archivos de
+// hasta 2GB, álbumes y listas completas): los premium, los administradores y,
+// con el plan desactivado (PREMIUM_PRICE=0), todos.
+func (b *DownloadBot) hasPremiumPerks(userID int64) bool {
+	return b.cfg().PremiumPrice <= 0 || b.cfg().isAdmin(userID) || b.isPremium(userID)
+}
+
+// premiumPerksText enumera lo que desbloquea el pago con la configuración actual.
+func (b *DownloadBot) premiumPerksText() string {
+	perks := []string{"⚡ Prioridad en la cola: tus descargas pasan antes cuando el servidor está ocupado."}
+	if free, premium := b.cfg().DailyBudgetMB, b.cfg().PremiumDailyBudgetMB; free > 0 && (premium == 0 || premium > free) {
+		limit := "sin límite"
+		if premium > 0 {
+			limit = humanSize(premium * 1024 * 1024)
+		}
+		perks = append(perks, fmt.Sprintf("📶 Límite diario de descarga: %s (en lugar de %s).", limit, humanSize(free*1024*1024)))
+	}
+	if b.mtproto != nil {
+		perks = append(perks, fmt.Sprintf("📦 Archivos de hasta 2 GB directamente en Telegram (sin premium, %s).", humanSize(MaxFileSizeBotAPI)))
+	}
+	perks = append(perks, "💿 Álbumes y posts con varios videos completos de una vez (sin premium, de uno en uno).")
+	return "• " + strings.Join(perks, "\n• ")
+}
+
+func (b *DownloadBot) premiumDays() int {
+	return int(b.cfg().PremiumDuration / (24 * time.Hour))
+}
+
+func (b *DownloadBot) handlePremiumCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil {
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) > 0 && args[0] == "grant" {
+		b.handlePremiumGrant(message, args[1:])
+		return
+	}
+
+	status := "Aún no tienes premium."
+	if entitlement, ok := b.store.premium(message.From.ID); ok && time.Now().Before(entitlement.Until) {
+		status = fmt.Sprintf("✅ Premium activo hasta el %s.", entitlement.Until.Format("02/01/2006"))
+	}
+	b.sendReply(chatID, message.MessageID, fmt.Sprintf("💎 *Plan Premium*\n\n%s\n\nCon premium tienes:\n%s\n\nY ayudas a mantener el bot.", status, b.premiumPerksText()))
+
+	if !message.Chat.IsPrivate() {
+		return // Las facturas se envían solo por privado
+	}
+	b.sendPremiumInvoice(chatID)
+}
+
+// sendPremiumInvoice envía la factura de premium al chat privado del usuario.
+func (b *DownloadBot) sendPremiumInvoice(chatID int64) bool {
+	invoice := tgbotapi.NewInvoice(chatID,
+		"💎 Premium",
+		fmt.Sprintf("%d días de Video Downloader Pro Premium", b.premiumDays()),
+		premiumPayload, b.cfg().PaymentProviderToken, "premium", b.cfg().PremiumCurrency,
+		[]tgbotapi.LabeledPrice{{Label: "Premium", Amount: b.cfg().PremiumPrice}})
+	if _, err := b.bot.Send(invoice); err != nil {
+		log.Printf("Error enviando factura: %v", err)
+		b.sendMessage(chatID, "❌ Los pagos no están disponibles en este momento.")
+		return false
+	}
+	return true
+}
+
+// handlePremiumGrant permite a un admin regalar premium: /premium grant <userID> <días>
+func (b *DownloadBot) handlePremiumGrant(message *tgbotapi.Message, args []string) {
+	chatID := message.Chat.ID
+	if !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden regalar premium.")
+		return
+	}
+	if len(args) < 2 {
+		b.sendReply(chatID, message.MessageID, "💎 Uso: /premium grant <userID> <días>")
+		return
+	}
+	userID, err1 := strconv.ParseInt(args[0], 10, 64)
+	days, err2 := strconv.Atoi(args[1])
+	if err1 != nil || err2 != nil || days <= 0 {
+		b.sendReply(chatID, message.MessageID, "❌ Usuario o días inválidos.")
+		return
+	}
+	entitlement := b.store.extendPremium(userID, time.Duration(days)*24*time.Hour, "")
+	b.sendReply(chatID, message.MessageID, fmt.Sprintf("✅ Premium de %d activo hasta el %s.", userID, entitlement.Until.Format("02/01/2006")))
+}
+
+// handlePreCheckout confirma el pago solo si coincide con la oferta actual.
+func (b *DownloadBot) handlePreCheckout(query *tgbotapi.PreCheckoutQuery) {
+	answer := tgbotapi.PreCheckoutConfig{PreCheckoutQueryID: query.ID, OK: true}
+	if query.InvoicePayload != premiumPayload || query.Currency != b.cfg().PremiumCurrency || query.TotalAmount != b.cfg().PremiumPrice {
+		answer.OK = false
+		answer.ErrorMessage = "La oferta ha cambiado. Usa /premium de nuevo."
+	}
+	if _, err := b.bot.Request(answer); err != nil {
+		log.Printf("Error respondiendo pre-checkout: %v", err)
+	}
+}
+
+func (b *DownloadBot) handleSuccessfulPayment(message *tgbotapi.Message) {
+	payment := message.SuccessfulPayment
+	if payment.InvoicePayload != premiumPayload || message.From == nil {
+		return
+	}
+	entitlement := b.store.extendPremium(message.From.ID, b.cfg().PremiumDuration, payment.TelegramPaymentChargeID)
+	log.Printf("💎 Premium comprado por %d (cargo %s)", message.From.ID, payment.TelegramPaymentChargeID)
+	b.sendMessage(message.Chat.ID, fmt.Sprintf("🎉 *¡Gracias!* Tu premium está activo hasta el %s.", entitlement.Until.Format("02/01/2006")))
+}
+
+// premiumWatcher avisa a los usuarios antes y después de que caduque su premium.
+func (b *DownloadBot) premiumWatcher() {
+	ticker := time.NewTicker(time.Hour)
+	for range ticker.C {
+		var remind, expired []int64
+
+		b.store.mu.Lock()
+		for userID, entitlement := range b.store.data.Premium {
+			left := time.Until(entitlement.Until)
+			switch {
+			case left <= 0 && !entitlement.Expired:
+				entitlement.Expired = true
+				expired = append(expired, userID)
+			case left > 0 && left < premiumReminderBefore && !entitlement.Reminded:
+				entitlement.Reminded = true
+				remind = append(remind, userID)
+			}
+		}
+		if len(remind)+len(expired) > 0 {
+			if err := b.store.save(); err != nil {
+				log.Printf("⚠️ Error guardando premium: %v", err)
+			}
+		}
+		b.store.mu.Unlock()
+
+		for _, userID := range remind {
+			b.sendMessage(userID, "⏳ Tu premium caduca en menos de 3 días. Usa /premium para renovarlo.")
+		}
+		for _, userID := range expired {
+			b.sendMessage(userID, "💎 Tu premium ha caducado. Usa /premium cuando quieras renovarlo.")
+		}
+	}
+}
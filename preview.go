@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Segundos de la vista previa de audio
+const audioPreviewSeconds = 30
+
+// previewKeyboard pregunta, tras la vista previa, si se descarga el audio completo.
+func previewKeyboard(audioFormat string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("🎵 Descargar el audio completo (%s)", strings.ToUpper(audioFormat)), "dl:audio:"+audioFormat)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("❌ Cancelar", "cancel")),
+	)
+}
+
+// handlePreviewCallback atiende "preview:audio": descarga solo los primeros
+// 30 segundos (o los del clip elegido) y los envía como nota de voz, para
+// comprobar que el enlace es el bueno antes de gastar la descarga completa.
+func (b *DownloadBot) handlePreviewCallback(key sessionKey, sess *UserSession) {
+	// Un doble toque no lanza dos vistas previas
+	if b.state.Incr(fmt.Sprintf("preview:%d:%d", key.ChatID, sess.MsgID), selectionDedupeTTL) > 1 {
+		return
+	}
+	// Como las descargas: ni en mantenimiento ni con el límite diario agotado
+	if notice, paused := b.inMaintenance(key.UserID); paused {
+		b.editMessage(key.ChatID, sess.MsgID, notice)
+		return
+	}
+	if !b.checkByteBudget(key, sess, 0) {
+		return
+	}
+	noKeyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	b.editMessageMarkup(key.ChatID, sess.MsgID, "🎧 *Preparando vista previa...*", noKeyboard)
+	b.schedule(key, sess, func() { b.sendAudioPreview(key, sess) })
+}
+
+func (b *DownloadBot) sendAudioPreview(key sessionKey, sess *UserSession) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	// Gasta ancho de banda, pero no es una descarga completada
+	job.preview = true
+	defer b.finishUsageJob(job)
+
+	// Lo que queda de audio desde el inicio del clip, si es menos de 30 s
+	seconds := audioPreviewSeconds
+	if meta.Duration > 0 {
+		seconds = min(seconds, max(int(meta.Duration)-sess.Options.ClipStart, 1))
+	}
+
+	fileName := fmt.Sprintf("preview_%d_%d_%d", chatID, key.UserID, time.Now().Unix())
+	opts := downloadOptions{ClipStart: sess.Options.ClipStart, ClipLength: audioPreviewSeconds}
+	path, err := b.downloadMedia(chatID, msgID, meta, "voice", "best", opts, fileName)
+	if err != nil {
+		var tooLarge *fileTooLargeError
+		if errors.As(err, &tooLarge) {
+			os.Remove(tooLarge.Path)
+		}
+		b.reportFailure("vista previa", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, err.Error())
+		b.editMessageMarkup(chatID, msgID, infoCard(meta), b.createQualityKeyboard(key, meta, 0))
+		return
+	}
+	defer os.Remove(path)
+
+	voice := tgbotapi.NewVoice(chatID, tgbotapi.FilePath(path))
+	voice.Caption = fmt.Sprintf("🎧 Vista previa (%d s): %s", seconds, meta.Title)
+	voice.Duration = seconds
+	voice.ReplyToMessageID = sess.ReplyTo
+	if _, err := b.bot.Send(voice); err != nil {
+		b.reportFailure("envío", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando la vista previa a Telegram.")
+		b.editMessageMarkup(chatID, msgID, infoCard(meta), b.createQualityKeyboard(key, meta, 0))
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		job.bytes = info.Size()
+	}
+
+	format := b.store.userSettings(key.UserID).audioFormat()
+	b.editMessageMarkup(chatID, msgID, fmt.Sprintf("🎥 *%s*\n\n🎧 Te enviamos los primeros %d segundos. ¿Es el audio que buscabas?", escapeMarkdown(meta.Title), seconds), previewKeyboard(format))
+}
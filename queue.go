@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream de Redis con las descargas pendientes y grupo de consumidores de los workers
+const (
+	jobStream = redisKeyPrefix + "jobs"
+	jobGroup  = "workers"
+)
+
+// Longitud máxima aproximada del stream (los trabajos confirmados se recortan)
+const jobStreamMaxLen = 10000
+
+// Mientras dura una descarga el worker renueva su trabajo en el stream cada
+// jobHeartbeatInterval; uno que lleva jobReclaimAfter sin renovarse es de un
+// worker caído y otro lo retoma
+const (
+	jobHeartbeatInterval = 20 * time.Second
+	jobReclaimAfter      = 2 * time.Minute
+)
+
+// downloadJob es una descarga elegida en el teclado que ejecuta un worker.
+type downloadJob struct {
+	Key     sessionKey   `json:"key"`
+	Session *UserSession `json:"session"`
+	Mode    string       `json:"mode"`
+	Quality string       `json:"quality"`
+	// Nombre del archivo, fijo para que un worker que retoma el trabajo
+	// continúe el parcial del anterior
+	FileName string `json:"file_name,omitempty"`
+	// Descarga pedida por la API REST (api.go): el resto de campos va vacío
+	API string `json:"api,omitempty"`
+	// Tema del foro de la petición (topics.go): el worker no ve los updates
+	Thread int `json:"thread,omitempty"`
+}
+
+// jobQueue reparte las descargas entre procesos worker (bot -worker) a través
+// de un stream de Redis, para escalar la descarga aparte del manejo de updates.
+type jobQueue struct {
+	client *redis.Client
+}
+
+// openJobQueue devuelve nil si JOB_QUEUE no está activada.
+func openJobQueue(cfg *Config) (*jobQueue, error) {
+	switch cfg.JobQueue {
+	case "":
+		return nil, nil
+	case "redis":
+	default:
+		return nil, fmt.Errorf("JOB_QUEUE no soportada: %q (solo \"redis\")", cfg.JobQueue)
+	}
+	if cfg.RedisURL == "" {
+		return nil, errors.New("JOB_QUEUE=redis necesita REDIS_URL")
+	}
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL inválida: %w", err)
+	}
+	q := &jobQueue{client: redis.NewClient(opts)}
+
+	// El grupo se crea una vez; si ya existe Redis responde BUSYGROUP
+	err = q.client.XGroupCreateMkStream(context.Background(), jobStream, jobGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("creando grupo de workers: %w", err)
+	}
+	return q, nil
+}
+
+func (q *jobQueue) push(job downloadJob) error {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.client.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: jobStream,
+		MaxLen: jobStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"job": raw},
+	}).Err()
+}
+
+// dispatchDownload encola la descarga si hay workers configurados; si no (o
+// si Redis falla) la ejecuta en este proceso como siempre.
+func (b *DownloadBot) dispatchDownload(key sessionKey, sess *UserSession, mode, quality string) {
+	// Un menú abierto antes del mantenimiento tampoco inicia descargas
+	if notice, paused := b.inMaintenance(key.UserID); paused {
+		b.editMessage(key.ChatID, sess.MsgID, notice)
+		return
+	}
+	b.store.recordLastDownload(key.UserID, sess.Meta.WebpageURL, mode, quality)
+	if b.queue != nil {
+		err := b.queue.push(downloadJob{Key: key, Session: sess, Mode: mode, Quality: quality, FileName: downloadFileName(key), Thread: threadFor(key.ChatID, sess.MsgID)})
+		if err == nil {
+			b.editMessage(key.ChatID, sess.MsgID, "⏳ *En cola, un worker empezará la descarga enseguida...*")
+			return
+		}
+		log.Printf("⚠️ No se pudo encolar la descarga, se hace localmente: %v", err)
+	}
+	b.scheduleSized(key, sess, b.expectedSize(sess.Meta, mode, quality), func() { b.performDownload(key, sess, mode, quality) })
+}
+
+// runWorker consume descargas de la cola con WORKER_CONCURRENCY tareas a la vez. No vuelve.
+func (b *DownloadBot) runWorker() {
+	if b.queue == nil {
+		log.Fatal("❌ El modo worker necesita JOB_QUEUE=redis y REDIS_URL.")
+	}
+	host, _ := os.Hostname()
+	process := workerProcessName()
+	// Latido antes de leer nada: sin él el coordinador daría el proceso por caído
+	b.queue.beat(process)
+	go b.queue.sendHeartbeats(process)
+	b.recoverInterruptedJobs(host)
+	for i := 0; i < b.cfg().WorkerConcurrency; i++ {
+		consumer := fmt.Sprintf("%s-%d", process, i)
+		go b.workerLoop(consumer)
+	}
+	log.Printf("👷 Worker iniciado con %d descargas simultáneas", b.cfg().WorkerConcurrency)
+	select {}
+}
+
+func (b *DownloadBot) workerLoop(consumer string) {
+	ctx := context.Background()
+	for {
+		// Primero los trabajos abandonados por workers caídos
+		claimed, _, err := b.queue.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   jobStream,
+			Group:    jobGroup,
+			Consumer: consumer,
+			MinIdle:  jobReclaimAfter,
+			Start:    "0",
+			Count:    1,
+		}).Result()
+		if err == nil && len(claimed) > 0 {
+			b.runJob(consumer, claimed[0])
+			continue
+		}
+
+		streams, err := b.queue.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    jobGroup,
+			Consumer: consumer,
+			Streams:  []string{jobStream, ">"},
+			Count:    1,
+			Block:    30 * time.Second,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️ Error leyendo la cola de descargas: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				b.runJob(consumer, msg)
+			}
+		}
+	}
+}
+
+// runJob ejecuta una descarga y la confirma, también si falla: los errores
+// ya se comunican al usuario y reintentarla solo repetiría el fallo.
+func (b *DownloadBot) runJob(consumer string, msg redis.XMessage) {
+	defer b.queue.client.XAck(context.Background(), jobStream, jobGroup, msg.ID)
+	stop := b.queue.heartbeat(consumer, msg.ID)
+	defer stop()
+
+	raw, _ := msg.Values["job"].(string)
+	var job downloadJob
+	err := json.Unmarshal([]byte(raw), &job)
+	if err == nil && job.API != "" {
+		defer holdChatDir(apiChatID)()
+		b.runAPIDownload(job.API)
+		return
+	}
+	if err != nil || job.Session == nil || job.Session.Meta == nil {
+		log.Printf("⚠️ Trabajo %s inválido en la cola: %v", msg.ID, err)
+		return
+	}
+	log.Printf("👷 Descarga %s: %s (%s %s)", msg.ID, job.Session.Meta.WebpageURL, job.Mode, job.Quality)
+	defer holdChatDir(job.Key.ChatID)()
+	if job.FileName == "" {
+		job.FileName = downloadFileName(job.Key)
+	}
+	rememberThread(job.Key.ChatID, job.Session.MsgID, job.Thread)
+	rememberThread(job.Key.ChatID, job.Session.ReplyTo, job.Thread)
+	// Cada bucle del worker es un hueco: se espera al disco antes de descargar
+	if !b.waitForDisk(job.Key, job.Session, b.expectedSize(job.Session.Meta, job.Mode, job.Quality)) {
+		return
+	}
+	b.performDownloadAs(job.Key, job.Session, job.Mode, job.Quality, job.FileName)
+}
+
+// heartbeat renueva el trabajo en el stream mientras dura la descarga:
+// reclamarlo para el mismo consumidor pone su inactividad a cero, así que
+// solo los de workers caídos llegan a jobReclaimAfter. Devuelve cómo pararlo.
+func (q *jobQueue) heartbeat(consumer, id string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				q.client.XClaimJustID(context.Background(), &redis.XClaimArgs{
+					Stream:   jobStream,
+					Group:    jobGroup,
+					Consumer: consumer,
+					Messages: []string{id},
+				})
+			}
+		}
+	}()
+	return func() { close(done) }
+}
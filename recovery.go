@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Un archivo sin tocar desde hace este tiempo al arrancar es de un proceso
+// caído. Los más recientes pueden ser de otra réplica que comparte la carpeta.
+const orphanFileAge = 10 * time.Minute
+
+// Las descargas interrumpidas hace más de esto ya no se reanudan
+const resumeMaxAge = 24 * time.Hour
+
+// Una descarga que ya se intentó tantas veces (p. ej. porque tumba el
+// proceso) no se vuelve a reanudar
+const resumeMaxAttempts = 3
+
+// PersistedJob es una descarga en curso apuntada en el almacén.
+type PersistedJob struct {
+	Key     sessionKey   `json:"key"`
+	Session *UserSession `json:"session"`
+	Mode    string       `json:"mode"`
+	Quality string       `json:"quality"`
+	Started time.Time    `json:"started"`
+	// Veces que se ha empezado la descarga, contando las reanudaciones
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// recordJob apunta una descarga que empieza. Si es la reanudación de una
+// apuntada, conserva cuándo empezó y suma un intento.
+func (s *Store) recordJob(fileName string, job PersistedJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Attempts = 1
+	if previous, ok := s.data.Jobs[fileName]; ok {
+		job.Started = previous.Started
+		job.Attempts = previous.Attempts + 1
+	}
+	s.data.Jobs[fileName] = job
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando descarga en curso: %v", err)
+	}
+}
+
+func (s *Store) finishJob(fileName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Jobs[fileName]; !ok {
+		return
+	}
+	delete(s.data.Jobs, fileName)
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando descarga en curso: %v", err)
+	}
+}
+
+// takeJobs devuelve las descargas interrumpidas que aún se pueden reanudar y
+// olvida el resto. Las devueltas siguen apuntadas para que recordJob cuente
+// el intento y conserve cuándo empezaron.
+func (s *Store) takeJobs() map[string]PersistedJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make(map[string]PersistedJob)
+	for name, job := range s.data.Jobs {
+		if time.Since(job.Started) < resumeMaxAge && job.Attempts < resumeMaxAttempts && job.Session != nil && job.Session.Meta != nil {
+			jobs[name] = job
+		} else {
+			delete(s.data.Jobs, name)
+		}
+	}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando descargas en curso: %v", err)
+	}
+	return jobs
+}
+
+// resumableJobs devuelve los nombres de archivo de las descargas en curso,
+// cuyos parciales no se deben borrar.
+func (s *Store) resumableJobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.data.Jobs))
+	for name, job := range s.data.Jobs {
+		if time.Since(job.Started) < resumeMaxAge {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// downloadFileName es el nombre (sin extensión) de una descarga nueva.
+func downloadFileName(key sessionKey) string {
+	return fmt.Sprintf("vid_%d_%d_%d", key.ChatID, key.UserID, time.Now().UnixNano())
+}
+
+// resumeDownloads vuelve a encolar las descargas que cortó el reinicio, con
+// su nombre de archivo: yt-dlp continúa desde el parcial. La sesión se
+// restaura porque con el estado en memoria se perdió.
+func (b *DownloadBot) resumeDownloads() {
+	jobs := b.store.takeJobs()
+	for fileName, job := range jobs {
+		key, sess := job.Key, job.Session
+		b.state.SaveSession(key, sess)
+		b.editMessage(key.ChatID, sess.MsgID, "🔄 *Reanudando tu descarga tras un reinicio...*")
+		b.scheduleSized(key, sess, b.expectedSize(sess.Meta, job.Mode, job.Quality), func() { b.performDownloadAs(key, sess, job.Mode, job.Quality, fileName) })
+	}
+	if len(jobs) > 0 {
+		log.Printf("🔄 %d descargas interrumpidas reanudadas", len(jobs))
+	}
+}
+
+// cleanupOrphans borra al arrancar lo que dejó en DownloadDir un proceso que
+// murió sin limpiar (descargas a medias, carpetas de capítulos o galerías),
+// salvo los parciales de las descargas que se van a reanudar.
+func cleanupOrphans(keep []string) {
+	removed, reclaimed := purgeTempFiles(orphanFileAge, true, keep)
+	if removed > 0 {
+		log.Printf("🧹 Limpieza al arrancar: %d archivos huérfanos borrados (%s)", removed, humanSize(reclaimed))
+	}
+}
+
+// purgeTempFiles borra los archivos de DownloadDir sin tocar desde hace más
+// de maxAge, excepto los que empiezan por un nombre de keep y, si
+// keepServed, los servidos por enlace (tienen su propia caducidad).
+func purgeTempFiles(maxAge time.Duration, keepServed bool, keep []string) (removed int, reclaimed int64) {
+	cutoff := time.Now().Add(-maxAge)
+	filepath.Walk(DownloadDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == DownloadDir {
+			return nil
+		}
+		if info.IsDir() {
+			if keepServed && path == servedDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		for _, prefix := range keep {
+			if strings.HasPrefix(info.Name(), prefix+".") {
+				return nil
+			}
+		}
+		if os.Remove(path) == nil {
+			removed++
+			reclaimed += info.Size()
+		}
+		return nil
+	})
+	removeEmptyDirs(DownloadDir, keepServed)
+	return removed, reclaimed
+}
+
+// removeEmptyDirs borra las subcarpetas vacías, de dentro hacia fuera.
+func removeEmptyDirs(root string, keepServed bool) {
+	entries, _ := os.ReadDir(root)
+	for _, entry := range entries {
+		if !entry.IsDir() || (keepServed && filepath.Join(root, entry.Name()) == servedDir()) {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		removeEmptyDirs(dir, keepServed)
+		os.Remove(dir) // Solo funciona si está vacía
+	}
+}
+
+// recoverInterruptedJobs retoma al arrancar un worker las descargas que otro
+// worker de esta misma máquina dejó a medias al caerse, sin esperar a que
+// pase jobReclaimAfter. Los consumidores se llaman <host>-<pid>-<n>: los del
+// host con otro pid son de otro proceso, que solo se da por muerto si ya no
+// renueva su latido ni sus trabajos (puede ser otro worker vivo en la máquina).
+func (b *DownloadBot) recoverInterruptedJobs(host string) {
+	ctx := context.Background()
+	ours := fmt.Sprintf("%s-%d-", host, os.Getpid())
+	consumers, err := b.queue.client.XInfoConsumers(ctx, jobStream, jobGroup).Result()
+	if err != nil {
+		log.Printf("⚠️ No se pudieron consultar los workers anteriores: %v", err)
+		return
+	}
+	var recovered []redis.XMessage
+	for _, consumer := range consumers {
+		if !strings.HasPrefix(consumer.Name, host+"-") || strings.HasPrefix(consumer.Name, ours) {
+			continue
+		}
+		if alive, err := b.queue.workerAlive(ctx, consumer.Name); err != nil || alive {
+			continue
+		}
+		if consumer.Pending > 0 {
+			pending, err := b.queue.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream:   jobStream,
+				Group:    jobGroup,
+				Start:    "-",
+				End:      "+",
+				Count:    consumer.Pending,
+				Consumer: consumer.Name,
+			}).Result()
+			if err != nil {
+				log.Printf("⚠️ No se pudieron leer los trabajos de %s: %v", consumer.Name, err)
+				continue
+			}
+			ids := make([]string, 0, len(pending))
+			for _, p := range pending {
+				ids = append(ids, p.ID)
+			}
+			claimed, err := b.queue.client.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   jobStream,
+				Group:    jobGroup,
+				Consumer: ours + "0",
+				MinIdle:  2 * jobHeartbeatInterval,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				log.Printf("⚠️ No se pudieron retomar los trabajos de %s: %v", consumer.Name, err)
+				continue
+			}
+			recovered = append(recovered, claimed...)
+			if len(claimed) < len(ids) {
+				continue // Alguno se sigue renovando: el consumidor no está muerto
+			}
+		}
+		b.queue.client.XGroupDelConsumer(ctx, jobStream, jobGroup, consumer.Name)
+	}
+	if len(recovered) == 0 {
+		return
+	}
+	log.Printf("🔄 %d descargas interrumpidas retomadas tras el reinicio", len(recovered))
+	// Una tras otra, para no pasar de WORKER_CONCURRENCY más que en una descarga
+	go func() {
+		for _, msg := range recovered {
+			b.runJob(ours+"0", msg)
+		}
+	}()
+}
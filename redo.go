@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// downloadChoice es un formato ya elegido con el que descargar sin teclado.
+type downloadChoice struct {
+	Mode    string
+	Quality string
+}
+
+// LastDownload es la última descarga que pidió un usuario.
+type LastDownload struct {
+	URL     string    `json:"url"`
+	Mode    string    `json:"mode"`
+	Quality string    `json:"quality"`
+	At      time.Time `json:"at"`
+}
+
+func (s *Store) recordLastDownload(userID int64, url, mode, quality string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.LastDownloads[userID] = LastDownload{URL: url, Mode: mode, Quality: quality, At: time.Now()}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando última descarga: %v", err)
+	}
+}
+
+func (s *Store) lastDownload(userID int64) (LastDownload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.data.LastDownloads[userID]
+	return last, ok
+}
+
+// handleRedoCommand repite la última descarga del usuario con el mismo
+// formato: /redo (útil si falló la subida o borró el archivo).
+func (b *DownloadBot) handleRedoCommand(message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	last, ok := b.store.lastDownload(message.From.ID)
+	if !ok {
+		b.sendReply(message.Chat.ID, message.MessageID, "🤷 Aún no has descargado nada que repetir.")
+		return
+	}
+	b.processLinkWith(message, last.URL, &downloadChoice{Mode: last.Mode, Quality: last.Quality})
+}
+
+// downloadFromButton descarga un enlace con un formato ya elegido desde un
+// botón (🔁 en un archivo entregado o uno de /saved). Se trata como si el
+// usuario hubiera enviado el enlace respondiendo al mensaje del botón.
+func (b *DownloadBot) downloadFromButton(cb *tgbotapi.CallbackQuery, url string, choice downloadChoice, notice string) {
+	b.bot.Request(tgbotapi.NewCallback(cb.ID, notice))
+	message := &tgbotapi.Message{MessageID: cb.Message.MessageID, Chat: cb.Message.Chat, From: cb.From}
+	b.processLinkWith(message, url, &choice)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Prefijo del parámetro de /start en los enlaces de invitación
+const referralPrefix = "ref_"
+
+// Referral es la invitación con la que llegó un usuario nuevo.
+type Referral struct {
+	Referrer int64     `json:"referrer"`
+	At       time.Time `json:"at"`
+	// Aún sin primera descarga: ni cuenta ni da el premio a quien invitó
+	Pending bool `json:"pending,omitempty"`
+}
+
+// recordReferral apunta que invitee llegó invitado por referrer. Solo cuenta
+// para usuarios nuevos: sin invitación previa y sin ninguna descarga.
+func (s *Store) recordReferral(invitee, referrer int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if invitee == referrer {
+		return false
+	}
+	if _, ok := s.data.Referrals[invitee]; ok {
+		return false
+	}
+	for _, users := range s.data.Usage {
+		if _, ok := users[invitee]; ok {
+			return false
+		}
+	}
+	s.data.Referrals[invitee] = Referral{Referrer: referrer, At: time.Now(), Pending: true}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando invitación: %v", err)
+	}
+	return true
+}
+
+// completeReferral da por buena la invitación de invitee tras su primera
+// descarga correcta y devuelve quién le invitó (false si no hay nada que premiar).
+func (s *Store) completeReferral(invitee int64) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.data.Referrals[invitee]
+	if !ok || !r.Pending {
+		return 0, false
+	}
+	r.Pending = false
+	s.data.Referrals[invitee] = r
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando invitación: %v", err)
+	}
+	return r.Referrer, true
+}
+
+// referralCounts devuelve cuántos amigos ha traído cada usuario (los que ya
+// descargaron algo).
+func (s *Store) referralCounts() map[int64]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[int64]int)
+	for _, r := range s.data.Referrals {
+		if !r.Pending {
+			counts[r.Referrer]++
+		}
+	}
+	return counts
+}
+
+// El código es el ID del usuario en base 36: corto y sin nada que guardar
+func referralCode(userID int64) string {
+	return strconv.FormatInt(userID, 36)
+}
+
+func (b *DownloadBot) referralLink(userID int64) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", b.bot.Self.UserName, referralPrefix, referralCode(userID))
+}
+
+// handleInviteCommand envía al usuario su enlace de invitación: /invite
+func (b *DownloadBot) handleInviteCommand(message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	count := b.store.referralCounts()[message.From.ID]
+	text := fmt.Sprintf("🎁 *Invita a tus amigos*\n\nComparte tu enlace:\n%s\n\nAmigos invitados: %d", b.referralLink(message.From.ID), count)
+	if b.cfg().ReferralBonus > 0 {
+		text += fmt.Sprintf("\n\nPor cada amigo nuevo que empiece a usar el bot ganas %s de premium.", formatDays(b.cfg().ReferralBonus))
+	}
+	b.sendReply(message.Chat.ID, message.MessageID, text)
+}
+
+// handleReferralStart registra la invitación de un /start ref_<código>. El
+// premio llega con la primera descarga del invitado (rewardReferral), para
+// que abrir cuentas solo para pulsar /start no dé premium.
+func (b *DownloadBot) handleReferralStart(message *tgbotapi.Message, code string) {
+	referrer, err := strconv.ParseInt(code, 36, 64)
+	if err != nil || message.From == nil || !b.store.recordReferral(message.From.ID, referrer) {
+		return
+	}
+	log.Printf("🎁 Usuario %d invitado por %d", message.From.ID, referrer)
+}
+
+// rewardReferral premia a quien invitó a userID tras su primera descarga correcta.
+func (b *DownloadBot) rewardReferral(userID int64) {
+	referrer, ok := b.store.completeReferral(userID)
+	if !ok {
+		return
+	}
+	log.Printf("🎁 Invitación de %d a %d completada", referrer, userID)
+	text := "🎁 ¡Un amigo al que invitaste ya ha hecho su primera descarga!"
+	if b.cfg().ReferralBonus > 0 {
+		entitlement := b.store.extendPremium(referrer, b.cfg().ReferralBonus, "")
+		text += fmt.Sprintf("\n\n💎 Has ganado %s de premium (activo hasta el %s).", formatDays(b.cfg().ReferralBonus), entitlement.Until.Format("02/01/2006"))
+	}
+	// Quien invita ya habló con el bot: su chat privado tiene su mismo ID
+	b.sendMessage(referrer, text)
+}
+
+// handleReferralsCommand muestra la clasificación de invitaciones: /referrals
+func (b *DownloadBot) handleReferralsCommand(message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	counts := b.store.referralCounts()
+	users := make([]int64, 0, len(counts))
+	for userID := range counts {
+		users = append(users, userID)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if counts[users[i]] != counts[users[j]] {
+			return counts[users[i]] > counts[users[j]]
+		}
+		return users[i] < users[j]
+	})
+
+	var text strings.Builder
+	text.WriteString("🏆 *Clasificación de invitaciones*\n\n")
+	if len(users) == 0 {
+		text.WriteString("Aún nadie ha invitado a nadie. ¡Sé el primero con /invite!")
+	}
+	medals := []string{"🥇", "🥈", "🥉"}
+	for i, userID := range users {
+		if i == 10 {
+			break
+		}
+		position := fmt.Sprintf("%d.", i+1)
+		if i < len(medals) {
+			position = medals[i]
+		}
+		// Solo se muestra el final del ID para no exponer a los usuarios
+		name := fmt.Sprintf("usuario ···%04d", userID%10000)
+		if userID == message.From.ID {
+			name = "tú"
+		}
+		fmt.Fprintf(&text, "%s %s — %d\n", position, name, counts[userID])
+	}
+	for i, userID := range users {
+		if userID == message.From.ID && i >= 10 {
+			fmt.Fprintf(&text, "\n…\n%d. tú — %d", i+1, counts[userID])
+		}
+	}
+	b.sendReply(message.Chat.ID, message.MessageID, text.String())
+}
+
+// formatDays muestra una duración en días ("3 días", "1 día").
+func formatDays(d time.Duration) string {
+	days := int(d / (24 * time.Hour))
+	if days == 1 {
+		return "1 día"
+	}
+	return fmt.Sprintf("%d días", days)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ajustes que solo se leen al arrancar: cambiarlos en el fichero no tiene
+// efecto hasta reiniciar el proceso.
+var restartOnlySettings = map[string]bool{
+	"CookieCheckInterval":    true,
+	"S3Endpoint":             true,
+	"S3Region":               true,
+	"S3Bucket":               true,
+	"S3AccessKey":            true,
+	"S3SecretKey":            true,
+	"S3LinkTTL":              true,
+	"WebDAVURL":              true,
+	"WebDAVPublicURL":        true,
+	"WebDAVUser":             true,
+	"WebDAVPassword":         true,
+	"MTProtoAppID":           true,
+	"MTProtoAppHash":         true,
+	"MTProtoSessionFile":     true,
+	"MTProtoStorageChannel":  true,
+	"UploadBotTokens":        true,
+	"UploadStorageChannel":   true,
+	"HealthPort":             true,
+	"CleanerInterval":        true,
+	"RedisURL":               true,
+	"JobQueue":               true,
+	"WorkerConcurrency":      true,
+	"MaxConcurrentDownloads": true,
+	"DownloadRateLimit":      true,
+	"TotalRateLimit":         true,
+	"RewriteRulesFile":       true,
+	"YtdlpOptionsFile":       true,
+	"YtdlpBin":               true,
+	"FFmpegBin":              true,
+	"FFprobeBin":             true,
+	"GalleryDLBin":           true,
+}
+
+// Solo una recarga a la vez: SIGHUP y /reload pueden coincidir
+var reloadMu sync.Mutex
+
+// cfg devuelve la configuración vigente. Se lee en cada uso (no se guarda en
+// variables largas) para que una recarga se note en las siguientes peticiones.
+func (b *DownloadBot) cfg() *Config {
+	return b.config.Load()
+}
+
+// Claves que puso CONFIG_FILE y el valor que tenían antes en el entorno (nil
+// si no estaban), para deshacerlas si se borran del fichero
+var fileEnvOriginal = map[string]*string{}
+
+// loadConfigFile vuelca en el entorno las variables de CONFIG_FILE, un
+// fichero de líneas CLAVE=valor (con # para comentarios). Así loadConfig
+// sigue leyendo solo del entorno y el fichero se puede editar en caliente.
+// Las claves que desaparecen del fichero vuelven a su valor anterior.
+func loadConfigFile() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%s:%d: se esperaba CLAVE=valor", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for key, original := range fileEnvOriginal {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if original == nil {
+			os.Unsetenv(key)
+		} else {
+			os.Setenv(key, *original)
+		}
+		delete(fileEnvOriginal, key)
+	}
+	for key, value := range values {
+		if _, ok := fileEnvOriginal[key]; !ok {
+			var original *string
+			if previous, set := os.LookupEnv(key); set {
+				original = &previous
+			}
+			fileEnvOriginal[key] = original
+		}
+		os.Setenv(key, value)
+	}
+	return nil
+}
+
+// reloadConfig vuelve a leer CONFIG_FILE y el entorno y sustituye la
+// configuración sin cortar el webhook ni las descargas en curso: las que ya
+// empezaron terminan con los ajustes con los que arrancaron. Devuelve los
+// campos que cambiaron.
+func (b *DownloadBot) reloadConfig() (changed []string, err error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if err := loadConfigFile(); err != nil {
+		return nil, err
+	}
+	old, next := b.cfg(), loadConfig()
+
+	oldValue, nextValue := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < oldValue.NumField(); i++ {
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			changed = append(changed, oldValue.Type().Field(i).Name)
+		}
+	}
+	b.config.Store(next)
+	if old.Debug != next.Debug {
+		b.setDebug(next.Debug)
+	}
+	log.Printf("🔁 Configuración recargada: %d cambios %v", len(changed), changed)
+	return changed, nil
+}
+
+// handleReloadCommand recarga la configuración: /reload
+func (b *DownloadBot) handleReloadCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil || !b.cfg().isAdmin(message.From.ID) {
+		b.sendReply(chatID, message.MessageID, "⛔ Solo los administradores pueden usar este comando.")
+		return
+	}
+	changed, err := b.reloadConfig()
+	if err != nil {
+		b.sendReply(chatID, message.MessageID, "❌ No se pudo recargar la configuración:\n`"+err.Error()+"`")
+		return
+	}
+	if len(changed) == 0 {
+		b.sendReply(chatID, message.MessageID, "🔁 Configuración recargada: no hay cambios.")
+		return
+	}
+	var text strings.Builder
+	text.WriteString("🔁 *Configuración recargada*\n")
+	var pending []string
+	for _, name := range changed {
+		if restartOnlySettings[name] {
+			pending = append(pending, name)
+			continue
+		}
+		text.WriteString("\n✅ " + name)
+	}
+	for _, name := range pending {
+		text.WriteString("\n⏸ " + name + " (al reiniciar)")
+	}
+	b.sendReply(chatID, message.MessageID, text.String())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// rewriteRule transforma enlaces de espejos (Invidious, Nitter, ProxiTok...)
+// en la URL canónica de la plataforma antes de analizarlos.
+type rewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// loadRewriteRules lee el archivo de reglas: una por línea, con la expresión
+// regular y el reemplazo separados por " => ". Las líneas con # se ignoran.
+func loadRewriteRules(path string) ([]rewriteRule, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []rewriteRule
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("línea %d: falta \"=>\"", n)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("línea %d: %w", n, err)
+		}
+		rules = append(rules, rewriteRule{pattern: re, replacement: strings.TrimSpace(parts[1])})
+	}
+	return rules, scanner.Err()
+}
+
+// rewriteURL aplica la primera regla que coincida con el enlace.
+func (b *DownloadBot) rewriteURL(url string) string {
+	for _, rule := range b.rewriteRules {
+		if rule.pattern.MatchString(url) {
+			rewritten := rule.pattern.ReplaceAllString(url, rule.replacement)
+			log.Printf("🔀 Enlace reescrito: %s -> %s", url, rewritten)
+			return rewritten
+		}
+	}
+	return url
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Enlaces guardados que se conservan por usuario (los más antiguos se pierden)
+const maxSavedLinks = 50
+
+// SavedLink es un enlace marcado con "⭐ Guardar" en un archivo entregado.
+type SavedLink struct {
+	URL     string    `json:"url"`
+	Title   string    `json:"title"`
+	Mode    string    `json:"mode"`
+	Quality string    `json:"quality"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// saveLink guarda el enlace (o lo sube al principio si ya estaba).
+func (s *Store) saveLink(userID int64, link SavedLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	links := []SavedLink{link}
+	for _, l := range s.data.Saved[userID] {
+		if l.URL != link.URL {
+			links = append(links, l)
+		}
+	}
+	if len(links) > maxSavedLinks {
+		links = links[:maxSavedLinks]
+	}
+	s.data.Saved[userID] = links
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando enlace: %v", err)
+	}
+}
+
+func (s *Store) unsaveLink(userID int64, rawURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var links []SavedLink
+	for _, l := range s.data.Saved[userID] {
+		if l.URL != rawURL {
+			links = append(links, l)
+		}
+	}
+	if len(links) == 0 {
+		delete(s.data.Saved, userID)
+	} else {
+		s.data.Saved[userID] = links
+	}
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando enlaces: %v", err)
+	}
+}
+
+func (s *Store) savedLinks(userID int64) []SavedLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SavedLink(nil), s.data.Saved[userID]...)
+}
+
+func (s *Store) isSaved(userID int64, rawURL string) bool {
+	for _, l := range s.savedLinks(userID) {
+		if l.URL == rawURL {
+			return true
+		}
+	}
+	return false
+}
+
+// saveButtonData es el botón "⭐ Guardar" de un archivo entregado. El título
+// va escapado para que no rompa la separación por ":"; la URL, al final.
+func saveButtonData(owner string, meta *VideoMetaData, mode, quality string) string {
+	return "file:" + owner + ":save:" + mode + ":" + quality + ":" + url.QueryEscape(meta.Title) + ":" + meta.WebpageURL
+}
+
+// handleSavedCommand lista los enlaces guardados con un botón para volver a
+// descargar cada uno: /saved
+func (b *DownloadBot) handleSavedCommand(message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	text, markup := b.savedMenu(message.From.ID)
+	msg := b.sendReply(message.Chat.ID, message.MessageID, text)
+	if msg.MessageID != 0 && len(markup.InlineKeyboard) > 0 {
+		b.editMessageMarkup(message.Chat.ID, msg.MessageID, text, markup)
+	}
+}
+
+func (b *DownloadBot) savedMenu(userID int64) (string, tgbotapi.InlineKeyboardMarkup) {
+	links := b.store.savedLinks(userID)
+	if len(links) == 0 {
+		return "⭐ *Guardados*\n\nAún no tienes enlaces guardados. Pulsa *⭐ Guardar* en un archivo que te haya enviado para tenerlo aquí.", tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	}
+	owner := strconv.FormatInt(userID, 10)
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, l := range links {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬇️ "+savedLabel(l), "file:"+owner+":get:"+l.Mode+":"+l.Quality+":"+l.URL),
+			tgbotapi.NewInlineKeyboardButtonData("🗑", "file:"+owner+":unsave:"+l.URL),
+		))
+	}
+	text := fmt.Sprintf("⭐ *Guardados* (%d)\n\nPulsa uno para descargarlo de nuevo o 🗑 para quitarlo.", len(links))
+	return text, tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// savedLabel es el texto del botón: título recortado y formato.
+func savedLabel(l SavedLink) string {
+	title := l.Title
+	if title == "" {
+		title = l.URL
+	}
+	if utf8.RuneCountInString(title) > 40 {
+		title = string([]rune(title)[:39]) + "…"
+	}
+	return title + " · " + choiceLabel(l.Mode, l.Quality)
+}
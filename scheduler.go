@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Clases de prioridad para los huecos del host
+const (
+	priorityFree = iota
+	priorityPremium
+	priorityAdmin
+)
+
+// Tras esta espera una tarea gratuita pasa por delante de todas: así los
+// usuarios prioritarios no pueden dejar a los demás sin turno
+const maxPriorityWait = 5 * time.Minute
+
+// scheduler ejecuta las descargas de cada chat de una en una (las demás
+// esperan en cola) y limita el total de descargas simultáneas del host, para
+// que un usuario que envía muchos enlaces no acapare la máquina. Cuando el
+// host está lleno, los huecos que quedan libres se dan por prioridad.
+type scheduler struct {
+	slots int   // Un hueco por descarga (yt-dlp + ffmpeg)
+	rate  int64 // Límite de bytes/s de cada descarga (0 = sin límite)
+
+	mu      sync.Mutex
+	nextID  uint64 // Identificador de la próxima tarea encolada
+	active  int
+	waiters []*slotWaiter
+	chats   map[int64][]scheduledTask // Tareas pendientes por chat; existe la clave si hay una activa
+	recent  []time.Duration           // Duración de las últimas tareas, para estimar esperas
+}
+
+// slotWaiter es una tarea esperando un hueco del host.
+type slotWaiter struct {
+	priority int
+	since    time.Time
+	ready    chan struct{}
+}
+
+// newScheduler reparte el límite total de ancho de banda entre los huecos:
+// como nunca hay más descargas que huecos, la suma no puede superarlo.
+// perDownload y total están en bytes/s (0 = sin límite).
+func newScheduler(maxConcurrent int, perDownload, total int64) *scheduler {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	rate := downloadRate(maxConcurrent, perDownload, total)
+	if rate > 0 {
+		log.Printf("🚦 Descargas limitadas a %s/s cada una (%d simultáneas)", humanSize(rate), maxConcurrent)
+	}
+	return &scheduler{
+		slots: maxConcurrent,
+		rate:  rate,
+		chats: make(map[int64][]scheduledTask),
+	}
+}
+
+// downloadRate es el límite de cada descarga con slots simultáneas: el
+// menor entre el propio y el reparto del total (0 = sin límite).
+func downloadRate(slots int, perDownload, total int64) int64 {
+	rate := perDownload
+	if share := total / int64(slots); share > 0 && (rate == 0 || share < rate) {
+		rate = share
+	}
+	return rate
+}
+
+// Descargas recientes con las que se estima la espera
+const etaSamples = 20
+
+// scheduledTask es una tarea en cola; moved se llama al cambiar su posición
+// (0 = es la siguiente del chat pero espera un hueco del host). wait, si lo
+// hay, se ejecuta antes de pedir el hueco (p. ej. esperar a que haya disco,
+// sin ocupar uno mientras); si devuelve false la tarea se descarta.
+type scheduledTask struct {
+	id       uint64
+	label    string // Qué es, para listar la cola (p. ej. el título)
+	priority int
+	wait     func() bool
+	run      func()
+	moved    func(position int)
+}
+
+// submit encola la tarea del chat y devuelve cuántas tiene delante (0 = empieza ya,
+// salvo que el límite global la haga esperar).
+func (s *scheduler) submit(chatID int64, priority int, run func(), moved func(int)) int {
+	return s.submitAfter(chatID, priority, nil, run, moved)
+}
+
+// submitAfter es submit con una espera previa al hueco del host (ver scheduledTask).
+func (s *scheduler) submitAfter(chatID int64, priority int, wait func() bool, run func(), moved func(int)) int {
+	return s.enqueue(chatID, scheduledTask{priority: priority, wait: wait, run: run, moved: moved})
+}
+
+// enqueue encola una tarea ya montada; ver submit.
+func (s *scheduler) enqueue(chatID int64, task scheduledTask) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	task.id = s.nextID
+	pending, active := s.chats[chatID]
+	if active {
+		s.chats[chatID] = append(pending, task)
+		return len(pending) + 1
+	}
+	s.chats[chatID] = nil
+	go s.runChat(chatID, task)
+	return 0
+}
+
+func (s *scheduler) runChat(chatID int64, task scheduledTask) {
+	for {
+		if task.wait == nil || task.wait() {
+			s.acquire(task)
+			started := time.Now()
+			release := holdChatDir(chatID)
+			task.run()
+			release()
+			s.release()
+			s.recordDuration(time.Since(started))
+		}
+
+		s.mu.Lock()
+		pending := s.chats[chatID]
+		if len(pending) == 0 {
+			delete(s.chats, chatID)
+			s.mu.Unlock()
+			return
+		}
+		task = pending[0]
+		pending = pending[1:]
+		s.chats[chatID] = pending
+		s.mu.Unlock()
+
+		// Las que siguen esperando avanzan un puesto
+		for i, t := range pending {
+			t.moved(i + 1)
+		}
+	}
+}
+
+// queuedTask es una tarea que espera en la cola de su chat.
+type queuedTask struct {
+	ID       uint64 `json:"id"`
+	Label    string `json:"label"`
+	Position int    `json:"position"`
+}
+
+// pending lista las tareas que esperan en la cola del chat, en orden.
+func (s *scheduler) pending(chatID int64) []queuedTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := make([]queuedTask, 0, len(s.chats[chatID]))
+	for i, t := range s.chats[chatID] {
+		tasks = append(tasks, queuedTask{ID: t.id, Label: t.label, Position: i + 1})
+	}
+	return tasks
+}
+
+// move lleva la tarea id a la posición position (1 = la siguiente) de la
+// cola del chat y avisa a las que cambian de sitio. false si ya no espera.
+func (s *scheduler) move(chatID int64, id uint64, position int) bool {
+	s.mu.Lock()
+	pending := s.chats[chatID]
+	from := -1
+	for i, t := range pending {
+		if t.id == id {
+			from = i
+		}
+	}
+	if from < 0 {
+		s.mu.Unlock()
+		return false
+	}
+	to := min(max(position-1, 0), len(pending)-1)
+	task := pending[from]
+	pending = append(pending[:from], pending[from+1:]...)
+	pending = append(pending[:to], append([]scheduledTask{task}, pending[to:]...)...)
+	s.chats[chatID] = pending
+	moved := append([]scheduledTask(nil), pending[min(from, to):max(from, to)+1]...)
+	s.mu.Unlock()
+
+	for i, t := range moved {
+		t.moved(min(from, to) + i + 1)
+	}
+	return true
+}
+
+// acquire ocupa un hueco del host o, si no hay, espera a que release se lo dé.
+func (s *scheduler) acquire(task scheduledTask) {
+	s.mu.Lock()
+	if s.active < s.slots && len(s.waiters) == 0 {
+		s.active++
+		s.mu.Unlock()
+		return
+	}
+	w := &slotWaiter{priority: task.priority, since: time.Now(), ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+
+	task.moved(0)
+	<-w.ready
+}
+
+// hold ocupa un hueco del host para una descarga que no pasa por la cola de
+// un chat (autopost, directos): así cuenta para el límite total de ancho de
+// banda. Devuelve cómo liberarlo.
+func (s *scheduler) hold(priority int) func() {
+	s.acquire(scheduledTask{priority: priority, moved: func(int) {}})
+	return s.release
+}
+
+// release libera un hueco o lo pasa directamente a la tarea que espera con
+// más prioridad (a igual prioridad, la que lleva más tiempo).
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiters) == 0 {
+		s.active--
+		return
+	}
+	next := 0
+	for i, w := range s.waiters {
+		if s.effectivePriority(w) > s.effectivePriority(s.waiters[next]) {
+			next = i
+		}
+	}
+	w := s.waiters[next]
+	s.waiters = append(s.waiters[:next], s.waiters[next+1:]...)
+	close(w.ready)
+}
+
+// effectivePriority sube al máximo a quien lleva demasiado esperando.
+func (s *scheduler) effectivePriority(w *slotWaiter) int {
+	if time.Since(w.since) > maxPriorityWait {
+		return priorityAdmin + 1
+	}
+	return w.priority
+}
+
+// recordDuration guarda la duración de una tarea para estimar esperas. Las
+// descartadas (el usuario canceló mientras esperaba) no cuentan.
+func (s *scheduler) recordDuration(d time.Duration) {
+	if d < time.Second {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent = append(s.recent, d)
+	if len(s.recent) > etaSamples {
+		s.recent = s.recent[1:]
+	}
+}
+
+// eta estima la espera de quien tiene position tareas delante en su chat, con
+// la duración media de las últimas descargas. Devuelve 0 si aún no hay datos.
+func (s *scheduler) eta(position int) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recent) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range s.recent {
+		total += d
+	}
+	return total / time.Duration(len(s.recent)) * time.Duration(position)
+}
+
+// schedule pasa la tarea del usuario por el planificador y, si le toca
+// esperar, lo indica en el mensaje de estado con la posición y la espera
+// estimada, que se actualizan al avanzar la cola. Si mientras espera el
+// usuario cancela, la tarea se descarta.
+func (b *DownloadBot) schedule(key sessionKey, sess *UserSession, task func()) {
+	b.scheduleSized(key, sess, 0, task)
+}
+
+// scheduleSized es schedule para una descarga de tamaño conocido: antes de
+// ocupar un hueco del host espera a que haya disco para expected bytes.
+func (b *DownloadBot) scheduleSized(key sessionKey, sess *UserSession, expected int64, task func()) {
+	current := func() bool {
+		cur, ok := b.loadSession(key)
+		return ok && cur.MsgID == sess.MsgID
+	}
+	wait := func() bool {
+		return current() && b.waitForDisk(key, sess, expected)
+	}
+	run := func() {
+		if current() {
+			task()
+		}
+	}
+	moved := func(pos int) {
+		if current() {
+			b.editMessage(key.ChatID, sess.MsgID, b.queueText(pos))
+		}
+	}
+	label := "Descarga"
+	if sess.Meta != nil && sess.Meta.Title != "" {
+		label = sess.Meta.Title
+	}
+	queued := scheduledTask{label: label, priority: b.taskPriority(key.UserID), wait: wait, run: run, moved: moved}
+	if pos := b.scheduler.enqueue(key.ChatID, queued); pos > 0 {
+		b.editMessage(key.ChatID, sess.MsgID, b.queueText(pos))
+	}
+}
+
+// taskPriority da la clase de prioridad del usuario en la cola del host.
+func (b *DownloadBot) taskPriority(userID int64) int {
+	switch {
+	case b.cfg().isAdmin(userID):
+		return priorityAdmin
+	case b.isPremium(userID):
+		return priorityPremium
+	}
+	return priorityFree
+}
+
+// queueText es el mensaje de espera para una posición de la cola.
+func (b *DownloadBot) queueText(pos int) string {
+	if pos == 0 {
+		return "⏳ *En espera*: el servidor está ocupado con otras descargas. Empezará en cuanto quede un hueco libre."
+	}
+	text := fmt.Sprintf("⏳ *En cola* (posición %d). Empezará cuando terminen las descargas anteriores de este chat.", pos)
+	if eta := b.scheduler.eta(pos); eta > 0 {
+		text += fmt.Sprintf("\n\nEspera estimada: ~%s", formatClock(eta))
+	}
+	return text
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDownloadRate(t *testing.T) {
+	tests := []struct {
+		name               string
+		slots              int
+		perDownload, total int64
+		want               int64
+	}{
+		{"sin límites", 4, 0, 0, 0},
+		{"solo por descarga", 4, 1000, 0, 1000},
+		{"solo total", 4, 0, 4000, 1000},
+		{"el reparto es menor", 4, 2000, 4000, 1000},
+		{"el propio es menor", 4, 500, 4000, 500},
+		{"total menor que los huecos", 4, 0, 3, 0},
+		{"total menor que los huecos con propio", 4, 700, 3, 700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downloadRate(tt.slots, tt.perDownload, tt.total); got != tt.want {
+				t.Errorf("downloadRate(%d, %d, %d) = %d, quiero %d", tt.slots, tt.perDownload, tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerMove(t *testing.T) {
+	tests := []struct {
+		name      string
+		id        uint64
+		position  int
+		wantOK    bool
+		wantOrder []uint64
+		wantMoved map[uint64]int // Aviso de posición que recibe cada tarea
+	}{
+		{"al principio", 4, 1, true, []uint64{4, 1, 2, 3}, map[uint64]int{4: 1, 1: 2, 2: 3, 3: 4}},
+		{"al final", 1, 4, true, []uint64{2, 3, 4, 1}, map[uint64]int{2: 1, 3: 2, 4: 3, 1: 4}},
+		{"en medio", 3, 2, true, []uint64{1, 3, 2, 4}, map[uint64]int{3: 2, 2: 3}},
+		{"misma posición", 2, 2, true, []uint64{1, 2, 3, 4}, map[uint64]int{2: 2}},
+		{"posición fuera de rango", 2, 99, true, []uint64{1, 3, 4, 2}, map[uint64]int{3: 2, 4: 3, 2: 4}},
+		{"posición cero", 3, 0, true, []uint64{3, 1, 2, 4}, map[uint64]int{3: 1, 1: 2, 2: 3}},
+		{"ya no espera", 9, 1, false, []uint64{1, 2, 3, 4}, map[uint64]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved := make(map[uint64]int)
+			s := newScheduler(1, 0, 0)
+			for id := uint64(1); id <= 4; id++ {
+				s.chats[7] = append(s.chats[7], scheduledTask{id: id, moved: func(position int) { moved[id] = position }})
+			}
+			if ok := s.move(7, tt.id, tt.position); ok != tt.wantOK {
+				t.Fatalf("move(%d, %d) = %v, quiero %v", tt.id, tt.position, ok, tt.wantOK)
+			}
+			var order []uint64
+			for i, task := range s.pending(7) {
+				order = append(order, task.ID)
+				if task.Position != i+1 {
+					t.Errorf("la tarea %d está en la posición %d, quiero %d", task.ID, task.Position, i+1)
+				}
+			}
+			if !reflect.DeepEqual(order, tt.wantOrder) {
+				t.Errorf("orden %v, quiero %v", order, tt.wantOrder)
+			}
+			if !reflect.DeepEqual(moved, tt.wantMoved) {
+				t.Errorf("avisos %v, quiero %v", moved, tt.wantMoved)
+			}
+		})
+	}
+}
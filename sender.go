@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Ritmo de envío que Telegram tolera sin responder 429
+const (
+	privateSendInterval = time.Second      // ~1 mensaje/s por chat privado
+	groupSendInterval   = 3 * time.Second  // ~20 mensajes/min por grupo o canal
+	maxFloodRetries     = 3                // Reintentos tras un 429 antes de rendirse
+	maxFloodWait        = 60 * time.Second // Esperas más largas no se hacen en línea
+)
+
+// floodSafeBot envuelve la Bot API para que todos los envíos del bot
+// respeten los límites de Telegram: reparte los mensajes de cada chat en el
+// tiempo, reintenta tras un 429 esperando lo que pide retry_after, agrupa las
+// ediciones de progreso de un mismo mensaje y registra los errores (antes se
+// descartaban sin más).
+type floodSafeBot struct {
+	*tgbotapi.BotAPI
+
+	mu    sync.Mutex
+	next  map[int64]time.Time      // Próximo turno libre de cada chat
+	edits map[editKey]*pendingEdit // Ediciones de progreso por mensaje
+}
+
+type editKey struct {
+	chatID int64
+	msgID  int
+}
+
+// pendingEdit guarda la última edición de progreso que espera su turno: las
+// intermedias se descartan porque solo importa el estado más reciente.
+type pendingEdit struct {
+	last   time.Time
+	latest tgbotapi.Chattable
+	timer  *time.Timer
+}
+
+func newFloodSafeBot(api *tgbotapi.BotAPI) *floodSafeBot {
+	api.Client = &debugClient{base: &topicClient{base: api.Client}}
+	return &floodSafeBot{
+		BotAPI: api,
+		next:   make(map[int64]time.Time),
+		edits:  make(map[editKey]*pendingEdit),
+	}
+}
+
+// Send envía respetando el turno del chat. Las ediciones de solo texto (el
+// progreso) se agrupan y pueden llegar con retraso; en ese caso devuelve un
+// mensaje vacío sin error.
+func (f *floodSafeBot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok && edit.InlineMessageID == "" {
+		key := editKey{edit.ChatID, edit.MessageID}
+		if edit.ReplyMarkup == nil {
+			return f.throttleEdit(key, c)
+		}
+		// Un cambio de teclado no puede quedar pisado por un progreso atrasado
+		f.dropEdit(key)
+	}
+	var msg tgbotapi.Message
+	err := f.do(c, func() (err error) {
+		msg, err = f.BotAPI.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+// Request es como Send para las llamadas que no devuelven un mensaje.
+func (f *floodSafeBot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := f.do(c, func() (err error) {
+		resp, err = f.BotAPI.Request(c)
+		return err
+	})
+	return resp, err
+}
+
+func (f *floodSafeBot) CopyMessage(c tgbotapi.CopyMessageConfig) (tgbotapi.MessageID, error) {
+	var id tgbotapi.MessageID
+	err := f.do(c, func() (err error) {
+		id, err = f.BotAPI.CopyMessage(c)
+		return err
+	})
+	return id, err
+}
+
+func (f *floodSafeBot) SendMediaGroup(c tgbotapi.MediaGroupConfig) ([]tgbotapi.Message, error) {
+	var msgs []tgbotapi.Message
+	err := f.do(c, func() (err error) {
+		msgs, err = f.BotAPI.SendMediaGroup(c)
+		return err
+	})
+	return msgs, err
+}
+
+// do espera el turno del chat y ejecuta la llamada, reintentando tras un 429.
+func (f *floodSafeBot) do(c tgbotapi.Chattable, call func() error) error {
+	f.waitTurn(chattableChat(c))
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = call()
+		wait, flooded := floodWait(err)
+		if !flooded || attempt >= maxFloodRetries || wait > maxFloodWait {
+			break
+		}
+		log.Printf("⏳ Telegram pide esperar %s (%T)", wait, c)
+		time.Sleep(wait)
+	}
+	if err != nil && !harmlessSendError(err) {
+		log.Printf("⚠️ Error de Telegram en %T: %v", c, err)
+	}
+	return err
+}
+
+// waitTurn reserva el siguiente hueco del chat y duerme hasta él. La reserva
+// se hace bajo el candado pero el envío no: una subida larga no bloquea los
+// demás mensajes del chat, solo los espacia.
+func (f *floodSafeBot) waitTurn(chatID int64) {
+	if chatID == 0 {
+		return // Respuestas a callbacks, consultas inline...: sin chat que espaciar
+	}
+	interval := privateSendInterval
+	if chatID < 0 {
+		interval = groupSendInterval
+	}
+	f.mu.Lock()
+	now := time.Now()
+	turn := f.next[chatID]
+	if turn.Before(now) {
+		turn = now
+	}
+	f.next[chatID] = turn.Add(interval)
+	// Los turnos pasados ya no sirven de nada
+	if len(f.next) > 1000 {
+		for id, t := range f.next {
+			if t.Before(now) {
+				delete(f.next, id)
+			}
+		}
+	}
+	f.mu.Unlock()
+	time.Sleep(time.Until(turn))
+}
+
+// throttleEdit envía la edición si la anterior del mismo mensaje fue hace más
+// de UpdateInterval; si no, la deja pendiente (sustituyendo a la que hubiera)
+// para cuando se cumpla el intervalo.
+func (f *floodSafeBot) throttleEdit(key editKey, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	f.mu.Lock()
+	p := f.edits[key]
+	if p == nil {
+		p = &pendingEdit{}
+		f.edits[key] = p
+		f.pruneEdits()
+	}
+	if wait := UpdateInterval - time.Since(p.last); wait > 0 || p.timer != nil {
+		p.latest = c
+		if p.timer == nil {
+			p.timer = time.AfterFunc(wait, func() { f.flushEdit(key) })
+		}
+		f.mu.Unlock()
+		return tgbotapi.Message{}, nil
+	}
+	p.last = time.Now()
+	f.mu.Unlock()
+
+	var msg tgbotapi.Message
+	err := f.do(c, func() (err error) {
+		msg, err = f.BotAPI.Send(c)
+		return err
+	})
+	return msg, err
+}
+
+func (f *floodSafeBot) flushEdit(key editKey) {
+	f.mu.Lock()
+	p := f.edits[key]
+	if p == nil || p.latest == nil {
+		f.mu.Unlock()
+		return
+	}
+	c := p.latest
+	p.latest, p.timer, p.last = nil, nil, time.Now()
+	f.mu.Unlock()
+
+	f.do(c, func() error {
+		_, err := f.BotAPI.Send(c)
+		return err
+	})
+}
+
+// dropEdit descarta la edición de progreso pendiente del mensaje.
+func (f *floodSafeBot) dropEdit(key editKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p := f.edits[key]; p != nil {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.latest, p.timer, p.last = nil, nil, time.Now()
+	}
+}
+
+// pruneEdits olvida los mensajes que no se editan desde hace rato. Se llama
+// con el candado tomado.
+func (f *floodSafeBot) pruneEdits() {
+	if len(f.edits) < 1000 {
+		return
+	}
+	for key, p := range f.edits {
+		if p.timer == nil && time.Since(p.last) > 10*time.Minute {
+			delete(f.edits, key)
+		}
+	}
+}
+
+// chattableChat saca el chat de destino de una llamada (0 si no tiene o es
+// un @canal, que no se espacia). La Bot API no expone los parámetros: todas
+// las configuraciones con chat llevan el campo ChatID (propio o heredado).
+func chattableChat(c tgbotapi.Chattable) int64 {
+	v := reflect.Indirect(reflect.ValueOf(c))
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	if field := v.FieldByName("ChatID"); field.IsValid() && field.Kind() == reflect.Int64 {
+		return field.Int()
+	}
+	return 0
+}
+
+// floodWait indica si el error es un 429 y cuánto pide esperar Telegram.
+func floodWait(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second, true
+	}
+	return 0, false
+}
+
+// harmlessSendError reconoce los errores esperables que no merece la pena
+// registrar: editar sin cambios o un mensaje que el usuario ya borró.
+func harmlessSendError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "message is not modified") ||
+		strings.Contains(msg, "message to edit not found") ||
+		strings.Contains(msg, "message to delete not found")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sessionKey identifica una sesión: el menú de un enlace de un usuario dentro
+// de un chat. En privado ChatID y UserID coinciden; en grupos cada miembro
+// tiene sus propias sesiones. Con el mensaje del menú en la clave, un usuario
+// puede tener varios enlaces en curso sin que uno pise al otro.
+type sessionKey struct {
+	ChatID int64
+	UserID int64
+	MsgID  int
+}
+
+// UserSession guarda el enlace en curso de un usuario mientras elige formato.
+type UserSession struct {
+	Meta    *VideoMetaData
+	MsgID   int // Mensaje de estado con el teclado
+	ReplyTo int // Mensaje original del usuario (para responder en hilo)
+
+	Album *albumInfo // Solo para sets y álbumes: lista de pistas
+
+	Options   downloadOptions // Opciones elegidas en el teclado antes de la calidad
+	LinkStart int             // Segundo de inicio indicado en el enlace (?t=90); 0 = ninguno
+}
+
+// downloadOptions son los ajustes de una descarga que no dependen del formato.
+type downloadOptions struct {
+	AudioLang  string // Idioma de la pista de audio; "" = la original
+	SubLang    string // Idioma de los subtítulos del video; "" = sin subtítulos
+	SubMode    string // "embed" (pista seleccionable) o "burn" (en la imagen)
+	Downscale  int    // Altura a la que reducir el video tras descargarlo; 0 = sin cambios
+	TargetMB   int    // Tamaño objetivo del video en MB (codificación en dos pasadas); 0 = sin límite
+	ClipStart  int    // Descargar solo desde este segundo; 0 = desde el principio
+	ClipLength int    // Segundos del clip desde ClipStart; 0 = hasta el final
+
+	SkipSponsors   bool // De /settings: quitar segmentos de SponsorBlock
+	NormalizeAudio bool // De /settings: loudnorm en las descargas de audio
+	CompatMode     bool // De /settings: video en H.264/AAC
+}
+
+// downloadOptions junta lo elegido en el teclado con los ajustes del usuario
+// que afectan a la descarga.
+func (b *DownloadBot) downloadOptions(userID int64, sess *UserSession) downloadOptions {
+	opts := sess.Options
+	settings := b.store.userSettings(userID)
+	opts.SkipSponsors = settings.SkipSponsors
+	opts.NormalizeAudio = settings.NormalizeAudio
+	opts.CompatMode = settings.CompatMode
+	return opts
+}
+
+func (b *DownloadBot) loadSession(key sessionKey) (*UserSession, bool) {
+	return b.state.LoadSession(key)
+}
+
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// mentionsBot indica si el texto menciona al bot con @usuario.
+func (b *DownloadBot) mentionsBot(text string) bool {
+	mention := "@" + strings.ToLower(b.bot.Self.UserName)
+	return strings.Contains(strings.ToLower(text), mention)
+}
+
+// commandForUs descarta comandos dirigidos explícitamente a otro bot (/cmd@otrobot).
+func (b *DownloadBot) commandForUs(message *tgbotapi.Message) bool {
+	withAt := message.CommandWithAt()
+	at := strings.Index(withAt, "@")
+	if at < 0 {
+		return true
+	}
+	return strings.EqualFold(withAt[at+1:], b.bot.Self.UserName)
+}
+
+// sendReply envía un mensaje respondiendo a otro (hilo) cuando replyTo != 0.
+func (b *DownloadBot) sendReply(chatID int64, replyTo int, text string) tgbotapi.Message {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyToMessageID = replyTo
+	sent, _ := b.bot.Send(msg)
+	return sent
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// UserSettings son las preferencias persistentes de cada usuario.
+type UserSettings struct {
+	// Preset de descarga rápida: si DefaultMode no está vacío, los enlaces se
+	// descargan directamente sin mostrar el teclado de calidades (salvo que
+	// ShowKeyboard esté activo, en cuyo caso el preset aparece como atajo).
+	DefaultMode    string `json:"default_mode,omitempty"`    // "video" o "audio"
+	DefaultQuality string `json:"default_quality,omitempty"` // Altura máxima para video, o "fit" (mejor ≤50MB)
+	AudioFormat    string `json:"audio_format,omitempty"`    // "mp3" (por defecto), "m4a" u "opus"
+	ShowKeyboard   bool   `json:"show_keyboard,omitempty"`
+
+	// Plantilla de yt-dlp para el nombre de los archivos enviados (vacía = la del operador)
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	// Sin pie con el origen (título, autor, enlace) en los archivos enviados
+	NoAttribution bool `json:"no_attribution,omitempty"`
+	// Quitar patrocinios e intros de los videos de YouTube (SponsorBlock)
+	SkipSponsors bool `json:"skip_sponsors,omitempty"`
+	// Normalizar el volumen de los audios (EBU R128)
+	NormalizeAudio bool `json:"normalize_audio,omitempty"`
+	// Convertir los videos a H.264/AAC para que se reproduzcan en todos los clientes
+	CompatMode bool `json:"compat_mode,omitempty"`
+	// No recibir los anuncios del bot (/notifications)
+	MuteAnnouncements bool `json:"mute_announcements,omitempty"`
+
+	// Última elección del teclado de calidades por plataforma: "video:720", "audio:best"
+	LastChoice map[string]string `json:"last_choice,omitempty"`
+	// Elecciones fijas por plataforma ("📌 Usar siempre"): sus enlaces se
+	// descargan así sin mostrar el teclado, hasta /forget
+	AlwaysChoice map[string]string `json:"always_choice,omitempty"`
+}
+
+// clone copia los ajustes con sus mapas: la copia se lee fuera de s.mu
+// mientras otras goroutines modifican el original.
+func (u UserSettings) clone() UserSettings {
+	u.LastChoice = maps.Clone(u.LastChoice)
+	u.AlwaysChoice = maps.Clone(u.AlwaysChoice)
+	return u
+}
+
+func (s *Store) userSettings(userID int64) UserSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if settings, ok := s.data.Settings[userID]; ok {
+		return settings.clone()
+	}
+	return UserSettings{}
+}
+
+func (s *Store) updateUserSettings(userID int64, fn func(*UserSettings)) UserSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, ok := s.data.Settings[userID]
+	if !ok {
+		settings = &UserSettings{}
+		s.data.Settings[userID] = settings
+	}
+	fn(settings)
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando ajustes de usuario: %v", err)
+	}
+	return settings.clone()
+}
+
+// rememberChoice guarda la calidad elegida por el usuario para la plataforma.
+func (s *Store) rememberChoice(userID int64, platform, mode, quality string) {
+	if platform == "" {
+		return
+	}
+	s.updateUserSettings(userID, func(settings *UserSettings) {
+		if settings.LastChoice == nil {
+			settings.LastChoice = make(map[string]string)
+		}
+		settings.LastChoice[platform] = mode + ":" + quality
+	})
+}
+
+func (s *Store) lastChoice(userID int64, platform string) (mode, quality string, ok bool) {
+	if platform == "" {
+		return "", "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings, found := s.data.Settings[userID]
+	if !found {
+		return "", "", false
+	}
+	return strings.Cut(settings.LastChoice[platform], ":")
+}
+
+func (s *Store) setAlwaysChoice(userID int64, platform, mode, quality string) {
+	s.updateUserSettings(userID, func(settings *UserSettings) {
+		if settings.AlwaysChoice == nil {
+			settings.AlwaysChoice = make(map[string]string)
+		}
+		settings.AlwaysChoice[platform] = mode + ":" + quality
+	})
+}
+
+func (s *Store) alwaysChoice(userID int64, platform string) (mode, quality string, ok bool) {
+	if platform == "" {
+		return "", "", false
+	}
+	return strings.Cut(s.userSettings(userID).AlwaysChoice[platform], ":")
+}
+
+// forgetChoices borra la elección fija de la plataforma (o todas si está
+// vacía) y devuelve cuántas había.
+func (s *Store) forgetChoices(userID int64, platform string) int {
+	removed := 0
+	s.updateUserSettings(userID, func(settings *UserSettings) {
+		if platform == "" {
+			removed = len(settings.AlwaysChoice)
+			settings.AlwaysChoice = nil
+			return
+		}
+		if _, ok := settings.AlwaysChoice[platform]; ok {
+			delete(settings.AlwaysChoice, platform)
+			removed = 1
+		}
+	})
+	return removed
+}
+
+// autoChoice decide si un enlace se descarga sin teclado: primero la
+// elección fija de la plataforma y, si no hay, el preset de descarga rápida.
+func (s UserSettings) autoChoice(platform string) (mode, quality string, ok bool) {
+	if choice, found := s.AlwaysChoice[platform]; found && platform != "" {
+		return strings.Cut(choice, ":")
+	}
+	if s.autoDownload() {
+		mode, quality = s.preset()
+		return mode, quality, true
+	}
+	return "", "", false
+}
+
+func choiceLabel(mode, quality string) string {
+	switch mode {
+	case "voice":
+		return "Nota de voz"
+	case "note":
+		return "Video nota"
+	case "sticker":
+		return "Sticker"
+	}
+	if mode == "audio" {
+		if kbps, ok := audioBitrate(quality); ok {
+			return fmt.Sprintf("MP3 %dkbps", kbps)
+		}
+		if quality == "" || quality == "best" {
+			return "MP3"
+		}
+		return strings.ToUpper(quality)
+	}
+	return videoQualityLabel(quality)
+}
+
+// Formatos de audio que se pueden elegir como predeterminados
+var audioFormats = []string{"mp3", "m4a", "opus"}
+
+// Calidades de video que ofrece el menú de /settings
+var settingsQualities = []string{"fit", "1080", "720", "480"}
+
+// preset devuelve el modo y la calidad con los que descargar por defecto.
+// Para audio la "calidad" es el formato de salida.
+func (s UserSettings) preset() (mode, quality string) {
+	if s.DefaultMode == "audio" {
+		return "audio", s.audioFormat()
+	}
+	return s.DefaultMode, s.DefaultQuality
+}
+
+func (s UserSettings) audioFormat() string {
+	if s.AudioFormat == "" {
+		return "mp3"
+	}
+	return s.AudioFormat
+}
+
+// autoDownload indica si los enlaces se descargan sin mostrar el teclado.
+func (s UserSettings) autoDownload() bool {
+	return s.DefaultMode != "" && !s.ShowKeyboard
+}
+
+func videoQualityLabel(quality string) string {
+	if quality == "fit" {
+		return "mejor ≤50MB"
+	}
+	return quality + "p"
+}
+
+func presetLabel(settings UserSettings) string {
+	switch settings.DefaultMode {
+	case "audio":
+		return "🎵 Audio " + strings.ToUpper(settings.audioFormat())
+	case "video":
+		return "🎬 Video " + videoQualityLabel(settings.DefaultQuality)
+	}
+	return "ninguno (se muestra el menú de calidades)"
+}
+
+func (b *DownloadBot) handlePresetCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil {
+		return
+	}
+	userID := message.From.ID
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		current := b.store.userSettings(userID)
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("⚡ *Descarga rápida*\n\nPreset actual: %s\n\nUso: /preset video <altura> | audio | off", presetLabel(current)))
+		return
+	}
+
+	var settings UserSettings
+	switch args[0] {
+	case "audio":
+		settings = b.store.updateUserSettings(userID, func(s *UserSettings) {
+			s.DefaultMode, s.DefaultQuality, s.ShowKeyboard = "audio", "best", false
+		})
+	case "video":
+		quality := "720"
+		if len(args) > 1 {
+			quality = strings.TrimSuffix(args[1], "p")
+		}
+		if _, err := strconv.Atoi(quality); err != nil {
+			b.sendReply(chatID, message.MessageID, "❌ La calidad debe ser una altura en píxeles, p. ej. 720.")
+			return
+		}
+		settings = b.store.updateUserSettings(userID, func(s *UserSettings) {
+			s.DefaultMode, s.DefaultQuality, s.ShowKeyboard = "video", quality, false
+		})
+	case "off":
+		settings = b.store.updateUserSettings(userID, func(s *UserSettings) {
+			s.DefaultMode, s.DefaultQuality = "", ""
+		})
+	default:
+		b.sendReply(chatID, message.MessageID, "⚡ Uso: /preset video <altura> | audio | off")
+		return
+	}
+	b.sendReply(chatID, message.MessageID, fmt.Sprintf("✅ Preset guardado: %s", presetLabel(settings)))
+}
+
+// Versión del formato de exportación de ajustes
+const settingsExportVersion = 1
+
+// settingsExport es el blob firmado que se intercambia entre instancias del bot.
+type settingsExport struct {
+	Version    int          `json:"version"`
+	UserID     int64        `json:"user_id"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Settings   UserSettings `json:"settings"`
+	Signature  string       `json:"signature,omitempty"`
+}
+
+// sign calcula la firma HMAC-SHA256 del blob (sin el campo de firma).
+func (e settingsExport) sign(key string) string {
+	e.Signature = ""
+	payload, _ := json.Marshal(e)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (b *DownloadBot) handleSettingsCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	if message.From == nil {
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		if !message.Chat.IsPrivate() {
+			b.sendReply(chatID, message.MessageID, "⚙️ Abre /settings en el chat privado con el bot.")
+			return
+		}
+		current := b.store.userSettings(message.From.ID)
+		msg := tgbotapi.NewMessage(chatID, settingsMenuText(current))
+		msg.ParseMode = "Markdown"
+		msg.ReplyMarkup = settingsMenuKeyboard(current)
+		b.bot.Send(msg)
+		return
+	}
+
+	switch args[0] {
+	case "export":
+		b.exportSettings(message)
+	case "import":
+		b.importSettings(message)
+	case "name":
+		b.handleFilenameSetting(message, args[1:])
+	default:
+		b.sendReply(chatID, message.MessageID, "⚙️ Uso: /settings [export | import | name]")
+	}
+}
+
+func settingsMenuText(settings UserSettings) string {
+	return fmt.Sprintf("⚙️ *Ajustes*\n\nPredeterminado: %s\n\nElige tus valores por defecto. Si saltas el menú de formatos, los enlaces se descargan directamente con ellos.\n\n/settings export — exportar tus ajustes\n/settings import — importar (respondiendo al archivo exportado)", presetLabel(settings))
+}
+
+// settingsMenuKeyboard marca con ✅ los valores actuales del usuario.
+func settingsMenuKeyboard(settings UserSettings) tgbotapi.InlineKeyboardMarkup {
+	mark := func(selected bool, label string) string {
+		if selected {
+			return "✅ " + label
+		}
+		return label
+	}
+
+	typeRow := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(mark(settings.DefaultMode == "video", "🎬 Video"), "set:mode:video"),
+		tgbotapi.NewInlineKeyboardButtonData(mark(settings.DefaultMode == "audio", "🎵 Audio"), "set:mode:audio"),
+	)
+	var qualityRow []tgbotapi.InlineKeyboardButton
+	for _, q := range settingsQualities {
+		qualityRow = append(qualityRow, tgbotapi.NewInlineKeyboardButtonData(mark(settings.DefaultQuality == q, videoQualityLabel(q)), "set:q:"+q))
+	}
+	var formatRow []tgbotapi.InlineKeyboardButton
+	for _, f := range audioFormats {
+		formatRow = append(formatRow, tgbotapi.NewInlineKeyboardButtonData(mark(settings.audioFormat() == f, strings.ToUpper(f)), "set:fmt:"+f))
+	}
+	toggle := func(on bool, label string) string {
+		if on {
+			return label + ": ✅"
+		}
+		return label + ": ❌"
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		typeRow,
+		qualityRow,
+		formatRow,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(toggle(settings.autoDownload(), "⚡ Saltar menú de formatos"), "set:skip")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(toggle(!settings.NoAttribution, "🔗 Pie con el origen"), "set:attr")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(toggle(settings.SkipSponsors, "⏭ Saltar patrocinios e intros"), "set:sponsor")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(toggle(settings.NormalizeAudio, "🔊 Normalizar volumen del audio"), "set:loudnorm")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(toggle(settings.CompatMode, "📱 Modo compatible (H.264)"), "set:compat")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🗑 Borrar predeterminados", "set:reset")),
+	)
+}
+
+// handleSettingsCallback aplica un cambio del menú de /settings: "set:<campo>[:<valor>]"
+func (b *DownloadBot) handleSettingsCallback(cb *tgbotapi.CallbackQuery) {
+	parts := strings.Split(cb.Data, ":")
+	value := ""
+	if len(parts) > 2 {
+		value = parts[2]
+	}
+
+	valid := func(list []string) bool {
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	var notice string
+	settings := b.store.updateUserSettings(cb.From.ID, func(s *UserSettings) {
+		switch parts[1] {
+		case "mode":
+			if value == "video" || value == "audio" {
+				s.DefaultMode = value
+				if value == "video" && (s.DefaultQuality == "" || s.DefaultQuality == "best") {
+					s.DefaultQuality = "720"
+				}
+			}
+		case "q":
+			if valid(settingsQualities) {
+				s.DefaultQuality = value
+				if s.DefaultMode == "" {
+					s.DefaultMode = "video"
+				}
+			}
+		case "fmt":
+			if valid(audioFormats) {
+				s.AudioFormat = value
+			}
+		case "skip":
+			if s.DefaultMode == "" {
+				notice = "Elige primero un tipo predeterminado."
+				return
+			}
+			s.ShowKeyboard = !s.ShowKeyboard
+		case "attr":
+			s.NoAttribution = !s.NoAttribution
+		case "sponsor":
+			s.SkipSponsors = !s.SkipSponsors
+		case "loudnorm":
+			s.NormalizeAudio = !s.NormalizeAudio
+		case "compat":
+			s.CompatMode = !s.CompatMode
+		case "reset":
+			// Solo los valores de descarga; el resto de ajustes se conserva
+			s.DefaultMode, s.DefaultQuality, s.AudioFormat, s.ShowKeyboard = "", "", "", false
+		}
+	})
+	b.bot.Request(tgbotapi.NewCallback(cb.ID, notice))
+
+	b.editMessageMarkup(cb.Message.Chat.ID, cb.Message.MessageID, settingsMenuText(settings), settingsMenuKeyboard(settings))
+}
+
+func (b *DownloadBot) exportSettings(message *tgbotapi.Message) {
+	export := settingsExport{
+		Version:    settingsExportVersion,
+		UserID:     message.From.ID,
+		ExportedAt: time.Now().UTC(),
+		Settings:   b.store.userSettings(message.From.ID),
+	}
+	export.Signature = export.sign(b.cfg().SettingsSigningKey)
+
+	raw, _ := json.MarshalIndent(export, "", "  ")
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: "ajustes_bot.json", Bytes: raw})
+	doc.Caption = "⚙️ Tus ajustes exportados. Para restaurarlos, responde a este archivo con /settings import en cualquier instancia del bot."
+	doc.ReplyToMessageID = message.MessageID
+	if _, err := b.bot.Send(doc); err != nil {
+		log.Printf("Error exportando ajustes: %v", err)
+		b.sendReply(message.Chat.ID, message.MessageID, "❌ No se pudieron exportar los ajustes.")
+	}
+}
+
+// importSettings acepta el JSON pegado como argumento o el documento
+// exportado al que responde el mensaje.
+func (b *DownloadBot) importSettings(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+
+	raw := []byte(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(message.CommandArguments()), "import")))
+	if len(raw) == 0 {
+		var doc *tgbotapi.Document
+		if message.ReplyToMessage != nil {
+			doc = message.ReplyToMessage.Document
+		}
+		if doc == nil {
+			b.sendReply(chatID, message.MessageID, "📎 Responde al archivo exportado con /settings import.")
+			return
+		}
+		var err error
+		raw, err = b.fetchTelegramFile(doc.FileID)
+		if err != nil {
+			log.Printf("Error descargando ajustes: %v", err)
+			b.sendReply(chatID, message.MessageID, "❌ No se pudo leer el archivo.")
+			return
+		}
+	}
+
+	var export settingsExport
+	if err := json.Unmarshal(raw, &export); err != nil || export.Version != settingsExportVersion {
+		b.sendReply(chatID, message.MessageID, "❌ El archivo no tiene un formato de ajustes válido.")
+		return
+	}
+	expected := export.sign(b.cfg().SettingsSigningKey)
+	if !hmac.Equal([]byte(expected), []byte(export.Signature)) {
+		b.sendReply(chatID, message.MessageID, "❌ La firma no es válida: el archivo fue modificado o viene de un bot con otra clave.")
+		return
+	}
+	if export.UserID != message.From.ID {
+		b.sendReply(chatID, message.MessageID, "⛔ Estos ajustes pertenecen a otro usuario.")
+		return
+	}
+
+	settings := b.store.updateUserSettings(message.From.ID, func(s *UserSettings) { *s = export.Settings })
+	b.sendReply(chatID, message.MessageID, fmt.Sprintf("✅ Ajustes importados.\n\nPreset: %s", presetLabel(settings)))
+}
+
+// fetchTelegramFile descarga a memoria un archivo enviado al bot (máx. 1MB).
+func (b *DownloadBot) fetchTelegramFile(fileID string) ([]byte, error) {
+	fileURL, err := b.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.httpClient.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
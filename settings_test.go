@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingsExportSign(t *testing.T) {
+	base := settingsExport{
+		Version:    settingsExportVersion,
+		UserID:     42,
+		ExportedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	signature := base.sign("clave")
+
+	signed := base
+	signed.Signature = signature
+	otherUser := base
+	otherUser.UserID = 43
+	otherDate := base
+	otherDate.ExportedAt = base.ExportedAt.Add(time.Second)
+
+	tests := []struct {
+		name   string
+		export settingsExport
+		key    string
+		same   bool
+	}{
+		{"mismo blob", base, "clave", true},
+		{"la firma no entra en la firma", signed, "clave", true},
+		{"otra clave", base, "otra", false},
+		{"otro usuario", otherUser, "clave", false},
+		{"otra fecha", otherDate, "clave", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.export.sign(tt.key); (got == signature) != tt.same {
+				t.Errorf("sign() = %q; igual a %q: %v, quiero %v", got, signature, got == signature, tt.same)
+			}
+		})
+	}
+	if signed.Signature != signature {
+		t.Errorf("sign cambió la firma del valor original")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Alias de dominios cortos o renombrados hacia el nombre de la plataforma
+var platformAliases = map[string]string{
+	"youtu":   "youtube",
+	"x":       "twitter",
+	"instagr": "instagram",
+	"fb":      "facebook",
+	"redd":    "reddit",
+}
+
+// Nombres legibles para los mensajes al usuario
+var platformNames = map[string]string{
+	"youtube":    "YouTube",
+	"tiktok":     "TikTok",
+	"instagram":  "Instagram",
+	"twitter":    "X/Twitter",
+	"facebook":   "Facebook",
+	"reddit":     "Reddit",
+	"soundcloud": "SoundCloud",
+	"vimeo":      "Vimeo",
+	"twitch":     "Twitch",
+}
+
+// Parámetros de rastreo que añaden las apps al compartir y que no afectan al contenido
+var trackingParams = []string{"si", "igshid", "igsh", "feature", "share_id", "is_from_webapp", "sender_device", "ref_src", "ref_url"}
+
+// detectPlatform reduce el host de un enlace al nombre de plataforma
+// (www.youtube.com -> youtube, vm.tiktok.com -> tiktok).
+func detectPlatform(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(strings.ToLower(u.Hostname()), ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	name := labels[len(labels)-2]
+	if alias, ok := platformAliases[name]; ok {
+		name = alias
+	}
+	return name
+}
+
+func platformDisplayName(platform string) string {
+	if name, ok := platformNames[platform]; ok {
+		return name
+	}
+	return platform
+}
+
+// extractURL busca el primer enlace dentro del texto. Las apps móviles suelen
+// compartir "Mira este video ... https://..." con texto extra alrededor.
+func extractURL(text string) string {
+	for _, field := range strings.Fields(text) {
+		if i := strings.Index(field, "http://"); i >= 0 {
+			return cleanSharedURL(field[i:])
+		}
+		if i := strings.Index(field, "https://"); i >= 0 {
+			return cleanSharedURL(field[i:])
+		}
+	}
+	return ""
+}
+
+// repliedURL busca el enlace en el mensaje al que se responde: en los grupos
+// es habitual que el enlace lo haya enviado otro y se conteste con /dl.
+func repliedURL(message *tgbotapi.Message) string {
+	if message.ReplyToMessage == nil {
+		return ""
+	}
+	return messageURL(message.ReplyToMessage)
+}
+
+// messageURL busca el enlace de un mensaje en todos los sitios donde puede
+// estar: enlaces con texto (text_link) y URLs marcadas por Telegram en el
+// texto o el pie, el texto libre y, en los posts reenviados, los botones.
+func messageURL(message *tgbotapi.Message) string {
+	if link := entityURL(message.Text, message.Entities); link != "" {
+		return link
+	}
+	if link := entityURL(message.Caption, message.CaptionEntities); link != "" {
+		return link
+	}
+	if link := extractURL(message.Text); link != "" {
+		return link
+	}
+	if link := extractURL(message.Caption); link != "" {
+		return link
+	}
+	// Los posts de canal reenviados suelen llevar el enlace en un botón
+	if message.ForwardDate != 0 && message.ReplyMarkup != nil {
+		for _, row := range message.ReplyMarkup.InlineKeyboard {
+			for _, button := range row {
+				if button.URL != nil {
+					if link := extractURL(*button.URL); link != "" {
+						return link
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// entityURL devuelve el primer enlace de las entidades del texto. Los
+// desplazamientos de Telegram cuentan unidades UTF-16.
+func entityURL(text string, entities []tgbotapi.MessageEntity) string {
+	var units []uint16
+	for _, e := range entities {
+		switch {
+		case e.IsTextLink():
+			if link := extractURL(e.URL); link != "" {
+				return link
+			}
+		case e.IsURL():
+			if units == nil {
+				units = utf16.Encode([]rune(text))
+			}
+			if e.Offset < 0 || e.Offset+e.Length > len(units) {
+				continue
+			}
+			raw := string(utf16.Decode(units[e.Offset : e.Offset+e.Length]))
+			// Telegram marca también enlaces sin esquema ("youtu.be/...")
+			if !strings.Contains(raw, "://") {
+				raw = "https://" + raw
+			}
+			if link := extractURL(raw); link != "" {
+				return link
+			}
+		}
+	}
+	return ""
+}
+
+// cleanSharedURL quita la puntuación pegada al final y los parámetros de rastreo.
+func cleanSharedURL(raw string) string {
+	raw = strings.TrimRight(raw, ".,;:!?)]}»\"'")
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") {
+			query.Del(key)
+		}
+	}
+	for _, key := range trackingParams {
+		query.Del(key)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// encodeStartPayload es el inverso de decodeStartPayload. Devuelve false si
+// el enlace codificado no cabe en los 64 caracteres del parámetro.
+func encodeStartPayload(link string) (string, bool) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(link))
+	return payload, len(payload) <= 64
+}
+
+// decodeStartPayload lee un enlace codificado en base64url en el parámetro de
+// /start (t.me/<bot>?start=<base64url>), para que otras apps y webs puedan
+// pasarle un enlace al bot. Telegram limita el parámetro a 64 caracteres.
+func decodeStartPayload(payload string) (string, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(payload, "="))
+	if err != nil {
+		return "", false
+	}
+	link := extractURL(string(raw))
+	return link, link != ""
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Con la cola de descargas (JOB_QUEUE) los workers y el proceso del webhook
+// comparten el almacén a través de Redis: si no, cada worker apuntaría los
+// ajustes, el archivo, el uso y el tráfico en su propio JSON.
+//
+// Cada mapa del almacén (archive, settings, usage...) es un hash de Redis con
+// una entrada por clave, y el resto de campos van juntos en otro hash. Cada
+// campo lleva su versión: al tomar el cerrojo solo se traen los campos que
+// otro proceso cambió, y al guardar solo se escriben las entradas que cambiaron.
+const (
+	storeFieldPrefix = redisKeyPrefix + "store:field:"
+	storeScalarsKey  = redisKeyPrefix + "store:scalars"
+	storeVersionsKey = redisKeyPrefix + "store:versions"
+	storeLockKey     = redisKeyPrefix + "store:lock"
+	// Almacén de versiones anteriores: todo el JSON en una sola clave
+	storeLegacyKey = redisKeyPrefix + "store:data"
+	// Lo que dura el cerrojo si su dueño muere sin soltarlo
+	storeLockTTL = 15 * time.Second
+	// Cada cuánto se avisa en el log mientras se espera el cerrojo
+	storeLockWait = 10 * time.Second
+	// Cada cuánto se guarda la copia local (data/state.json) del almacén compartido
+	storeSnapshotInterval = time.Minute
+)
+
+// storeLock es el mutex del Store. Sin Redis es un sync.Mutex; compartido,
+// además toma el cerrojo de Redis y trae lo que otro proceso cambió, así que
+// todos los métodos del Store valen tal cual.
+type storeLock struct {
+	sync.Mutex
+	shared *sharedStore
+}
+
+func (l *storeLock) Lock() {
+	l.Mutex.Lock()
+	if l.shared != nil {
+		l.shared.lock()
+	}
+}
+
+func (l *storeLock) Unlock() {
+	if l.shared != nil {
+		l.shared.unlock()
+	}
+	l.Mutex.Unlock()
+}
+
+// storeField es un campo de storeData tal como se guarda en Redis.
+type storeField struct {
+	name  string // Nombre JSON, que es también el de su clave en Redis
+	index int    // Posición en storeData
+	isMap bool   // Los mapas van en su propio hash, una entrada por clave
+}
+
+// storeFields lista los campos de storeData a partir de sus etiquetas json.
+var storeFields = func() []storeField {
+	t := reflect.TypeOf(storeData{})
+	fields := make([]storeField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, storeField{name: name, index: i, isMap: t.Field(i).Type.Kind() == reflect.Map})
+	}
+	return fields
+}()
+
+type sharedStore struct {
+	client *redis.Client
+	data   *storeData // El s.data del Store, que se refresca en el sitio
+	token  string     // Dueño del cerrojo tomado
+
+	// Lo último que se leyó o escribió en Redis: versión de cada campo y
+	// JSON de cada entrada, para traer y escribir solo las diferencias
+	versions map[string]int64
+	entries  map[string]map[string]string
+
+	dirty bool // Hay cambios sin pasar a la copia local
+}
+
+// Suelta el cerrojo solo si sigue siendo nuestro (pudo caducar y tomarlo otro)
+var storeUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// share pasa el almacén a Redis. El primer proceso que lo comparte sube su
+// estado local (o el de una versión anterior del bot, si lo hay); los demás
+// usan el que ya hay (lock ya lo trajo). Desde entonces la copia local se guarda cada
+// storeSnapshotInterval, por si hay que volver a arrancar sin Redis.
+func (s *Store) share(client *redis.Client) error {
+	s.mu.Mutex.Lock()
+	defer s.mu.Mutex.Unlock()
+	ss := &sharedStore{
+		client:   client,
+		data:     &s.data,
+		versions: make(map[string]int64),
+		entries:  make(map[string]map[string]string),
+	}
+	ss.lock()
+	defer ss.unlock()
+
+	ctx := context.Background()
+	seeded, err := client.Exists(ctx, storeVersionsKey).Result()
+	if err != nil {
+		return err
+	}
+	if seeded == 0 {
+		if raw, err := client.Get(ctx, storeLegacyKey).Bytes(); err == nil {
+			var legacy storeData
+			if err := json.Unmarshal(raw, &legacy); err != nil {
+				return err
+			}
+			legacy.init()
+			s.data = legacy
+			log.Printf("🗄 Almacén compartido convertido al formato por entradas")
+		} else {
+			log.Printf("🗄 Almacén local subido a Redis para compartirlo con los workers")
+		}
+		if err := ss.save(&s.data); err != nil {
+			return err
+		}
+		client.Del(ctx, storeLegacyKey)
+	}
+	s.mu.shared = ss
+	go s.snapshotLoop()
+	return nil
+}
+
+// lock toma el cerrojo de Redis y trae los cambios de otros procesos. Si no
+// lo consigue sigue intentándolo: seguir sin él haría perder escrituras.
+func (ss *sharedStore) lock() {
+	ctx := context.Background()
+	token := randomToken(8)
+	warnAt := time.Now().Add(storeLockWait)
+	for {
+		ok, err := ss.client.SetNX(ctx, storeLockKey, token, storeLockTTL).Result()
+		if err == nil && ok {
+			ss.token = token
+			break
+		}
+		if time.Now().After(warnAt) {
+			log.Printf("⚠️ Esperando el cerrojo del almacén compartido: %v", err)
+			warnAt = time.Now().Add(storeLockWait)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	ss.refresh(ctx)
+}
+
+func (ss *sharedStore) unlock() {
+	storeUnlockScript.Run(context.Background(), ss.client, []string{storeLockKey}, ss.token)
+	ss.token = ""
+}
+
+// refresh trae de Redis los campos que otro proceso cambió desde la última vez.
+func (ss *sharedStore) refresh(ctx context.Context) {
+	raw, err := ss.client.HGetAll(ctx, storeVersionsKey).Result()
+	if err != nil {
+		log.Printf("⚠️ Error leyendo el almacén compartido: %v", err)
+		return
+	}
+	data := reflect.ValueOf(ss.data).Elem()
+	for _, field := range storeFields {
+		version, _ := strconv.ParseInt(raw[field.name], 10, 64)
+		if version == ss.versions[field.name] {
+			continue
+		}
+		entries, value, err := ss.fetch(ctx, field)
+		if err != nil {
+			log.Printf("⚠️ Error leyendo %s del almacén compartido: %v", field.name, err)
+			continue
+		}
+		target := data.Field(field.index)
+		fresh := reflect.New(target.Type())
+		if err := json.Unmarshal(value, fresh.Interface()); err != nil {
+			log.Printf("⚠️ %s inválido en el almacén compartido: %v", field.name, err)
+			continue
+		}
+		target.Set(fresh.Elem())
+		ss.entries[field.name] = entries
+		ss.versions[field.name] = version
+		ss.dirty = true
+	}
+	ss.data.init()
+}
+
+// fetch lee un campo de Redis: sus entradas (los mapas) y el JSON completo.
+func (ss *sharedStore) fetch(ctx context.Context, field storeField) (map[string]string, []byte, error) {
+	if !field.isMap {
+		value, err := ss.client.HGet(ctx, storeScalarsKey, field.name).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return nil, []byte("null"), nil
+		}
+		return map[string]string{"": string(value)}, value, err
+	}
+	entries, err := ss.client.HGetAll(ctx, storeFieldPrefix+field.name).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	object := make(map[string]json.RawMessage, len(entries))
+	for key, value := range entries {
+		object[key] = json.RawMessage(value)
+	}
+	value, err := json.Marshal(object)
+	return entries, value, err
+}
+
+// save escribe en Redis las entradas que cambiaron desde la última lectura o
+// escritura y sube la versión de sus campos. Sin el cerrojo no se escribe:
+// se pisarían los cambios de otro proceso.
+func (ss *sharedStore) save(data *storeData) error {
+	if ss.token == "" {
+		return errors.New("sin cerrojo del almacén compartido")
+	}
+	ctx := context.Background()
+	pipe := ss.client.TxPipeline()
+	value := reflect.ValueOf(data).Elem()
+	changed := make(map[string]map[string]string)
+	for _, field := range storeFields {
+		entries, err := fieldEntries(field, value.Field(field.index).Interface())
+		if err != nil {
+			return err
+		}
+		known := ss.entries[field.name]
+		dirty := false
+		for key, entry := range entries {
+			if old, ok := known[key]; ok && old == entry {
+				continue
+			}
+			dirty = true
+			if field.isMap {
+				pipe.HSet(ctx, storeFieldPrefix+field.name, key, entry)
+			} else {
+				pipe.HSet(ctx, storeScalarsKey, field.name, entry)
+			}
+		}
+		for key := range known {
+			if _, ok := entries[key]; !ok && field.isMap {
+				dirty = true
+				pipe.HDel(ctx, storeFieldPrefix+field.name, key)
+			}
+		}
+		if dirty {
+			changed[field.name] = entries
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	incrs := make(map[string]*redis.IntCmd, len(changed))
+	for name := range changed {
+		incrs[name] = pipe.HIncrBy(ctx, storeVersionsKey, name, 1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	for name, entries := range changed {
+		ss.entries[name] = entries
+		ss.versions[name] = incrs[name].Val()
+	}
+	ss.dirty = true
+	return nil
+}
+
+// fieldEntries pasa un campo a sus entradas en JSON: una por clave en los
+// mapas y una sola ("") en el resto.
+func fieldEntries(field storeField, value any) (map[string]string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if !field.isMap {
+		return map[string]string{"": string(raw)}, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]string, len(object))
+	for key, entry := range object {
+		entries[key] = string(entry)
+	}
+	return entries, nil
+}
+
+// snapshotLoop guarda cada storeSnapshotInterval una copia local del almacén
+// compartido si cambió: si Redis se pierde, el bot arranca con ella.
+func (s *Store) snapshotLoop() {
+	for range time.Tick(storeSnapshotInterval) {
+		// Solo el mutex local: la copia es la de este proceso
+		s.mu.Mutex.Lock()
+		if s.mu.shared.dirty {
+			if err := writeJSONAtomic(s.path, s.data); err != nil {
+				log.Printf("⚠️ Error guardando la copia local del almacén: %v", err)
+			} else {
+				s.mu.shared.dirty = false
+			}
+		}
+		s.mu.Mutex.Unlock()
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dominios de enlaces cortos que redirigen al contenido real
+var shortLinkHosts = map[string]bool{
+	"t.co":              true,
+	"vm.tiktok.com":     true,
+	"vt.tiktok.com":     true,
+	"bit.ly":            true,
+	"tinyurl.com":       true,
+	"goo.gl":            true,
+	"fb.watch":          true,
+	"redd.it":           true,
+	"on.soundcloud.com": true,
+	"pin.it":            true,
+}
+
+// Saltos de redirección que se siguen como mucho, y tiempo máximo para
+// seguirlos todos: el usuario espera mientras tanto
+const (
+	maxShortLinkHops    = 5
+	maxShortLinkExpand  = 10 * time.Second
+	maxShortLinkEntries = 10000
+)
+
+// Cuánto se recuerda la expansión de un enlace corto
+const shortLinkCacheTTL = time.Hour
+
+type expandedLink struct {
+	url     string
+	expires time.Time
+}
+
+var (
+	// enlace corto -> expansión; al crecer se olvidan las caducadas
+	shortLinkCache = struct {
+		sync.Mutex
+		links map[string]expandedLink
+	}{links: make(map[string]expandedLink)}
+
+	// Cliente que no sigue redirecciones: se leen una a una
+	shortLinkClient = &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+// expandShortLink convierte los enlaces cortos en la URL canónica antes de
+// validar, extraer metadatos o buscar en la caché, para que youtu.be/x y
+// youtube.com/watch?v=x cuenten como el mismo contenido. Si algo falla se
+// devuelve el enlace tal cual (yt-dlp suele saber seguirlo igualmente).
+func expandShortLink(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+
+	// youtu.be se traduce sin red
+	if host == "youtu.be" {
+		id := strings.Trim(u.Path, "/")
+		if id == "" {
+			return rawURL
+		}
+		query := u.Query()
+		query.Set("v", id)
+		return cleanSharedURL("https://www.youtube.com/watch?" + query.Encode())
+	}
+	if !shortLinkHosts[host] {
+		return rawURL
+	}
+
+	if expanded, ok := cachedShortLink(rawURL); ok {
+		return expanded
+	}
+	expanded := followRedirects(rawURL)
+	if expanded != rawURL {
+		log.Printf("🔗 Enlace corto expandido: %s -> %s", rawURL, expanded)
+	}
+	cacheShortLink(rawURL, expanded)
+	return expanded
+}
+
+func cachedShortLink(rawURL string) (string, bool) {
+	shortLinkCache.Lock()
+	defer shortLinkCache.Unlock()
+	cached, ok := shortLinkCache.links[rawURL]
+	if !ok || time.Now().After(cached.expires) {
+		return "", false
+	}
+	return cached.url, true
+}
+
+func cacheShortLink(rawURL, expanded string) {
+	shortLinkCache.Lock()
+	defer shortLinkCache.Unlock()
+	now := time.Now()
+	if len(shortLinkCache.links) >= maxShortLinkEntries {
+		for link, cached := range shortLinkCache.links {
+			if now.After(cached.expires) {
+				delete(shortLinkCache.links, link)
+			}
+		}
+	}
+	// Si siguen todas vigentes se vacía: es solo una caché
+	if len(shortLinkCache.links) >= maxShortLinkEntries {
+		clear(shortLinkCache.links)
+	}
+	shortLinkCache.links[rawURL] = expandedLink{url: expanded, expires: now.Add(shortLinkCacheTTL)}
+}
+
+// followRedirects sigue las redirecciones con HEAD (con GET si el servidor no
+// admite HEAD) y devuelve la última URL a la que se llegó en maxShortLinkExpand.
+func followRedirects(rawURL string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), maxShortLinkExpand)
+	defer cancel()
+	current := rawURL
+	for range maxShortLinkHops {
+		next, ok := redirectTarget(ctx, current, http.MethodHead)
+		if !ok && ctx.Err() == nil {
+			next, ok = redirectTarget(ctx, current, http.MethodGet)
+		}
+		if !ok || next == "" {
+			break
+		}
+		current = next
+	}
+	return cleanSharedURL(current)
+}
+
+// redirectTarget hace una petición y devuelve el destino de la redirección
+// ("" si no redirige). ok es false si la petición falló o el método no vale.
+func redirectTarget(ctx context.Context, rawURL, method string) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return "", false
+	}
+	// Algunos acortadores solo redirigen a navegadores
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; TelegramBot)")
+	resp, err := shortLinkClient.Do(req)
+	if err != nil {
+		return "", false
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return "", resp.StatusCode < 400
+	}
+	location, err := resp.Location()
+	if err != nil || (location.Scheme != "http" && location.Scheme != "https") {
+		return "", true
+	}
+	return location.String(), true
+}
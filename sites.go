@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"strings"
+)
+
+// siteHandler adapta la descarga a un sitio concreto sin tocar el flujo
+// común: cada gancho es opcional y se aplica solo a los enlaces del sitio.
+type siteHandler struct {
+	name string
+	// Argumentos de yt-dlp que se añaden en cualquier invocación con el enlace
+	args []string
+	// Filtro de formato que se prefiere en cada alternativa del selector; las
+	// originales quedan de respaldo (ver withFormatFilter)
+	formatFilter string
+	// resolve transforma el enlace antes de validarlo y extraer los metadatos
+	resolve func(rawURL string) string
+}
+
+var siteHandlers = make(map[string]*siteHandler) // dominio -> handler
+
+// registerSite asocia el handler a los dominios dados; también vale para sus
+// subdominios (m.tiktok.com, old.reddit.com...).
+func registerSite(handler *siteHandler, domains ...string) {
+	for _, domain := range domains {
+		siteHandlers[domain] = handler
+	}
+}
+
+func init() {
+	// TikTok sirve el mismo video con y sin marca de agua: yt-dlp marca el
+	// primero en la nota del formato
+	registerSite(&siteHandler{
+		name:         "tiktok",
+		formatFilter: "[format_note!*=?watermark]",
+	}, "tiktok.com")
+
+	// v.redd.it es el CDN de Reddit: su DASH trae video y audio por separado y
+	// sin título. La publicación a la que redirige da a yt-dlp los dos streams
+	// para fusionarlos y los metadatos del post
+	registerSite(&siteHandler{
+		name: "reddit",
+		resolve: func(rawURL string) string {
+			if resolved := followRedirects(rawURL); strings.Contains(resolved, "/comments/") {
+				return resolved
+			}
+			return rawURL
+		},
+	}, "v.redd.it")
+}
+
+// siteHandlerFor busca el handler del dominio del enlace o de alguno de sus
+// dominios padre. Devuelve nil si el sitio no tiene tratamiento especial.
+func siteHandlerFor(rawURL string) *siteHandler {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	for host != "" {
+		if handler, ok := siteHandlers[host]; ok {
+			return handler
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found || !strings.Contains(parent, ".") {
+			break
+		}
+		host = parent
+	}
+	return nil
+}
+
+// resolveSiteLink aplica el resolve del sitio, si lo tiene.
+func resolveSiteLink(rawURL string) string {
+	handler := siteHandlerFor(rawURL)
+	if handler == nil || handler.resolve == nil {
+		return rawURL
+	}
+	resolved := handler.resolve(rawURL)
+	if resolved != rawURL {
+		log.Printf("🧩 Enlace de %s resuelto: %s -> %s", handler.name, rawURL, resolved)
+	}
+	return resolved
+}
+
+// siteArgs devuelve los argumentos extra de yt-dlp del sitio del enlace.
+func siteArgs(rawURL string) []string {
+	if handler := siteHandlerFor(rawURL); handler != nil {
+		return handler.args
+	}
+	return nil
+}
+
+// siteFormatFilter devuelve el filtro de formato preferido del sitio ("" si no hay).
+func siteFormatFilter(rawURL string) string {
+	if handler := siteHandlerFor(rawURL); handler != nil {
+		return handler.formatFilter
+	}
+	return ""
+}
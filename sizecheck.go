@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sendLimit es el tamaño máximo que se le puede enviar directamente al
+// usuario: 2GB si es premium y la sesión MTProto está activa y, si no, el
+// límite de la Bot API.
+func (b *DownloadBot) sendLimit(userID int64) int64 {
+	if b.mtproto.available() && b.hasPremiumPerks(userID) {
+		return MaxFileSizeMTProto
+	}
+	return MaxFileSizeBotAPI
+}
+
+// expectedSize busca el tamaño estimado de una opción en la lista de formatos.
+// Devuelve 0 si no se conoce (p. ej. audio en el formato predeterminado).
+func (b *DownloadBot) expectedSize(meta *VideoMetaData, mode, quality string) int64 {
+	for _, opt := range formatOptions(meta, b.cfg().FormatPolicy) {
+		if opt.Mode == mode && opt.Quality == quality {
+			return opt.Size
+		}
+	}
+	return 0
+}
+
+// largestFitting devuelve la resolución más alta cuyo tamaño conocido cabe en el límite.
+func (b *DownloadBot) largestFitting(meta *VideoMetaData, limit int64) (formatOption, bool) {
+	for _, opt := range formatOptions(meta, b.cfg().FormatPolicy) {
+		if opt.Mode == "video" && opt.Size > 0 && opt.Size <= limit {
+			return opt, true
+		}
+	}
+	return formatOption{}, false
+}
+
+// warnIfTooLarge avisa antes de descargar si la opción elegida va a superar el
+// límite de envío, y ofrece la mejor calidad que cabe, descargar igualmente
+// (se entregará como enlace) o volver al menú. Devuelve true si avisó.
+func (b *DownloadBot) warnIfTooLarge(key sessionKey, sess *UserSession, mode, quality string) bool {
+	// Al recodificar o recortar, el tamaño de la fuente no dice nada del resultado
+	if sess.Options.ClipStart > 0 || (mode == "video" && (sess.Options.Downscale > 0 || sess.Options.TargetMB > 0)) {
+		return false
+	}
+	limit := b.sendLimit(key.UserID)
+	size := b.expectedSize(sess.Meta, mode, quality)
+	if size <= limit {
+		return false
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if opt, ok := b.largestFitting(sess.Meta, limit); ok {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📉 "+opt.Label+" (la mejor que cabe)", "dl:video:"+opt.Quality),
+		))
+	} else if ffmpegAvailable.Load() {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📉 Mejor calidad que quepa", "dl:video:fit"),
+		))
+	}
+	rows = append(rows,
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📦 Descargar igualmente", "force:"+mode+":"+quality)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")),
+	)
+
+	text := fmt.Sprintf("⚠️ *Archivo demasiado grande*\n\n%s ocupará unos %s y el límite de envío es %s. Si lo descargas igualmente puede que solo recibas un enlace.",
+		choiceLabel(mode, quality), humanSize(size), humanSize(limit))
+	if limit < MaxFileSizeMTProto && size <= MaxFileSizeMTProto && b.mtproto.available() {
+		text += "\n\n💎 Con /premium recibes archivos de hasta 2 GB directamente en Telegram."
+	}
+	b.editMessageMarkup(key.ChatID, sess.MsgID, text, tgbotapi.NewInlineKeyboardMarkup(rows...))
+	return true
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Segundos que se muestra cada imagen del carrusel en el video
+const slideshowImageSeconds = 3
+
+// Tiempo máximo para montar el video con ffmpeg
+const slideshowTimeout = 5 * time.Minute
+
+var slideshowAudioExts = map[string]bool{".mp3": true, ".m4a": true, ".aac": true, ".opus": true, ".ogg": true}
+
+// isTikTokSlideshow reconoce los posts de fotos de TikTok: por la URL o
+// porque yt-dlp solo encontró la música (no hay formatos de video).
+func isTikTokSlideshow(rawURL string, meta *VideoMetaData) bool {
+	if detectPlatform(rawURL) != "tiktok" {
+		return false
+	}
+	if strings.Contains(rawURL, "/photo/") {
+		return true
+	}
+	if meta == nil || len(meta.Formats) == 0 {
+		return false
+	}
+	for _, f := range meta.Formats {
+		if f.VideoCodec != "" && f.VideoCodec != "none" {
+			return false
+		}
+	}
+	return true
+}
+
+// processSlideshow convierte un carrusel de TikTok en un MP4 que se pueda
+// enviar: imágenes con gallery-dl, música con yt-dlp si gallery-dl no la
+// trae, y ffmpeg para montarlo. Devuelve false si faltan herramientas, para
+// que el llamador muestre el error original.
+func (b *DownloadBot) processSlideshow(key sessionKey, msgID, replyTo int, rawURL string, meta *VideoMetaData) bool {
+	if !ffmpegAvailable.Load() {
+		return false
+	}
+	if _, err := exec.LookPath(galleryDLBin); err != nil {
+		return false
+	}
+	if meta == nil {
+		meta = &VideoMetaData{Title: "TikTok", WebpageURL: rawURL}
+	}
+	sess := &UserSession{Meta: meta, MsgID: msgID, ReplyTo: replyTo}
+	b.state.SaveSession(key, sess)
+	b.schedule(key, sess, func() { b.sendSlideshow(key, sess) })
+	return true
+}
+
+func (b *DownloadBot) sendSlideshow(key sessionKey, sess *UserSession) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	defer b.finishUsageJob(job)
+	defer b.state.DeleteSession(key)
+
+	b.editMessage(chatID, msgID, "🖼 *Descargando las fotos del post...*")
+	dir := filepath.Join(chatDir(chatID), fmt.Sprintf("slideshow_%d_%d_%d", chatID, key.UserID, time.Now().Unix()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Error creando carpeta del carrusel: %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	images, audio, err := b.downloadSlideshow(meta.WebpageURL, dir)
+	if err != nil || len(images) == 0 {
+		b.reportFailure("descarga", key, meta.WebpageURL, fmt.Errorf("carrusel: %v", err))
+		b.editMessage(chatID, msgID, "❌ No se pudieron descargar las fotos de este post.")
+		return
+	}
+
+	b.editMessage(chatID, msgID, fmt.Sprintf("🎞 *Montando el video (%d fotos)...*", len(images)))
+	videoPath := filepath.Join(dir, "slideshow.mp4")
+	if err := assembleSlideshow(images, audio, videoPath); err != nil {
+		b.reportFailure("conversión", key, meta.WebpageURL, err)
+		b.editMessage(chatID, msgID, "❌ No se pudo montar el video con las fotos.")
+		return
+	}
+
+	b.editMessage(chatID, msgID, "📤 *Subiendo a Telegram...*")
+	target := uploadTarget{ChatID: chatID, ReplyTo: sess.ReplyTo, Caption: b.attributionCaption(key.UserID, meta)}
+	if _, err := b.uploadFile(target, videoPath, "", "video", meta); err != nil {
+		b.reportFailure("envío", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando el archivo a Telegram.")
+		return
+	}
+	job.delivered(videoPath)
+	b.deleteMessage(chatID, msgID)
+}
+
+// downloadSlideshow baja las fotos (en orden) y la música del carrusel.
+func (b *DownloadBot) downloadSlideshow(rawURL, dir string) (images []string, audio string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), galleryTimeout)
+	defer cancel()
+	args := append([]string{"--config-ignore", "-D", dir}, b.cookieArgs(rawURL)...)
+	cmd := exec.CommandContext(ctx, galleryDLBin, append(args, rawURL)...)
+	killGroupOnCancel(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, "", fmt.Errorf("gallery-dl: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		switch {
+		case entry.IsDir():
+		case galleryImageExts[ext]:
+			images = append(images, filepath.Join(dir, entry.Name()))
+		case slideshowAudioExts[ext] && audio == "":
+			audio = filepath.Join(dir, entry.Name())
+		}
+	}
+	// gallery-dl numera sin ceros delante: 10 va después de 9, no de 1
+	sort.Slice(images, func(i, j int) bool { return naturalLess(images[i], images[j]) })
+
+	// La música: yt-dlp sí sabe sacarla de los posts de fotos
+	if audio == "" {
+		audioCtx, cancel := context.WithTimeout(context.Background(), b.cfg().DownloadTimeout)
+		defer cancel()
+		template := filepath.Join(dir, "audio.%(ext)s")
+		if err := b.ytdlpCommand(audioCtx, rawURL, "-f", "bestaudio/best", "-o", template, rawURL).Run(); err != nil {
+			log.Printf("⚠️ Carrusel sin música (%s): %v", rawURL, err)
+		} else if matches, _ := filepath.Glob(filepath.Join(dir, "audio.*")); len(matches) > 0 {
+			audio = matches[0]
+		}
+	}
+	return images, audio, nil
+}
+
+// assembleSlideshow monta las fotos en un video vertical de 1080x1920 con la
+// música en bucle hasta que acaban las fotos.
+func assembleSlideshow(images []string, audio, output string) error {
+	listPath := output + ".txt"
+	defer os.Remove(listPath)
+	var list strings.Builder
+	for _, img := range images {
+		fmt.Fprintf(&list, "file '%s'\nduration %d\n", strings.ReplaceAll(img, "'", `'\''`), slideshowImageSeconds)
+	}
+	// El demuxer concat ignora la duración de la última imagen si no se repite
+	fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(images[len(images)-1], "'", `'\''`))
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return err
+	}
+
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", listPath}
+	if audio != "" {
+		args = append(args, "-stream_loop", "-1", "-i", audio)
+	}
+	args = append(args,
+		"-vf", "scale=1080:1920:force_original_aspect_ratio=decrease,pad=1080:1920:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30,format=yuv420p",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23")
+	if audio != "" {
+		args = append(args, "-c:a", "aac", "-b:a", "128k", "-shortest")
+	}
+	args = append(args, "-movflags", "+faststart", output)
+
+	ctx, cancel := context.WithTimeout(context.Background(), slideshowTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, ffmpegBin, args...)
+	killGroupOnCancel(cmd)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if timedOut(ctx) {
+			return errors.New("ffmpeg: tiempo agotado montando el carrusel")
+		}
+		return fmt.Errorf("ffmpeg: %v: %s", err, lastLines(string(out), 5))
+	}
+	return nil
+}
+
+// naturalLess compara nombres de archivo tratando cada tramo de dígitos como
+// un número: "img_2" < "img_10".
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := leadingDigits(a)
+			nb, rb := leadingDigits(b)
+			// Sin ceros a la izquierda, el número más largo es el mayor
+			trimmedA, trimmedB := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(trimmedA) != len(trimmedB) {
+				return len(trimmedA) < len(trimmedB)
+			}
+			if trimmedA != trimmedB {
+				return trimmedA < trimmedB
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// leadingDigits separa los dígitos del principio de s del resto.
+func leadingDigits(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
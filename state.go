@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Las sesiones caducan si el usuario no elige formato en este tiempo
+const sessionTTL = 24 * time.Hour
+
+// Cuánto se recuerda en Redis que un update ya se procesó (Telegram deja de
+// reintentar un webhook mucho antes)
+const updateDedupeTTL = 24 * time.Hour
+
+// StateStore guarda el estado efímero que deben compartir todas las réplicas
+// del bot detrás de un balanceador: las sesiones del teclado de calidades, los
+// updates ya procesados y los contadores para límites de uso. Con una sola
+// instancia basta la implementación en memoria; con varias, Redis.
+type StateStore interface {
+	LoadSession(key sessionKey) (*UserSession, bool)
+	SaveSession(key sessionKey, sess *UserSession)
+	DeleteSession(key sessionKey)
+
+	// MarkUpdate registra el update y devuelve false si ya se había procesado.
+	MarkUpdate(updateID int) bool
+
+	// Incr suma uno al contador y devuelve su valor en la ventana actual;
+	// el contador se reinicia cuando pasa window desde el primer incremento.
+	Incr(counter string, window time.Duration) int64
+	// Count devuelve el valor del contador sin sumar (0 si no existe o caducó).
+	Count(counter string) int64
+
+	// SaveCallbacks guarda durante ttl las acciones de los botones de un menú
+	// por su token; LoadCallback recupera la de un botón pulsado.
+	SaveCallbacks(targets map[string]callbackTarget, ttl time.Duration)
+	LoadCallback(token string) (callbackTarget, bool)
+
+	// SaveAPIJob y LoadAPIJob guardan el estado de las descargas pedidas por
+	// la API REST, que puede actualizar un worker de otro proceso.
+	SaveAPIJob(job *apiJob)
+	LoadAPIJob(id string) (*apiJob, bool)
+}
+
+// openStateStore elige Redis si REDIS_URL está configurada.
+func openStateStore(cfg *Config, updates *updateGuard) (StateStore, error) {
+	if cfg.RedisURL == "" {
+		return newMemoryState(updates), nil
+	}
+	return newRedisState(cfg.RedisURL)
+}
+
+// memoryState es el estado de una instancia única: sesiones en memoria y
+// updates procesados en data/updates.json.
+type memoryState struct {
+	sessions sync.Map // sessionKey -> *storedSession
+	updates  *updateGuard
+	saves    atomic.Int64 // Para purgar las sesiones caducadas de vez en cuando
+
+	mu        sync.Mutex
+	counters  map[string]*windowCounter
+	callbacks map[string]storedCallback
+	apiJobs   map[string]apiJob
+}
+
+// storedSession caduca como en Redis: con varias sesiones por usuario, los
+// menús abandonados se acumularían.
+type storedSession struct {
+	sess    *UserSession
+	expires time.Time
+}
+
+type storedCallback struct {
+	target  callbackTarget
+	expires time.Time
+}
+
+type windowCounter struct {
+	value   int64
+	resetAt time.Time
+}
+
+func newMemoryState(updates *updateGuard) *memoryState {
+	return &memoryState{
+		updates:   updates,
+		counters:  make(map[string]*windowCounter),
+		callbacks: make(map[string]storedCallback),
+		apiJobs:   make(map[string]apiJob),
+	}
+}
+
+func (m *memoryState) LoadSession(key sessionKey) (*UserSession, bool) {
+	val, ok := m.sessions.Load(key)
+	if !ok {
+		return nil, false
+	}
+	stored := val.(*storedSession)
+	if time.Now().After(stored.expires) {
+		m.sessions.Delete(key)
+		return nil, false
+	}
+	return stored.sess, true
+}
+
+func (m *memoryState) SaveSession(key sessionKey, sess *UserSession) {
+	now := time.Now()
+	m.sessions.Store(key, &storedSession{sess: sess, expires: now.Add(sessionTTL)})
+	if m.saves.Add(1)%1000 == 0 {
+		m.sessions.Range(func(k, val any) bool {
+			if now.After(val.(*storedSession).expires) {
+				m.sessions.Delete(k)
+			}
+			return true
+		})
+	}
+}
+
+func (m *memoryState) DeleteSession(key sessionKey) {
+	m.sessions.Delete(key)
+}
+
+func (m *memoryState) MarkUpdate(updateID int) bool {
+	return m.updates.markNew(updateID)
+}
+
+func (m *memoryState) Incr(counter string, window time.Duration) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	c, ok := m.counters[counter]
+	if !ok || now.After(c.resetAt) {
+		// Cada enlace repetido deja su contador: al crecer se olvidan los caducados
+		if !ok && len(m.counters) > 10000 {
+			for name, old := range m.counters {
+				if now.After(old.resetAt) {
+					delete(m.counters, name)
+				}
+			}
+		}
+		c = &windowCounter{resetAt: now.Add(window)}
+		m.counters[counter] = c
+	}
+	c.value++
+	return c.value
+}
+
+func (m *memoryState) Count(counter string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[counter]
+	if !ok || time.Now().After(c.resetAt) {
+		return 0
+	}
+	return c.value
+}
+
+func (m *memoryState) SaveCallbacks(targets map[string]callbackTarget, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	// Al crecer se olvidan los botones caducados
+	if len(m.callbacks) > 10000 {
+		for token, c := range m.callbacks {
+			if now.After(c.expires) {
+				delete(m.callbacks, token)
+			}
+		}
+	}
+	for token, target := range targets {
+		m.callbacks[token] = storedCallback{target: target, expires: now.Add(ttl)}
+	}
+}
+
+func (m *memoryState) LoadCallback(token string) (callbackTarget, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.callbacks[token]
+	if !ok || time.Now().After(c.expires) {
+		return callbackTarget{}, false
+	}
+	return c.target, true
+}
+
+func (m *memoryState) SaveAPIJob(job *apiJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, old := range m.apiJobs {
+		if time.Since(old.Updated) > apiJobTTL {
+			delete(m.apiJobs, id)
+		}
+	}
+	m.apiJobs[job.ID] = *job
+}
+
+func (m *memoryState) LoadAPIJob(id string) (*apiJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.apiJobs[id]
+	if !ok {
+		return nil, false
+	}
+	return &job, true
+}
+
+// redisState comparte el estado entre réplicas. Si Redis falla se registra
+// el error y se actúa de la forma menos dañina (sesión perdida, update
+// procesado), para no bloquear el bot.
+type redisState struct {
+	client *redis.Client
+}
+
+// Prefijo de todas las claves, para poder compartir la base de datos
+const redisKeyPrefix = "tgbot:"
+
+func newRedisState(redisURL string) (*redisState, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL inválida: %w", err)
+	}
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("conectando a Redis: %w", err)
+	}
+	log.Printf("🧠 Estado compartido en Redis (%s)", opts.Addr)
+	return &redisState{client: client}, nil
+}
+
+func sessionRedisKey(key sessionKey) string {
+	return fmt.Sprintf("%ssession:%d:%d:%d", redisKeyPrefix, key.ChatID, key.UserID, key.MsgID)
+}
+
+func (r *redisState) LoadSession(key sessionKey) (*UserSession, bool) {
+	raw, err := r.client.Get(context.Background(), sessionRedisKey(key)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("⚠️ Error leyendo sesión de Redis: %v", err)
+		}
+		return nil, false
+	}
+	var sess UserSession
+	if err := json.Unmarshal(raw, &sess); err != nil {
+		log.Printf("⚠️ Sesión corrupta en Redis: %v", err)
+		return nil, false
+	}
+	return &sess, true
+}
+
+func (r *redisState) SaveSession(key sessionKey, sess *UserSession) {
+	raw, err := json.Marshal(sess)
+	if err != nil {
+		log.Printf("⚠️ Error serializando sesión: %v", err)
+		return
+	}
+	if err := r.client.Set(context.Background(), sessionRedisKey(key), raw, sessionTTL).Err(); err != nil {
+		log.Printf("⚠️ Error guardando sesión en Redis: %v", err)
+	}
+}
+
+func (r *redisState) DeleteSession(key sessionKey) {
+	if err := r.client.Del(context.Background(), sessionRedisKey(key)).Err(); err != nil {
+		log.Printf("⚠️ Error borrando sesión de Redis: %v", err)
+	}
+}
+
+func (r *redisState) MarkUpdate(updateID int) bool {
+	key := redisKeyPrefix + "update:" + strconv.Itoa(updateID)
+	isNew, err := r.client.SetNX(context.Background(), key, 1, updateDedupeTTL).Result()
+	if err != nil {
+		// Mejor arriesgar un duplicado que perder el mensaje del usuario
+		log.Printf("⚠️ Error deduplicando update en Redis: %v", err)
+		return true
+	}
+	return isNew
+}
+
+func (r *redisState) Incr(counter string, window time.Duration) int64 {
+	ctx := context.Background()
+	key := redisKeyPrefix + "counter:" + counter
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Error en contador de Redis: %v", err)
+		return 0
+	}
+	return incr.Val()
+}
+
+func (r *redisState) Count(counter string) int64 {
+	value, err := r.client.Get(context.Background(), redisKeyPrefix+"counter:"+counter).Int64()
+	if err != nil && err != redis.Nil {
+		log.Printf("⚠️ Error leyendo contador de Redis: %v", err)
+	}
+	return value
+}
+
+func (r *redisState) SaveCallbacks(targets map[string]callbackTarget, ttl time.Duration) {
+	ctx := context.Background()
+	pipe := r.client.Pipeline()
+	for token, target := range targets {
+		raw, _ := json.Marshal(target)
+		pipe.Set(ctx, redisKeyPrefix+"callback:"+token, raw, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Error guardando botones en Redis: %v", err)
+	}
+}
+
+func (r *redisState) LoadCallback(token string) (callbackTarget, bool) {
+	raw, err := r.client.Get(context.Background(), redisKeyPrefix+"callback:"+token).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("⚠️ Error leyendo botón de Redis: %v", err)
+		}
+		return callbackTarget{}, false
+	}
+	var target callbackTarget
+	if err := json.Unmarshal(raw, &target); err != nil {
+		return callbackTarget{}, false
+	}
+	return target, true
+}
+
+func (r *redisState) SaveAPIJob(job *apiJob) {
+	raw, _ := json.Marshal(job)
+	if err := r.client.Set(context.Background(), redisKeyPrefix+"apijob:"+job.ID, raw, apiJobTTL).Err(); err != nil {
+		log.Printf("⚠️ Error guardando descarga de la API en Redis: %v", err)
+	}
+}
+
+func (r *redisState) LoadAPIJob(id string) (*apiJob, bool) {
+	raw, err := r.client.Get(context.Background(), redisKeyPrefix+"apijob:"+id).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Printf("⚠️ Error leyendo descarga de la API de Redis: %v", err)
+		}
+		return nil, false
+	}
+	var job apiJob
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, false
+	}
+	return &job, true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Momento del arranque, para el tiempo en marcha de /status
+var startedAt = time.Now()
+
+// lastFailure es el último fallo informado con reportFailure, de cualquier usuario.
+var lastFailure atomic.Pointer[userFailure]
+
+// load devuelve las tareas en marcha, las que esperan un hueco del host y
+// las que esperan detrás de otra de su chat.
+func (s *scheduler) load() (active, waiting, queued int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pending := range s.chats {
+		queued += len(pending)
+	}
+	return s.active, len(s.waiters), queued
+}
+
+// depth devuelve los trabajos de la cola de Redis sin repartir y los que un
+// worker tiene entre manos.
+func (q *jobQueue) depth() (waiting, running int64, err error) {
+	groups, err := q.client.XInfoGroups(context.Background(), jobStream).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, g := range groups {
+		if g.Name == jobGroup {
+			return max(g.Lag, 0), g.Pending, nil
+		}
+	}
+	return 0, 0, nil
+}
+
+// handleStatusCommand informa del estado del bot. Los administradores (o
+// todos, con STATUS_PUBLIC) ven el diagnóstico completo: versiones, colas,
+// descargas en curso, tiempo en marcha y último error.
+func (b *DownloadBot) handleStatusCommand(message *tgbotapi.Message) {
+	chatID := message.Chat.ID
+	admin := message.From != nil && b.cfg().isAdmin(message.From.ID)
+	if !admin && !b.cfg().StatusPublic {
+		status := "✅ Bot funcionando correctamente\n\nEnvía un enlace para descargar contenido."
+		if !ffmpegAvailable.Load() {
+			status += "\n\n⚠️ ffmpeg no disponible: solo se puede descargar audio en su formato original."
+		}
+		b.sendReply(chatID, message.MessageID, status)
+		return
+	}
+
+	report := b.currentHealth()
+	var text strings.Builder
+	text.WriteString("🩺 *Estado del bot*\n\n")
+	if state := b.store.maintenance(); state.Enabled {
+		fmt.Fprintf(&text, "🛠 En mantenimiento desde el %s\n", state.Since.Format("02/01/2006 15:04"))
+	}
+	fmt.Fprintf(&text, "⏱ En marcha desde hace %s\n", time.Since(startedAt).Round(time.Minute))
+	fmt.Fprintf(&text, "📡 Telegram: %s\n", statusMark(report.Telegram))
+	if version := ytdlpVersion(); version != "" {
+		fmt.Fprintf(&text, "🎬 yt-dlp: %s %s\n", statusMark(report.Ytdlp), escapeMarkdown(version))
+	} else {
+		fmt.Fprintf(&text, "🎬 yt-dlp: %s\n", statusMark(report.Ytdlp))
+	}
+	fmt.Fprintf(&text, "🎞 ffmpeg: %s\n", statusMark(report.FFmpeg))
+	if report.DiskFreeMB >= 0 {
+		fmt.Fprintf(&text, "💾 Disco libre: %s\n", humanSize(report.DiskFreeMB*1024*1024))
+	}
+
+	active, waiting, queued := b.scheduler.load()
+	fmt.Fprintf(&text, "\n⚙️ Descargas en curso: %d de %d huecos\n⏳ Esperando hueco: %d · en cola de su chat: %d\n", active, b.scheduler.slots, waiting, queued)
+	if b.queue != nil {
+		if pending, running, err := b.queue.depth(); err == nil {
+			fmt.Fprintf(&text, "👷 Cola de workers: %d pendientes, %d en marcha\n", pending, running)
+		} else {
+			text.WriteString("👷 Cola de workers: no se pudo consultar\n")
+		}
+	}
+
+	if failure := lastFailure.Load(); failure != nil {
+		fmt.Fprintf(&text, "\n❌ Último error (%s):\n%s", failure.At.Format("02/01/2006 15:04"), escapeMarkdown(lastLines(failure.Error, 3)))
+	} else {
+		text.WriteString("\n✅ Sin errores desde el arranque")
+	}
+	b.sendReply(chatID, message.MessageID, text.String())
+}
+
+func statusMark(ok bool) string {
+	if ok {
+		return "✅"
+	}
+	return "❌"
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Límites de los stickers de video de Telegram: WEBM VP9 sin audio, hasta 3
+// segundos y 30 fps, un lado de 512px (el otro menor) y 256 KB
+const (
+	stickerSize        = 512
+	stickerMaxDuration = 3
+	stickerMaxFPS      = 30
+	stickerMaxBytes    = 256 * 1024
+)
+
+// Tasas de bits que se prueban en orden hasta que el sticker cabe en 256 KB;
+// la primera ("") es calidad constante, que en clips sencillos ocupa menos
+var stickerBitrates = []string{"", "600k", "400k", "250k"}
+
+// convertSticker convierte los primeros 3 segundos del video en un sticker de
+// video. Devuelve la ruta del .webm, que sustituye al original.
+func convertSticker(path string) (string, error) {
+	converted := strings.TrimSuffix(path, ".mp4") + ".webm"
+	filter := fmt.Sprintf("scale='if(gte(iw,ih),%d,-2)':'if(gte(iw,ih),-2,%d)',fps=%d", stickerSize, stickerSize, stickerMaxFPS)
+	for _, bitrate := range stickerBitrates {
+		args := []string{"-y", "-i", path,
+			"-t", fmt.Sprint(stickerMaxDuration),
+			"-vf", filter,
+			"-an",
+			"-c:v", "libvpx-vp9", "-deadline", "good", "-cpu-used", "4", "-row-mt", "1",
+		}
+		if bitrate == "" {
+			args = append(args, "-crf", "34", "-b:v", "0")
+		} else {
+			args = append(args, "-b:v", bitrate, "-maxrate", bitrate, "-bufsize", bitrate)
+		}
+		args = append(args, converted)
+		if err := exec.Command(ffmpegBin, args...).Run(); err != nil {
+			os.Remove(converted)
+			return "", fmt.Errorf("ffmpeg: %w", err)
+		}
+		if info, err := os.Stat(converted); err == nil && info.Size() <= stickerMaxBytes {
+			os.Remove(path)
+			return converted, nil
+		}
+	}
+	os.Remove(converted)
+	return "", fmt.Errorf("el sticker no cabe en %d KB", stickerMaxBytes/1024)
+}
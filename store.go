@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Store guarda el estado persistente del bot en un archivo JSON.
+// Todas las operaciones están protegidas por un mutex; cada cambio
+// se escribe a disco de forma atómica (archivo temporal + rename).
+type Store struct {
+	mu   storeLock
+	path string
+	data storeData
+}
+
+type storeData struct {
+	Archive  map[string]ArchiveEntry       `json:"archive"`
+	Autopost AutopostConfig                `json:"autopost"`
+	Settings map[int64]*UserSettings       `json:"settings"`
+	Premium  map[int64]*PremiumEntitlement `json:"premium"`
+	Failures map[string]FailureEntry       `json:"failures"`
+
+	Moderation ModerationState `json:"moderation"`
+	Mirrors    []MirroredPost  `json:"mirrors"`
+
+	// Uso por mes ("2006-01") y usuario
+	Usage map[string]map[int64]*UsageStats `json:"usage"`
+
+	// Invitaciones por usuario invitado
+	Referrals map[int64]Referral `json:"referrals"`
+
+	// Última descarga pedida por cada usuario, para /redo
+	LastDownloads map[int64]LastDownload `json:"last_downloads"`
+
+	// Enlaces guardados con "⭐ Guardar", del más reciente al más antiguo
+	Saved map[int64][]SavedLink `json:"saved"`
+
+	// Usuarios que han escrito al bot en privado, destinatarios de /announce
+	Users map[int64]KnownUser `json:"users"`
+
+	// Descargas en curso por nombre de archivo, para reanudarlas tras un reinicio
+	Jobs map[string]PersistedJob `json:"jobs"`
+
+	// Tráfico por día ("2006-01-02") y usuario, y presupuestos diarios fijados por admins
+	Bandwidth   map[string]map[int64]*DailyBandwidth `json:"bandwidth"`
+	ByteBudgets map[int64]int64                      `json:"byte_budgets"`
+
+	// Usuarios que pasaron el captcha de nuevos usuarios
+	Verified map[int64]time.Time `json:"verified"`
+
+	Maintenance MaintenanceState `json:"maintenance"`
+
+	// Últimos archivos enviados por URL (de cualquier chat), para el modo inline
+	ServedFiles map[string]ServedFile `json:"served_files"`
+}
+
+func openStore(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &s.data); err != nil {
+			return nil, err
+		}
+	}
+
+	s.data.init()
+	s.data.backfillUsers()
+	return s, nil
+}
+
+// init crea los mapas que falten (estado nuevo o de una versión anterior).
+func (d *storeData) init() {
+	if d.Archive == nil {
+		d.Archive = make(map[string]ArchiveEntry)
+	}
+	if d.Settings == nil {
+		d.Settings = make(map[int64]*UserSettings)
+	}
+	if d.Premium == nil {
+		d.Premium = make(map[int64]*PremiumEntitlement)
+	}
+	if d.Failures == nil {
+		d.Failures = make(map[string]FailureEntry)
+	}
+	if d.Usage == nil {
+		d.Usage = make(map[string]map[int64]*UsageStats)
+	}
+	if d.Referrals == nil {
+		d.Referrals = make(map[int64]Referral)
+	}
+	if d.LastDownloads == nil {
+		d.LastDownloads = make(map[int64]LastDownload)
+	}
+	if d.Saved == nil {
+		d.Saved = make(map[int64][]SavedLink)
+	}
+	if d.Users == nil {
+		d.Users = make(map[int64]KnownUser)
+	}
+	if d.Jobs == nil {
+		d.Jobs = make(map[string]PersistedJob)
+	}
+	if d.Bandwidth == nil {
+		d.Bandwidth = make(map[string]map[int64]*DailyBandwidth)
+	}
+	if d.ByteBudgets == nil {
+		d.ByteBudgets = make(map[int64]int64)
+	}
+	if d.Verified == nil {
+		d.Verified = make(map[int64]time.Time)
+	}
+	if d.ServedFiles == nil {
+		d.ServedFiles = make(map[string]ServedFile)
+	}
+	if d.Moderation.BlockedURLs == nil {
+		d.Moderation.BlockedURLs = make(map[string]time.Time)
+	}
+	if d.Moderation.BlockedDomains == nil {
+		d.Moderation.BlockedDomains = make(map[string]time.Time)
+	}
+	if d.Moderation.Banned == nil {
+		d.Moderation.Banned = make(map[int64]time.Time)
+	}
+}
+
+// save escribe el estado a disco. Debe llamarse con s.mu tomado.
+func (s *Store) save() error {
+	if s.mu.shared != nil {
+		return s.mu.shared.save(&s.data)
+	}
+	return writeJSONAtomic(s.path, s.data)
+}
+
+// writeJSONAtomic serializa v en path usando un archivo temporal + rename,
+// para no dejar un archivo a medias si el proceso muere mientras escribe.
+func writeJSONAtomic(path string, v interface{}) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
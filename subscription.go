@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Tiempo durante el que se confía en una verificación positiva de suscripción
+const subscriptionCacheTTL = 10 * time.Minute
+
+// pendingLink es un enlace retenido hasta que el usuario se suscriba al canal.
+type pendingLink struct {
+	Message *tgbotapi.Message
+	URL     string
+}
+
+// subscriptionChannelConfig traduce el canal configurado (@usuario o ID) al
+// formato que espera getChatMember.
+func (b *DownloadBot) subscriptionChannelConfig(userID int64) tgbotapi.GetChatMemberConfig {
+	config := tgbotapi.GetChatMemberConfig{}
+	config.UserID = userID
+	if id, err := strconv.ParseInt(b.cfg().ForceSubChannel, 10, 64); err == nil {
+		config.ChatID = id
+	} else {
+		config.SuperGroupUsername = "@" + strings.TrimPrefix(b.cfg().ForceSubChannel, "@")
+	}
+	return config
+}
+
+// isSubscribed comprueba si el usuario pertenece al canal obligatorio.
+// Si la comprobación falla por un error de la API se deja pasar al usuario,
+// para no bloquear el bot por un problema de configuración.
+func (b *DownloadBot) isSubscribed(userID int64) bool {
+	if b.cfg().ForceSubChannel == "" || b.cfg().isAdmin(userID) {
+		return true
+	}
+	if until, ok := b.memberCache.Load(userID); ok && time.Now().Before(until.(time.Time)) {
+		return true
+	}
+
+	member, err := b.bot.GetChatMember(b.subscriptionChannelConfig(userID))
+	if err != nil {
+		log.Printf("⚠️ Error comprobando suscripción de %d: %v", userID, err)
+		return true
+	}
+
+	subscribed := member.IsCreator() || member.IsAdministrator() || member.Status == "member" ||
+		(member.Status == "restricted" && member.IsMember)
+	if subscribed {
+		b.memberCache.Store(userID, time.Now().Add(subscriptionCacheTTL))
+	}
+	return subscribed
+}
+
+func (b *DownloadBot) subscriptionJoinURL() string {
+	if b.cfg().ForceSubURL != "" {
+		return b.cfg().ForceSubURL
+	}
+	return "https://t.me/" + strings.TrimPrefix(b.cfg().ForceSubChannel, "@")
+}
+
+// requireSubscription retiene el enlace y muestra el botón "Unirse + Verificar"
+// si el usuario aún no está suscrito. Devuelve true si puede continuar.
+func (b *DownloadBot) requireSubscription(message *tgbotapi.Message, url string) bool {
+	if message.From == nil || b.isSubscribed(message.From.ID) {
+		return true
+	}
+
+	key := sessionKey{ChatID: message.Chat.ID, UserID: message.From.ID}
+	b.pendingLinks.Store(key, &pendingLink{Message: message, URL: url})
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("📢 Unirse al canal", b.subscriptionJoinURL()),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ Ya me uní, verificar", "verify_sub"),
+		),
+	)
+	msg := tgbotapi.NewMessage(message.Chat.ID, "🔒 *Para usar el bot debes unirte a nuestro canal.*\n\nÚnete y pulsa *Verificar* para continuar con tu enlace.")
+	msg.ParseMode = "Markdown"
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = keyboard
+	b.bot.Send(msg)
+	return false
+}
+
+func (b *DownloadBot) handleVerifySubscription(cb *tgbotapi.CallbackQuery) {
+	if !b.isSubscribed(cb.From.ID) {
+		b.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "❌ Todavía no te has unido al canal."))
+		return
+	}
+	b.bot.Request(tgbotapi.NewCallback(cb.ID, "✅ Verificado"))
+
+	chatID := cb.Message.Chat.ID
+	b.deleteMessage(chatID, cb.Message.MessageID)
+
+	key := sessionKey{ChatID: chatID, UserID: cb.From.ID}
+	if val, ok := b.pendingLinks.LoadAndDelete(key); ok {
+		pending := val.(*pendingLink)
+		b.processLink(pending.Message, pending.URL)
+		return
+	}
+	b.sendMessage(chatID, "✅ ¡Gracias por unirte! Ya puedes enviar tus enlaces.")
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Formas de entregar los subtítulos con el video
+const (
+	subModeEmbed = "embed" // Pista de subtítulos en el MP4, se activa en el reproductor
+	subModeBurn  = "burn"  // Dibujados en la imagen (hay que recodificar)
+)
+
+// Máximo de idiomas en el menú: los automáticos de YouTube incluyen
+// traducciones a más de cien idiomas
+const maxSubtitleButtons = 12
+
+// subtitleTrack es un idioma de subtítulos disponible para el video.
+type subtitleTrack struct {
+	Lang string
+	Auto bool // Generados automáticamente
+}
+
+func (t subtitleTrack) label() string {
+	label := languageLabel(strings.TrimSuffix(t.Lang, "-orig"))
+	if t.Auto {
+		label += " (auto)"
+	}
+	return label
+}
+
+// subtitleTracks lista primero los subtítulos subidos por el autor y después
+// los automáticos del idioma original y de los idiomas que conocemos.
+func subtitleTracks(meta *VideoMetaData) []subtitleTrack {
+	var tracks []subtitleTrack
+	for _, lang := range sortedKeys(meta.Subtitles) {
+		if lang != "live_chat" {
+			tracks = append(tracks, subtitleTrack{Lang: lang})
+		}
+	}
+	for _, lang := range sortedKeys(meta.AutomaticCaptions) {
+		if _, manual := meta.Subtitles[lang]; manual {
+			continue
+		}
+		if _, known := languageNames[lang]; known || strings.HasSuffix(lang, "-orig") {
+			tracks = append(tracks, subtitleTrack{Lang: lang, Auto: true})
+		}
+	}
+	if len(tracks) > maxSubtitleButtons {
+		tracks = tracks[:maxSubtitleButtons]
+	}
+	return tracks
+}
+
+func sortedKeys(m map[string][]SubtitleFormat) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// subtitleArgs pide a yt-dlp los subtítulos del idioma elegido en SRT y, si
+// van como pista, que los incruste en el MP4.
+func subtitleArgs(opts downloadOptions) []string {
+	args := []string{"--write-subs", "--write-auto-subs", "--sub-langs", opts.SubLang, "--convert-subs", "srt"}
+	if opts.SubMode == subModeEmbed {
+		args = append(args, "--embed-subs")
+	}
+	return args
+}
+
+// burnSubtitles dibuja los subtítulos en la imagen, reemplazando el archivo.
+func burnSubtitles(path, subPath string) error {
+	converted := path + ".subs.mp4"
+	cmd := exec.Command(ffmpegBin, "-y", "-i", path,
+		"-vf", "subtitles="+subPath,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-c:a", "copy",
+		"-movflags", "+faststart",
+		converted)
+	if err := cmd.Run(); err != nil {
+		os.Remove(converted)
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(converted, path)
+}
+
+// subtitleMenuKeyboard lista los idiomas disponibles.
+func subtitleMenuKeyboard(tracks []subtitleTrack, opts downloadOptions) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i := 0; i < len(tracks); i += 2 {
+		var row []tgbotapi.InlineKeyboardButton
+		for _, track := range tracks[i:min(i+2, len(tracks))] {
+			label := track.label()
+			if track.Lang == opts.SubLang {
+				label = "✅ " + label
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(label, "sub:"+track.Lang))
+		}
+		rows = append(rows, row)
+	}
+	if opts.SubLang != "" {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🚫 Sin subtítulos", "sub:off")))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// subtitleModeKeyboard ofrece qué hacer con el idioma elegido.
+func subtitleModeKeyboard(lang string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("📄 Solo el archivo .srt", "sub:"+lang+":file")),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🎬 Video con subtítulos (pista)", "sub:"+lang+":"+subModeEmbed)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🔥 Video con subtítulos quemados", "sub:"+lang+":"+subModeBurn)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "sub:menu")),
+	)
+}
+
+// subtitleChoiceLabel describe la elección actual para el botón del teclado.
+func subtitleChoiceLabel(opts downloadOptions) string {
+	how := "pista"
+	if opts.SubMode == subModeBurn {
+		how = "quemados"
+	}
+	return fmt.Sprintf("%s, %s", languageLabel(strings.TrimSuffix(opts.SubLang, "-orig")), how)
+}
+
+// handleSubtitleCallback gestiona "sub:menu", "sub:off", "sub:<idioma>" y
+// "sub:<idioma>:<file|embed|burn>".
+func (b *DownloadBot) handleSubtitleCallback(key sessionKey, sess *UserSession, args []string) {
+	chatID, msgID := key.ChatID, sess.MsgID
+	switch {
+	case args[0] == "menu":
+		b.editMessageMarkup(chatID, msgID, "💬 *Subtítulos*\n\nElige el idioma:", subtitleMenuKeyboard(subtitleTracks(sess.Meta), sess.Options))
+	case args[0] == "off":
+		sess.Options.SubLang, sess.Options.SubMode = "", ""
+		b.state.SaveSession(key, sess)
+		b.editMessageMarkup(chatID, msgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+	case len(args) == 1:
+		b.editMessageMarkup(chatID, msgID, fmt.Sprintf("💬 *Subtítulos: %s*\n\n¿Cómo los quieres?", languageLabel(strings.TrimSuffix(args[0], "-orig"))), subtitleModeKeyboard(args[0]))
+	case args[1] == "file":
+		go b.sendSubtitleFile(key, sess, args[0], "srt")
+	default:
+		// Se recuerdan en la sesión y se aplican al elegir la calidad del video
+		sess.Options.SubLang, sess.Options.SubMode = args[0], args[1]
+		b.state.SaveSession(key, sess)
+		b.editMessageMarkup(chatID, msgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+	}
+}
+
+// fetchSubtitle descarga solo los subtítulos de un idioma en SRT y devuelve la ruta.
+func (b *DownloadBot) fetchSubtitle(chatID int64, meta *VideoMetaData, lang, fileName string) (string, error) {
+	base := filepath.Join(chatDir(chatID), fileName)
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().ProbeTimeout)
+	defer cancel()
+	cmd := b.ytdlpCommand(ctx, meta.WebpageURL,
+		"--skip-download",
+		"--write-subs", "--write-auto-subs",
+		"--sub-langs", lang,
+		"--convert-subs", "srt",
+		"-o", base+".%(ext)s",
+		meta.WebpageURL)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("yt-dlp: %w: %s", err, lastLines(string(out), 3))
+	}
+	path := base + "." + lang + ".srt"
+	if _, err := os.Stat(path); err != nil {
+		return "", errors.New("yt-dlp no escribió los subtítulos")
+	}
+	return path, nil
+}
+
+// sendSubtitleFile envía los subtítulos como documento, en SRT o como texto
+// plano ("txt"), y deja el teclado como estaba por si el usuario también
+// quiere el video.
+func (b *DownloadBot) sendSubtitleFile(key sessionKey, sess *UserSession, lang, format string) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	b.editMessage(chatID, msgID, "💬 *Descargando subtítulos...*")
+	defer b.editMessageMarkup(chatID, msgID, infoCard(meta), b.createQualityKeyboard(key, meta, 0))
+
+	fileName := fmt.Sprintf("sub_%d_%d_%d", chatID, key.UserID, time.Now().Unix())
+	path, err := b.fetchSubtitle(chatID, meta, lang, fileName)
+	if err != nil {
+		b.reportFailure("subtítulos", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ No se pudieron descargar los subtítulos.")
+		return
+	}
+	defer os.Remove(path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error leyendo subtítulos: %v", err)
+		return
+	}
+	caption := "💬 " + meta.Title
+	if format == "txt" {
+		data, caption = []byte(srtToText(string(data))), "📝 Transcripción: "+meta.Title
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: sanitizeFileName(meta.Title) + "." + lang + "." + format, Bytes: data})
+	doc.Caption = caption
+	doc.ReplyToMessageID = sess.ReplyTo
+	if _, err := b.bot.Send(doc); err != nil {
+		b.reportFailure("envío", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando el archivo a Telegram.")
+	}
+}
+
+// transcriptTrack elige los subtítulos para la transcripción: los del autor
+// o, si no hay, los automáticos del idioma original.
+func transcriptTrack(meta *VideoMetaData) (subtitleTrack, bool) {
+	tracks := subtitleTracks(meta)
+	if len(tracks) == 0 {
+		return subtitleTrack{}, false
+	}
+	for _, track := range tracks {
+		if !track.Auto || strings.HasSuffix(track.Lang, "-orig") {
+			return track, true
+		}
+	}
+	return tracks[0], true
+}
+
+// transcriptKeyboard ofrece la transcripción como texto plano o con tiempos.
+func transcriptKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📄 Texto (.txt)", "tr:txt"),
+			tgbotapi.NewInlineKeyboardButtonData("⏱ Con tiempos (.srt)", "tr:srt"),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("◀️ Volver", "page:0")),
+	)
+}
+
+// handleTranscriptCallback gestiona "tr:menu" y "tr:<txt|srt>".
+func (b *DownloadBot) handleTranscriptCallback(key sessionKey, sess *UserSession, format string) {
+	track, ok := transcriptTrack(sess.Meta)
+	if !ok {
+		if !b.whisperEnabled() {
+			b.editMessageMarkup(key.ChatID, sess.MsgID, infoCard(sess.Meta), b.createQualityKeyboard(key, sess.Meta, 0))
+			return
+		}
+		// Sin subtítulos: se transcribe el audio con whisper
+		if format == "menu" {
+			b.editMessageMarkup(key.ChatID, sess.MsgID, "🗣 *Transcripción automática*\n\nEl video no tiene subtítulos: se transcribirá el audio, lo que puede tardar varios minutos. ¿En qué formato?", transcriptKeyboard())
+			return
+		}
+		b.schedule(key, sess, func() { b.whisperTranscript(key, sess, format) })
+		return
+	}
+	if format == "menu" {
+		b.editMessageMarkup(key.ChatID, sess.MsgID, fmt.Sprintf("📝 *Transcripción* (%s)\n\n¿En qué formato?", track.label()), transcriptKeyboard())
+		return
+	}
+	go b.sendSubtitleFile(key, sess, track.Lang, format)
+}
+
+// srtToText deja solo el texto de un SRT: sin números, tiempos ni etiquetas,
+// y sin las líneas repetidas de los subtítulos automáticos (que van subiendo
+// de una en una).
+func srtToText(srt string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(srt, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(htmlTagPattern.ReplaceAllString(line, ""))
+		if line == "" || strings.Contains(line, "-->") || isDigits(line) {
+			continue
+		}
+		if len(lines) > 0 && lines[len(lines)-1] == line {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram reduce las fotos a 2560px y no acepta más de 10 MB: por encima se
+// envía como documento para conservar la imagen original
+const (
+	maxPhotoSide  = 2560
+	maxPhotoBytes = 10 * 1024 * 1024
+)
+
+// Tope de lo que se baja de una miniatura: ninguna portada real se le acerca
+const maxThumbnailBytes = 20 * 1024 * 1024
+
+// thumbnailClient solo se conecta a direcciones públicas: las URL de las
+// miniaturas vienen del sitio y no deben poder apuntar a la red interna del
+// servidor (ni directamente ni con una redirección o un DNS que cambie).
+var thumbnailClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("dirección no pública: %s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 || !webURL(req.URL) {
+			return errors.New("redirección no permitida")
+		}
+		return nil
+	},
+}
+
+// publicIP descarta loopback, redes privadas, link-local y similares.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsUnspecified() && !ip.IsMulticast() && !ip.IsInterfaceLocalMulticast()
+}
+
+// webURL dice si la URL es http(s) con host.
+func webURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != ""
+}
+
+// Thumbnail es una de las miniaturas que lista yt-dlp para un contenido.
+type Thumbnail struct {
+	URL        string `json:"url"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Preference int    `json:"preference"`
+}
+
+// thumbnailCandidates ordena las miniaturas de la más grande a la más
+// pequeña. yt-dlp las lista de peor a mejor, así que las que no indican
+// tamaño se prueban en orden inverso, y al final va la que eligió yt-dlp.
+func thumbnailCandidates(meta *VideoMetaData) []string {
+	thumbs := make([]Thumbnail, 0, len(meta.Thumbnails))
+	for i := len(meta.Thumbnails) - 1; i >= 0; i-- {
+		if meta.Thumbnails[i].URL != "" {
+			thumbs = append(thumbs, meta.Thumbnails[i])
+		}
+	}
+	sort.SliceStable(thumbs, func(i, j int) bool {
+		return thumbs[i].Width*thumbs[i].Height > thumbs[j].Width*thumbs[j].Height
+	})
+	urls := make([]string, 0, len(thumbs)+1)
+	for _, thumb := range thumbs {
+		urls = append(urls, thumb.URL)
+	}
+	if meta.Thumbnail != "" {
+		urls = append(urls, meta.Thumbnail)
+	}
+	return urls
+}
+
+// fetchThumbnail baja la primera miniatura que responda: las de máxima
+// resolución no siempre existen (p. ej. maxresdefault en YouTube).
+func (b *DownloadBot) fetchThumbnail(meta *VideoMetaData, pathNoExt string) (string, error) {
+	for _, rawURL := range thumbnailCandidates(meta) {
+		if u, err := url.Parse(rawURL); err != nil || !webURL(u) {
+			continue
+		}
+		resp, err := thumbnailClient.Get(rawURL)
+		if err != nil {
+			continue
+		}
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+			resp.Body.Close()
+			continue
+		}
+		ext := strings.TrimPrefix(resp.Header.Get("Content-Type"), "image/")
+		if ext == "jpeg" {
+			ext = "jpg"
+		}
+		path := pathNoExt + "." + ext
+		out, err := os.Create(path)
+		if err != nil {
+			resp.Body.Close()
+			return "", err
+		}
+		n, err := io.Copy(out, io.LimitReader(resp.Body, maxThumbnailBytes+1))
+		resp.Body.Close()
+		out.Close()
+		if err != nil || n > maxThumbnailBytes {
+			os.Remove(path)
+			continue
+		}
+		return path, nil
+	}
+	return "", errors.New("sin miniaturas disponibles")
+}
+
+// handleThumbnailCallback lanza el envío de la miniatura una sola vez por
+// menú y dentro del planificador, como las demás tareas del usuario.
+func (b *DownloadBot) handleThumbnailCallback(key sessionKey, sess *UserSession) {
+	// Un doble toque no baja dos veces la miniatura
+	if b.state.Incr(fmt.Sprintf("thumb:%d:%d", key.ChatID, sess.MsgID), selectionDedupeTTL) > 1 {
+		return
+	}
+	b.schedule(key, sess, func() { b.sendThumbnail(key, sess) })
+}
+
+// sendThumbnail envía la miniatura o portada de mayor resolución: como foto
+// si Telegram no la reduce y, si no, como documento. El menú sigue abierto.
+func (b *DownloadBot) sendThumbnail(key sessionKey, sess *UserSession) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	b.editMessage(chatID, msgID, "🖼 *Buscando la miniatura...*")
+	defer b.editMessageMarkup(chatID, msgID, infoCard(meta), b.createQualityKeyboard(key, meta, 0))
+
+	pathNoExt := filepath.Join(chatDir(chatID), fmt.Sprintf("thumb_%d_%d_%d", chatID, key.UserID, time.Now().Unix()))
+	path, err := b.fetchThumbnail(meta, pathNoExt)
+	if err != nil {
+		b.reportFailure("miniatura", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ No se pudo descargar la miniatura.")
+		return
+	}
+	defer os.Remove(path)
+
+	// Telegram no muestra WebP como foto: se pasa a JPG si hay ffmpeg
+	if strings.HasSuffix(path, ".webp") && ffmpegAvailable.Load() {
+		converted := pathNoExt + ".jpg"
+		if err := exec.Command(ffmpegBin, "-y", "-i", path, "-q:v", "2", converted).Run(); err == nil {
+			os.Remove(path)
+			path = converted
+		} else {
+			os.Remove(converted)
+		}
+	}
+
+	asPhoto := false
+	if f, err := os.Open(path); err == nil {
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		info, statErr := os.Stat(path)
+		asPhoto = err == nil && statErr == nil && config.Width <= maxPhotoSide && config.Height <= maxPhotoSide && info.Size() <= maxPhotoBytes
+	}
+
+	caption := "🖼 " + meta.Title
+	var msg tgbotapi.Chattable
+	if asPhoto {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(path))
+		photo.Caption = caption
+		photo.ReplyToMessageID = sess.ReplyTo
+		msg = photo
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.sendReply(chatID, sess.ReplyTo, "❌ No se pudo descargar la miniatura.")
+			return
+		}
+		doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: sanitizeFileName(meta.Title) + filepath.Ext(path), Bytes: data})
+		doc.Caption = caption
+		doc.ReplyToMessageID = sess.ReplyTo
+		msg = doc
+	}
+	if _, err := b.bot.Send(msg); err != nil {
+		b.reportFailure("envío", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando el archivo a Telegram.")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Cuánto se recuerda el tema de un mensaje (lo que vive un menú de calidades)
+const topicTTL = 2 * sessionTTL
+
+// En los supergrupos con temas (foros) cada mensaje pertenece a un hilo,
+// message_thread_id. La versión de tgbotapi que usamos no conoce el campo, así
+// que se recuerda aparte el tema de cada mensaje (los que llegan y los que
+// envía el bot) y topicClient lo añade a los envíos que responden a uno de
+// ellos. Así el estado y los archivos vuelven al tema de la petición en vez
+// de acabar en el General. Los envíos que no responden a nada (avisos, el
+// mensaje de /start...) van al tema de la última petición del chat.
+type topicKey struct {
+	chatID int64
+	msgID  int
+}
+
+type topicEntry struct {
+	thread int
+	seen   time.Time
+}
+
+var topics = struct {
+	sync.Mutex
+	threads map[topicKey]topicEntry
+	// Tema de la última petición recibida en cada chat (0 = General)
+	requests map[int64]topicEntry
+}{threads: make(map[topicKey]topicEntry), requests: make(map[int64]topicEntry)}
+
+// rememberThread apunta que el mensaje está en el tema thread (0 = sin tema).
+func rememberThread(chatID int64, msgID, thread int) {
+	if thread == 0 || msgID == 0 {
+		return
+	}
+	topics.Lock()
+	defer topics.Unlock()
+	now := time.Now()
+	if len(topics.threads) > 10000 {
+		for key, entry := range topics.threads {
+			if now.Sub(entry.seen) > topicTTL {
+				delete(topics.threads, key)
+			}
+		}
+	}
+	topics.threads[topicKey{chatID, msgID}] = topicEntry{thread: thread, seen: now}
+}
+
+// rememberRequestThread apunta el tema de la última petición del chat; un
+// mensaje en el General lo devuelve a 0.
+func rememberRequestThread(chatID int64, thread int) {
+	topics.Lock()
+	defer topics.Unlock()
+	now := time.Now()
+	if len(topics.requests) > 10000 {
+		for chat, entry := range topics.requests {
+			if now.Sub(entry.seen) > topicTTL {
+				delete(topics.requests, chat)
+			}
+		}
+	}
+	topics.requests[chatID] = topicEntry{thread: thread, seen: now}
+}
+
+// requestThreadFor devuelve el tema de la última petición del chat.
+func requestThreadFor(chatID int64) int {
+	topics.Lock()
+	defer topics.Unlock()
+	entry, ok := topics.requests[chatID]
+	if !ok || time.Since(entry.seen) > topicTTL {
+		return 0
+	}
+	return entry.thread
+}
+
+// threadFor devuelve el tema del mensaje, o 0 si no está en ninguno.
+func threadFor(chatID int64, msgID int) int {
+	topics.Lock()
+	defer topics.Unlock()
+	entry, ok := topics.threads[topicKey{chatID, msgID}]
+	if !ok || time.Since(entry.seen) > topicTTL {
+		return 0
+	}
+	return entry.thread
+}
+
+// topicMessage son los campos de un mensaje que tgbotapi descarta.
+type topicMessage struct {
+	MessageID int `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	ThreadID int  `json:"message_thread_id"`
+	IsTopic  bool `json:"is_topic_message"`
+}
+
+func (m *topicMessage) remember() {
+	if m != nil && m.IsTopic {
+		rememberThread(m.Chat.ID, m.MessageID, m.ThreadID)
+	}
+}
+
+// rememberRequest apunta además el mensaje como la última petición del chat.
+func (m *topicMessage) rememberRequest() {
+	if m == nil {
+		return
+	}
+	m.remember()
+	thread := 0
+	if m.IsTopic {
+		thread = m.ThreadID
+	}
+	rememberRequestThread(m.Chat.ID, thread)
+}
+
+// noteTopics lee el tema de los mensajes de un update en crudo.
+func noteTopics(raw []byte) {
+	var update struct {
+		Message       *topicMessage `json:"message"`
+		EditedMessage *topicMessage `json:"edited_message"`
+		CallbackQuery *struct {
+			Message *topicMessage `json:"message"`
+		} `json:"callback_query"`
+	}
+	if json.Unmarshal(raw, &update) != nil {
+		return
+	}
+	update.Message.rememberRequest()
+	update.EditedMessage.rememberRequest()
+	if update.CallbackQuery != nil {
+		update.CallbackQuery.Message.rememberRequest()
+	}
+}
+
+// topicClient envuelve el cliente HTTP de la Bot API: a los envíos que
+// responden a un mensaje de un tema les añade message_thread_id (a los que no
+// responden a nada, el de la última petición del chat), y apunta el tema de
+// los mensajes que devuelve Telegram para las respuestas siguientes.
+type topicClient struct {
+	base tgbotapi.HTTPClient
+}
+
+func (c *topicClient) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	if !strings.HasPrefix(method, "send") && method != "copyMessage" {
+		return c.base.Do(req)
+	}
+	chatID, replyTo := requestTarget(req)
+	thread := threadFor(chatID, replyTo)
+	if replyTo == 0 {
+		thread = requestThreadFor(chatID)
+	}
+	if thread != 0 {
+		addThreadParam(req, thread)
+	}
+
+	resp, err := c.base.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return resp, nil
+	}
+	noteSentTopics(raw, chatID, thread)
+	return resp, nil
+}
+
+// noteSentTopics apunta el tema de los mensajes enviados: el que indica
+// Telegram o, si no lo devuelve (copyMessage), el que se pidió.
+func noteSentTopics(raw []byte, chatID int64, thread int) {
+	var single struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if json.Unmarshal(raw, &single) != nil {
+		return
+	}
+	var sent []*topicMessage
+	if json.Unmarshal(single.Result, &sent) != nil {
+		var one topicMessage
+		if json.Unmarshal(single.Result, &one) != nil {
+			return
+		}
+		sent = []*topicMessage{&one}
+	}
+	for _, m := range sent {
+		if m.IsTopic {
+			m.remember()
+		} else {
+			rememberThread(chatID, m.MessageID, thread)
+		}
+	}
+}
+
+// requestTarget lee chat_id y reply_to_message_id del cuerpo del envío sin
+// consumirlo: los formularios se releen con GetBody; en los multipart (las
+// subidas) los campos van antes que los archivos y basta leer el principio.
+func requestTarget(req *http.Request) (chatID int64, replyTo int) {
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	fields := map[string]string{}
+	switch {
+	case mediaType == "application/x-www-form-urlencoded" && req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return 0, 0
+		}
+		raw, _ := io.ReadAll(body)
+		values, _ := url.ParseQuery(string(raw))
+		fields["chat_id"], fields["reply_to_message_id"] = values.Get("chat_id"), values.Get("reply_to_message_id")
+	case mediaType == "multipart/form-data":
+		var consumed bytes.Buffer
+		reader := multipart.NewReader(io.TeeReader(req.Body, &consumed), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil || part.FileName() != "" {
+				break
+			}
+			value, _ := io.ReadAll(io.LimitReader(part, 64))
+			fields[part.FormName()] = string(value)
+		}
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(&consumed, req.Body), req.Body}
+	}
+	chatID, _ = strconv.ParseInt(fields["chat_id"], 10, 64)
+	replyTo, _ = strconv.Atoi(fields["reply_to_message_id"])
+	return chatID, replyTo
+}
+
+// addThreadParam añade message_thread_id a la petición: al formulario o, en
+// los multipart, a la URL (la Bot API junta ambos).
+func addThreadParam(req *http.Request, thread int) {
+	param := "message_thread_id=" + strconv.Itoa(thread)
+	if req.GetBody == nil {
+		req.URL.RawQuery = param
+		return
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return
+	}
+	raw, _ := io.ReadAll(body)
+	raw = append(raw, "&"+param...)
+	req.Body = io.NopCloser(bytes.NewReader(raw))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(raw)), nil }
+	req.ContentLength = int64(len(raw))
+}
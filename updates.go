@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+)
+
+// Cantidad de IDs recientes que se recuerdan para detectar reenvíos
+const updateGuardWindow = 500
+
+// updateGuard recuerda qué updates de Telegram ya se procesaron. Telegram
+// reintenta los webhooks que no recibieron respuesta (p. ej. tras una caída),
+// así que un update puede llegar dos veces; sin este filtro el usuario
+// recibiría descargas duplicadas.
+type updateGuard struct {
+	mu   sync.Mutex
+	path string
+	seen map[int]bool
+	data updateGuardData
+}
+
+type updateGuardData struct {
+	// Todo update con ID menor que el más antiguo de Recent ya se procesó
+	Recent []int `json:"recent"`
+}
+
+func openUpdateGuard(path string) (*updateGuard, error) {
+	g := &updateGuard{path: path, seen: make(map[int]bool)}
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &g.data); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range g.data.Recent {
+		g.seen[id] = true
+	}
+	return g, nil
+}
+
+// markNew registra el update y devuelve false si ya se había procesado.
+func (g *updateGuard) markNew(updateID int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seen[updateID] {
+		return false
+	}
+	if len(g.data.Recent) >= updateGuardWindow && updateID < g.data.Recent[0] {
+		return false
+	}
+
+	g.seen[updateID] = true
+	g.data.Recent = append(g.data.Recent, updateID)
+	if len(g.data.Recent) > updateGuardWindow {
+		delete(g.seen, g.data.Recent[0])
+		g.data.Recent = g.data.Recent[1:]
+	}
+
+	if err := writeJSONAtomic(g.path, g.data); err != nil {
+		log.Printf("⚠️ Error guardando updates procesados: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// uploaderBot es uno de los bots que pueden subir archivos. El principal
+// envía directamente; los auxiliares suben al canal de almacén y el principal
+// copia el mensaje al usuario (que no tiene por qué haber iniciado los auxiliares).
+type uploaderBot struct {
+	api        *tgbotapi.BotAPI
+	main       bool
+	active     int       // Subidas en curso
+	floodUntil time.Time // Telegram pidió esperar (429) hasta entonces
+}
+
+// uploaderPool reparte las subidas entre el bot principal y los auxiliares
+// (UPLOAD_BOT_TOKENS) para subir varios archivos a la vez sin que el límite
+// de envíos de un solo bot frene a todos.
+type uploaderPool struct {
+	mu      sync.Mutex
+	bots    []*uploaderBot
+	storage int64 // Canal de almacén para los auxiliares (0 = solo el principal)
+}
+
+// newUploaderPool conecta los bots auxiliares. Los tokens inválidos se
+// descartan con un aviso; sin canal de almacén no se usan auxiliares.
+func (b *DownloadBot) newUploaderPool() *uploaderPool {
+	pool := &uploaderPool{bots: []*uploaderBot{{api: b.bot.BotAPI, main: true}}}
+	if len(b.cfg().UploadBotTokens) == 0 {
+		return pool
+	}
+	if b.cfg().UploadStorageChannel == "" {
+		log.Printf("⚠️ UPLOAD_BOT_TOKENS necesita un canal de almacén (UPLOAD_STORAGE_CHANNEL): solo se usará el bot principal")
+		return pool
+	}
+	storage, err := b.resolveChannel(b.cfg().UploadStorageChannel)
+	if err != nil {
+		log.Printf("⚠️ El bot no accede al canal de almacén %s: %v", b.cfg().UploadStorageChannel, err)
+		return pool
+	}
+	pool.storage = storage.ID
+	for _, token := range b.cfg().UploadBotTokens {
+		api, err := tgbotapi.NewBotAPI(token)
+		if err != nil {
+			log.Printf("⚠️ Token de bot de subida inválido: %v", err)
+			continue
+		}
+		pool.bots = append(pool.bots, &uploaderBot{api: api})
+		log.Printf("📤 Bot de subida auxiliar: @%s", api.Self.UserName)
+	}
+	return pool
+}
+
+// acquire elige el bot con menos subidas en curso que no esté penalizado.
+// Si todos lo están, el principal (Telegram hará esperar igualmente).
+func (p *uploaderPool) acquire() *uploaderBot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *uploaderBot
+	for _, u := range p.bots {
+		if time.Now().Before(u.floodUntil) {
+			continue
+		}
+		if best == nil || u.active < best.active {
+			best = u
+		}
+	}
+	if best == nil {
+		best = p.bots[0]
+	}
+	best.active++
+	return best
+}
+
+func (p *uploaderPool) acquireMain() *uploaderBot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bots[0].active++
+	return p.bots[0]
+}
+
+func (p *uploaderPool) release(u *uploaderBot, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u.active--
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		u.floodUntil = time.Now().Add(time.Duration(apiErr.RetryAfter) * time.Second)
+		log.Printf("⏳ @%s limitado por Telegram durante %ds", u.api.Self.UserName, apiErr.RetryAfter)
+	}
+}
+
+// sendUpload sube el mensaje que construye build con el bot menos ocupado.
+// build recibe el chat y la respuesta de destino porque los auxiliares envían
+// al almacén, y devuelve también cómo cerrar el archivo abierto. Si un
+// auxiliar falla, se reintenta con el principal.
+func (b *DownloadBot) sendUpload(target uploadTarget, build func(chatID int64, replyTo int) (tgbotapi.Chattable, func())) (tgbotapi.Message, error) {
+	u := b.uploaders.acquire()
+	if !u.main {
+		sent, err := b.uploadViaHelper(u, target, build)
+		b.uploaders.release(u, err)
+		if err == nil {
+			return sent, nil
+		}
+		log.Printf("⚠️ Error subiendo con @%s, se usa el bot principal: %v", u.api.Self.UserName, err)
+		u = b.uploaders.acquireMain()
+	}
+
+	msg, done := build(target.ChatID, target.ReplyTo)
+	defer done()
+	sent, err := b.bot.Send(msg)
+	b.uploaders.release(u, err)
+	return sent, err
+}
+
+// uploadViaHelper sube al almacén con un auxiliar y copia el mensaje al
+// usuario. copyMessage solo devuelve el ID de la copia y el file_id del
+// auxiliar no le sirve al bot principal, así que este reenvía el original
+// dentro del almacén para quedarse con el archivo (caché, archivo, inline).
+func (b *DownloadBot) uploadViaHelper(u *uploaderBot, target uploadTarget, build func(chatID int64, replyTo int) (tgbotapi.Chattable, func())) (tgbotapi.Message, error) {
+	msg, done := build(b.uploaders.storage, 0)
+	defer done()
+	stored, err := u.api.Send(msg)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	// El mensaje del almacén se borra tras copiarlo: la copia conserva el archivo
+	defer u.api.Send(tgbotapi.NewDeleteMessage(b.uploaders.storage, stored.MessageID))
+
+	copyMsg := tgbotapi.NewCopyMessage(target.ChatID, b.uploaders.storage, stored.MessageID)
+	copyMsg.ReplyToMessageID = target.ReplyTo
+	copied, err := b.bot.CopyMessage(copyMsg)
+	if err != nil {
+		return tgbotapi.Message{}, fmt.Errorf("copiando desde el almacén: %w", err)
+	}
+
+	sent := tgbotapi.Message{MessageID: copied.MessageID, Chat: &tgbotapi.Chat{ID: target.ChatID}}
+	forwarded, err := b.bot.Send(tgbotapi.NewForward(b.uploaders.storage, b.uploaders.storage, stored.MessageID))
+	if err != nil {
+		log.Printf("⚠️ No se pudo leer el archivo subido por @%s: %v", u.api.Self.UserName, err)
+		return sent, nil
+	}
+	b.bot.Request(tgbotapi.NewDeleteMessage(b.uploaders.storage, forwarded.MessageID))
+	sent.Video, sent.Audio, sent.Voice, sent.VideoNote = forwarded.Video, forwarded.Audio, forwarded.Voice, forwarded.VideoNote
+	sent.Document, sent.Sticker, sent.Animation = forwarded.Document, forwarded.Sticker, forwarded.Animation
+	return sent, nil
+}
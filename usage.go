@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Formato de las claves de mes en la tabla de uso
+const usageMonthLayout = "2006-01"
+
+// UsageStats acumula el uso de un usuario durante un mes, para facturar o
+// limitar el consumo.
+type UsageStats struct {
+	Jobs           int     `json:"jobs"`
+	Failed         int     `json:"failed"`
+	Bytes          int64   `json:"bytes"`
+	ComputeSeconds float64 `json:"compute_seconds"`
+}
+
+func (s *Store) recordUsage(userID int64, at time.Time, bytes int64, compute time.Duration, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	month := at.Format(usageMonthLayout)
+	users, found := s.data.Usage[month]
+	if !found {
+		users = make(map[int64]*UsageStats)
+		s.data.Usage[month] = users
+	}
+	stats, found := users[userID]
+	if !found {
+		stats = &UsageStats{}
+		users[userID] = stats
+	}
+	stats.Jobs++
+	if !ok {
+		stats.Failed++
+	}
+	stats.Bytes += bytes
+	stats.ComputeSeconds += compute.Seconds()
+	if err := s.save(); err != nil {
+		log.Printf("⚠️ Error guardando uso: %v", err)
+	}
+}
+
+func (s *Store) usageForMonth(month string) map[int64]UsageStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := make(map[int64]UsageStats)
+	for userID, stats := range s.data.Usage[month] {
+		report[userID] = *stats
+	}
+	return report
+}
+
+// usageJob mide una tarea (descarga, grabación, publicación) de principio a fin.
+type usageJob struct {
+	userID     int64
+	started    time.Time
+	bytes      int64 // Enviado al usuario
+	downloaded int64 // Descargado de la plataforma (0 = lo mismo que bytes)
+	ok         bool
+	preview    bool // Vista previa: solo cuenta el tráfico, no como descarga
+}
+
+// Tareas en curso, para /readyz
+var activeJobs atomic.Int64
+
+func startUsageJob(userID int64) *usageJob {
+	activeJobs.Add(1)
+	return &usageJob{userID: userID, started: time.Now()}
+}
+
+// delivered marca la tarea como entregada con el tamaño del archivo enviado.
+func (j *usageJob) delivered(path string) {
+	j.ok = true
+	if info, err := os.Stat(path); err == nil {
+		j.bytes = info.Size()
+	}
+}
+
+func (b *DownloadBot) finishUsageJob(j *usageJob) {
+	activeJobs.Add(-1)
+	b.store.recordBandwidth(j.userID, j.started, max(j.downloaded, j.bytes), j.bytes)
+	if j.preview {
+		return
+	}
+	b.store.recordUsage(j.userID, j.started, j.bytes, time.Since(j.started), j.ok)
+	if j.ok {
+		b.rewardReferral(j.userID)
+	}
+}
+
+// handleAdminReport envía el uso por usuario de un mes en CSV: /admin report [AAAA-MM]
+func (b *DownloadBot) handleAdminReport(message *tgbotapi.Message, args []string) {
+	chatID := message.Chat.ID
+	month := time.Now().Format(usageMonthLayout)
+	if len(args) > 0 {
+		if _, err := time.Parse(usageMonthLayout, args[0]); err != nil {
+			b.sendReply(chatID, message.MessageID, "📊 Uso: /admin report <AAAA-MM>")
+			return
+		}
+		month = args[0]
+	}
+
+	report := b.store.usageForMonth(month)
+	if len(report) == 0 {
+		b.sendReply(chatID, message.MessageID, fmt.Sprintf("📊 No hay uso registrado en %s.", month))
+		return
+	}
+
+	users := make([]int64, 0, len(report))
+	for userID := range report {
+		users = append(users, userID)
+	}
+	// Los que más consumen primero
+	sort.Slice(users, func(i, j int) bool { return report[users[i]].Bytes > report[users[j]].Bytes })
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"user_id", "jobs", "failed", "bytes", "megabytes", "compute_minutes"})
+	var total UsageStats
+	for _, userID := range users {
+		stats := report[userID]
+		w.Write([]string{
+			strconv.FormatInt(userID, 10),
+			strconv.Itoa(stats.Jobs),
+			strconv.Itoa(stats.Failed),
+			strconv.FormatInt(stats.Bytes, 10),
+			fmt.Sprintf("%.1f", float64(stats.Bytes)/(1024*1024)),
+			fmt.Sprintf("%.1f", stats.ComputeSeconds/60),
+		})
+		total.Jobs += stats.Jobs
+		total.Failed += stats.Failed
+		total.Bytes += stats.Bytes
+		total.ComputeSeconds += stats.ComputeSeconds
+	}
+	w.Flush()
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: "uso_" + month + ".csv", Bytes: buf.Bytes()})
+	doc.Caption = fmt.Sprintf("📊 Uso de %s\n👥 %d usuarios · %d tareas (%d fallidas)\n💾 %.1f MB · ⏱ %.0f min de cómputo",
+		month, len(users), total.Jobs, total.Failed, float64(total.Bytes)/(1024*1024), total.ComputeSeconds/60)
+	doc.ReplyToMessageID = message.MessageID
+	if _, err := b.bot.Send(doc); err != nil {
+		log.Printf("Error enviando informe de uso: %v", err)
+		b.sendReply(chatID, message.MessageID, "❌ No se pudo enviar el informe.")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Límites de las notas de video de Telegram: cuadradas, hasta 640px y 60 segundos
+const (
+	videoNoteSize        = 640
+	videoNoteMaxDuration = 60
+)
+
+// convertVideoNote recorta el centro del video a un cuadrado de 640px y lo
+// corta a 60 segundos, reemplazando el archivo.
+func convertVideoNote(path string) error {
+	converted := path + ".note.mp4"
+	filter := fmt.Sprintf("crop='min(iw,ih)':'min(iw,ih)',scale=%d:%d", videoNoteSize, videoNoteSize)
+	cmd := exec.Command(ffmpegBin, "-y", "-i", path,
+		"-t", fmt.Sprint(videoNoteMaxDuration),
+		"-vf", filter,
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "26",
+		"-c:a", "aac", "-b:a", "96k",
+		"-movflags", "+faststart",
+		converted)
+	if err := cmd.Run(); err != nil {
+		os.Remove(converted)
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return os.Rename(converted, path)
+}
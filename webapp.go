@@ -0,0 +1,283 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+//go:embed webapp/index.html webapp/admin.html
+var webAppFiles embed.FS
+
+// Antigüedad máxima aceptada para el initData de la Web App
+const webAppInitDataTTL = 24 * time.Hour
+
+// Botón de Web App; la versión de tgbotapi que usamos aún no lo incluye.
+type webAppButton struct {
+	Text   string `json:"text"`
+	WebApp struct {
+		URL string `json:"url"`
+	} `json:"web_app"`
+}
+
+type webAppMarkup struct {
+	InlineKeyboard [][]webAppButton `json:"inline_keyboard"`
+}
+
+// historyItem es una entrada del historial tal como la ve la Web App.
+type historyItem struct {
+	Key string `json:"key"`
+	ArchiveEntry
+}
+
+func (s *Store) archiveForChat(chatID int64) []historyItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := strconv.FormatInt(chatID, 10) + ":"
+	var items []historyItem
+	for key, entry := range s.data.Archive {
+		if strings.HasPrefix(key, prefix) {
+			items = append(items, historyItem{Key: key, ArchiveEntry: entry})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].SentAt.After(items[j].SentAt) })
+	return items
+}
+
+func (s *Store) archiveByKey(key string) (ArchiveEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.data.Archive[key]
+	return entry, ok
+}
+
+func webAppURL() string {
+	return strings.TrimSuffix(WebhookURL, "/webhook") + "/app"
+}
+
+// validateInitData verifica la firma del initData de Telegram y devuelve el
+// ID del usuario. https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func validateInitData(initData, botToken string) (int64, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return 0, err
+	}
+	hash := values.Get("hash")
+	if hash == "" {
+		return 0, errors.New("initData sin hash")
+	}
+
+	var pairs []string
+	for key := range values {
+		if key != "hash" {
+			pairs = append(pairs, key+"="+values.Get(key))
+		}
+	}
+	sort.Strings(pairs)
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(hash)) {
+		return 0, errors.New("firma de initData inválida")
+	}
+
+	authDate, _ := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if time.Since(time.Unix(authDate, 0)) > webAppInitDataTTL {
+		return 0, errors.New("initData caducado")
+	}
+
+	var user struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return 0, errors.New("initData sin usuario")
+	}
+	return user.ID, nil
+}
+
+// webAppAuth envuelve un handler de la API exigiendo un initData válido.
+func (b *DownloadBot) webAppAuth(next func(w http.ResponseWriter, r *http.Request, userID int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := validateInitData(r.Header.Get("X-Telegram-Init-Data"), b.bot.Token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r, userID)
+	}
+}
+
+func (b *DownloadBot) registerWebApp() {
+	http.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		page, _ := webAppFiles.ReadFile("webapp/index.html")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+	http.HandleFunc("/app/api/history", b.webAppAuth(b.webAppHistory))
+	http.HandleFunc("/app/api/settings", b.webAppAuth(b.webAppSettings))
+	http.HandleFunc("/app/api/resend", b.webAppAuth(b.webAppResend))
+	http.HandleFunc("/app/api/queue", b.webAppAuth(b.webAppQueue))
+	http.HandleFunc("/app/api/subscriptions", b.webAppAuth(b.webAppSubscriptions))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (b *DownloadBot) webAppHistory(w http.ResponseWriter, r *http.Request, userID int64) {
+	items := b.store.archiveForChat(userID)
+	if items == nil {
+		items = []historyItem{}
+	}
+	writeJSON(w, items)
+}
+
+func (b *DownloadBot) webAppSettings(w http.ResponseWriter, r *http.Request, userID int64) {
+	if r.Method == http.MethodPost {
+		var req UserSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "JSON inválido", http.StatusBadRequest)
+			return
+		}
+		switch req.DefaultMode {
+		case "", "audio", "video":
+		default:
+			http.Error(w, "modo inválido", http.StatusBadRequest)
+			return
+		}
+		if req.DefaultMode == "video" && req.DefaultQuality != "fit" {
+			if _, err := strconv.Atoi(req.DefaultQuality); err != nil {
+				http.Error(w, "calidad inválida", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.DefaultMode == "audio" {
+			req.DefaultQuality = "best"
+		}
+		writeJSON(w, b.store.updateUserSettings(userID, func(s *UserSettings) {
+			s.DefaultMode, s.DefaultQuality = req.DefaultMode, req.DefaultQuality
+		}))
+		return
+	}
+	writeJSON(w, b.store.userSettings(userID))
+}
+
+// webAppResend vuelve a enviar al chat privado del usuario un archivo de su historial.
+func (b *DownloadBot) webAppResend(w http.ResponseWriter, r *http.Request, userID int64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	// Solo se pueden reenviar entradas del chat privado del propio usuario
+	if !strings.HasPrefix(req.Key, strconv.FormatInt(userID, 10)+":") {
+		http.Error(w, "entrada no encontrada", http.StatusNotFound)
+		return
+	}
+	entry, ok := b.store.archiveByKey(req.Key)
+	if !ok {
+		http.Error(w, "entrada no encontrada", http.StatusNotFound)
+		return
+	}
+	if err := b.sendArchived(userID, 0, &VideoMetaData{Title: entry.Title}, entry, ""); err != nil {
+		http.Error(w, "no se pudo reenviar", http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+// webAppQueue lista las descargas que esperan en el chat privado del usuario
+// y, con POST, mueve una a otra posición de la cola.
+func (b *DownloadBot) webAppQueue(w http.ResponseWriter, r *http.Request, userID int64) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			ID       uint64 `json:"id"`
+			Position int    `json:"position"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "JSON inválido", http.StatusBadRequest)
+			return
+		}
+		// Solo la cola del chat privado: en los grupos es de todos sus miembros
+		if !b.scheduler.move(userID, req.ID, req.Position) {
+			http.Error(w, "la descarga ya no está en cola", http.StatusNotFound)
+			return
+		}
+	}
+	writeJSON(w, b.scheduler.pending(userID))
+}
+
+// subscriptionsView son las suscripciones del usuario: anuncios, premium y
+// el canal obligatorio.
+type subscriptionsView struct {
+	Announcements bool       `json:"announcements"`
+	PremiumUntil  *time.Time `json:"premium_until,omitempty"`
+	CanBuyPremium bool       `json:"can_buy_premium"`
+	Channel       string     `json:"channel,omitempty"`
+	Subscribed    bool       `json:"subscribed"`
+}
+
+// webAppSubscriptions muestra las suscripciones del usuario. Con POST activa
+// o desactiva los anuncios ({"announcements": bool}) o envía al chat la
+// factura para comprar o renovar premium ({"buy_premium": true}).
+func (b *DownloadBot) webAppSubscriptions(w http.ResponseWriter, r *http.Request, userID int64) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Announcements *bool `json:"announcements"`
+			BuyPremium    bool  `json:"buy_premium"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "JSON inválido", http.StatusBadRequest)
+			return
+		}
+		if req.Announcements != nil {
+			b.store.updateUserSettings(userID, func(s *UserSettings) { s.MuteAnnouncements = !*req.Announcements })
+		}
+		if req.BuyPremium && (b.cfg().PremiumPrice <= 0 || !b.sendPremiumInvoice(userID)) {
+			http.Error(w, "pagos no disponibles", http.StatusBadGateway)
+			return
+		}
+	}
+	view := subscriptionsView{
+		Announcements: !b.store.userSettings(userID).MuteAnnouncements,
+		CanBuyPremium: b.cfg().PremiumPrice > 0,
+		Channel:       b.cfg().ForceSubChannel,
+		Subscribed:    b.isSubscribed(userID),
+	}
+	if entitlement, ok := b.store.premium(userID); ok && time.Now().Before(entitlement.Until) {
+		view.PremiumUntil = &entitlement.Until
+	}
+	writeJSON(w, view)
+}
+
+func (b *DownloadBot) sendWebAppButton(chatID int64) {
+	button := webAppButton{Text: "📱 Abrir panel"}
+	button.WebApp.URL = webAppURL()
+
+	msg := tgbotapi.NewMessage(chatID, "📱 *Panel del bot*\n\nConsulta tu historial y tu cola, gestiona tus suscripciones y ajusta tus preferencias desde la mini-app.")
+	msg.ParseMode = "Markdown"
+	msg.ReplyMarkup = webAppMarkup{InlineKeyboard: [][]webAppButton{{button}}}
+	b.bot.Send(msg)
+}
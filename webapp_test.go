@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw"
+
+// signInitData firma los campos como lo hace Telegram con el token del bot.
+func signInitData(fields map[string]string, botToken string) string {
+	values := url.Values{}
+	var pairs []string
+	for key, value := range fields {
+		values.Set(key, value)
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return values.Encode()
+}
+
+func TestValidateInitData(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-2*webAppInitDataTTL).Unix(), 10)
+	valid := signInitData(map[string]string{"auth_date": now, "user": `{"id":42,"first_name":"Ana"}`, "query_id": "AAE"}, testBotToken)
+
+	tests := []struct {
+		name     string
+		initData string
+		wantID   int64
+		wantErr  bool
+	}{
+		{"válido", valid, 42, false},
+		{"sin hash", "auth_date=" + now + "&user=%7B%22id%22%3A42%7D", 0, true},
+		{"firmado con otro token", signInitData(map[string]string{"auth_date": now, "user": `{"id":42}`}, "999:otro"), 0, true},
+		{"campo alterado", strings.Replace(valid, "query_id=AAE", "query_id=AAF", 1), 0, true},
+		{"caducado", signInitData(map[string]string{"auth_date": old, "user": `{"id":42}`}, testBotToken), 0, true},
+		{"sin usuario", signInitData(map[string]string{"auth_date": now}, testBotToken), 0, true},
+		{"usuario sin id", signInitData(map[string]string{"auth_date": now, "user": `{"first_name":"Ana"}`}, testBotToken), 0, true},
+		{"query inválida", "%zz", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := validateInitData(tt.initData, testBotToken)
+			if (err != nil) != tt.wantErr || id != tt.wantID {
+				t.Errorf("validateInitData() = %d, %v; quiero %d, error %v", id, err, tt.wantID, tt.wantErr)
+			}
+		})
+	}
+}
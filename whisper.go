@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Variantes de whisper soportadas (WHISPER_KIND)
+const (
+	whisperCpp    = "cpp"    // whisper.cpp: whisper-cli -m modelo.bin
+	whisperOpenAI = "openai" // openai-whisper: whisper --model base
+)
+
+// defaultWhisperModel es el modelo por defecto de cada variante: whisper.cpp
+// necesita la ruta al .bin y openai-whisper el nombre del modelo.
+func defaultWhisperModel(kind string) string {
+	if kind == whisperOpenAI {
+		return "base"
+	}
+	return "./models/ggml-base.bin"
+}
+
+var (
+	// whisper.cpp con -pp: "whisper_print_progress_callback: progress =  25%"
+	whisperPercentPattern = regexp.MustCompile(`progress\s*=\s*(\d+)%`)
+	// openai-whisper con --verbose: "[01:02.000 --> 01:05.500] texto"
+	whisperSegmentPattern = regexp.MustCompile(`-->\s*(?:(\d+):)?(\d+):(\d+(?:\.\d+)?)\]`)
+)
+
+// whisperEnabled indica si el operador configuró un binario de whisper.
+func (b *DownloadBot) whisperEnabled() bool {
+	return b.cfg().WhisperBin != ""
+}
+
+// whisperTranscript transcribe el audio de un video sin subtítulos: baja el
+// audio, lo pasa a WAV de 16kHz (lo que espera whisper) y envía el resultado
+// en texto o SRT. Se ejecuta como una descarga más, en la cola del chat.
+func (b *DownloadBot) whisperTranscript(key sessionKey, sess *UserSession, format string) {
+	chatID, msgID, meta := key.ChatID, sess.MsgID, sess.Meta
+	job := b.beginDownload(key, sess, 0)
+	if job == nil {
+		return
+	}
+	defer b.finishUsageJob(job)
+	defer b.editMessageMarkup(chatID, msgID, infoCard(meta), b.createQualityKeyboard(key, meta, 0))
+
+	fileName := fmt.Sprintf("whisper_%d_%d_%d", chatID, key.UserID, time.Now().Unix())
+	audioPath, err := b.downloadMedia(chatID, msgID, meta, "audio", "native", downloadOptions{}, fileName)
+	var tooLarge *fileTooLargeError
+	if errors.As(err, &tooLarge) {
+		// Aquí no se envía el audio: el límite de Telegram no importa
+		audioPath, err = tooLarge.Path, nil
+	}
+	if err != nil {
+		b.reportFailure("transcripción", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, err.Error())
+		return
+	}
+	defer os.Remove(audioPath)
+
+	b.editMessage(chatID, msgID, "⚙️ *Preparando audio para transcribir...*")
+	wavPath := filepath.Join(chatDir(chatID), fileName+".wav")
+	defer os.Remove(wavPath)
+	if err := exec.Command(ffmpegBin, "-y", "-i", audioPath, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wavPath).Run(); err != nil {
+		b.reportFailure("transcripción", key, meta.WebpageURL, fmt.Errorf("ffmpeg: %w", err))
+		b.sendReply(chatID, sess.ReplyTo, "❌ No se pudo preparar el audio para transcribir.")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.cfg().DownloadTimeout)
+	defer cancel()
+	srtPath, err := b.runWhisper(ctx, chatID, msgID, wavPath, meta.Duration)
+	if err != nil {
+		b.reportFailure("transcripción", key, meta.WebpageURL, err)
+		msg := "❌ No se pudo transcribir el audio."
+		if timedOut(ctx) {
+			msg = fmt.Sprintf("⏱️ La transcripción superó el tiempo máximo (%s) y se canceló.", formatClock(b.cfg().DownloadTimeout))
+		}
+		b.sendReply(chatID, sess.ReplyTo, msg)
+		return
+	}
+	defer os.Remove(srtPath)
+
+	data, err := os.ReadFile(srtPath)
+	if err != nil {
+		log.Printf("Error leyendo transcripción: %v", err)
+		return
+	}
+	if format == "txt" {
+		data = []byte(srtToText(string(data)))
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: sanitizeFileName(meta.Title) + "." + format, Bytes: data})
+	doc.Caption = "🗣 Transcripción automática: " + meta.Title
+	doc.ReplyToMessageID = sess.ReplyTo
+	if _, err := b.bot.Send(doc); err != nil {
+		b.reportFailure("envío", key, meta.WebpageURL, err)
+		b.sendReply(chatID, sess.ReplyTo, "❌ Ocurrió un error enviando el archivo a Telegram.")
+		return
+	}
+	job.ok, job.bytes = true, int64(len(data))
+}
+
+// runWhisper ejecuta whisper sobre el WAV mostrando el progreso y devuelve la
+// ruta del SRT generado.
+func (b *DownloadBot) runWhisper(ctx context.Context, chatID int64, msgID int, wavPath string, duration float64) (string, error) {
+	base := wavPath[:len(wavPath)-len(filepath.Ext(wavPath))]
+	var cmd *exec.Cmd
+	var srtPath string
+	switch b.cfg().WhisperKind {
+	case whisperOpenAI:
+		// Escribe <nombre del wav>.srt en el directorio de salida
+		args := []string{wavPath,
+			"--model", b.cfg().WhisperModel,
+			"--output_format", "srt",
+			"--output_dir", filepath.Dir(wavPath),
+			"--verbose", "True"}
+		// Sin --language detecta el idioma él mismo
+		if b.cfg().WhisperLanguage != "auto" {
+			args = append(args, "--language", b.cfg().WhisperLanguage)
+		}
+		cmd = exec.CommandContext(ctx, b.cfg().WhisperBin, args...)
+		srtPath = base + ".srt"
+	default:
+		cmd = exec.CommandContext(ctx, b.cfg().WhisperBin,
+			"-m", b.cfg().WhisperModel,
+			"-l", b.cfg().WhisperLanguage,
+			"-f", wavPath,
+			"-osrt", "-of", base,
+			"-pp")
+		srtPath = base + ".srt"
+	}
+	killGroupOnCancel(cmd)
+
+	// Las dos variantes informan del progreso por distinta salida: se leen juntas
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	output := &tailWriter{}
+	go b.monitorWhisper(io.TeeReader(pr, output), chatID, msgID, duration)
+
+	b.editMessage(chatID, msgID, "🗣 *Transcribiendo...*")
+	err := cmd.Run()
+	pw.Close()
+	if err != nil {
+		os.Remove(srtPath)
+		return "", fmt.Errorf("whisper: %w: %s", err, lastLines(output.String(), 5))
+	}
+	if _, err := os.Stat(srtPath); err != nil {
+		return "", errors.New("whisper no escribió el SRT")
+	}
+	return srtPath, nil
+}
+
+// monitorWhisper lee la salida de whisper y actualiza el mensaje de estado con
+// el porcentaje (whisper.cpp) o con el tiempo transcrito sobre la duración
+// (openai-whisper).
+func (b *DownloadBot) monitorWhisper(r io.Reader, chatID int64, msgID int, duration float64) {
+	scanner := bufio.NewScanner(r)
+	var lastEdit time.Time
+	for scanner.Scan() {
+		line := scanner.Text()
+		percent := -1.0
+		if m := whisperPercentPattern.FindStringSubmatch(line); m != nil {
+			percent, _ = strconv.ParseFloat(m[1], 64)
+		} else if m := whisperSegmentPattern.FindStringSubmatch(line); m != nil && duration > 0 {
+			h, _ := strconv.ParseFloat(m[1], 64)
+			mins, _ := strconv.ParseFloat(m[2], 64)
+			secs, _ := strconv.ParseFloat(m[3], 64)
+			percent = min((h*3600+mins*60+secs)/duration*100, 100)
+		}
+		if percent < 0 || time.Since(lastEdit) < UpdateInterval {
+			continue
+		}
+		lastEdit = time.Now()
+		value := fmt.Sprintf("%.1f", percent)
+		b.editMessage(chatID, msgID, fmt.Sprintf("🗣 *Transcribiendo: %s%%*\n%s", value, generateProgressBar(value)))
+	}
+	// Si el escáner se detiene (línea demasiado larga) hay que seguir vaciando la tubería
+	io.Copy(io.Discard, r)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cada proceso worker mantiene viva la clave worker:<host>-<pid> renovándola
+// cada workerAliveInterval; si deja de hacerlo durante workerAliveTTL el
+// coordinador lo da por caído, devuelve sus descargas a la cola y avisa.
+const (
+	workerAlivePrefix   = redisKeyPrefix + "worker:"
+	workerAliveInterval = 15 * time.Second
+	workerAliveTTL      = time.Minute
+	workerWatchInterval = 30 * time.Second
+)
+
+// workerProcess es el nombre del proceso de un consumidor <host>-<pid>-<n>.
+func workerProcess(consumer string) string {
+	if i := strings.LastIndex(consumer, "-"); i > 0 {
+		return consumer[:i]
+	}
+	return consumer
+}
+
+// workerAlive dice si el proceso del consumidor sigue renovando su latido.
+func (q *jobQueue) workerAlive(ctx context.Context, consumer string) (bool, error) {
+	n, err := q.client.Exists(ctx, workerAlivePrefix+workerProcess(consumer)).Result()
+	return n > 0, err
+}
+
+// beat renueva el latido de este worker.
+func (q *jobQueue) beat(process string) {
+	err := q.client.Set(context.Background(), workerAlivePrefix+process, time.Now().Unix(), workerAliveTTL).Err()
+	if err != nil {
+		log.Printf("⚠️ No se pudo renovar el latido del worker: %v", err)
+	}
+}
+
+// sendHeartbeats renueva el latido cada workerAliveInterval. No vuelve.
+func (q *jobQueue) sendHeartbeats(process string) {
+	for range time.Tick(workerAliveInterval) {
+		q.beat(process)
+	}
+}
+
+// retire se despide al apagar el worker: borra su latido y los consumidores
+// sin trabajos. Los que quedan a medias los devuelve a la cola el coordinador.
+func (q *jobQueue) retire(process string) {
+	ctx := context.Background()
+	q.client.Del(ctx, workerAlivePrefix+process)
+	consumers, err := q.client.XInfoConsumers(ctx, jobStream, jobGroup).Result()
+	if err != nil {
+		return
+	}
+	for _, consumer := range consumers {
+		if workerProcess(consumer.Name) == process && consumer.Pending == 0 {
+			q.client.XGroupDelConsumer(ctx, jobStream, jobGroup, consumer.Name)
+		}
+	}
+}
+
+// watchWorkers vigila desde el proceso principal los workers de la cola. No vuelve.
+func (b *DownloadBot) watchWorkers() {
+	ticker := time.NewTicker(workerWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		b.reapDeadWorkers()
+	}
+}
+
+// reapDeadWorkers devuelve a la cola las descargas de los workers sin latido
+// y avisa al operador de cada proceso caído.
+func (b *DownloadBot) reapDeadWorkers() {
+	ctx := context.Background()
+	consumers, err := b.queue.client.XInfoConsumers(ctx, jobStream, jobGroup).Result()
+	if err != nil {
+		log.Printf("⚠️ No se pudieron consultar los workers: %v", err)
+		return
+	}
+	// Descargas devueltas a la cola por proceso caído en esta vuelta
+	dead := make(map[string]int)
+	for _, consumer := range consumers {
+		alive, err := b.queue.workerAlive(ctx, consumer.Name)
+		if err != nil || alive {
+			continue
+		}
+		process := workerProcess(consumer.Name)
+		n, err := b.queue.requeue(ctx, consumer.Name, consumer.Pending)
+		if err != nil {
+			log.Printf("⚠️ No se pudieron devolver a la cola los trabajos de %s: %v", consumer.Name, err)
+		}
+		// Sin trabajos pendientes ya no hace falta: los que aún no llevan
+		// jobReclaimAfter sin renovarse se recogen en la siguiente vuelta
+		removed := false
+		if pending, err := b.queue.pendingOf(ctx, consumer.Name); err == nil && pending == 0 {
+			removed = b.queue.client.XGroupDelConsumer(ctx, jobStream, jobGroup, consumer.Name).Err() == nil
+		}
+		if n > 0 || removed {
+			dead[process] += n
+		}
+	}
+	for process, n := range dead {
+		log.Printf("💀 Worker %s caído: %d descargas devueltas a la cola", process, n)
+		text := fmt.Sprintf("💀 *Worker caído:* `%s`\n\nNo renueva su latido desde hace más de %s.", process, workerAliveTTL)
+		if n > 0 {
+			text += fmt.Sprintf(" %d descargas en curso han vuelto a la cola para otro worker.", n)
+		}
+		b.notifyAdmin(text)
+	}
+}
+
+// requeue vuelve a encolar los trabajos del consumidor que llevan
+// jobReclaimAfter sin renovarse y confirma los originales. Devuelve cuántos.
+func (q *jobQueue) requeue(ctx context.Context, consumer string, count int64) (int, error) {
+	if count == 0 {
+		return 0, nil
+	}
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   jobStream,
+		Group:    jobGroup,
+		Idle:     jobReclaimAfter,
+		Start:    "-",
+		End:      "+",
+		Count:    count,
+		Consumer: consumer,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	ids := make([]string, 0, len(pending))
+	for _, p := range pending {
+		ids = append(ids, p.ID)
+	}
+	// El MinIdle evita quitárselo a un worker que lo haya retomado entretanto
+	claimed, err := q.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   jobStream,
+		Group:    jobGroup,
+		Consumer: consumer,
+		MinIdle:  jobReclaimAfter,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, msg := range claimed {
+		err := q.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: jobStream,
+			MaxLen: jobStreamMaxLen,
+			Approx: true,
+			Values: msg.Values,
+		}).Err()
+		if err != nil {
+			return n, err
+		}
+		q.client.XAck(ctx, jobStream, jobGroup, msg.ID)
+		n++
+	}
+	return n, nil
+}
+
+// pendingOf cuenta los trabajos sin confirmar del consumidor.
+func (q *jobQueue) pendingOf(ctx context.Context, consumer string) (int64, error) {
+	pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   jobStream,
+		Group:    jobGroup,
+		Start:    "-",
+		End:      "+",
+		Count:    1,
+		Consumer: consumer,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return int64(len(pending)), err
+}
+
+// workerProcessName es el nombre de este proceso worker, prefijo de sus consumidores.
+func workerProcessName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
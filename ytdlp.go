@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Opciones de yt-dlp que gestiona el propio bot: permitirlas en el archivo del
+// operador rompería la salida, el progreso o el JSON de metadatos que leemos.
+var managedYtdlpOptions = map[string]bool{
+	"-o": true, "--output": true, "-P": true, "--paths": true,
+	"-f": true, "--format": true, "-x": true, "--extract-audio": true,
+	"--audio-format": true, "--merge-output-format": true, "--remux-video": true,
+	"-j": true, "--dump-json": true, "-J": true, "--dump-single-json": true,
+	"--print": true, "-O": true, "--print-to-file": true,
+	"-s": true, "--simulate": true, "--skip-download": true, "--no-download": true,
+	"-q": true, "--quiet": true, "--progress-template": true, "--no-progress": true,
+	"--newline": true, "--exec": true, "--exec-before-download": true,
+	"-a": true, "--batch-file": true, "--load-info-json": true,
+	"--config-location": true, "--config-locations": true, "--ignore-config": true,
+	"--cookies": true, "--yes-playlist": true, "--no-playlist": true,
+	"-U": true, "--update": true, "--update-to": true,
+}
+
+// loadYtdlpOptions lee el archivo de opciones del operador: una opción por
+// línea, con su valor opcional separado por espacio. Las líneas con # se ignoran.
+func loadYtdlpOptions(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var options []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(line, " ")
+		if !strings.HasPrefix(name, "-") {
+			return nil, fmt.Errorf("línea %d: se esperaba una opción que empiece por \"-\"", n)
+		}
+		if managedYtdlpOptions[strings.SplitN(name, "=", 2)[0]] {
+			return nil, fmt.Errorf("línea %d: %s la gestiona el bot y no se puede cambiar", n, name)
+		}
+		options = append(options, name)
+		if hasValue {
+			options = append(options, strings.Trim(strings.TrimSpace(value), `"'`))
+		}
+	}
+	return options, scanner.Err()
+}
+
+// ytdlpCommand prepara una invocación de yt-dlp aislada de la configuración
+// del host: ignora los archivos de configuración globales y del usuario, y
+// solo aplica las opciones del operador, las cookies y los argumentos dados.
+func (b *DownloadBot) ytdlpCommand(ctx context.Context, url string, args ...string) *exec.Cmd {
+	full := []string{"--ignore-config"}
+	full = append(full, b.ytdlpOptions...)
+	// Con scheduler, el límite de cada hueco; sin él (-cli) hay una sola descarga
+	rate := downloadRate(1, b.cfg().DownloadRateLimit, b.cfg().TotalRateLimit)
+	if b.scheduler != nil {
+		rate = b.scheduler.rate
+	}
+	if rate > 0 {
+		full = append(full, "--limit-rate", strconv.FormatInt(rate, 10))
+	}
+	full = append(full, b.cookieArgs(url)...)
+	full = append(full, siteArgs(url)...)
+	if debugMode.Load() {
+		full = append(full, "--verbose")
+	}
+	full = append(full, args...)
+	if debugMode.Load() {
+		log.Printf("🐞 yt-dlp %s", strings.Join(redactArgs(full), " "))
+	}
+	cmd := exec.CommandContext(ctx, ytdlpBin, full...)
+	killGroupOnCancel(cmd)
+	return cmd
+}
+
+// timedOut indica si el comando falló porque venció su contexto.
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}